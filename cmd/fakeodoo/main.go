@@ -0,0 +1,34 @@
+// Command fakeodoo serves an in-memory Odoo for local development, so that
+// waOdoo can run without a real Odoo:
+//
+//	go run ./cmd/fakeodoo -fixtures fixtures.json
+//	ODOO_URL=http://localhost:8069 ODOO_DB=test ODOO_USERNAME=admin ODOO_API_KEY=admin go run .
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8069", "address to listen on")
+	fixtures := flag.String("fixtures", "", "JSON file of records to load")
+	database := flag.String("db", "test", "database name")
+	version := flag.String("version", "17.0", "Odoo version to report")
+	flag.Parse()
+
+	server := odootest.New()
+	server.Database = *database
+	server.Version = *version
+	if *fixtures != "" {
+		if err := server.LoadFile(*fixtures); err != nil {
+			log.Fatalf("Failed to load fixtures: %v", err)
+		}
+	}
+
+	log.Printf("Fake Odoo %s serving database %q on %s (login %s, API key %s)", *version, *database, *addr, odootest.AdminLogin, odootest.AdminKey)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
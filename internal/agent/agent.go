@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/failure"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Sender delivers replies to WhatsApp users. It is implemented by
+// *whatsapp.Service and faked in tests.
+type Sender interface {
+	SendMessage(ctx context.Context, msg whatsapp.OutgoingMessage) (*whatsapp.MessageResponse, error)
+	SendList(ctx context.Context, msg whatsapp.ListMessage) (*whatsapp.MessageResponse, error)
+	SendButtons(ctx context.Context, msg whatsapp.ButtonMessage) (*whatsapp.MessageResponse, error)
+	SendTemplate(ctx context.Context, msg whatsapp.TemplateMessage) (*whatsapp.MessageResponse, error)
+}
+
+// MediaDownloader fetches media that users send. It is implemented by
+// *whatsapp.Service and faked in tests.
+type MediaDownloader interface {
+	DownloadMedia(ctx context.Context, mediaID string) (*whatsapp.Media, error)
+}
+
+// ImageSender sends generated images, such as charts. It is implemented by
+// *whatsapp.Service and faked in tests.
+type ImageSender interface {
+	UploadMedia(ctx context.Context, data []byte, mimeType, filename string) (string, error)
+	SendImage(ctx context.Context, msg whatsapp.ImageMessage) (*whatsapp.MessageResponse, error)
+}
+
+// UserResolver finds the Odoo user a WhatsApp number is bound to, or nil
+// for numbers that aren't bound. It is implemented by *binding.Registry.
+type UserResolver interface {
+	Resolve(ctx context.Context, waID string) (*odoo.User, error)
+}
+
+// sessionTTL is how long a multi-step conversation waits for the user
+const sessionTTL = 30 * time.Minute
+
+// Capability is a chat feature the agent routes messages to
+type Capability interface {
+	// Name identifies the capability and prefixes the IDs of the interactive
+	// options it sends, e.g. "inventory:product:42"
+	Name() string
+	// Help is a one-line usage example shown when no capability matches
+	Help() string
+	// Match reports whether a free-text message is meant for this capability
+	Match(msg whatsapp.WebhookMessage) bool
+	// Handle processes the message and replies to the sender
+	Handle(ctx context.Context, msg whatsapp.WebhookMessage) error
+}
+
+// Agent routes incoming WhatsApp messages to the registered capabilities
+type Agent struct {
+	// Sessions is shared with capabilities that hold multi-step conversations
+	Sessions *Sessions
+	// Users, when set, makes capabilities act as the sender's Odoo user
+	Users UserResolver
+
+	sender       Sender
+	capabilities []Capability
+}
+
+// New creates an agent that replies through sender
+func New(sender Sender) *Agent {
+	return &Agent{
+		Sessions: NewSessions(sessionTTL),
+		sender:   sender,
+	}
+}
+
+// Register adds a capability. Capabilities are matched in registration order.
+func (a *Agent) Register(c Capability) {
+	a.capabilities = append(a.capabilities, c)
+}
+
+// HandleMessage routes a message to the capability that owns it. It has the
+// signature of whatsapp.MessageHandler.
+func (a *Agent) HandleMessage(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	if a.Users != nil {
+		// Fail closed rather than fall back to the service account's rights
+		user, err := a.Users.Resolve(ctx, msg.SenderID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve user of %s: %w", msg.SenderID, err)
+		}
+		if user != nil {
+			ctx = odoo.WithUser(ctx, user)
+		}
+	}
+
+	if c := a.route(msg); c != nil {
+		log.Printf("Routing message %s to %s", msg.MessageID, c.Name())
+		if err := c.Handle(ctx, msg); err != nil {
+			// Tell the user what went wrong, without Odoo's internals
+			explanation := failure.Report(err, c.Name())
+			if _, sendErr := a.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: msg.SenderID, Message: explanation.Text()}); sendErr != nil {
+				log.Printf("Failed to explain failure %s to %s: %v", explanation.Ref, msg.SenderID, sendErr)
+			}
+			return fmt.Errorf("%s failed (reference %s): %w", c.Name(), explanation.Ref, err)
+		}
+		return nil
+	}
+
+	if msg.Type != "text" && msg.Type != "interactive" {
+		return nil
+	}
+	return a.sendHelp(ctx, msg.SenderID)
+}
+
+func (a *Agent) route(msg whatsapp.WebhookMessage) Capability {
+	// Answers to interactive messages go back to the capability that sent them
+	if msg.ReplyID != "" {
+		name, _, _ := strings.Cut(msg.ReplyID, ":")
+		return a.capability(name)
+	}
+
+	// A capability in the middle of a conversation gets every message
+	if session := a.Sessions.Get(msg.SenderID); session != nil && session.Capture {
+		if c := a.capability(session.Capability); c != nil {
+			return c
+		}
+	}
+
+	for _, c := range a.capabilities {
+		if c.Match(msg) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Agent) capability(name string) Capability {
+	for _, c := range a.capabilities {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Agent) sendHelp(ctx context.Context, to string) error {
+	var b strings.Builder
+	b.WriteString("Sorry, I didn't understand that. You can ask me things like:")
+	for _, c := range a.capabilities {
+		b.WriteString("\n• ")
+		b.WriteString(c.Help())
+	}
+
+	_, err := a.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: b.String()})
+	return err
+}
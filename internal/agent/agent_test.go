@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCapability struct {
+	name    string
+	prefix  string
+	handled []whatsapp.WebhookMessage
+	users   []*odoo.User
+	// err fails every message
+	err error
+}
+
+func (f *fakeCapability) Name() string { return f.name }
+func (f *fakeCapability) Help() string { return f.prefix + " <something>" }
+func (f *fakeCapability) Match(msg whatsapp.WebhookMessage) bool {
+	return strings.HasPrefix(msg.Body, f.prefix)
+}
+func (f *fakeCapability) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	f.handled = append(f.handled, msg)
+	f.users = append(f.users, odoo.UserFrom(ctx))
+	return f.err
+}
+
+func TestHandleMessageRouting(t *testing.T) {
+	a := assert.New(t)
+	sender := &agenttest.Sender{}
+	stock := &fakeCapability{name: "inventory", prefix: "stock"}
+	leads := &fakeCapability{name: "crm", prefix: "lead"}
+
+	agent := New(sender)
+	agent.Register(stock)
+	agent.Register(leads)
+	ctx := context.Background()
+
+	a.NoError(agent.HandleMessage(ctx, whatsapp.WebhookMessage{Type: "text", Body: "stock desk"}))
+	a.NoError(agent.HandleMessage(ctx, whatsapp.WebhookMessage{Type: "interactive", Body: "Desk", ReplyID: "crm:lead:3"}))
+
+	a.Len(stock.handled, 1)
+	a.Len(leads.handled, 1)
+	a.Empty(sender.Messages)
+}
+
+func TestHandleMessageHelp(t *testing.T) {
+	a := assert.New(t)
+	sender := &agenttest.Sender{}
+
+	agent := New(sender)
+	agent.Register(&fakeCapability{name: "inventory", prefix: "stock"})
+
+	a.NoError(agent.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "hello"}))
+
+	if a.Len(sender.Messages, 1) {
+		a.Equal("6591234567", sender.Messages[0].To)
+		a.Contains(sender.Messages[0].Message, "stock <something>")
+	}
+}
+
+func TestHandleMessageSession(t *testing.T) {
+	a := assert.New(t)
+	sender := &agenttest.Sender{}
+	stock := &fakeCapability{name: "inventory", prefix: "stock"}
+	tickets := &fakeCapability{name: "helpdesk", prefix: "report"}
+
+	agent := New(sender)
+	agent.Register(stock)
+	agent.Register(tickets)
+	agent.Sessions.Start("6591234567", "helpdesk", nil)
+
+	// Even a message another capability matches belongs to the open session
+	a.NoError(agent.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "stock is wrong"}))
+	a.Len(tickets.handled, 1)
+	a.Empty(stock.handled)
+
+	agent.Sessions.End("6591234567")
+	a.NoError(agent.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "stock desk"}))
+	a.Len(stock.handled, 1)
+}
+
+type fakeUsers map[string]*odoo.User
+
+func (f fakeUsers) Resolve(ctx context.Context, waID string) (*odoo.User, error) {
+	return f[waID], nil
+}
+
+func TestHandleMessageActsAsBoundUser(t *testing.T) {
+	a := assert.New(t)
+	stock := &fakeCapability{name: "inventory", prefix: "stock"}
+	ana := &odoo.User{ID: 9, Login: "ana", APIKey: "key"}
+
+	agent := New(&agenttest.Sender{})
+	agent.Users = fakeUsers{"6591234567": ana}
+	agent.Register(stock)
+	ctx := context.Background()
+
+	a.NoError(agent.HandleMessage(ctx, whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "stock desk"}))
+	a.NoError(agent.HandleMessage(ctx, whatsapp.WebhookMessage{SenderID: "6598765432", Type: "text", Body: "stock desk"}))
+
+	a.Equal([]*odoo.User{ana, nil}, stock.users)
+}
+
+func TestHandleMessageExplainsFailures(t *testing.T) {
+	a := assert.New(t)
+	sender := &agenttest.Sender{}
+	fault := &odoo.Fault{Code: 200, Message: "Odoo Server Error", Data: odoo.FaultData{
+		Name:    "odoo.exceptions.AccessError",
+		Message: "You are not allowed to access 'Sales Order' (sale.order) records.",
+		Debug:   "Traceback (most recent call last):\n  File \"odoo/models.py\"",
+	}}
+	sales := &fakeCapability{name: "sales", prefix: "quote", err: &odoo.CallError{Model: "sale.order", Method: "read", Err: fault}}
+
+	agent := New(sender)
+	agent.Register(sales)
+	err := agent.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "quote S00042"})
+
+	a.ErrorIs(err, fault)
+	text := sender.LastText()
+	a.True(strings.HasPrefix(text, "🚫 You don't have access to sales orders in Odoo."), text)
+	a.NotContains(text, "Traceback")
+	// The reference quoted to the user is the one logged
+	if ref := regexp.MustCompile(`Reference (\w+)`).FindStringSubmatch(text); a.NotNil(ref) {
+		a.Contains(err.Error(), "reference "+ref[1])
+	}
+}
@@ -0,0 +1,99 @@
+// Package agenttest provides test doubles for code built on the agent package
+package agenttest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Sender records every message instead of sending it to WhatsApp
+type Sender struct {
+	mu        sync.Mutex
+	Messages  []whatsapp.OutgoingMessage
+	Lists     []whatsapp.ListMessage
+	Buttons   []whatsapp.ButtonMessage
+	Templates []whatsapp.TemplateMessage
+	Images    []whatsapp.ImageMessage
+
+	// Media is served by DownloadMedia, keyed by media id. UploadMedia adds
+	// to it.
+	Media map[string]*whatsapp.Media
+}
+
+func (s *Sender) SendMessage(ctx context.Context, msg whatsapp.OutgoingMessage) (*whatsapp.MessageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Messages = append(s.Messages, msg)
+	return s.response(), nil
+}
+
+func (s *Sender) SendList(ctx context.Context, msg whatsapp.ListMessage) (*whatsapp.MessageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Lists = append(s.Lists, msg)
+	return s.response(), nil
+}
+
+func (s *Sender) SendButtons(ctx context.Context, msg whatsapp.ButtonMessage) (*whatsapp.MessageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Buttons = append(s.Buttons, msg)
+	return s.response(), nil
+}
+
+func (s *Sender) SendTemplate(ctx context.Context, msg whatsapp.TemplateMessage) (*whatsapp.MessageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Templates = append(s.Templates, msg)
+	return s.response(), nil
+}
+
+func (s *Sender) SendImage(ctx context.Context, msg whatsapp.ImageMessage) (*whatsapp.MessageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Images = append(s.Images, msg)
+	return s.response(), nil
+}
+
+func (s *Sender) UploadMedia(ctx context.Context, data []byte, mimeType, filename string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Media == nil {
+		s.Media = map[string]*whatsapp.Media{}
+	}
+	id := fmt.Sprintf("media.test%d", len(s.Media)+1)
+	s.Media[id] = &whatsapp.Media{ID: id, MimeType: mimeType, Data: data}
+	return id, nil
+}
+
+func (s *Sender) DownloadMedia(ctx context.Context, mediaID string) (*whatsapp.Media, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	media, ok := s.Media[mediaID]
+	if !ok {
+		return nil, fmt.Errorf("media %s not found", mediaID)
+	}
+	return media, nil
+}
+
+// LastText returns the body of the most recent text message, or "" if none
+func (s *Sender) LastText() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.Messages) == 0 {
+		return ""
+	}
+	return s.Messages[len(s.Messages)-1].Message
+}
+
+// response must be called with mu held
+func (s *Sender) response() *whatsapp.MessageResponse {
+	return &whatsapp.MessageResponse{
+		Success: true,
+		Message: "Message sent successfully",
+		ID:      fmt.Sprintf("wamid.test%d", len(s.Messages)+len(s.Lists)+len(s.Buttons)+len(s.Templates)+len(s.Images)),
+	}
+}
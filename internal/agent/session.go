@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// Session is a multi-step conversation a capability is having with a user.
+// The capability keeps its own progress in Data. While a session started
+// with Start is active, every message from that user is routed to the
+// capability; one started with Hold only waits for answers to the
+// capability's interactive messages.
+type Session struct {
+	Capability string
+	Data       interface{}
+	Capture    bool
+
+	expires time.Time
+}
+
+// Sessions tracks the active session of each WhatsApp user. Sessions expire
+// after a period of inactivity so an abandoned flow doesn't capture the
+// user's next question.
+type Sessions struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*Session
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{ttl: ttl, sessions: map[string]*Session{}}
+}
+
+// Start begins a session that captures all of the user's messages,
+// replacing any session the user already had
+func (s *Sessions) Start(waID, capability string, data interface{}) {
+	s.put(waID, capability, data, true)
+}
+
+// Hold keeps data until the user answers an interactive message, replacing
+// any session the user already had. Free text still goes through matching.
+func (s *Sessions) Hold(waID, capability string, data interface{}) {
+	s.put(waID, capability, data, false)
+}
+
+func (s *Sessions) put(waID, capability string, data interface{}, capture bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[waID] = &Session{
+		Capability: capability,
+		Data:       data,
+		Capture:    capture,
+		expires:    time.Now().Add(s.ttl),
+	}
+}
+
+// Get returns the user's active session and extends it, or nil if there is none
+func (s *Sessions) Get(waID string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[waID]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(session.expires) {
+		delete(s.sessions, waID)
+		return nil
+	}
+	session.expires = time.Now().Add(s.ttl)
+	return session
+}
+
+// End finishes the user's session
+func (s *Sessions) End(waID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, waID)
+}
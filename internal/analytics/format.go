@@ -0,0 +1,183 @@
+package analytics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pclk/waOdoo/internal/chart"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+const (
+	// maxRows is how many groups a table lists
+	maxRows = 15
+	// maxLabel is the width of a group label, so that tables fit the width
+	// of a phone
+	maxLabel = 20
+	// chartRows is the number of groups past which a breakdown is drawn
+	// rather than tabled
+	chartRows = 5
+)
+
+// charted tells whether the groups of a question are best sent as a chart
+func charted(q *Question, groups []odoo.Record) bool {
+	// Charts draw a single breakdown
+	if len(q.GroupBy) != 1 || len(groups) == 0 {
+		return false
+	}
+	return q.ChartAsked || len(groups) > chartRows
+}
+
+// Chart draws the groups of a question, as a line for periods and as bars
+// otherwise unless another kind was asked for
+func Chart(q *Question, groups []odoo.Record) *chart.Chart {
+	kind := q.Chart
+	if kind == "" {
+		kind = chart.Bar
+		if q.dated() {
+			kind = chart.Line
+		}
+	}
+	points := make([]chart.Point, len(groups))
+	for i, g := range groups {
+		points[i] = chart.Point{Label: groupLabel(g, q.GroupBy[0]), Value: figure(q.Measure, g)}
+	}
+	return &chart.Chart{
+		Kind:   kind,
+		Title:  q.Title(),
+		Points: points,
+		Format: func(v float64) string { return formatFigure(q.Measure, v) },
+	}
+}
+
+// Caption sums up a chart in the message it is sent with
+func Caption(q *Question, total float64) string {
+	return fmt.Sprintf("📊 *%s*\nTotal: %s", q.Title(), formatFigure(q.Measure, total))
+}
+
+// Format renders the groups of a question as a monospace table with a total
+// row, or its single figure when it isn't broken down
+func Format(q *Question, groups []odoo.Record, total float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 *%s*\n", q.Title())
+	if len(q.GroupBy) == 0 {
+		fmt.Fprintf(&b, "%s: %s", q.Measure.Label, formatFigure(q.Measure, total))
+		return b.String()
+	}
+	if len(groups) == 0 {
+		b.WriteString("Nothing to report.")
+		return b.String()
+	}
+
+	width := maxLabel / len(q.GroupBy)
+	var rows [][]string
+	for i, g := range groups {
+		if i == maxRows {
+			break
+		}
+		var row []string
+		for _, field := range q.GroupBy {
+			row = append(row, truncate(groupLabel(g, field), width))
+		}
+		rows = append(rows, append(row, formatFigure(q.Measure, figure(q.Measure, g))))
+	}
+	footer := make([]string, len(q.GroupBy)+1)
+	footer[0] = "Total"
+	footer[len(footer)-1] = formatFigure(q.Measure, total)
+
+	b.WriteString(table(append(append([]string{}, q.Labels...), q.Measure.Label), rows, footer))
+	if len(groups) > maxRows {
+		fmt.Fprintf(&b, "\n…and %d more", len(groups)-maxRows)
+	}
+	return b.String()
+}
+
+// table lays out rows in aligned columns between ``` so that WhatsApp shows
+// them in a monospace font. The last column holds figures and is aligned
+// right.
+func table(headers []string, rows [][]string, footer []string) string {
+	widths := make([]int, len(headers))
+	for _, row := range append(append([][]string{headers}, rows...), footer) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var b strings.Builder
+	line := func(row []string) {
+		for i, cell := range row {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i == len(row)-1 {
+				b.WriteString(pad + cell)
+			} else {
+				b.WriteString(cell + pad + " ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	rule := make([]string, len(widths))
+	for i, w := range widths {
+		rule[i] = strings.Repeat("-", w)
+	}
+
+	b.WriteString("```\n")
+	line(headers)
+	line(rule)
+	for _, row := range rows {
+		line(row)
+	}
+	line(rule)
+	line(footer)
+	b.WriteString("```")
+	return b.String()
+}
+
+// figure returns the measure of a group
+func figure(m Measure, group odoo.Record) float64 {
+	if m.Field == "" {
+		return float64(group.Int("__count"))
+	}
+	return group.Float(measureField(m))
+}
+
+// measureField returns the field name of a measure, e.g. "price_total" for
+// "price_total:sum"
+func measureField(m Measure) string {
+	field, _, _ := strings.Cut(m.Field, ":")
+	return field
+}
+
+func formatFigure(m Measure, v float64) string {
+	amount := whatsapp.FormatAmount(v)
+	if m.Monetary {
+		return amount
+	}
+	// Counts and whole quantities have no decimals
+	return strings.TrimSuffix(amount, ".00")
+}
+
+// groupLabel returns the display value of a group, which Odoo encodes like
+// the field it groups by
+func groupLabel(group odoo.Record, groupBy string) string {
+	switch v := group[groupBy].(type) {
+	case []interface{}:
+		if _, name := group.Many2one(groupBy); name != "" {
+			return name
+		}
+	case string:
+		return strings.ReplaceAll(v, "_", " ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "None"
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
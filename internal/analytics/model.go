@@ -0,0 +1,206 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pclk/waOdoo/internal/filter"
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Report is an Odoo reporting model that answers questions such as "sales
+// this month by salesperson". Its filter model names it and compiles the
+// conditions of a question.
+type Report struct {
+	filter.Model
+	// Measures are the figures a question can ask for, the first one by
+	// default
+	Measures []Measure `json:"measures"`
+	// Dimensions are what the figures can be broken down by. Dates can
+	// always be broken down by day, week, month, quarter or year.
+	Dimensions []Dimension `json:"dimensions,omitempty"`
+}
+
+// Measure is an aggregated field, e.g. "price_total:sum". An empty field
+// counts records.
+type Measure struct {
+	Field    string   `json:"field"`
+	Label    string   `json:"label"`
+	Aliases  []string `json:"aliases"`
+	Monetary bool     `json:"monetary,omitempty"`
+}
+
+// Dimension is a field read_group groups by, e.g. "user_id"
+type Dimension struct {
+	Field   string   `json:"field"`
+	Label   string   `json:"label"`
+	Aliases []string `json:"aliases"`
+}
+
+// count is the measure of every report that counts its records
+var count = Measure{Label: "Count", Aliases: []string{"count", "number", "number of"}}
+
+// dateUnits break figures down by the report's date field
+var dateUnits = map[string]string{
+	"day": "day", "days": "day", "daily": "day",
+	"week": "week", "weeks": "week", "weekly": "week",
+	"month": "month", "months": "month", "monthly": "month",
+	"quarter": "quarter", "quarters": "quarter", "quarterly": "quarter",
+	"year": "year", "years": "year", "yearly": "year",
+}
+
+var (
+	salesperson = Dimension{Field: "user_id", Label: "Salesperson", Aliases: []string{"salesperson", "salespeople", "salesman", "seller", "rep"}}
+	customer    = Dimension{Field: "partner_id", Label: "Customer", Aliases: []string{"customer", "customers", "client", "clients"}}
+	vendor      = Dimension{Field: "partner_id", Label: "Vendor", Aliases: []string{"vendor", "vendors", "supplier", "suppliers"}}
+	product     = Dimension{Field: "product_id", Label: "Product", Aliases: []string{"product", "products", "item", "items"}}
+	team        = Dimension{Field: "team_id", Label: "Team", Aliases: []string{"team", "teams", "sales team"}}
+	country     = Dimension{Field: "country_id", Label: "Country", Aliases: []string{"country", "countries"}}
+)
+
+// DefaultReports are answered when no reports are configured
+var DefaultReports = []Report{
+	{
+		Model: filter.Model{
+			Name:   "sale.report",
+			Nouns:  []string{"sales", "sales orders", "revenue", "sold", "sell"},
+			Domain: odoo.Domain{odoo.Cond("state", "=", "sale")},
+			Fields: []filter.Field{
+				{Name: "date", Type: "datetime", Aliases: []string{"date", "order date"}},
+				{Name: "price_total", Type: "monetary", Aliases: []string{"amount", "total"}},
+			},
+			PartnerField: "partner_id",
+			AmountField:  "price_total",
+			DateField:    "date",
+			UserField:    "user_id",
+			ProductField: "product_id",
+		},
+		Measures: []Measure{
+			{Field: "price_total:sum", Label: "Amount", Aliases: []string{"amount", "revenue", "total", "value"}, Monetary: true},
+			{Field: "price_subtotal:sum", Label: "Untaxed", Aliases: []string{"untaxed", "untaxed amount"}, Monetary: true},
+			{Field: "product_uom_qty:sum", Label: "Quantity", Aliases: []string{"quantity", "qty", "units"}},
+		},
+		Dimensions: []Dimension{
+			salesperson, customer, product, team, country,
+			{Field: "categ_id", Label: "Category", Aliases: []string{"category", "categories", "product category"}},
+		},
+	},
+	{
+		Model: filter.Model{
+			Name:  "account.invoice.report",
+			Nouns: []string{"invoiced", "invoices", "invoicing"},
+			Domain: odoo.Domain{
+				odoo.Cond("move_type", "in", []string{"out_invoice", "out_refund"}),
+				odoo.Cond("state", "=", "posted"),
+			},
+			Fields:       []filter.Field{{Name: "invoice_date", Type: "date", Aliases: []string{"date", "invoice date"}}},
+			PartnerField: "partner_id",
+			DateField:    "invoice_date",
+			UserField:    "invoice_user_id",
+			ProductField: "product_id",
+		},
+		Measures: []Measure{
+			{Field: "price_subtotal:sum", Label: "Amount", Aliases: []string{"amount", "revenue", "total", "untaxed"}, Monetary: true},
+			{Field: "quantity:sum", Label: "Quantity", Aliases: []string{"quantity", "qty", "units"}},
+		},
+		Dimensions: []Dimension{
+			{Field: "invoice_user_id", Label: "Salesperson", Aliases: salesperson.Aliases},
+			customer, product, team, country,
+			{Field: "product_categ_id", Label: "Category", Aliases: []string{"category", "categories", "product category"}},
+		},
+	},
+	{
+		Model: filter.Model{
+			Name:  "account.invoice.report",
+			Nouns: []string{"bills", "vendor bills", "spend", "spending"},
+			Domain: odoo.Domain{
+				odoo.Cond("move_type", "in", []string{"in_invoice", "in_refund"}),
+				odoo.Cond("state", "=", "posted"),
+			},
+			Fields:       []filter.Field{{Name: "invoice_date", Type: "date", Aliases: []string{"date", "bill date"}}},
+			PartnerField: "partner_id",
+			DateField:    "invoice_date",
+			ProductField: "product_id",
+		},
+		Measures: []Measure{
+			{Field: "price_subtotal:sum", Label: "Amount", Aliases: []string{"amount", "total", "untaxed"}, Monetary: true},
+			{Field: "quantity:sum", Label: "Quantity", Aliases: []string{"quantity", "qty", "units"}},
+		},
+		Dimensions: []Dimension{
+			vendor, product,
+			{Field: "product_categ_id", Label: "Category", Aliases: []string{"category", "categories", "product category"}},
+		},
+	},
+	{
+		Model: filter.Model{
+			Name:         "purchase.report",
+			Nouns:        []string{"purchases", "purchase orders", "purchased", "bought"},
+			Domain:       odoo.Domain{odoo.Cond("state", "in", []string{"purchase", "done"})},
+			Fields:       []filter.Field{{Name: "date_order", Type: "datetime", Aliases: []string{"date", "order date"}}},
+			PartnerField: "partner_id",
+			DateField:    "date_order",
+			UserField:    "user_id",
+			ProductField: "product_id",
+		},
+		Measures: []Measure{
+			{Field: "price_total:sum", Label: "Amount", Aliases: []string{"amount", "total", "value"}, Monetary: true},
+			{Field: "qty_ordered:sum", Label: "Quantity", Aliases: []string{"quantity", "qty", "units"}},
+		},
+		Dimensions: []Dimension{
+			vendor, product, country,
+			{Field: "user_id", Label: "Buyer", Aliases: []string{"buyer", "buyers", "purchaser", "representative"}},
+			{Field: "category_id", Label: "Category", Aliases: []string{"category", "categories", "product category"}},
+		},
+	},
+	{
+		Model: filter.Model{
+			Name:         "crm.lead",
+			Nouns:        []string{"opportunities", "pipeline", "leads"},
+			Domain:       odoo.Domain{odoo.Cond("type", "=", "opportunity")},
+			Fields:       []filter.Field{{Name: "create_date", Type: "datetime", Aliases: []string{"created"}}},
+			PartnerField: "partner_id",
+			AmountField:  "expected_revenue",
+			DateField:    "create_date",
+			UserField:    "user_id",
+		},
+		Measures: []Measure{
+			{Field: "expected_revenue:sum", Label: "Expected", Aliases: []string{"expected revenue", "revenue", "amount", "value"}, Monetary: true},
+			{Field: "prorated_revenue:sum", Label: "Prorated", Aliases: []string{"prorated revenue", "prorated", "weighted"}, Monetary: true},
+		},
+		Dimensions: []Dimension{
+			salesperson, customer, team, country,
+			{Field: "stage_id", Label: "Stage", Aliases: []string{"stage", "stages"}},
+			{Field: "source_id", Label: "Source", Aliases: []string{"source", "sources"}},
+		},
+	},
+}
+
+// LoadReports reads the reports from a JSON file. An empty path means the
+// DefaultReports.
+func LoadReports(path string) ([]Report, error) {
+	if path == "" {
+		return DefaultReports, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reports: %w", err)
+	}
+
+	var reports []Report
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return nil, fmt.Errorf("failed to parse reports: %w", err)
+	}
+	for i, r := range reports {
+		if r.Name == "" || len(r.Nouns) == 0 || len(r.Measures) == 0 {
+			return nil, fmt.Errorf("report %d needs a model, nouns and measures", i)
+		}
+		for _, d := range r.Dimensions {
+			if d.Field == "" || len(d.Aliases) == 0 {
+				return nil, fmt.Errorf("a dimension of report %s needs a field and aliases", r.Name)
+			}
+		}
+	}
+	return reports, nil
+}
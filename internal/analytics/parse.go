@@ -0,0 +1,279 @@
+package analytics
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/chart"
+	"github.com/pclk/waOdoo/internal/filter"
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// questionPattern matches the words that open a question, which the filter
+// compiler wouldn't understand
+var questionPattern = regexp.MustCompile(`(?i)^\s*(?:(?:(show(?:\s+me)?)|(what(?:'s|\s+(?:are|were|is|was))|how\s+much)|(how\s+many))` +
+	`(?:\s+(?:did|have|has|do|does))?(?:\s+we)?\s+)?(?:(?:our|the)\s+)?((?:total|sum\s+of)\s+)?`)
+
+// chartPattern matches a request for a chart, e.g. "as a pie chart" or
+// "graph of"
+var chartPattern = regexp.MustCompile(`(?i)(?:\b(?:as|in)\s+an?\s+)?\b(?:(bar|line|pie)\s+)?(?:chart|graph|plot)\b(?:\s+of\b)?`)
+
+// Question is a compiled analytics question, e.g. "sales this month by
+// salesperson"
+type Question struct {
+	Report  *Report
+	Measure Measure
+	// GroupBy are the read_group groupings, e.g. "user_id" or "date:month",
+	// and Labels their column headers
+	GroupBy []string
+	Labels  []string
+	Query   *filter.Query
+	// ChartAsked tells whether the figures were asked for as a chart, and
+	// Chart which kind, if one was named
+	ChartAsked bool
+	Chart      chart.Kind
+}
+
+// Title restates the question, e.g. "Sales this month by salesperson"
+func (q *Question) Title() string {
+	title := q.Query.Describe()
+	if q.Measure.Label != q.Report.Measures[0].Label {
+		title = strings.ToLower(q.Measure.Label) + " of " + title
+	}
+	if len(q.Labels) > 0 {
+		title += " by " + strings.ToLower(strings.Join(q.Labels, " and "))
+	}
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+// dated tells whether the first grouping is a date, whose groups are listed
+// in order rather than largest first
+func (q *Question) dated() bool {
+	return len(q.GroupBy) > 0 && strings.Contains(q.GroupBy[0], ":")
+}
+
+// Analyzer compiles questions about reports into read_group arguments. The
+// conditions of a question are compiled like a filter.
+type Analyzer struct {
+	reports  []Report
+	models   []filter.Model
+	compiler *filter.Compiler
+}
+
+func NewAnalyzer(client *odoo.Client, reports []Report) *Analyzer {
+	a := &Analyzer{reports: reports, models: make([]filter.Model, len(reports))}
+	for i, r := range reports {
+		a.models[i] = r.Model
+	}
+	a.compiler = filter.NewCompiler(client, a.models)
+	return a
+}
+
+// Find returns the report a question is about, or nil
+func (a *Analyzer) Find(text string) *Report {
+	return a.report(a.compiler.Find(text))
+}
+
+// report returns the report of one of the compiler's models
+func (a *Analyzer) report(m *filter.Model) *Report {
+	for i := range a.models {
+		if &a.models[i] == m {
+			return &a.reports[i]
+		}
+	}
+	return nil
+}
+
+// IsQuestion tells whether text asks for figures, e.g. "how much did we
+// sell" or "sales by customer", rather than for records
+func (a *Analyzer) IsQuestion(text string) bool {
+	report := a.Find(text)
+	if report == nil {
+		return false
+	}
+	s := a.split(report, text)
+	return s.asked || s.chartAsked || len(s.groupBy) > 0
+}
+
+// Parse compiles a question, computing its dates as of now
+func (a *Analyzer) Parse(ctx context.Context, text string, now time.Time) (*Question, error) {
+	report := a.Find(text)
+	if report == nil {
+		// Let the compiler list what can be asked about
+		_, err := a.compiler.Compile(ctx, text, now)
+		return nil, err
+	}
+
+	s := a.split(report, text)
+	query, err := a.compiler.Compile(ctx, s.rest, now)
+	if err != nil {
+		return nil, err
+	}
+	// The words left may have named another report, e.g. "quantity of
+	// sales orders"
+	report = a.report(query.Model)
+	if s.measure == nil {
+		s.measure = &report.Measures[0]
+	}
+	return &Question{
+		Report:     report,
+		Measure:    *s.measure,
+		GroupBy:    s.groupBy,
+		Labels:     s.labels,
+		Query:      query,
+		Chart:      s.chart,
+		ChartAsked: s.chartAsked,
+	}, nil
+}
+
+// split is a question with its measure and groupings taken out
+type split struct {
+	rest    string
+	measure *Measure
+	groupBy []string
+	labels  []string
+	// asked is true when the question opened like one, e.g. "how much"
+	asked      bool
+	chart      chart.Kind
+	chartAsked bool
+}
+
+// split takes the measure and the "by <dimension>" groupings out of a
+// question, leaving the conditions for the filter compiler
+func (a *Analyzer) split(report *Report, text string) split {
+	var s split
+	if c := chartPattern.FindStringSubmatch(text); c != nil {
+		s.chart, s.chartAsked = chart.Kind(strings.ToLower(c[1])), true
+		text = chartPattern.ReplaceAllString(text, " ")
+	}
+	m := questionPattern.FindStringSubmatch(text)
+	s.asked = m[2] != "" || m[3] != "" || m[4] != ""
+	if m[3] != "" {
+		s.measure = &count
+	}
+
+	words := strings.Fields(text[len(m[0]):])
+	lower := make([]string, len(words))
+	for i, w := range words {
+		lower[i] = strings.ToLower(strings.Trim(w, ",.?!;:"))
+	}
+
+	var rest, measureWords []string
+	for i := 0; i < len(words); {
+		if lower[i] == "by" || lower[i] == "per" {
+			if n := s.dimensions(report, lower[i+1:]); n > 0 {
+				i += n + 1
+				continue
+			}
+		}
+		if unit, ok := dateUnits[lower[i]]; ok && strings.HasSuffix(lower[i], "ly") && report.DateField != "" {
+			// "monthly sales"
+			s.group(report.DateField+":"+unit, strings.ToUpper(unit[:1])+unit[1:])
+			i++
+			continue
+		}
+		if measure, n := measureAt(report, lower[i:]); n > 0 && s.measure == nil {
+			s.measure = measure
+			if wordAt(lower, i+n) == "of" {
+				n++
+			}
+			measureWords = append(measureWords, words[i:i+n]...)
+			i += n
+			continue
+		}
+		rest = append(rest, words[i])
+		i++
+	}
+
+	// A measure that is also the report's noun, e.g. "revenue", stays
+	s.rest = strings.Join(rest, " ")
+	if s.measure != nil && len(measureWords) > 0 && a.compiler.Find(s.rest) == nil {
+		s.measure = nil
+		s.rest = strings.Join(append(measureWords, rest...), " ")
+	}
+	return s
+}
+
+// dimensions reads the groupings after "by", e.g. "salesperson and month",
+// and returns how many words they used
+func (s *split) dimensions(report *Report, words []string) int {
+	used := 0
+	for len(s.groupBy) < 2 {
+		n := 0
+		if used > 0 {
+			if w := wordAt(words, used); w != "and" && w != "then" {
+				break
+			}
+			n = 1
+		}
+		if unit, ok := dateUnits[wordAt(words, used+n)]; ok && report.DateField != "" {
+			s.group(report.DateField+":"+unit, strings.ToUpper(unit[:1])+unit[1:])
+			used += n + 1
+			continue
+		}
+		d, length := dimensionAt(report, words[min(used+n, len(words)):])
+		if length == 0 {
+			break
+		}
+		s.group(d.Field, d.Label)
+		used += n + length
+	}
+	return used
+}
+
+func (s *split) group(field, label string) {
+	s.groupBy = append(s.groupBy, field)
+	s.labels = append(s.labels, label)
+}
+
+// measureAt returns the measure named at the start of words, the longest
+// alias winning
+func measureAt(report *Report, words []string) (*Measure, int) {
+	var best *Measure
+	var n int
+	measures := append(append([]Measure{}, report.Measures...), count)
+	for i := range measures {
+		for _, alias := range measures[i].Aliases {
+			aw := strings.Fields(alias)
+			if len(aw) > n && hasPrefix(words, aw) {
+				best, n = &measures[i], len(aw)
+			}
+		}
+	}
+	return best, n
+}
+
+func dimensionAt(report *Report, words []string) (Dimension, int) {
+	var best Dimension
+	var n int
+	for _, d := range report.Dimensions {
+		for _, alias := range d.Aliases {
+			aw := strings.Fields(alias)
+			if len(aw) > n && hasPrefix(words, aw) {
+				best, n = d, len(aw)
+			}
+		}
+	}
+	return best, n
+}
+
+func hasPrefix(words, prefix []string) bool {
+	if len(prefix) > len(words) {
+		return false
+	}
+	for i, w := range prefix {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+func wordAt(words []string, i int) string {
+	if i < len(words) {
+		return words[i]
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// now is Wednesday 12 March 2025, 09:00 in Singapore
+var now = time.Date(2025, 3, 12, 9, 0, 0, 0, time.FixedZone("SGT", 8*3600))
+
+func newTestServer(t *testing.T) *odootest.Server {
+	server := odootest.NewServer(t)
+	server.Seed("res.partner",
+		odoo.Record{"id": 7, "name": "Acme Corp", "is_company": true, "commercial_partner_id": 7},
+		odoo.Record{"id": 10, "name": "Deco Addict", "is_company": true, "commercial_partner_id": 10},
+	)
+	server.AddUser(odoo.Record{"id": 6, "name": "Marc Demo", "login": "demo", "tz": "Asia/Singapore"}, "demo")
+	return server
+}
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	analyzer := NewAnalyzer(newTestServer(t).Client(), DefaultReports)
+	ctx := context.Background()
+
+	tests := []struct {
+		text    string
+		model   string
+		measure string
+		groupBy []string
+		title   string
+		domain  odoo.Domain
+	}{
+		{
+			"Sales this month by salesperson",
+			"sale.report", "price_total:sum", []string{"user_id"},
+			"Sales this month by salesperson",
+			odoo.Domain{
+				odoo.Cond("state", "=", "sale"),
+				odoo.Cond("date", ">=", "2025-02-28 16:00:00"), odoo.Cond("date", "<", "2025-03-31 16:00:00"),
+			},
+		},
+		{
+			"revenue by customer",
+			"sale.report", "price_total:sum", []string{"partner_id"},
+			"Sales by customer",
+			odoo.Domain{odoo.Cond("state", "=", "sale")},
+		},
+		{
+			"quantity sold by product and month last quarter",
+			"sale.report", "product_uom_qty:sum", []string{"product_id", "date:month"},
+			"Quantity of sales last quarter by product and month",
+			odoo.Domain{
+				odoo.Cond("state", "=", "sale"),
+				odoo.Cond("date", ">=", "2024-09-30 16:00:00"), odoo.Cond("date", "<", "2024-12-31 16:00:00"),
+			},
+		},
+		{
+			"How many opportunities by stage?",
+			"crm.lead", "", []string{"stage_id"},
+			"Count of opportunities by stage",
+			odoo.Domain{odoo.Cond("type", "=", "opportunity")},
+		},
+		{
+			"monthly invoiced in 2024 for Acme Corp",
+			"account.invoice.report", "price_subtotal:sum", []string{"invoice_date:month"},
+			"Invoiced in 2024 for Acme Corp by month",
+			odoo.Domain{
+				odoo.Cond("move_type", "in", []string{"out_invoice", "out_refund"}), odoo.Cond("state", "=", "posted"),
+				odoo.Cond("invoice_date", ">=", "2024-01-01"), odoo.Cond("invoice_date", "<", "2025-01-01"),
+				odoo.Cond("partner_id", "child_of", []int{7}),
+			},
+		},
+		{
+			"what were our total purchases last month per vendor",
+			"purchase.report", "price_total:sum", []string{"partner_id"},
+			"Purchases last month by vendor",
+			odoo.Domain{
+				odoo.Cond("state", "in", []string{"purchase", "done"}),
+				odoo.Cond("date_order", ">=", "2025-01-31 16:00:00"), odoo.Cond("date_order", "<", "2025-02-28 16:00:00"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		a.True(analyzer.IsQuestion(tt.text), tt.text)
+		q, err := analyzer.Parse(ctx, tt.text, now)
+		if a.NoError(err, tt.text) {
+			a.Equal(tt.model, q.Report.Name, tt.text)
+			a.Equal(tt.measure, q.Measure.Field, tt.text)
+			a.Equal(tt.groupBy, q.GroupBy, tt.text)
+			a.Equal(tt.title, q.Title(), tt.text)
+			a.Equal(tt.domain, q.Query.Domain, tt.text)
+		}
+	}
+
+	// Records are searched for rather than reported on
+	a.False(analyzer.IsQuestion("show sales orders for Acme Corp"))
+	a.False(analyzer.IsQuestion("sales by Marc Demo"))
+	a.False(analyzer.IsQuestion("how much is the fish"))
+}
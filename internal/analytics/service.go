@@ -0,0 +1,159 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/chart"
+	"github.com/pclk/waOdoo/internal/filter"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Service answers questions such as "sales this month by salesperson" with
+// a table or a chart of figures computed by read_group
+type Service struct {
+	analyzer *Analyzer
+	odoo     *odoo.Client
+	sender   agent.Sender
+	images   agent.ImageSender
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, images agent.ImageSender, reports []Report) *Service {
+	return &Service{analyzer: NewAnalyzer(client, reports), odoo: client, sender: sender, images: images, now: time.Now}
+}
+
+func (s *Service) Name() string {
+	return "analytics"
+}
+
+func (s *Service) Help() string {
+	return `"sales this month by salesperson" for figures from Odoo reports, "as a pie chart" to draw them`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && s.analyzer.IsQuestion(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// Figures are computed with the user's own access rights, which needs
+	// their API key: the service account could read any record
+	user := odoo.UserFrom(ctx)
+	if user == nil {
+		return s.send(ctx, msg.SenderID, "Reports are only available to Odoo users.")
+	}
+	if user.APIKey == "" {
+		return s.send(ctx, msg.SenderID, "To ask about figures from WhatsApp, link this number to your Odoo user with an API key first.")
+	}
+
+	tz, err := s.timezone(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		tz, location = "UTC", time.UTC
+	}
+	question, err := s.analyzer.Parse(ctx, msg.Body, s.now().In(location))
+	var filterErr *filter.Error
+	if errors.As(err, &filterErr) {
+		return s.send(ctx, msg.SenderID, filterErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	groups, total, err := s.Compute(ctx, question, tz)
+	if err != nil {
+		return err
+	}
+
+	if charted(question, groups) {
+		// Tables are the fallback when a chart can't be sent
+		err := s.sendChart(ctx, msg.SenderID, Chart(question, groups), Caption(question, total))
+		if err == nil {
+			return nil
+		}
+		log.Printf("Failed to send chart of %s: %v", question.Report.Name, err)
+	}
+	return s.send(ctx, msg.SenderID, Format(question, groups, total))
+}
+
+// sendChart uploads a chart and sends it with a caption
+func (s *Service) sendChart(ctx context.Context, to string, c *chart.Chart, caption string) error {
+	data, err := c.PNG()
+	if err != nil {
+		return err
+	}
+	mediaID, err := s.images.UploadMedia(ctx, data, "image/png", "chart.png")
+	if err != nil {
+		return fmt.Errorf("failed to upload chart: %w", err)
+	}
+	_, err = s.images.SendImage(ctx, whatsapp.ImageMessage{To: to, MediaID: mediaID, Caption: caption})
+	return err
+}
+
+// Compute runs the read_group query of a question, grouping dates in the
+// timezone tz, and returns its groups and the figure of all of them
+func (s *Service) Compute(ctx context.Context, q *Question, tz string) ([]odoo.Record, float64, error) {
+	model := q.Report.Name
+	field := measureField(q.Measure)
+	var fields []string
+	order := "__count desc"
+	if q.Measure.Field != "" {
+		fields = []string{q.Measure.Field}
+		order = field + " desc"
+	}
+	if q.dated() {
+		// Periods are listed in order
+		order = ""
+	}
+	opts := &odoo.SearchOptions{Order: order, Context: map[string]interface{}{"tz": tz}}
+
+	groups, err := s.odoo.ReadGroup(ctx, model, q.Query.Domain, fields, q.GroupBy, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to group %s: %w", model, err)
+	}
+	if len(q.GroupBy) == 0 || q.Measure.Field == "" || strings.HasSuffix(q.Measure.Field, ":sum") {
+		var total float64
+		for _, g := range groups {
+			total += figure(q.Measure, g)
+		}
+		return groups, total, nil
+	}
+
+	// Averages and other aggregates can't be added up
+	all, err := s.odoo.ReadGroup(ctx, model, q.Query.Domain, fields, nil, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to total %s: %w", model, err)
+	}
+	var total float64
+	if len(all) > 0 {
+		total = figure(q.Measure, all[0])
+	}
+	return groups, total, nil
+}
+
+// timezone returns the timezone of a user
+func (s *Service) timezone(ctx context.Context, userID int) (string, error) {
+	users, err := s.odoo.Read(ctx, "res.users", []int{userID}, []string{"tz"}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read user: %w", err)
+	}
+	if len(users) == 0 || users[0].String("tz") == "" {
+		return "UTC", nil
+	}
+	return users[0].String("tz"), nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
@@ -0,0 +1,67 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceHandle(t *testing.T) {
+	a := assert.New(t)
+	server := newTestServer(t)
+	line := func(id, user int, date string, amount float64, state string) odoo.Record {
+		return odoo.Record{"id": id, "user_id": user, "partner_id": 7, "date": date, "price_total": amount, "state": state}
+	}
+	server.Seed("sale.report",
+		line(1, 2, "2025-03-03 02:00:00", 12000, "sale"),
+		line(2, 6, "2025-03-05 08:30:00", 2500.5, "sale"),
+		line(3, 2, "2025-03-10 04:00:00", 800, "sale"),
+		line(4, 6, "2025-02-20 04:00:00", 9999, "sale"),
+		line(5, 6, "2025-03-11 04:00:00", 5000, "draft"),
+	)
+
+	sender := &agenttest.Sender{}
+	service := NewService(server.Client(), sender, sender, DefaultReports)
+	service.now = func() time.Time { return now }
+
+	msg := whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "Sales this month by salesperson"}
+	a.True(service.Match(msg))
+	a.NoError(service.Handle(context.Background(), msg))
+	a.Equal("Reports are only available to Odoo users.", sender.LastText())
+
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 6, Login: "demo"})
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("To ask about figures from WhatsApp, link this number to your Odoo user with an API key first.", sender.LastText())
+
+	ctx = odoo.WithUser(context.Background(), &odoo.User{ID: 6, Login: "demo", APIKey: "demo"})
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("📊 *Sales this month by salesperson*\n"+
+		"```\n"+
+		"Salesperson       Amount\n"+
+		"-------------- ---------\n"+
+		"Mitchell Admin 12,800.00\n"+
+		"Marc Demo       2,500.50\n"+
+		"-------------- ---------\n"+
+		"Total          15,300.50\n"+
+		"```", sender.LastText())
+
+	msg.Body = "how much did we sell this month"
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("📊 *Sales this month*\nAmount: 15,300.50", sender.LastText())
+
+	msg.Body = "pie chart of sales this month by salesperson"
+	a.NoError(service.Handle(ctx, msg))
+	if a.Len(sender.Images, 1) {
+		a.Equal("📊 *Sales this month by salesperson*\nTotal: 15,300.50", sender.Images[0].Caption)
+		a.Equal("image/png", sender.Media[sender.Images[0].MediaID].MimeType)
+	}
+
+	msg.Body = "my sales by customer yesterday"
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("📊 *Sales assigned to me yesterday by customer*\nNothing to report.", sender.LastText())
+}
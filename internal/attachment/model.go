@@ -0,0 +1,54 @@
+package attachment
+
+import "github.com/pclk/waOdoo/internal/odoo"
+
+// Target is a kind of record that media can be filed on
+type Target struct {
+	Model string
+	// Label names the kind of record in the choices sent to the user
+	Label string
+	// PartnerField links the records to the contact they concern
+	PartnerField string
+	// Domain restricts the records offered, e.g. to those not cancelled
+	Domain odoo.Domain
+}
+
+var (
+	// SaleOrders are quotations and sales orders
+	SaleOrders = Target{
+		Model:        "sale.order",
+		Label:        "Order",
+		PartnerField: "partner_id",
+		Domain:       odoo.Domain{odoo.Cond("state", "!=", "cancel")},
+	}
+	// Pickings are deliveries and receipts, e.g. for signed delivery notes
+	Pickings = Target{
+		Model:        "stock.picking",
+		Label:        "Transfer",
+		PartnerField: "partner_id",
+		Domain:       odoo.Domain{odoo.Cond("state", "!=", "cancel")},
+	}
+	// Tickets are helpdesk tickets, e.g. for photos of damaged goods
+	Tickets = Target{
+		Model:        "helpdesk.ticket",
+		Label:        "Ticket",
+		PartnerField: "partner_id",
+	}
+)
+
+// choice is a record the user can file media on
+type choice struct {
+	Model string
+	ID    int
+	Name  string
+	Label string
+}
+
+// pending is media waiting for the user to choose where it goes
+type pending struct {
+	MediaID  string
+	Filename string
+	MimeType string
+	// Choices are the records offered, keyed by the ID of their list row
+	Choices map[string]choice
+}
@@ -0,0 +1,237 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+const (
+	// maxChoices is the number of rows a WhatsApp list message can hold
+	maxChoices = 10
+	// recentPerTarget is how many recent records of each kind are offered
+	recentPerTarget = 3
+	// recentFor is how long after its last change a record is offered
+	recentFor = 30 * 24 * time.Hour
+)
+
+// Service files photos and documents sent on WhatsApp as attachments of the
+// Odoo record they concern, e.g. a signed delivery note on its transfer
+type Service struct {
+	// Targets are the kinds of records media can be filed on, besides the
+	// sender's contact
+	Targets []Target
+
+	odoo     *odoo.Client
+	sender   agent.Sender
+	media    agent.MediaDownloader
+	sessions *agent.Sessions
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, media agent.MediaDownloader, sessions *agent.Sessions) *Service {
+	return &Service{
+		Targets:  []Target{SaleOrders, Pickings},
+		odoo:     client,
+		sender:   sender,
+		media:    media,
+		sessions: sessions,
+	}
+}
+
+func (s *Service) Name() string {
+	return "attach"
+}
+
+func (s *Service) Help() string {
+	return `a photo or document captioned with a reference, e.g. "WH/OUT/00012", to file it in Odoo`
+}
+
+// Match accepts photos, videos and documents. Captioned receipts go to the
+// expense capability, which is registered first.
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	switch msg.Type {
+	case "image", "video", "document":
+		return msg.MediaID() != ""
+	}
+	return false
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	if msg.ReplyID != "" {
+		return s.choose(ctx, msg)
+	}
+
+	// The choices fall back on their last known values so that the file is
+	// queued while Odoo is down
+	choices, err := s.choices(odoo.LastKnown(ctx), msg)
+	if err != nil {
+		return err
+	}
+
+	p := &pending{MediaID: msg.MediaID(), Filename: msg.MediaFilename(), Choices: map[string]choice{}}
+	p.MimeType, _ = msg.Media["mime_type"].(string)
+
+	switch len(choices) {
+	case 0:
+		return s.send(ctx, msg.SenderID, "I couldn't tell which Odoo record this belongs to. Please send it again with the reference in the caption, e.g. S00042.")
+	case 1:
+		return s.attach(ctx, msg.SenderID, p, choices[0])
+	}
+
+	var rows []whatsapp.ListRow
+	for _, c := range choices {
+		id := fmt.Sprintf("attach:%s:%d", c.Model, c.ID)
+		p.Choices[id] = c
+		rows = append(rows, whatsapp.ListRow{ID: id, Title: c.Name, Description: c.Label})
+	}
+	s.sessions.Hold(msg.SenderID, s.Name(), p)
+
+	_, err = s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       msg.SenderID,
+		Body:     fmt.Sprintf("Where should I file %s?", p.Filename),
+		Button:   "Choose record",
+		Sections: []whatsapp.ListSection{{Rows: rows}},
+	})
+	return err
+}
+
+// choose files held media on the record the user picked
+func (s *Service) choose(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	session := s.sessions.Get(msg.SenderID)
+	if session == nil || session.Capability != s.Name() {
+		return s.send(ctx, msg.SenderID, "That file has expired. Please send it again.")
+	}
+	p := session.Data.(*pending)
+	c, ok := p.Choices[msg.ReplyID]
+	if !ok {
+		return fmt.Errorf("invalid reply id %q", msg.ReplyID)
+	}
+	s.sessions.End(msg.SenderID)
+	return s.attach(ctx, msg.SenderID, p, c)
+}
+
+// choices returns the records named in the caption or, failing that, the
+// sender's recent records and their contact. Senders that aren't bound to an
+// Odoo user only get records of their own company.
+func (s *Service) choices(ctx context.Context, msg whatsapp.WebhookMessage) ([]choice, error) {
+	var commercialID int
+	partner, err := s.odoo.PartnerByPhone(ctx, msg.SenderID, []string{"display_name", "commercial_partner_id"})
+	if err != nil {
+		return nil, err
+	}
+	if partner != nil {
+		if commercialID, _ = partner.Many2one("commercial_partner_id"); commercialID == 0 {
+			commercialID = partner.ID()
+		}
+	}
+	bound := odoo.UserFrom(ctx) != nil
+	if !bound && partner == nil {
+		return nil, nil
+	}
+
+	if refs := References(msg.Body); len(refs) > 0 {
+		var found []choice
+		for _, target := range s.Targets {
+			domain := append(odoo.Domain{}, target.Domain...)
+			if !bound {
+				domain = append(domain, odoo.Cond(target.PartnerField, "child_of", commercialID))
+			}
+			for _, ref := range refs {
+				records, err := s.odoo.SearchRead(ctx, target.Model, append(domain, odoo.Cond("name", "=ilike", ref)),
+					[]string{"display_name"}, &odoo.SearchOptions{Limit: 1})
+				if err != nil {
+					return nil, fmt.Errorf("failed to search %s: %w", target.Model, err)
+				}
+				for _, r := range records {
+					found = append(found, choice{Model: target.Model, ID: r.ID(), Name: r.String("display_name"), Label: target.Label})
+				}
+			}
+		}
+		if len(found) > 0 {
+			return limit(found), nil
+		}
+	}
+
+	if partner == nil {
+		return nil, nil
+	}
+	var recent []choice
+	// Whole days keep the search the same all day, for its last known result
+	since := time.Now().Add(-recentFor).UTC().Truncate(24 * time.Hour).Format(odoo.DatetimeFormat)
+	for _, target := range s.Targets {
+		domain := append(odoo.Domain{
+			odoo.Cond(target.PartnerField, "child_of", commercialID),
+			odoo.Cond("write_date", ">=", since),
+		}, target.Domain...)
+		records, err := s.odoo.SearchRead(ctx, target.Model, domain, []string{"display_name"},
+			&odoo.SearchOptions{Limit: recentPerTarget, Order: "write_date desc"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search recent %s: %w", target.Model, err)
+		}
+		for _, r := range records {
+			recent = append(recent, choice{Model: target.Model, ID: r.ID(), Name: r.String("display_name"), Label: target.Label})
+		}
+	}
+	recent = append(limit(recent), choice{Model: "res.partner", ID: commercialID, Name: partner.String("display_name"), Label: "Contact"})
+	return recent, nil
+}
+
+// attach downloads the media and stores it on the chosen record under its
+// original filename
+func (s *Service) attach(ctx context.Context, to string, p *pending, c choice) error {
+	media, err := s.media.DownloadMedia(ctx, p.MediaID)
+	if err != nil {
+		log.Printf("Failed to download media %s from %s: %v", p.MediaID, to, err)
+		return s.send(ctx, to, "Sorry, I couldn't download that file. Please send it again.")
+	}
+	mimeType := media.MimeType
+	if mimeType == "" {
+		mimeType = p.MimeType
+	}
+
+	// The file is saved once Odoo is back if it can't be reached now
+	summary := fmt.Sprintf("%s on *%s*", p.Filename, c.Name)
+	_, err = s.odoo.Attach(odoo.Queueable(ctx, to, summary), c.Model, c.ID, p.Filename, mimeType, media.Data)
+	if errors.Is(err, odoo.ErrQueued) {
+		return s.send(ctx, to, fmt.Sprintf("⏳ Odoo is unreachable right now. I'll save %s as soon as it's back and let you know.", summary))
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Attached %s from %s to %s %d", p.Filename, to, c.Model, c.ID)
+	return s.send(ctx, to, fmt.Sprintf("📎 Saved %s on *%s*.", p.Filename, c.Name))
+}
+
+// References returns the words of a caption that look like record
+// references, i.e. that contain a digit, e.g. "S00042" or "WH/OUT/00012"
+func References(caption string) []string {
+	var refs []string
+	for _, word := range strings.Fields(caption) {
+		word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if len(word) >= 3 && strings.ContainsAny(word, "0123456789") {
+			refs = append(refs, word)
+		}
+	}
+	return refs
+}
+
+// limit keeps the choices that fit in a list message next to the contact
+func limit(choices []choice) []choice {
+	if len(choices) > maxChoices-1 {
+		return choices[:maxChoices-1]
+	}
+	return choices
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
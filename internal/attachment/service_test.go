@@ -0,0 +1,123 @@
+package attachment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{Media: map[string]*whatsapp.Media{
+		"media-1": {ID: "media-1", MimeType: "application/pdf", Data: []byte("pdf")},
+	}}
+	return NewService(recorder.Client(), sender, sender, agent.NewSessions(time.Minute)), sender, recorder
+}
+
+var customer = []interface{}{map[string]interface{}{
+	"id":                    float64(9),
+	"display_name":          "Deco Addict, Ana",
+	"commercial_partner_id": []interface{}{float64(3), "Deco Addict"},
+}}
+
+func document(caption string) whatsapp.WebhookMessage {
+	return whatsapp.WebhookMessage{
+		SenderID:  "6591112222",
+		MessageID: "wamid.doc",
+		Type:      "document",
+		Body:      caption,
+		Media:     map[string]interface{}{"id": "media-1", "mime_type": "application/pdf", "filename": "delivery-note.pdf"},
+	}
+}
+
+func attachment(recorder *odootest.Recorder) map[string]interface{} {
+	if c := recorder.Find("ir.attachment", "create"); c != nil {
+		return c.Args[0].(map[string]interface{})
+	}
+	return nil
+}
+
+func TestReferences(t *testing.T) {
+	a := assert.New(t)
+	a.Equal([]string{"WH/OUT/00012", "S00042"}, References("Signed note for WH/OUT/00012 (S00042)."))
+	a.Empty(References("damaged box, 2 of them"))
+}
+
+func TestHandleAttachesToReference(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read":   customer,
+		"stock.picking.search_read": []interface{}{map[string]interface{}{"id": float64(12), "display_name": "WH/OUT/00012"}},
+		"ir.attachment.create":      40,
+	})
+
+	a.NoError(service.Handle(context.Background(), document("signed WH/OUT/00012")))
+
+	values := attachment(recorder)
+	if a.NotNil(values) {
+		a.Equal("stock.picking", values["res_model"])
+		a.Equal(float64(12), values["res_id"])
+		a.Equal("delivery-note.pdf", values["name"])
+		a.Equal("application/pdf", values["mimetype"])
+	}
+	a.Equal("📎 Saved delivery-note.pdf on *WH/OUT/00012*.", sender.LastText())
+
+	// Customers only find records of their own company
+	for _, c := range recorder.Calls() {
+		if c.Model == "stock.picking" {
+			a.Contains(c.Args[0], []interface{}{"partner_id", "child_of", float64(3)})
+		}
+	}
+}
+
+func TestHandleOffersRecentRecords(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read":   customer,
+		"sale.order.search_read":    []interface{}{map[string]interface{}{"id": float64(42), "display_name": "S00042"}},
+		"stock.picking.search_read": []interface{}{map[string]interface{}{"id": float64(12), "display_name": "WH/OUT/00012"}},
+		"ir.attachment.create":      40,
+	})
+
+	a.NoError(service.Handle(context.Background(), document("")))
+	if a.Len(sender.Lists, 1) {
+		var ids []string
+		for _, row := range sender.Lists[0].Sections[0].Rows {
+			ids = append(ids, row.ID)
+		}
+		a.Equal([]string{"attach:sale.order:42", "attach:stock.picking:12", "attach:res.partner:3"}, ids)
+	}
+	a.Nil(attachment(recorder), "nothing is saved before the user chooses")
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6591112222",
+		Type:     "interactive",
+		ReplyID:  "attach:stock.picking:12",
+	}))
+	values := attachment(recorder)
+	if a.NotNil(values) {
+		a.Equal("stock.picking", values["res_model"])
+		a.Equal(float64(12), values["res_id"])
+	}
+	a.Equal("📎 Saved delivery-note.pdf on *WH/OUT/00012*.", sender.LastText())
+}
+
+func TestHandleUnknownSender(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read": []interface{}{},
+	})
+
+	a.NoError(service.Handle(context.Background(), document("S00042")))
+	a.Len(recorder.Calls(), 1, "strangers can't look up records by reference")
+	a.Contains(sender.LastText(), "reference in the caption")
+}
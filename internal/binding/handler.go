@@ -0,0 +1,122 @@
+package binding
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handler is the admin API managing bindings
+type Handler struct {
+	registry *Registry
+	token    string
+}
+
+// NewHandler creates a handler that only accepts requests carrying the
+// ADMIN_API_TOKEN as a bearer token
+func NewHandler(registry *Registry) *Handler {
+	return &Handler{registry: registry, token: os.Getenv("ADMIN_API_TOKEN")}
+}
+
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	group := e.Group("/admin/bindings", h.authorize)
+	group.GET("", h.ListBindings)
+	group.POST("", h.AddBinding)
+	group.DELETE("/:wa_id", h.RevokeBinding)
+}
+
+func (h *Handler) authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			return c.JSON(http.StatusUnauthorized, Response{
+				Success: false,
+				Message: "Invalid or missing token",
+			})
+		}
+		return next(c)
+	}
+}
+
+// ListBindings returns every binding
+// @Summary      List user bindings
+// @Description  Lists the WhatsApp numbers bound to Odoo users
+// @Tags         admin
+// @Success      200  {array}   Binding
+// @Failure      401  {object}  Response
+// @Failure      500  {object}  Response
+// @Router       /admin/bindings [get]
+func (h *Handler) ListBindings(c echo.Context) error {
+	bindings, err := h.registry.List(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if bindings == nil {
+		bindings = []Binding{}
+	}
+	return c.JSON(http.StatusOK, bindings)
+}
+
+// AddBinding binds a WhatsApp number to an Odoo user
+// @Summary      Add a user binding
+// @Description  Binds a WhatsApp number to the Odoo user with the given login, replacing any previous binding of the number
+// @Param        binding  body      BindRequest  true  "Binding details"
+// @Tags         admin
+// @Success      200      {object}  Binding
+// @Failure      400      {object}  Response
+// @Failure      401      {object}  Response
+// @Router       /admin/bindings [post]
+func (h *Handler) AddBinding(c echo.Context) error {
+	var req BindRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "Invalid request format",
+		})
+	}
+
+	b, err := h.registry.Bind(c.Request().Context(), req.WaID, req.Connection, req.Login, req.APIKey)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+// RevokeBinding removes the binding of a WhatsApp number
+// @Summary      Revoke a user binding
+// @Description  Unbinds a WhatsApp number from its Odoo user
+// @Param        wa_id  path      string  true  "WhatsApp number"
+// @Tags         admin
+// @Success      200    {object}  Response
+// @Failure      401    {object}  Response
+// @Failure      404    {object}  Response
+// @Failure      500    {object}  Response
+// @Router       /admin/bindings/{wa_id} [delete]
+func (h *Handler) RevokeBinding(c echo.Context) error {
+	revoked, err := h.registry.Revoke(c.Request().Context(), c.Param("wa_id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	if !revoked {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "No binding for this number",
+		})
+	}
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: "Binding revoked",
+	})
+}
@@ -0,0 +1,54 @@
+package binding
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAPI(t *testing.T) {
+	a := assert.New(t)
+	registry, _ := newTestRegistry(t, "s3cret")
+	t.Setenv("ADMIN_API_TOKEN", "admin-token")
+	e := echo.New()
+	NewHandler(registry).RegisterRoutes(e)
+
+	request := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	a.Equal(http.StatusUnauthorized, request(http.MethodGet, "/admin/bindings", "", "").Code)
+	a.Equal(http.StatusUnauthorized, request(http.MethodGet, "/admin/bindings", "nope", "").Code)
+
+	rec := request(http.MethodPost, "/admin/bindings", "admin-token", `{"wa_id":"6591234567","login":"ana","api_key":"ana-key"}`)
+	a.Equal(http.StatusOK, rec.Code)
+	a.NotContains(rec.Body.String(), "ana-key")
+
+	a.Equal(http.StatusBadRequest, request(http.MethodPost, "/admin/bindings", "admin-token", `{"wa_id":"6591234567","login":"bob"}`).Code)
+
+	rec = request(http.MethodGet, "/admin/bindings", "admin-token", "")
+	if a.Equal(http.StatusOK, rec.Code) {
+		var bindings []Binding
+		a.NoError(json.Unmarshal(rec.Body.Bytes(), &bindings))
+		if a.Len(bindings, 1) {
+			a.Equal("ana", bindings[0].Login)
+			a.True(bindings[0].HasAPIKey)
+			a.Empty(bindings[0].APIKey)
+		}
+	}
+
+	a.Equal(http.StatusOK, request(http.MethodDelete, "/admin/bindings/6591234567", "admin-token", "").Code)
+	a.Equal(http.StatusNotFound, request(http.MethodDelete, "/admin/bindings/6591234567", "admin-token", "").Code)
+}
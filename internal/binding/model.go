@@ -0,0 +1,35 @@
+package binding
+
+import "time"
+
+// Binding ties a WhatsApp number to an Odoo user
+type Binding struct {
+	WaID string `json:"wa_id"`
+	// Connection is the name of the Odoo database the user belongs to
+	Connection string `json:"connection"`
+	UserID     int    `json:"user_id"`
+	Login      string `json:"login"`
+	Name       string `json:"name"`
+	// CompanyID is the company the user switched to, or 0 for the default
+	CompanyID int `json:"company_id,omitempty"`
+	// APIKey is the user's Odoo API key, encrypted at rest. Without one the
+	// user is identified but calls run as the service account.
+	APIKey    string    `json:"-"`
+	HasAPIKey bool      `json:"has_api_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BindRequest is the body of the admin API call adding a binding
+type BindRequest struct {
+	WaID string `json:"wa_id"`
+	// Connection defaults to the first Odoo database
+	Connection string `json:"connection,omitempty"`
+	Login      string `json:"login"`
+	APIKey     string `json:"api_key,omitempty"`
+}
+
+// Response is the admin API's reply to calls that don't return bindings
+type Response struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
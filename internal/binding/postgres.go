@@ -0,0 +1,106 @@
+package binding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pclk/waOdoo/internal/database"
+)
+
+// PostgresStore keeps bindings in the wa_user_bindings table
+type PostgresStore struct {
+	db *database.DB
+}
+
+func NewPostgresStore(db *database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Migrate creates the bindings table if it doesn't exist
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS wa_user_bindings (
+			wa_id      TEXT PRIMARY KEY,
+			user_id    INTEGER NOT NULL,
+			login      TEXT NOT NULL,
+			name       TEXT NOT NULL DEFAULT '',
+			api_key    TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create bindings table: %w", err)
+	}
+
+	_, err = s.db.Pool.Exec(ctx, `
+		ALTER TABLE wa_user_bindings
+			ADD COLUMN IF NOT EXISTS connection TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS company_id INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		return fmt.Errorf("failed to migrate bindings table: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, waID string) (*Binding, error) {
+	var b Binding
+	err := s.db.Pool.QueryRow(ctx,
+		`SELECT wa_id, connection, user_id, login, name, company_id, api_key, created_at FROM wa_user_bindings WHERE wa_id = $1`, waID,
+	).Scan(&b.WaID, &b.Connection, &b.UserID, &b.Login, &b.Name, &b.CompanyID, &b.APIKey, &b.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get binding: %w", err)
+	}
+	b.HasAPIKey = b.APIKey != ""
+	return &b, nil
+}
+
+func (s *PostgresStore) Save(ctx context.Context, b Binding) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO wa_user_bindings (wa_id, connection, user_id, login, name, company_id, api_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (wa_id) DO UPDATE SET
+			connection = EXCLUDED.connection,
+			user_id = EXCLUDED.user_id,
+			login = EXCLUDED.login,
+			name = EXCLUDED.name,
+			company_id = EXCLUDED.company_id,
+			api_key = EXCLUDED.api_key,
+			created_at = EXCLUDED.created_at`,
+		b.WaID, b.Connection, b.UserID, b.Login, b.Name, b.CompanyID, b.APIKey, b.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save binding: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, waID string) (bool, error) {
+	tag, err := s.db.Pool.Exec(ctx, `DELETE FROM wa_user_bindings WHERE wa_id = $1`, waID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete binding: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *PostgresStore) List(ctx context.Context) ([]Binding, error) {
+	rows, err := s.db.Pool.Query(ctx,
+		`SELECT wa_id, connection, user_id, login, name, company_id, api_key, created_at FROM wa_user_bindings ORDER BY wa_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bindings: %w", err)
+	}
+	defer rows.Close()
+
+	var bindings []Binding
+	for rows.Next() {
+		var b Binding
+		if err := rows.Scan(&b.WaID, &b.Connection, &b.UserID, &b.Login, &b.Name, &b.CompanyID, &b.APIKey, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read binding: %w", err)
+		}
+		b.HasAPIKey = b.APIKey != ""
+		bindings = append(bindings, b)
+	}
+	return bindings, rows.Err()
+}
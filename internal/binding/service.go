@@ -0,0 +1,185 @@
+package binding
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Connections looks up the Odoo database of a binding by name, "" being
+// the default one. It is implemented by *connection.Router.
+type Connections interface {
+	Client(name string) *odoo.Client
+}
+
+// Registry binds WhatsApp numbers to Odoo users
+type Registry struct {
+	connections Connections
+	store       Store
+	sealer      *sealer
+}
+
+// NewRegistry creates a registry whose API keys are encrypted with the
+// BINDING_SECRET. Without a secret, bindings can't store API keys.
+func NewRegistry(connections Connections, store Store) (*Registry, error) {
+	s, err := newSealer(os.Getenv("BINDING_SECRET"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up api key encryption: %w", err)
+	}
+	return &Registry{connections: connections, store: store, sealer: s}, nil
+}
+
+// Bind ties waID to the active Odoo user with the given login on the named
+// connection. An API key, if given, must be the user's own and lets waOdoo
+// act as them.
+func (r *Registry) Bind(ctx context.Context, waID, connection, login, apiKey string) (*Binding, error) {
+	waID = normalize(waID)
+	if waID == "" || login == "" {
+		return nil, fmt.Errorf("both a WhatsApp number and a login are required")
+	}
+	client := r.connections.Client(connection)
+	if client == nil {
+		return nil, fmt.Errorf("unknown odoo connection %s", connection)
+	}
+
+	users, err := client.SearchRead(ctx, "res.users", odoo.Domain{odoo.Cond("login", "=", login)},
+		[]string{"name", "login"}, &odoo.SearchOptions{Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no active Odoo user with login %s", login)
+	}
+
+	b := Binding{
+		WaID:       waID,
+		Connection: client.Name,
+		UserID:     users[0].ID(),
+		Login:      users[0].String("login"),
+		Name:       users[0].String("name"),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if apiKey != "" {
+		if r.sealer == nil {
+			return nil, fmt.Errorf("BINDING_SECRET must be set to store API keys")
+		}
+		uid, err := client.Login(ctx, login, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		if uid != b.UserID {
+			return nil, fmt.Errorf("the API key belongs to another user")
+		}
+		if b.APIKey, err = r.sealer.seal(apiKey); err != nil {
+			return nil, err
+		}
+		b.HasAPIKey = true
+	}
+
+	if err := r.store.Save(ctx, b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Revoke removes the binding of waID and reports whether there was one
+func (r *Registry) Revoke(ctx context.Context, waID string) (bool, error) {
+	return r.store.Delete(ctx, normalize(waID))
+}
+
+// List returns every binding
+func (r *Registry) List(ctx context.Context) ([]Binding, error) {
+	return r.store.List(ctx)
+}
+
+// Resolve returns the Odoo user waID is bound to, or nil for unbound numbers
+func (r *Registry) Resolve(ctx context.Context, waID string) (*odoo.User, error) {
+	b, err := r.store.Get(ctx, normalize(waID))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return r.user(b)
+}
+
+// ConnectionOf returns the name of the connection waID is bound to, or ""
+// for unbound numbers
+func (r *Registry) ConnectionOf(ctx context.Context, waID string) (string, error) {
+	b, err := r.store.Get(ctx, normalize(waID))
+	if err != nil || b == nil {
+		return "", err
+	}
+	return r.connectionName(b), nil
+}
+
+// SetCompany switches the company a bound user works in
+func (r *Registry) SetCompany(ctx context.Context, waID string, companyID int) error {
+	b, err := r.store.Get(ctx, normalize(waID))
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return fmt.Errorf("%s is not bound to an Odoo user", waID)
+	}
+	b.CompanyID = companyID
+	return r.store.Save(ctx, *b)
+}
+
+// Scope returns a resolver that only knows the users of the named
+// connection, for the agent working on that database
+func (r *Registry) Scope(connection string) *Scoped {
+	return &Scoped{registry: r, connection: connection}
+}
+
+// Scoped resolves the users bound on one connection
+type Scoped struct {
+	registry   *Registry
+	connection string
+}
+
+func (s *Scoped) Resolve(ctx context.Context, waID string) (*odoo.User, error) {
+	b, err := s.registry.store.Get(ctx, normalize(waID))
+	if err != nil || b == nil || s.registry.connectionName(b) != s.connection {
+		return nil, err
+	}
+	return s.registry.user(b)
+}
+
+func (r *Registry) user(b *Binding) (*odoo.User, error) {
+	user := &odoo.User{ID: b.UserID, Login: b.Login, Name: b.Name, CompanyID: b.CompanyID}
+	if b.APIKey != "" {
+		if r.sealer == nil {
+			return nil, fmt.Errorf("BINDING_SECRET is needed to use the API key bound to %s", b.WaID)
+		}
+		var err error
+		if user.APIKey, err = r.sealer.open(b.APIKey); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// connectionName returns the connection of a binding; bindings made before
+// there were several connections belong to the default one
+func (r *Registry) connectionName(b *Binding) string {
+	if b.Connection != "" {
+		return b.Connection
+	}
+	if client := r.connections.Client(""); client != nil {
+		return client.Name
+	}
+	return ""
+}
+
+// normalize strips a phone number down to the WhatsApp id
+func normalize(waID string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, waID)
+}
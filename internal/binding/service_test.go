@@ -0,0 +1,154 @@
+package binding
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// clients are the test's Odoo connections, the default one named "main"
+type clients map[string]*odoo.Client
+
+func (c clients) Client(name string) *odoo.Client {
+	if name == "" {
+		name = "main"
+	}
+	return c[name]
+}
+
+// newTestRegistry fakes the Odoo of two connections, main and branch, where
+// ana's API key is "ana-key"
+func newTestRegistry(t *testing.T, secret string) (*Registry, *MemoryStore) {
+	connections := clients{}
+	for _, name := range []string{"main", "branch"} {
+		server := odootest.NewServer(t)
+		server.AddUser(odoo.Record{"id": 9, "login": "ana", "name": "Ana Lopez"}, "ana-key")
+		client := server.Client()
+		client.Name = name
+		connections[name] = client
+	}
+
+	t.Setenv("BINDING_SECRET", secret)
+	store := NewMemoryStore()
+	registry, err := NewRegistry(connections, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry, store
+}
+
+func TestBindAndResolve(t *testing.T) {
+	a := assert.New(t)
+	registry, store := newTestRegistry(t, "s3cret")
+	ctx := context.Background()
+
+	b, err := registry.Bind(ctx, "+65 9123 4567", "", "ana", "ana-key")
+	if a.NoError(err) {
+		a.Equal("6591234567", b.WaID)
+		a.Equal("main", b.Connection)
+		a.Equal(9, b.UserID)
+		a.Equal("Ana Lopez", b.Name)
+		a.True(b.HasAPIKey)
+	}
+
+	stored, _ := store.Get(ctx, "6591234567")
+	if a.NotNil(stored) {
+		a.NotEmpty(stored.APIKey)
+		a.NotContains(stored.APIKey, "ana-key", "keys are encrypted at rest")
+	}
+
+	user, err := registry.Resolve(ctx, "6591234567")
+	if a.NoError(err) {
+		a.Equal(&odoo.User{ID: 9, Login: "ana", Name: "Ana Lopez", APIKey: "ana-key"}, user)
+	}
+
+	user, err = registry.Resolve(ctx, "6598765432")
+	a.NoError(err)
+	a.Nil(user)
+}
+
+func TestBindRejectsInvalidCredentials(t *testing.T) {
+	a := assert.New(t)
+	registry, store := newTestRegistry(t, "s3cret")
+	ctx := context.Background()
+
+	_, err := registry.Bind(ctx, "6591234567", "", "ana", "wrong")
+	a.ErrorContains(err, "invalid credentials")
+
+	_, err = registry.Bind(ctx, "6591234567", "", "bob", "")
+	a.ErrorContains(err, "no active Odoo user")
+
+	bindings, _ := store.List(ctx)
+	a.Empty(bindings)
+}
+
+func TestBindWithoutSecret(t *testing.T) {
+	a := assert.New(t)
+	registry, _ := newTestRegistry(t, "")
+	ctx := context.Background()
+
+	_, err := registry.Bind(ctx, "6591234567", "", "ana", "ana-key")
+	a.ErrorContains(err, "BINDING_SECRET")
+
+	// Identity-only bindings don't need a secret
+	b, err := registry.Bind(ctx, "6591234567", "", "ana", "")
+	if a.NoError(err) {
+		a.False(b.HasAPIKey)
+	}
+	user, err := registry.Resolve(ctx, "6591234567")
+	if a.NoError(err) {
+		a.Equal(9, user.ID)
+		a.Empty(user.APIKey)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	a := assert.New(t)
+	registry, _ := newTestRegistry(t, "s3cret")
+	ctx := context.Background()
+
+	_, err := registry.Bind(ctx, "6591234567", "", "ana", "")
+	a.NoError(err)
+
+	revoked, err := registry.Revoke(ctx, "+6591234567")
+	a.NoError(err)
+	a.True(revoked)
+
+	revoked, err = registry.Revoke(ctx, "6591234567")
+	a.NoError(err)
+	a.False(revoked)
+
+	user, _ := registry.Resolve(ctx, "6591234567")
+	a.Nil(user)
+}
+
+func TestConnectionsAndCompanies(t *testing.T) {
+	a := assert.New(t)
+	registry, _ := newTestRegistry(t, "s3cret")
+	ctx := context.Background()
+
+	_, err := registry.Bind(ctx, "6591234567", "warehouse", "ana", "")
+	a.ErrorContains(err, "unknown odoo connection")
+
+	_, err = registry.Bind(ctx, "6591234567", "branch", "ana", "")
+	a.NoError(err)
+
+	name, err := registry.ConnectionOf(ctx, "6591234567")
+	a.NoError(err)
+	a.Equal("branch", name)
+
+	user, _ := registry.Scope("main").Resolve(ctx, "6591234567")
+	a.Nil(user, "bound on another connection")
+
+	a.NoError(registry.SetCompany(ctx, "6591234567", 3))
+	user, err = registry.Scope("branch").Resolve(ctx, "6591234567")
+	if a.NoError(err) && a.NotNil(user) {
+		a.Equal(9, user.ID)
+		a.Equal(3, user.CompanyID)
+	}
+
+	a.Error(registry.SetCompany(ctx, "6598765432", 3))
+}
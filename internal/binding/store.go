@@ -0,0 +1,65 @@
+package binding
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store persists bindings by WhatsApp id
+type Store interface {
+	// Get returns the binding of waID, or nil when there is none
+	Get(ctx context.Context, waID string) (*Binding, error)
+	// Save adds a binding or replaces the one of the same number
+	Save(ctx context.Context, b Binding) error
+	// Delete removes the binding of waID and reports whether there was one
+	Delete(ctx context.Context, waID string) (bool, error)
+	List(ctx context.Context) ([]Binding, error)
+}
+
+// MemoryStore keeps bindings in memory, for tests and setups without a
+// database
+type MemoryStore struct {
+	mu       sync.Mutex
+	bindings map[string]Binding
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{bindings: map[string]Binding{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, waID string) (*Binding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bindings[waID]
+	if !ok {
+		return nil, nil
+	}
+	return &b, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, b Binding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bindings[b.WaID] = b
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, waID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.bindings[waID]
+	delete(s.bindings, waID)
+	return ok, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Binding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bindings := make([]Binding, 0, len(s.bindings))
+	for _, b := range s.bindings {
+		bindings = append(bindings, b)
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].WaID < bindings[j].WaID })
+	return bindings, nil
+}
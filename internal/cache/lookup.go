@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxResults is how many records a lookup answer lists
+const maxResults = 5
+
+var lookupPattern = regexp.MustCompile(`(?i)^\s*(?:find|look\s*up|search(?:\s+for)?)\s+(contact|customer|supplier|vendor|partner|product|item)s?\s+(.+?)\s*\??\s*$`)
+
+// lookupModels maps the words of a lookup to the model they search
+var lookupModels = map[string]string{
+	"contact":  "res.partner",
+	"customer": "res.partner",
+	"supplier": "res.partner",
+	"vendor":   "res.partner",
+	"partner":  "res.partner",
+	"product":  "product.product",
+	"item":     "product.product",
+}
+
+// Lookup answers contact and product lookups from the cache, saying how
+// fresh the data is
+type Lookup struct {
+	// StaleAfter is the age from which answers warn that Odoo may have
+	// newer data
+	StaleAfter time.Duration
+
+	cache  *Cache
+	sender agent.Sender
+	now    func() time.Time
+}
+
+func NewLookup(cache *Cache, sender agent.Sender, staleAfter time.Duration) *Lookup {
+	return &Lookup{StaleAfter: staleAfter, cache: cache, sender: sender, now: time.Now}
+}
+
+func (l *Lookup) Name() string {
+	return "lookup"
+}
+
+func (l *Lookup) Help() string {
+	return `"find contact Azure" or "find product desk" for contact details and prices`
+}
+
+func (l *Lookup) Match(msg whatsapp.WebhookMessage) bool {
+	m := lookupPattern.FindStringSubmatch(msg.Body)
+	return m != nil && l.cache.Cached(lookupModels[strings.ToLower(m[1])])
+}
+
+func (l *Lookup) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// The cache holds what the service account sees, so answers are limited
+	// to the records the user may read, which needs their API key
+	user := odoo.UserFrom(ctx)
+	if user == nil {
+		return l.send(ctx, msg.SenderID, "Lookups are only available to Odoo users.")
+	}
+	if user.APIKey == "" {
+		return l.send(ctx, msg.SenderID, "To look up Odoo records from WhatsApp, link this number to your Odoo user with an API key first.")
+	}
+
+	m := lookupPattern.FindStringSubmatch(msg.Body)
+	if m == nil {
+		return nil
+	}
+	model, term := lookupModels[strings.ToLower(m[1])], m[2]
+
+	result, err := l.cache.Search(ctx, model, term, maxResults+1)
+	if err != nil {
+		return err
+	}
+	result.Records, err = l.cache.Accessible(ctx, model, result.Records)
+	if err != nil {
+		return err
+	}
+	return l.send(ctx, msg.SenderID, l.Format(model, term, result))
+}
+
+// Format renders the records found, followed by how fresh they are
+func (l *Lookup) Format(model, term string, result *Result) string {
+	var b strings.Builder
+	if len(result.Records) == 0 {
+		fmt.Fprintf(&b, "No match for \"%s\".", term)
+	}
+	for i, r := range result.Records {
+		if i == maxResults {
+			b.WriteString("\n…and more, try a longer search.")
+			break
+		}
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		if model == "product.product" {
+			b.WriteString(formatProduct(r))
+		} else {
+			b.WriteString(formatPartner(r))
+		}
+	}
+
+	age := l.now().Sub(result.SyncedAt)
+	if l.StaleAfter > 0 && age >= l.StaleAfter {
+		fmt.Fprintf(&b, "\n\n⚠️ Last synced %s, Odoo may have newer data.", formatAge(age))
+	} else {
+		fmt.Fprintf(&b, "\n\n🕒 Synced %s.", formatAge(age))
+	}
+	return b.String()
+}
+
+func formatPartner(r odoo.Record) string {
+	lines := []string{"*" + r.String("display_name") + "*"}
+	for _, f := range []struct{ icon, field string }{{"📞", "mobile"}, {"☎️", "phone"}, {"✉️", "email"}, {"📍", "city"}} {
+		if v := r.String(f.field); v != "" {
+			lines = append(lines, f.icon+" "+v)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatProduct(r odoo.Record) string {
+	line := "*" + r.String("display_name") + "*"
+	if _, uom := r.Many2one("uom_id"); uom != "" {
+		return fmt.Sprintf("%s\n💲 %s per %s", line, whatsapp.FormatAmount(r.Float("list_price")), uom)
+	}
+	return fmt.Sprintf("%s\n💲 %s", line, whatsapp.FormatAmount(r.Float("list_price")))
+}
+
+// formatAge renders a duration the way people say it, e.g. "5 min ago"
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%d min ago", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%d h ago", int(age.Hours()))
+	}
+	return fmt.Sprintf("%d days ago", int(age.Hours()/24))
+}
+
+func (l *Lookup) send(ctx context.Context, to, text string) error {
+	_, err := l.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
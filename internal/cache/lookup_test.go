@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupHandle(t *testing.T) {
+	a := assert.New(t)
+	cache, _, _ := newTestCache(t, map[string][]interface{}{
+		"res.partner.search_read": {[]interface{}{
+			partner(3, "Azure Interior", "+65 9876 5432", "2025-03-10 09:00:00", true),
+		}},
+		"res.partner.search": {[]int{3}, []int{3}, []int{3}, []int{}},
+	})
+	a.NoError(cache.Sync(context.Background(), "res.partner"))
+
+	sender := &agenttest.Sender{}
+	lookup := NewLookup(cache, sender, 15*time.Minute)
+	lookup.now = func() time.Time { return cache.now().Add(5 * time.Minute) }
+
+	msg := whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "find customer azure?"}
+	a.True(lookup.Match(msg))
+	a.False(lookup.Match(whatsapp.WebhookMessage{Body: "find invoice INV/2025/0001"}), "invoices aren't cached")
+
+	a.NoError(lookup.Handle(context.Background(), msg))
+	a.Equal("Lookups are only available to Odoo users.", sender.LastText())
+
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 7, Login: "marc"})
+	a.NoError(lookup.Handle(ctx, msg))
+	a.Equal("To look up Odoo records from WhatsApp, link this number to your Odoo user with an API key first.", sender.LastText())
+
+	ctx = odoo.WithUser(context.Background(), &odoo.User{ID: 7, Login: "marc", APIKey: "marc-key"})
+	a.NoError(lookup.Handle(ctx, msg))
+	a.Equal("*Azure Interior*\n☎️ +65 9876 5432\n\n🕒 Synced 5 min ago.", sender.LastText())
+
+	lookup.now = func() time.Time { return cache.now().Add(3 * time.Hour) }
+	a.NoError(lookup.Handle(ctx, msg))
+	a.Equal("*Azure Interior*\n☎️ +65 9876 5432\n\n⚠️ Last synced 3 h ago, Odoo may have newer data.", sender.LastText())
+
+	// Records the user can't read in Odoo are left out
+	lookup.now = func() time.Time { return cache.now() }
+	a.NoError(lookup.Handle(ctx, msg))
+	a.Equal("No match for \"azure\".\n\n🕒 Synced just now.", sender.LastText())
+}
+
+func TestFormatProduct(t *testing.T) {
+	a := assert.New(t)
+	lookup := NewLookup(nil, nil, 0)
+	lookup.now = func() time.Time { return time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC) }
+
+	text := lookup.Format("product.product", "zzz", &Result{SyncedAt: lookup.now()})
+	a.Equal("No match for \"zzz\".\n\n🕒 Synced just now.", text)
+
+	a.Equal("*[DESK] Desk*\n💲 1,250.00 per Units", formatProduct(odoo.Record{
+		"display_name": "[DESK] Desk",
+		"list_price":   1250.0,
+		"uom_id":       []interface{}{float64(1), "Units"},
+	}))
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Model is an Odoo model mirrored into the cache
+type Model struct {
+	Name   string   `json:"model"`
+	Fields []string `json:"fields"`
+	// SearchFields are matched by lookups, case-insensitively
+	SearchFields []string `json:"search_fields"`
+	// Domain limits the records that are cached
+	Domain odoo.Domain `json:"domain,omitempty"`
+	// Archivable models have an active field, so archived records are
+	// synced as inactive instead of disappearing
+	Archivable bool `json:"archivable,omitempty"`
+}
+
+// DefaultModels are cached when no models are configured
+var DefaultModels = []Model{
+	{
+		Name:         "res.partner",
+		Fields:       []string{"display_name", "phone", "mobile", "email", "city"},
+		SearchFields: []string{"display_name", "phone", "mobile", "email"},
+		Archivable:   true,
+	},
+	{
+		Name:         "product.product",
+		Fields:       []string{"display_name", "default_code", "barcode", "list_price", "uom_id"},
+		SearchFields: []string{"display_name", "default_code", "barcode"},
+		Domain:       odoo.Domain{odoo.Cond("sale_ok", "=", true)},
+		Archivable:   true,
+	},
+}
+
+// Entry is a cached record
+type Entry struct {
+	Record    odoo.Record
+	WriteDate string
+	Active    bool
+}
+
+// State is how far the sync of a model got
+type State struct {
+	// Cursor is the latest write_date synced
+	Cursor       string
+	SyncedAt     time.Time
+	ReconciledAt time.Time
+}
+
+// Result is the answer to a lookup, with the time the data was synced
+type Result struct {
+	Records  []odoo.Record
+	SyncedAt time.Time
+}
+
+// LoadModels reads the models to cache from a JSON file. An empty path
+// means the DefaultModels.
+func LoadModels(path string) ([]Model, error) {
+	if path == "" {
+		return DefaultModels, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached models: %w", err)
+	}
+
+	var models []Model
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, fmt.Errorf("failed to parse cached models: %w", err)
+	}
+	for i, m := range models {
+		if m.Name == "" || len(m.Fields) == 0 {
+			return nil, fmt.Errorf("cached model %d needs a model and fields", i)
+		}
+	}
+	return models, nil
+}
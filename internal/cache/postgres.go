@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pclk/waOdoo/internal/database"
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// PostgresStore keeps the cache in the odoo_cache and odoo_sync_state tables
+type PostgresStore struct {
+	db *database.DB
+}
+
+func NewPostgresStore(db *database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Migrate creates the cache tables if they don't exist
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS odoo_cache (
+			connection TEXT NOT NULL,
+			model      TEXT NOT NULL,
+			id         INTEGER NOT NULL,
+			data       JSONB NOT NULL,
+			write_date TEXT NOT NULL,
+			active     BOOLEAN NOT NULL DEFAULT TRUE,
+			PRIMARY KEY (connection, model, id)
+		);
+		CREATE TABLE IF NOT EXISTS odoo_sync_state (
+			connection    TEXT NOT NULL,
+			model         TEXT NOT NULL,
+			cursor        TEXT NOT NULL DEFAULT '',
+			synced_at     TIMESTAMPTZ,
+			reconciled_at TIMESTAMPTZ,
+			PRIMARY KEY (connection, model)
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create cache tables: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) State(ctx context.Context, connection, model string) (State, error) {
+	var state State
+	var syncedAt, reconciledAt *time.Time
+	err := s.db.Pool.QueryRow(ctx,
+		`SELECT cursor, synced_at, reconciled_at FROM odoo_sync_state WHERE connection = $1 AND model = $2`,
+		connection, model,
+	).Scan(&state.Cursor, &syncedAt, &reconciledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("failed to get sync state: %w", err)
+	}
+	if syncedAt != nil {
+		state.SyncedAt = *syncedAt
+	}
+	if reconciledAt != nil {
+		state.ReconciledAt = *reconciledAt
+	}
+	return state, nil
+}
+
+func (s *PostgresStore) SaveState(ctx context.Context, connection, model string, state State) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO odoo_sync_state (connection, model, cursor, synced_at, reconciled_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (connection, model) DO UPDATE SET
+			cursor = EXCLUDED.cursor,
+			synced_at = EXCLUDED.synced_at,
+			reconciled_at = EXCLUDED.reconciled_at`,
+		connection, model, state.Cursor, nullTime(state.SyncedAt), nullTime(state.ReconciledAt))
+	if err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Upsert(ctx context.Context, connection, model string, entries []Entry) error {
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		data, err := json.Marshal(e.Record)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s %d: %w", model, e.Record.ID(), err)
+		}
+		batch.Queue(`
+			INSERT INTO odoo_cache (connection, model, id, data, write_date, active)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (connection, model, id) DO UPDATE SET
+				data = EXCLUDED.data,
+				write_date = EXCLUDED.write_date,
+				active = EXCLUDED.active`,
+			connection, model, e.Record.ID(), data, e.WriteDate, e.Active)
+	}
+	if err := s.db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to cache %s records: %w", model, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Retain(ctx context.Context, connection, model string, ids []int) (int, error) {
+	if ids == nil {
+		ids = []int{}
+	}
+	tag, err := s.db.Pool.Exec(ctx,
+		`DELETE FROM odoo_cache WHERE connection = $1 AND model = $2 AND NOT (id = ANY($3))`,
+		connection, model, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove deleted %s records: %w", model, err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *PostgresStore) Search(ctx context.Context, connection, model string, fields []string, term string, limit int) ([]odoo.Record, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	// Field names are parameters too, so the configuration can't inject SQL
+	args := []interface{}{connection, model, "%" + term + "%"}
+	var conditions []string
+	for _, f := range fields {
+		args = append(args, f)
+		conditions = append(conditions, fmt.Sprintf("data->>$%d ILIKE $3", len(args)))
+	}
+	if digits := onlyDigits(term); len(digits) >= minPhoneDigits {
+		args = append(args, "%"+digits+"%")
+		phoneArg := len(args)
+		for i := range fields {
+			conditions = append(conditions, fmt.Sprintf("regexp_replace(data->>$%d, '\\D', '', 'g') LIKE $%d", 4+i, phoneArg))
+		}
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT data FROM odoo_cache
+		WHERE connection = $1 AND model = $2 AND active AND (%s)
+		ORDER BY id LIMIT $%d`, strings.Join(conditions, " OR "), len(args))
+	rows, err := s.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search cached %s: %w", model, err)
+	}
+	defer rows.Close()
+
+	var records []odoo.Record
+	for rows.Next() {
+		var record odoo.Record
+		if err := rows.Scan(&record); err != nil {
+			return nil, fmt.Errorf("failed to read cached %s: %w", model, err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
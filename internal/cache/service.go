@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// pageSize is how many changed records are pulled per request
+const pageSize = 500
+
+// Cache mirrors Odoo models into a local store, pulling the records that
+// changed since the last sync, so lookups don't have to wait for Odoo
+type Cache struct {
+	// ReconcileEvery is how often records deleted in Odoo are removed,
+	// which needs the ids of every record
+	ReconcileEvery time.Duration
+
+	odoo       *odoo.Client
+	store      Store
+	connection string
+	models     map[string]Model
+	order      []string
+	now        func() time.Time
+}
+
+func New(client *odoo.Client, store Store, models []Model) *Cache {
+	c := &Cache{
+		ReconcileEvery: time.Hour,
+		odoo:           client,
+		store:          store,
+		connection:     client.Name,
+		models:         map[string]Model{},
+		now:            time.Now,
+	}
+	for _, m := range models {
+		c.models[m.Name] = m
+		c.order = append(c.order, m.Name)
+	}
+	return c
+}
+
+// Run syncs every model each interval until ctx is cancelled
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range c.order {
+			if err := c.Sync(ctx, name); err != nil {
+				log.Printf("Failed to sync %s cache: %v", name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync pulls the records of a model changed since the last sync, and
+// removes the deleted ones when it is time to reconcile
+func (c *Cache) Sync(ctx context.Context, name string) error {
+	m, ok := c.models[name]
+	if !ok {
+		return fmt.Errorf("%s is not cached", name)
+	}
+	state, err := c.store.State(ctx, c.connection, name)
+	if err != nil {
+		return err
+	}
+	started := c.now()
+
+	fields := append([]string{"write_date"}, m.Fields...)
+	var odooContext map[string]interface{}
+	if m.Archivable {
+		fields = append(fields, "active")
+		odooContext = map[string]interface{}{"active_test": false}
+	}
+
+	domain := append(odoo.Domain{}, m.Domain...)
+	if state.Cursor != "" {
+		// Records written in the same second as the cursor may not all have
+		// been seen, so they are pulled again
+		domain = append(domain, odoo.Cond("write_date", ">=", state.Cursor))
+	}
+
+	for offset := 0; ; offset += pageSize {
+		records, err := c.odoo.SearchRead(ctx, name, domain, fields,
+			&odoo.SearchOptions{Limit: pageSize, Offset: offset, Order: "write_date, id", Context: odooContext})
+		if err != nil {
+			return fmt.Errorf("failed to pull changed %s: %w", name, err)
+		}
+
+		entries := make([]Entry, len(records))
+		for i, r := range records {
+			entries[i] = Entry{Record: r, WriteDate: r.String("write_date"), Active: !m.Archivable || r.Bool("active")}
+			if entries[i].WriteDate > state.Cursor {
+				state.Cursor = entries[i].WriteDate
+			}
+		}
+		if len(entries) > 0 {
+			if err := c.store.Upsert(ctx, c.connection, name, entries); err != nil {
+				return err
+			}
+		}
+		if len(records) < pageSize {
+			break
+		}
+	}
+	state.SyncedAt = started
+
+	if c.now().Sub(state.ReconciledAt) >= c.ReconcileEvery {
+		var ids []int
+		kwargs := map[string]interface{}{}
+		if odooContext != nil {
+			kwargs["context"] = odooContext
+		}
+		if err := c.odoo.ExecuteKW(ctx, name, "search", []interface{}{append(odoo.Domain{}, m.Domain...)}, kwargs, &ids); err != nil {
+			return fmt.Errorf("failed to list %s ids: %w", name, err)
+		}
+		removed, err := c.store.Retain(ctx, c.connection, name, ids)
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			log.Printf("Removed %d deleted %s records from the cache", removed, name)
+		}
+		state.ReconciledAt = started
+	}
+
+	return c.store.SaveState(ctx, c.connection, name, state)
+}
+
+// Search looks up cached records of a model whose search fields contain
+// term, along with when they were synced
+func (c *Cache) Search(ctx context.Context, name, term string, limit int) (*Result, error) {
+	m, ok := c.models[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not cached", name)
+	}
+	state, err := c.store.State(ctx, c.connection, name)
+	if err != nil {
+		return nil, err
+	}
+	if state.SyncedAt.IsZero() {
+		return nil, fmt.Errorf("%s has not been synced yet", name)
+	}
+
+	records, err := c.store.Search(ctx, c.connection, name, m.SearchFields, term, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Records: records, SyncedAt: state.SyncedAt}, nil
+}
+
+// Accessible keeps the records the user of ctx may read in Odoo. The cache
+// holds what the service account sees, so the ids are checked against
+// Odoo as the user.
+func (c *Cache) Accessible(ctx context.Context, name string, records []odoo.Record) ([]odoo.Record, error) {
+	if len(records) == 0 {
+		return records, nil
+	}
+	ids := make([]int, len(records))
+	for i, r := range records {
+		ids[i] = r.ID()
+	}
+
+	var allowed []int
+	kwargs := map[string]interface{}{"context": map[string]interface{}{"active_test": false}}
+	if err := c.odoo.ExecuteKW(ctx, name, "search", []interface{}{odoo.Domain{odoo.Cond("id", "in", ids)}}, kwargs, &allowed); err != nil {
+		return nil, fmt.Errorf("failed to check access to %s: %w", name, err)
+	}
+	keep := make(map[int]bool, len(allowed))
+	for _, id := range allowed {
+		keep[id] = true
+	}
+
+	var visible []odoo.Record
+	for _, r := range records {
+		if keep[r.ID()] {
+			visible = append(visible, r)
+		}
+	}
+	return visible, nil
+}
+
+// Cached reports whether a model is in the cache
+func (c *Cache) Cached(name string) bool {
+	_, ok := c.models[name]
+	return ok
+}
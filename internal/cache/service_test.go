@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCache runs the cache against a recorder answering calls with the
+// results queued for "model.method", in turn
+func newTestCache(t *testing.T, results map[string][]interface{}) (*Cache, *MemoryStore, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, nil)
+	for key, queued := range results {
+		dot := strings.LastIndex(key, ".")
+		recorder.Queue(key[:dot], key[dot+1:], queued...)
+	}
+
+	store := NewMemoryStore()
+	cache := New(recorder.Client(), store, DefaultModels)
+	cache.now = func() time.Time { return time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC) }
+	return cache, store, recorder
+}
+
+func partner(id int, name, phone, writeDate string, active bool) map[string]interface{} {
+	return map[string]interface{}{"id": id, "display_name": name, "phone": phone, "write_date": writeDate, "active": active}
+}
+
+func TestSyncPullsChangesSinceCursor(t *testing.T) {
+	a := assert.New(t)
+	cache, store, recorder := newTestCache(t, map[string][]interface{}{
+		"res.partner.search_read": {
+			[]interface{}{
+				partner(3, "Azure Interior", "+65 9876 5432", "2025-03-10 09:00:00", true),
+				partner(4, "Deco Addict", "+65 9123 4567", "2025-03-11 10:30:00", true),
+			},
+			[]interface{}{
+				partner(4, "Deco Addict", "+65 9123 4567", "2025-03-12 08:00:00", false),
+			},
+		},
+		"res.partner.search": {[]int{3, 4}, []int{3}},
+	})
+	ctx := context.Background()
+
+	a.NoError(cache.Sync(ctx, "res.partner"))
+	state, _ := store.State(ctx, "test", "res.partner")
+	a.Equal("2025-03-11 10:30:00", state.Cursor)
+	a.Equal(cache.now(), state.SyncedAt)
+
+	first := recorder.Calls()[0]
+	a.Equal(map[string]interface{}{"active_test": false}, first.Kwargs["context"])
+	a.Equal([]interface{}{}, first.Args[0], "the first sync pulls everything")
+
+	// Deco Addict was archived
+	result, err := cache.Search(ctx, "res.partner", "deco", 5)
+	a.NoError(err)
+	a.Len(result.Records, 1)
+
+	cache.now = func() time.Time { return time.Date(2025, 3, 12, 9, 1, 0, 0, time.UTC) }
+	a.NoError(cache.Sync(ctx, "res.partner"))
+	second := recorder.Calls()[2]
+	a.Equal([]interface{}{[]interface{}{"write_date", ">=", "2025-03-11 10:30:00"}}, second.Args[0])
+	a.Len(recorder.Calls(), 3, "reconciling waits for ReconcileEvery")
+
+	result, err = cache.Search(ctx, "res.partner", "deco", 5)
+	a.NoError(err)
+	a.Empty(result.Records)
+	a.Equal(cache.now(), result.SyncedAt)
+}
+
+func TestSyncRemovesDeletedRecords(t *testing.T) {
+	a := assert.New(t)
+	cache, _, recorder := newTestCache(t, map[string][]interface{}{
+		"res.partner.search_read": {
+			[]interface{}{
+				partner(3, "Azure Interior", "+65 9876 5432", "2025-03-10 09:00:00", true),
+				partner(4, "Deco Addict", "+65 9123 4567", "2025-03-11 10:30:00", true),
+			},
+		},
+		// Deco Addict was deleted since
+		"res.partner.search": {[]int{3}},
+	})
+	ctx := context.Background()
+
+	a.NoError(cache.Sync(ctx, "res.partner"))
+	reconcile := recorder.Calls()[1]
+	a.Equal("search", reconcile.Method)
+
+	result, err := cache.Search(ctx, "res.partner", "9123 4567", 5)
+	a.NoError(err)
+	a.Empty(result.Records)
+
+	result, err = cache.Search(ctx, "res.partner", "6598765432", 5)
+	a.NoError(err)
+	a.Len(result.Records, 1, "phone numbers match on digits")
+}
+
+func TestSearchBeforeFirstSync(t *testing.T) {
+	a := assert.New(t)
+	cache, _, _ := newTestCache(t, nil)
+
+	_, err := cache.Search(context.Background(), "res.partner", "azure", 5)
+	a.ErrorContains(err, "not been synced")
+
+	_, err = cache.Search(context.Background(), "crm.lead", "azure", 5)
+	a.ErrorContains(err, "not cached")
+}
+
+func TestSyncWithFakeOdoo(t *testing.T) {
+	a := assert.New(t)
+	server := odootest.NewServer(t)
+	server.Now = func() time.Time { return time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC) }
+	server.Seed("res.partner",
+		odoo.Record{"id": 7, "name": "Azure Interior", "phone": "+65 9876 5432", "active": true},
+		odoo.Record{"id": 9, "name": "Deco Addict", "phone": "+65 9123 4567", "active": true},
+	)
+	store := NewMemoryStore()
+	cache := New(server.Client(), store, DefaultModels)
+	ctx := context.Background()
+
+	a.NoError(cache.Sync(ctx, "res.partner"))
+	result, err := cache.Search(ctx, "res.partner", "98765432", 5)
+	if a.NoError(err) && a.Len(result.Records, 1) {
+		a.Equal("Azure Interior", result.Records[0].String("display_name"))
+	}
+
+	// Archiving and deleting in Odoo reach the cache on the next sync
+	server.Now = func() time.Time { return time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC) }
+	a.NoError(server.Update("res.partner", 7, odoo.Record{"active": false, "write_date": "2025-03-11 09:00:00"}))
+	cache.ReconcileEvery = 0
+	a.NoError(server.Client().Unlink(ctx, "res.partner", []int{9}))
+	a.NoError(cache.Sync(ctx, "res.partner"))
+
+	for _, term := range []string{"azure", "deco"} {
+		result, err = cache.Search(ctx, "res.partner", term, 5)
+		a.NoError(err)
+		a.Empty(result.Records, term)
+	}
+}
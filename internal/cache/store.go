@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Store persists cached records and sync state, per connection and model
+type Store interface {
+	State(ctx context.Context, connection, model string) (State, error)
+	SaveState(ctx context.Context, connection, model string, state State) error
+	// Upsert adds or replaces records
+	Upsert(ctx context.Context, connection, model string, entries []Entry) error
+	// Retain removes the records whose ids are not in ids and returns how
+	// many were removed
+	Retain(ctx context.Context, connection, model string, ids []int) (int, error)
+	// Search returns active records where one of fields contains term
+	Search(ctx context.Context, connection, model string, fields []string, term string, limit int) ([]odoo.Record, error)
+}
+
+type storeKey struct {
+	connection string
+	model      string
+}
+
+// MemoryStore keeps the cache in memory, for tests and setups without a
+// database
+type MemoryStore struct {
+	mu      sync.Mutex
+	states  map[storeKey]State
+	entries map[storeKey]map[int]Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[storeKey]State{}, entries: map[storeKey]map[int]Entry{}}
+}
+
+func (s *MemoryStore) State(ctx context.Context, connection, model string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[storeKey{connection, model}], nil
+}
+
+func (s *MemoryStore) SaveState(ctx context.Context, connection, model string, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[storeKey{connection, model}] = state
+	return nil
+}
+
+func (s *MemoryStore) Upsert(ctx context.Context, connection, model string, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := storeKey{connection, model}
+	if s.entries[key] == nil {
+		s.entries[key] = map[int]Entry{}
+	}
+	for _, e := range entries {
+		s.entries[key][e.Record.ID()] = e
+	}
+	return nil
+}
+
+func (s *MemoryStore) Retain(ctx context.Context, connection, model string, ids []int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	var removed int
+	for id := range s.entries[storeKey{connection, model}] {
+		if !keep[id] {
+			delete(s.entries[storeKey{connection, model}], id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *MemoryStore) Search(ctx context.Context, connection, model string, fields []string, term string, limit int) ([]odoo.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []odoo.Record
+	for _, e := range s.entries[storeKey{connection, model}] {
+		if !e.Active {
+			continue
+		}
+		for _, f := range fields {
+			if matches(e.Record.String(f), term) {
+				records = append(records, e.Record)
+				break
+			}
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID() < records[j].ID() })
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// matches reports whether value contains term, ignoring case, or, for
+// phone numbers, ignoring everything but digits
+func matches(value, term string) bool {
+	if strings.Contains(strings.ToLower(value), strings.ToLower(term)) {
+		return true
+	}
+	digits := onlyDigits(term)
+	return len(digits) >= minPhoneDigits && strings.Contains(onlyDigits(value), digits)
+}
+
+// minPhoneDigits is the shortest term that is also matched as a phone number
+const minPhoneDigits = 6
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,23 @@
+package calendar
+
+import (
+	"time"
+)
+
+// Employee is an hr.employee that customers can meet, with the data needed
+// to compute their availability
+type Employee struct {
+	ID         int
+	Name       string
+	UserID     int
+	PartnerID  int
+	ResourceID int
+	CalendarID int
+	Location   *time.Location
+}
+
+// Slot is a free meeting slot of an employee
+type Slot struct {
+	Employee Employee
+	Start    time.Time
+}
@@ -0,0 +1,581 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+const (
+	// eventTag marks meetings booked over WhatsApp; only they get reminders
+	eventTag = "WhatsApp"
+	// remindedTag marks meetings whose reminders were sent, so they aren't
+	// sent again after a restart
+	remindedTag = "WhatsApp reminder sent"
+	// maxChoices is the number of rows a WhatsApp list message can hold
+	maxChoices = 10
+	// slotsPerDay spreads the offered slots over several days
+	slotsPerDay = 3
+	// minNotice keeps customers from booking a slot that starts right away
+	minNotice = time.Hour
+)
+
+var bookPattern = regexp.MustCompile(`(?i)^\s*(?:book|schedule|set\s+up|arrange)\s+(?:a\s+|an\s+)?(?:meeting|call|appointment)(?:\s+with\s+(.+?))?\s*[.!?]?\s*$`)
+
+// Service books meetings in the Odoo calendar over WhatsApp and reminds
+// attendees before they start
+type Service struct {
+	odoo   *odoo.Client
+	sender agent.Sender
+
+	// employees are the names of the employees customers meet by default
+	employees      []string
+	duration       time.Duration
+	days           int
+	reminderBefore time.Duration
+	reminder       string
+
+	// reminded holds the meetings reminded but not yet marked in Odoo
+	mu       sync.Mutex
+	reminded map[int]bool
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewService(client *odoo.Client, sender agent.Sender) *Service {
+	var employees []string
+	for _, name := range strings.Split(os.Getenv("MEETING_EMPLOYEES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			employees = append(employees, name)
+		}
+	}
+
+	days, err := strconv.Atoi(os.Getenv("MEETING_DAYS"))
+	if err != nil || days <= 0 {
+		days = 5
+	}
+	reminder := os.Getenv("MEETING_REMINDER_TEMPLATE")
+	if reminder == "" {
+		reminder = "meeting_reminder"
+	}
+
+	return &Service{
+		odoo:           client,
+		sender:         sender,
+		employees:      employees,
+		duration:       durationFromEnv("MEETING_DURATION", 30*time.Minute),
+		days:           days,
+		reminderBefore: durationFromEnv("MEETING_REMINDER_BEFORE", time.Hour),
+		reminder:       reminder,
+		reminded:       map[int]bool{},
+		now:            time.Now,
+	}
+}
+
+func (s *Service) Name() string {
+	return "calendar"
+}
+
+func (s *Service) Help() string {
+	return `"book a meeting" (optionally "with <name>") to schedule a meeting`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && bookPattern.MatchString(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	if msg.ReplyID != "" {
+		var employeeID int
+		var start int64
+		if _, err := fmt.Sscanf(msg.ReplyID, "calendar:slot:%d:%d", &employeeID, &start); err != nil {
+			return fmt.Errorf("invalid reply id %q: %w", msg.ReplyID, err)
+		}
+		return s.book(ctx, msg, employeeID, time.Unix(start, 0))
+	}
+
+	names := s.employees
+	if m := bookPattern.FindStringSubmatch(msg.Body); m != nil && m[1] != "" {
+		names = []string{m[1]}
+	}
+	employees, err := s.findEmployees(ctx, names)
+	if err != nil {
+		return err
+	}
+	if len(employees) == 0 {
+		if len(names) == 1 && names[0] != "" {
+			return s.send(ctx, msg.SenderID, fmt.Sprintf("I couldn't find anyone called \"%s\" to meet.", names[0]))
+		}
+		return s.send(ctx, msg.SenderID, "Sorry, there's nobody available to meet right now.")
+	}
+
+	var slots []Slot
+	for _, e := range employees {
+		employeeSlots, err := s.FreeSlots(ctx, e, s.now().Add(minNotice), s.now().AddDate(0, 0, s.days))
+		if err != nil {
+			return err
+		}
+		for _, start := range employeeSlots {
+			slots = append(slots, Slot{Employee: e, Start: start})
+		}
+	}
+	return s.sendSlots(ctx, msg.SenderID, slots, len(employees) > 1)
+}
+
+// FreeSlots returns the employee's free slots between from and to according
+// to their working hours, leaves and calendar events
+func (s *Service) FreeSlots(ctx context.Context, e Employee, from, to time.Time) ([]time.Time, error) {
+	attendances, err := s.attendances(ctx, e.CalendarID)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := s.busy(ctx, e, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	all := FreeSlots(from, to, e.Location, attendances, busy, s.duration)
+
+	// Keep the earliest few slots of each day
+	var slots []time.Time
+	perDay := map[string]int{}
+	for _, slot := range all {
+		day := slot.Format("2006-01-02")
+		if perDay[day] < slotsPerDay {
+			perDay[day]++
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// book creates the meeting for a selected slot if it is still free
+func (s *Service) book(ctx context.Context, msg whatsapp.WebhookMessage, employeeID int, start time.Time) error {
+	employees, err := s.employeesByDomain(ctx, odoo.Domain{odoo.Cond("id", "=", employeeID)})
+	if err != nil {
+		return err
+	}
+	if len(employees) == 0 {
+		return s.send(ctx, msg.SenderID, "Sorry, that person is no longer available for meetings.")
+	}
+	e := employees[0]
+	end := start.Add(s.duration)
+
+	busy, err := s.busy(ctx, e, start, end)
+	if err != nil {
+		return err
+	}
+	if isBusy(busy, start, end) {
+		return s.send(ctx, msg.SenderID, "Sorry, that slot was just taken. Send \"book a meeting\" to see the remaining ones.")
+	}
+
+	partnerID, partnerName, err := s.findOrCreatePartner(ctx, msg)
+	if err != nil {
+		return err
+	}
+	tagID, err := s.findOrCreateTag(ctx, eventTag)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.odoo.Create(ctx, "calendar.event", map[string]interface{}{
+		"name":        fmt.Sprintf("Meeting with %s", partnerName),
+		"start":       start.UTC().Format(odoo.DatetimeFormat),
+		"stop":        end.UTC().Format(odoo.DatetimeFormat),
+		"user_id":     e.UserID,
+		"partner_ids": []interface{}{[]interface{}{6, 0, []int{partnerID, e.PartnerID}}},
+		"categ_ids":   []interface{}{[]interface{}{6, 0, []int{tagID}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create meeting: %w", err)
+	}
+
+	local := start.In(e.Location)
+	return s.send(ctx, msg.SenderID, fmt.Sprintf("✅ Your meeting with %s is booked for %s at %s (%s).\nI'll remind you %s before.",
+		e.Name, local.Format("Mon 2 Jan"), local.Format("15:04"), e.Location, formatDuration(s.reminderBefore)))
+}
+
+// Run sends reminders for upcoming WhatsApp meetings until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SendReminders(ctx); err != nil {
+				log.Printf("Failed to send meeting reminders: %v", err)
+			}
+		}
+	}
+}
+
+// SendReminders sends the reminder template to the external attendees of
+// WhatsApp meetings starting within the reminder period
+func (s *Service) SendReminders(ctx context.Context) error {
+	remindedID, err := s.findOrCreateTag(ctx, remindedTag)
+	if err != nil {
+		return err
+	}
+
+	now := s.now().UTC()
+	events, err := s.odoo.SearchRead(ctx, "calendar.event", odoo.Domain{
+		odoo.Cond("categ_ids.name", "=", eventTag),
+		odoo.Cond("categ_ids", "not in", []int{remindedID}),
+		odoo.Cond("start", ">", now.Format(odoo.DatetimeFormat)),
+		odoo.Cond("start", "<=", now.Add(s.reminderBefore).Format(odoo.DatetimeFormat)),
+	}, []string{"name", "start", "partner_ids", "user_id"}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to search meetings: %w", err)
+	}
+
+	for _, event := range events {
+		if s.isReminded(event.ID()) {
+			continue
+		}
+
+		start, err := time.Parse(odoo.DatetimeFormat, event.String("start"))
+		if err != nil {
+			return fmt.Errorf("invalid start of meeting %d: %w", event.ID(), err)
+		}
+		_, organizer := event.Many2one("user_id")
+
+		// Internal users are reminded by Odoo itself
+		partners, err := s.odoo.SearchRead(ctx, "res.partner", odoo.Domain{
+			odoo.Cond("id", "in", event.IDs("partner_ids")),
+			odoo.Cond("user_ids", "=", false),
+		}, []string{"name", "phone", "mobile", "tz"}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to read attendees: %w", err)
+		}
+
+		for _, p := range partners {
+			phone := p.String("mobile")
+			if phone == "" {
+				phone = p.String("phone")
+			}
+			if phone == "" {
+				continue
+			}
+
+			location, err := time.LoadLocation(p.String("tz"))
+			if err != nil {
+				location = time.UTC
+			}
+			local := start.In(location)
+
+			_, err = s.sender.SendTemplate(ctx, whatsapp.TemplateMessage{
+				To:   phone,
+				Name: s.reminder,
+				BodyParameters: []string{
+					p.String("name"),
+					organizer,
+					local.Format("Mon 2 Jan 15:04 MST"),
+				},
+			})
+			if err != nil {
+				log.Printf("Failed to remind %s of meeting %d: %v", p.String("name"), event.ID(), err)
+			}
+		}
+		s.setReminded(event.ID(), true)
+
+		err = s.odoo.Write(ctx, "calendar.event", []int{event.ID()}, map[string]interface{}{
+			"categ_ids": []interface{}{[]interface{}{4, remindedID}},
+		})
+		if err != nil {
+			log.Printf("Failed to mark meeting %d as reminded: %v", event.ID(), err)
+			continue
+		}
+		s.setReminded(event.ID(), false)
+	}
+	return nil
+}
+
+func (s *Service) sendSlots(ctx context.Context, to string, slots []Slot, showEmployee bool) error {
+	if len(slots) == 0 {
+		return s.send(ctx, to, fmt.Sprintf("Sorry, there are no free slots in the next %d days.", s.days))
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	if len(slots) > maxChoices {
+		slots = slots[:maxChoices]
+	}
+
+	var sections []whatsapp.ListSection
+	for _, slot := range slots {
+		local := slot.Start.In(slot.Employee.Location)
+		day := local.Format("Mon 2 Jan")
+		if len(sections) == 0 || sections[len(sections)-1].Title != day {
+			sections = append(sections, whatsapp.ListSection{Title: day})
+		}
+
+		row := whatsapp.ListRow{
+			ID:    fmt.Sprintf("calendar:slot:%d:%d", slot.Employee.ID, slot.Start.Unix()),
+			Title: fmt.Sprintf("%s – %s", local.Format("15:04"), local.Add(s.duration).Format("15:04")),
+		}
+		if showEmployee {
+			row.Description = "with " + slot.Employee.Name
+		}
+		sections[len(sections)-1].Rows = append(sections[len(sections)-1].Rows, row)
+	}
+
+	_, err := s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     fmt.Sprintf("Here are the next free slots (%s, %s). Which one suits you?", formatDuration(s.duration), slots[0].Employee.Location),
+		Button:   "Choose a slot",
+		Sections: sections,
+	})
+	return err
+}
+
+func (s *Service) findEmployees(ctx context.Context, names []string) ([]Employee, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	domain := odoo.Domain{}
+	for i := 1; i < len(names); i++ {
+		domain = append(domain, "|")
+	}
+	for _, name := range names {
+		domain = append(domain, odoo.Cond("name", "ilike", name))
+	}
+	return s.employeesByDomain(ctx, domain)
+}
+
+// employeesByDomain reads employees with the user partner and calendar
+// needed for scheduling; employees without a user can't attend meetings
+func (s *Service) employeesByDomain(ctx context.Context, domain odoo.Domain) ([]Employee, error) {
+	domain = append(domain, odoo.Cond("user_id", "!=", false), odoo.Cond("resource_calendar_id", "!=", false))
+	records, err := s.odoo.SearchRead(ctx, "hr.employee", domain,
+		[]string{"name", "user_id", "resource_id", "resource_calendar_id", "tz"}, &odoo.SearchOptions{Limit: maxChoices})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search employees: %w", err)
+	}
+
+	// The partners of all the employees' users are read at once
+	userIDs := make([]int, 0, len(records))
+	for _, r := range records {
+		userID, _ := r.Many2one("user_id")
+		userIDs = append(userIDs, userID)
+	}
+	users, err := s.odoo.Read(ctx, "res.users", userIDs, []string{"partner_id"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	partners := make(map[int]int, len(users))
+	for _, u := range users {
+		partners[u.ID()], _ = u.Many2one("partner_id")
+	}
+
+	employees := make([]Employee, 0, len(records))
+	for _, r := range records {
+		userID, _ := r.Many2one("user_id")
+		resourceID, _ := r.Many2one("resource_id")
+		calendarID, _ := r.Many2one("resource_calendar_id")
+
+		partnerID, ok := partners[userID]
+		if !ok {
+			continue
+		}
+
+		location, err := time.LoadLocation(r.String("tz"))
+		if err != nil {
+			location = time.UTC
+		}
+
+		employees = append(employees, Employee{
+			ID:         r.ID(),
+			Name:       r.String("name"),
+			UserID:     userID,
+			PartnerID:  partnerID,
+			ResourceID: resourceID,
+			CalendarID: calendarID,
+			Location:   location,
+		})
+	}
+	return employees, nil
+}
+
+func (s *Service) attendances(ctx context.Context, calendarID int) ([]Attendance, error) {
+	records, err := s.odoo.SearchRead(ctx, "resource.calendar.attendance", odoo.Domain{
+		odoo.Cond("calendar_id", "=", calendarID),
+		odoo.Cond("display_type", "=", false),
+	}, []string{"dayofweek", "hour_from", "hour_to"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read working hours: %w", err)
+	}
+
+	attendances := make([]Attendance, 0, len(records))
+	for _, r := range records {
+		// Odoo numbers days from Monday = "0"
+		day, err := strconv.Atoi(r.String("dayofweek"))
+		if err != nil {
+			continue
+		}
+		attendances = append(attendances, Attendance{
+			Weekday:  time.Weekday((day + 1) % 7),
+			HourFrom: r.Float("hour_from"),
+			HourTo:   r.Float("hour_to"),
+		})
+	}
+	return attendances, nil
+}
+
+// busy returns the employee's meetings and leaves overlapping from-to
+func (s *Service) busy(ctx context.Context, e Employee, from, to time.Time) ([]Interval, error) {
+	start, stop := from.UTC().Format(odoo.DatetimeFormat), to.UTC().Format(odoo.DatetimeFormat)
+
+	events, err := s.odoo.SearchRead(ctx, "calendar.event", odoo.Domain{
+		odoo.Cond("partner_ids", "in", []int{e.PartnerID}),
+		odoo.Cond("show_as", "=", "busy"),
+		odoo.Cond("start", "<", stop),
+		odoo.Cond("stop", ">", start),
+	}, []string{"start", "stop", "allday"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search meetings: %w", err)
+	}
+
+	// Leaves of the employee and public holidays of their calendar
+	leaves, err := s.odoo.SearchRead(ctx, "resource.calendar.leaves", odoo.Domain{
+		"|",
+		odoo.Cond("resource_id", "=", e.ResourceID),
+		"&",
+		odoo.Cond("resource_id", "=", false),
+		odoo.Cond("calendar_id", "in", []interface{}{e.CalendarID, false}),
+		odoo.Cond("date_from", "<", stop),
+		odoo.Cond("date_to", ">", start),
+	}, []string{"date_from", "date_to"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search leaves: %w", err)
+	}
+
+	var busy []Interval
+	for _, ev := range events {
+		interval, ok := parseInterval(ev.String("start"), ev.String("stop"))
+		if !ok {
+			continue
+		}
+		if ev.Bool("allday") {
+			// All-day events span whole days in the employee's timezone
+			day := interval.Start
+			interval.Start = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, e.Location)
+			interval.End = time.Date(interval.End.Year(), interval.End.Month(), interval.End.Day(), 0, 0, 0, 0, e.Location).AddDate(0, 0, 1)
+		}
+		busy = append(busy, interval)
+	}
+	for _, l := range leaves {
+		if interval, ok := parseInterval(l.String("date_from"), l.String("date_to")); ok {
+			busy = append(busy, interval)
+		}
+	}
+	return busy, nil
+}
+
+// findOrCreatePartner returns the contact booking the meeting, creating one
+// for numbers Odoo doesn't know yet
+func (s *Service) findOrCreatePartner(ctx context.Context, msg whatsapp.WebhookMessage) (int, string, error) {
+	partner, err := s.odoo.PartnerByPhone(ctx, msg.SenderID, []string{"name"})
+	if err != nil {
+		return 0, "", err
+	}
+	if partner != nil {
+		return partner.ID(), partner.String("name"), nil
+	}
+
+	name := msg.SenderName
+	if name == "" {
+		name = odoo.E164(msg.SenderID)
+	}
+	id, err := s.odoo.Create(ctx, "res.partner", map[string]interface{}{
+		"name":  name,
+		"phone": odoo.E164(msg.SenderID),
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create partner: %w", err)
+	}
+	return id, name, nil
+}
+
+func (s *Service) findOrCreateTag(ctx context.Context, name string) (int, error) {
+	tags, err := s.odoo.SearchRead(ctx, "calendar.event.type", odoo.Domain{odoo.Cond("name", "=", name)},
+		[]string{"id"}, &odoo.SearchOptions{Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to search meeting tag: %w", err)
+	}
+	if len(tags) > 0 {
+		return tags[0].ID(), nil
+	}
+
+	id, err := s.odoo.Create(ctx, "calendar.event.type", map[string]interface{}{"name": name})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create meeting tag: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Service) isReminded(eventID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reminded[eventID]
+}
+
+func (s *Service) setReminded(eventID int, reminded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reminded {
+		s.reminded[eventID] = true
+	} else {
+		delete(s.reminded, eventID)
+	}
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+func parseInterval(from, to string) (Interval, bool) {
+	start, err := time.Parse(odoo.DatetimeFormat, from)
+	if err != nil {
+		return Interval{}, false
+	}
+	end, err := time.Parse(odoo.DatetimeFormat, to)
+	if err != nil {
+		return Interval{}, false
+	}
+	return Interval{Start: start, End: end}, true
+}
+
+// formatDuration prints durations the way people say them, e.g. "30 minutes"
+func formatDuration(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "1 hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
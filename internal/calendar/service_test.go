@@ -0,0 +1,136 @@
+package calendar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{}
+	service := NewService(recorder.Client(), sender)
+	// Monday 10 March 2025, 08:00 in Singapore
+	service.now = func() time.Time { return time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC) }
+	return service, sender, recorder
+}
+
+var employeeResults = map[string]interface{}{
+	"hr.employee.search_read": []map[string]interface{}{{
+		"id":                   5,
+		"name":                 "Marc Demo",
+		"user_id":              []interface{}{6, "Marc Demo"},
+		"resource_id":          []interface{}{7, "Marc Demo"},
+		"resource_calendar_id": []interface{}{1, "Standard 40 hours/week"},
+		"tz":                   "Asia/Singapore",
+	}},
+	"res.users.read": []map[string]interface{}{{"id": 6, "partner_id": []interface{}{30, "Marc Demo"}}},
+}
+
+func TestHandleOffersSlots(t *testing.T) {
+	a := assert.New(t)
+	results := map[string]interface{}{
+		"resource.calendar.attendance.search_read": []map[string]interface{}{
+			{"dayofweek": "0", "hour_from": 9.0, "hour_to": 10.0},
+			{"dayofweek": "1", "hour_from": 9.0, "hour_to": 12.0},
+		},
+		// Busy on Monday 09:00-09:30 Singapore time
+		"calendar.event.search_read": []map[string]interface{}{{"start": "2025-03-10 01:00:00", "stop": "2025-03-10 01:30:00", "allday": false}},
+	}
+	for k, v := range employeeResults {
+		results[k] = v
+	}
+	service, sender, _ := newTestService(t, results)
+
+	msg := whatsapp.WebhookMessage{SenderID: "6598765432", Type: "text", Body: "Book a meeting with Marc"}
+	a.True(service.Match(msg))
+	a.NoError(service.Handle(context.Background(), msg))
+
+	if a.Len(sender.Lists, 1) {
+		sections := sender.Lists[0].Sections
+		if a.Len(sections, 2) {
+			a.Equal("Mon 10 Mar", sections[0].Title)
+			a.Equal([]whatsapp.ListRow{{ID: "calendar:slot:5:1741570200", Title: "09:30 – 10:00"}}, sections[0].Rows)
+			a.Equal("Tue 11 Mar", sections[1].Title)
+			a.Len(sections[1].Rows, slotsPerDay)
+		}
+	}
+}
+
+func TestHandleBooksSlot(t *testing.T) {
+	a := assert.New(t)
+	results := map[string]interface{}{
+		"res.partner.search_read":         []map[string]interface{}{{"id": 44, "name": "Jane Tan"}},
+		"calendar.event.type.search_read": []map[string]interface{}{{"id": 3}},
+		"calendar.event.create":           90,
+	}
+	for k, v := range employeeResults {
+		results[k] = v
+	}
+	service, sender, recorder := newTestService(t, results)
+
+	err := service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6598765432",
+		Type:     "interactive",
+		ReplyID:  "calendar:slot:5:1741570200",
+	})
+
+	a.NoError(err)
+	calls := recorder.Calls()
+	create := calls[len(calls)-1]
+	if a.Equal("calendar.event", create.Model) && a.Equal("create", create.Method) {
+		values := create.Args[0].(map[string]interface{})
+		a.Equal("Meeting with Jane Tan", values["name"])
+		a.Equal("2025-03-10 01:30:00", values["start"])
+		a.Equal("2025-03-10 02:00:00", values["stop"])
+		a.Equal([]interface{}{[]interface{}{float64(6), float64(0), []interface{}{float64(44), float64(30)}}}, values["partner_ids"])
+	}
+	a.Equal("✅ Your meeting with Marc Demo is booked for Mon 10 Mar at 09:30 (Asia/Singapore).\nI'll remind you 1 hour before.", sender.LastText())
+}
+
+func TestSendReminders(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"calendar.event.search_read": []map[string]interface{}{{
+			"id": 90, "name": "Meeting with Jane Tan", "start": "2025-03-10 00:30:00",
+			"partner_ids": []interface{}{44, 30}, "user_id": []interface{}{6, "Marc Demo"},
+		}},
+		"res.partner.search_read":         []map[string]interface{}{{"id": 44, "name": "Jane Tan", "mobile": "+65 9876 5432", "tz": "Asia/Singapore"}},
+		"calendar.event.type.search_read": []map[string]interface{}{{"id": 4}},
+		"calendar.event.write":            true,
+	})
+
+	a.NoError(service.SendReminders(context.Background()))
+
+	// Reminded meetings are tagged in Odoo and left out of later searches
+	var searched, marked bool
+	for _, c := range recorder.Calls() {
+		switch {
+		case c.Model == "calendar.event" && c.Method == "search_read":
+			searched = true
+			a.Contains(c.Args[0], []interface{}{"categ_ids", "not in", []interface{}{float64(4)}})
+		case c.Model == "calendar.event" && c.Method == "write":
+			marked = true
+			a.Equal([]interface{}{float64(90)}, c.Args[0])
+			a.Equal(map[string]interface{}{"categ_ids": []interface{}{[]interface{}{float64(4), float64(4)}}}, c.Args[1])
+		}
+	}
+	a.True(searched)
+	a.True(marked)
+
+	if a.Len(sender.Templates, 1) {
+		a.Equal(whatsapp.TemplateMessage{
+			To:             "+65 9876 5432",
+			Name:           "meeting_reminder",
+			BodyParameters: []string{"Jane Tan", "Marc Demo", "Mon 10 Mar 08:30 +08"},
+		}, sender.Templates[0])
+	}
+}
@@ -0,0 +1,69 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+)
+
+// Attendance is a working period of a resource calendar, in the calendar's
+// timezone, e.g. Monday from 8.0 to 12.0
+type Attendance struct {
+	Weekday  time.Weekday
+	HourFrom float64
+	HourTo   float64
+}
+
+// Interval is a period of time, typically a meeting or a leave
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (i Interval) overlaps(start, end time.Time) bool {
+	return i.Start.Before(end) && i.End.After(start)
+}
+
+// FreeSlots returns the start of every slot of the given duration between
+// from and to that lies within working hours and doesn't overlap busy time.
+// Slots are aligned on the start of each working period.
+func FreeSlots(from, to time.Time, loc *time.Location, attendances []Attendance, busy []Interval, duration time.Duration) []time.Time {
+	var slots []time.Time
+
+	first := from.In(loc)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, a := range attendances {
+			if a.Weekday != day.Weekday() {
+				continue
+			}
+			periodEnd := clock(day, a.HourTo)
+			for start := clock(day, a.HourFrom); !start.Add(duration).After(periodEnd); start = start.Add(duration) {
+				end := start.Add(duration)
+				if start.Before(from) || end.After(to) || isBusy(busy, start, end) {
+					continue
+				}
+				slots = append(slots, start)
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+	return slots
+}
+
+func isBusy(busy []Interval, start, end time.Time) bool {
+	for _, b := range busy {
+		if b.overlaps(start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// clock returns the time of day of Odoo's float hours, e.g. 13.5 for 13:30,
+// on day in its location. Adding hours to midnight would be an hour off on
+// the days clocks change.
+func clock(day time.Time, h float64) time.Time {
+	minutes := int(h*60 + 0.5)
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
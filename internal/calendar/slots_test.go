@@ -0,0 +1,58 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeSlots(t *testing.T) {
+	a := assert.New(t)
+	singapore, _ := time.LoadLocation("Asia/Singapore")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 3, day, hour, minute, 0, 0, singapore)
+	}
+
+	// Monday 10 March 09:15 until Tuesday evening
+	from, to := at(10, 9, 15), at(11, 23, 0)
+	attendances := []Attendance{
+		{Weekday: time.Monday, HourFrom: 9, HourTo: 12},
+		{Weekday: time.Monday, HourFrom: 13, HourTo: 14},
+		{Weekday: time.Tuesday, HourFrom: 9, HourTo: 10.5},
+	}
+	busy := []Interval{
+		{Start: at(10, 10, 0), End: at(10, 11, 0)},
+		// A leave covering Tuesday morning from 10:00, expressed in UTC
+		{Start: at(11, 10, 0).UTC(), End: at(11, 12, 0).UTC()},
+	}
+
+	slots := FreeSlots(from, to, singapore, attendances, busy, 30*time.Minute)
+
+	a.Equal([]time.Time{
+		at(10, 9, 30),
+		at(10, 11, 0), at(10, 11, 30),
+		at(10, 13, 0), at(10, 13, 30),
+		at(11, 9, 0), at(11, 9, 30),
+	}, slots)
+}
+
+func TestFreeSlotsOnDSTDay(t *testing.T) {
+	a := assert.New(t)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if !a.NoError(err) {
+		return
+	}
+
+	// Clocks go forward on Sunday 30 March 2025, working hours stay 9 to 10
+	from := time.Date(2025, 3, 30, 0, 0, 0, 0, berlin)
+	to := time.Date(2025, 3, 31, 0, 0, 0, 0, berlin)
+	attendances := []Attendance{{Weekday: time.Sunday, HourFrom: 9, HourTo: 10}}
+
+	slots := FreeSlots(from, to, berlin, attendances, nil, 30*time.Minute)
+
+	a.Equal([]time.Time{
+		time.Date(2025, 3, 30, 9, 0, 0, 0, berlin),
+		time.Date(2025, 3, 30, 9, 30, 0, 0, berlin),
+	}, slots)
+}
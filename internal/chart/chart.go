@@ -0,0 +1,313 @@
+// Package chart draws bar, line and pie charts of aggregated Odoo figures
+// as PNG images small enough to send over WhatsApp
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind is the shape of a chart
+type Kind string
+
+const (
+	Bar  Kind = "bar"
+	Line Kind = "line"
+	Pie  Kind = "pie"
+)
+
+// ParseKind reads a kind of chart, e.g. from a digest section
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(strings.ToLower(s)); k {
+	case Bar, Line, Pie:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown chart %q, expected bar, line or pie", s)
+}
+
+// Point is a labelled figure, such as one read_group group
+type Point struct {
+	Label string
+	Value float64
+}
+
+// Chart is a series of figures drawn as one kind of chart
+type Chart struct {
+	Kind   Kind
+	Title  string
+	Points []Point
+	// Format renders the figures shown next to bars and in the legend of
+	// pies. It defaults to the figure with up to two decimals.
+	Format func(float64) string
+}
+
+const (
+	width = 800
+	// scale is the size of a font pixel in labels, and titleScale in titles
+	scale      = 2
+	titleScale = 3
+	margin     = 24
+	// plotTop is where charts start, below their title
+	plotTop = 2*margin + glyphHeight*titleScale
+	// maxPoints is the number of points drawn, the others being merged into
+	// an "Other" point on bar and pie charts
+	maxPoints = 20
+	// maxSlices is the number of slices of a pie
+	maxSlices = 8
+)
+
+var (
+	background = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	ink        = color.RGBA{0x33, 0x33, 0x33, 0xFF}
+	grey       = color.RGBA{0x77, 0x77, 0x77, 0xFF}
+	grid       = color.RGBA{0xE0, 0xE0, 0xE0, 0xFF}
+	// palette colors bars, lines and slices, starting with Odoo's purple
+	palette = []color.RGBA{
+		{0x71, 0x4B, 0x67, 0xFF}, {0x01, 0x7E, 0x84, 0xFF}, {0xE4, 0x6F, 0x37, 0xFF}, {0x3C, 0x8D, 0xBC, 0xFF},
+		{0x8E, 0xB0, 0x21, 0xFF}, {0xD8, 0x45, 0x5C, 0xFF}, {0xF2, 0xB7, 0x05, 0xFF}, {0x99, 0x99, 0x99, 0xFF},
+	}
+)
+
+// PNG draws the chart and encodes it as a PNG image
+func (c *Chart) PNG() ([]byte, error) {
+	if len(c.Points) == 0 {
+		return nil, fmt.Errorf("chart %q has no figures", c.Title)
+	}
+
+	var img *image.RGBA
+	switch c.Kind {
+	case Line:
+		img = c.line()
+	case Pie:
+		img = c.pie()
+	default:
+		img = c.bar()
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// canvas creates an image of the chart's width with its title drawn
+func (c *Chart) canvas(height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fill(img, img.Bounds(), background)
+	title := fitText(c.Title, width-2*margin, titleScale)
+	drawText(img, (width-textWidth(title, titleScale))/2, margin, title, titleScale, ink)
+	return img
+}
+
+func (c *Chart) format(v float64) string {
+	if c.Format != nil {
+		return c.Format(v)
+	}
+	return round(v)
+}
+
+// bar draws horizontal bars, which leave room for long labels such as
+// customer names
+func (c *Chart) bar() *image.RGBA {
+	points := merge(c.Points, maxPoints)
+	const rowHeight = 32
+	const barHeight = 22
+
+	labels := make([]string, len(points))
+	values := make([]string, len(points))
+	labelWidth, valueWidth := 0, 0
+	for i, p := range points {
+		labels[i] = fitText(p.Label, width/3, scale)
+		values[i] = c.format(p.Value)
+		labelWidth = max(labelWidth, textWidth(labels[i], scale))
+		valueWidth = max(valueWidth, textWidth(values[i], scale))
+	}
+
+	top := plotTop
+	img := c.canvas(top + len(points)*rowHeight + margin)
+	left := margin + labelWidth + margin/2
+	right := width - margin - valueWidth - margin/2
+	low, high := bounds(points)
+	x := func(v float64) int { return left + int(math.Round((v-low)/(high-low)*float64(right-left))) }
+
+	zero := x(0)
+	fill(img, image.Rect(zero, top-margin/2, zero+1, top+len(points)*rowHeight), grid)
+	textHeight := glyphHeight * scale
+	for i, p := range points {
+		y := top + i*rowHeight
+		drawText(img, left-margin/2-textWidth(labels[i], scale), y+(barHeight-textHeight)/2, labels[i], scale, ink)
+		end := x(p.Value)
+		fill(img, image.Rect(min(zero, end), y, max(zero, end), y+barHeight), palette[0])
+		drawText(img, max(zero, end)+margin/2, y+(barHeight-textHeight)/2, values[i], scale, ink)
+	}
+	return img
+}
+
+// line draws the points in order, as periods are
+func (c *Chart) line() *image.RGBA {
+	points := c.Points
+	const height = 480
+	top := plotTop
+	img := c.canvas(height)
+	bottom := height - margin - glyphHeight*scale - margin/2
+
+	low, high := bounds(points)
+	step := niceStep((high - low) / 4)
+	low, high = math.Floor(low/step)*step, math.Ceil(high/step)*step
+	if high == low {
+		high = low + step
+	}
+
+	// Ticks on the left, with the widest label setting the plot's left edge
+	var ticks []float64
+	for i := 0; low+float64(i)*step <= high+step/2; i++ {
+		ticks = append(ticks, low+float64(i)*step)
+	}
+	labelWidth := 0
+	for _, v := range ticks {
+		labelWidth = max(labelWidth, textWidth(short(v), scale))
+	}
+	left, right := margin+labelWidth+margin/2, width-margin
+	y := func(v float64) int { return bottom - int(math.Round((v-low)/(high-low)*float64(bottom-top))) }
+	for _, v := range ticks {
+		fill(img, image.Rect(left, y(v), right, y(v)+1), grid)
+		label := short(v)
+		drawText(img, left-margin/2-textWidth(label, scale), y(v)-glyphHeight*scale/2, label, scale, ink)
+	}
+
+	x := func(i int) int {
+		if len(points) == 1 {
+			return (left + right) / 2
+		}
+		return left + i*(right-left)/(len(points)-1)
+	}
+	// Label as many points as fit under the axis
+	widest := 0
+	for _, p := range points {
+		widest = max(widest, textWidth(p.Label, scale))
+	}
+	labelEvery := (widest+margin/2)*len(points)/(right-left) + 1
+	for i, p := range points {
+		if i > 0 {
+			drawLine(img, x(i-1), y(points[i-1].Value), x(i), y(p.Value), 3, palette[0])
+		}
+		if i%labelEvery == 0 {
+			label := fitText(p.Label, (right-left)/len(points)*labelEvery, scale)
+			lx := min(max(x(i)-textWidth(label, scale)/2, margin/2), width-margin/2-textWidth(label, scale))
+			drawText(img, lx, bottom+margin/2, label, scale, ink)
+		}
+	}
+	for i, p := range points {
+		fillCircle(img, x(i), y(p.Value), 5, palette[0])
+	}
+	return img
+}
+
+// pie draws the share of each point, largest first, with a legend
+func (c *Chart) pie() *image.RGBA {
+	var points []Point
+	for _, p := range c.Points {
+		if p.Value > 0 {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		// Only positive figures have a share
+		return c.bar()
+	}
+	points = merge(points, maxSlices)
+	var total float64
+	for _, p := range points {
+		total += p.Value
+	}
+
+	const radius = 170
+	const rowHeight = 44
+	top := plotTop
+	img := c.canvas(top + max(2*radius, len(points)*rowHeight) + margin)
+	cx, cy := margin+radius, top+radius
+
+	// Slices start at 12 o'clock and go clockwise
+	var start float64
+	for i, p := range points {
+		end := start + p.Value/total*2*math.Pi
+		fillSlice(img, cx, cy, radius, start, end, palette[i%len(palette)])
+		start = end
+	}
+
+	left := cx + radius + 2*margin
+	for i, p := range points {
+		y := top + i*rowHeight
+		fill(img, image.Rect(left, y, left+glyphHeight*scale, y+glyphHeight*scale), palette[i%len(palette)])
+		drawText(img, left+margin, y, fitText(p.Label, width-margin-left-margin, scale), scale, ink)
+		share := fmt.Sprintf("%s (%.0f%%)", c.format(p.Value), p.Value/total*100)
+		drawText(img, left+margin, y+glyphHeight*scale+4, share, scale, grey)
+	}
+	return img
+}
+
+// merge keeps the first n-1 points and adds the others up as "Other" when
+// there are more than n
+func merge(points []Point, n int) []Point {
+	if len(points) <= n {
+		return points
+	}
+	merged := append([]Point{}, points[:n-1]...)
+	other := Point{Label: fmt.Sprintf("Other (%d)", len(points)-n+1)}
+	for _, p := range points[n-1:] {
+		other.Value += p.Value
+	}
+	return append(merged, other)
+}
+
+// bounds returns the range of values, zero included
+func bounds(points []Point) (float64, float64) {
+	var low, high float64
+	for _, p := range points {
+		low, high = math.Min(low, p.Value), math.Max(high, p.Value)
+	}
+	if low == high {
+		high = low + 1
+	}
+	return low, high
+}
+
+// niceStep rounds a step between ticks up to 1, 2 or 5 times a power of ten
+func niceStep(step float64) float64 {
+	if step <= 0 {
+		return 1
+	}
+	power := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if step <= m*power {
+			return m * power
+		}
+	}
+	return 10 * power
+}
+
+// short renders a tick compactly, e.g. 1.5k or 2M
+func short(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e9:
+		return round(v/1e9) + "B"
+	case abs >= 1e6:
+		return round(v/1e6) + "M"
+	case abs >= 1e3:
+		return round(v/1e3) + "k"
+	}
+	return round(v)
+}
+
+// round renders v with up to two decimals
+func round(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
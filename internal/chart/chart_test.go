@@ -0,0 +1,73 @@
+package chart
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPNG(t *testing.T) {
+	a := assert.New(t)
+	points := []Point{{"Mitchell Admin", 12800}, {"Marc Demo", 2500.5}, {"Société Générale", 7300}, {"None", -400}}
+
+	for _, kind := range []Kind{Bar, Line, Pie} {
+		c := &Chart{Kind: kind, Title: "Sales this month by salesperson", Points: points}
+		data, err := c.PNG()
+		if !a.NoError(err, kind) {
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if a.NoError(err, kind) {
+			a.Equal(width, img.Bounds().Dx(), kind)
+			a.True(hasColor(img, image.Rect(0, 0, width, plotTop), ink), "title of %s chart", kind)
+			a.True(hasColor(img, img.Bounds(), palette[0]), "figures of %s chart", kind)
+		}
+	}
+
+	_, err := (&Chart{Kind: Bar, Title: "Nothing"}).PNG()
+	a.Error(err)
+}
+
+func TestParseKind(t *testing.T) {
+	a := assert.New(t)
+	kind, err := ParseKind("Pie")
+	a.NoError(err)
+	a.Equal(Pie, kind)
+	_, err = ParseKind("donut")
+	a.EqualError(err, `unknown chart "donut", expected bar, line or pie`)
+}
+
+func TestMerge(t *testing.T) {
+	a := assert.New(t)
+	points := []Point{{"a", 5}, {"b", 4}, {"c", 3}, {"d", 2}}
+	a.Equal(points, merge(points, 4))
+	a.Equal([]Point{{"a", 5}, {"b", 4}, {"Other (2)", 5}}, merge(points, 3))
+}
+
+func TestTicks(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(1.0, niceStep(0.7))
+	a.Equal(2000.0, niceStep(1250))
+	a.Equal(50.0, niceStep(42))
+	a.Equal("1.5k", short(1500))
+	a.Equal("2M", short(2e6))
+	a.Equal("-250", short(-250))
+	a.Equal("0.3", short(0.1+0.2))
+}
+
+// hasColor tells whether a part of an image has a pixel of a color
+func hasColor(img image.Image, r image.Rectangle, c color.Color) bool {
+	cr, cg, cb, _ := c.RGBA()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if pr, pg, pb, _ := img.At(x, y).RGBA(); pr == cr && pg == cg && pb == cb {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// fill paints a rectangle
+func fill(img *image.RGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawLine paints a line of a width from x0, y0 to x1, y1
+func drawLine(img *image.RGBA, x0, y0, x1, y1, width int, c color.Color) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		fill(img, image.Rect(x-width/2, y-width/2, x-width/2+width, y-width/2+width), c)
+	}
+}
+
+// fillCircle paints a disc centred on cx, cy
+func fillCircle(img *image.RGBA, cx, cy, radius int, c color.Color) {
+	fillSlice(img, cx, cy, radius, 0, 2*math.Pi, c)
+}
+
+// fillSlice paints the part of a disc between two angles, in radians
+// clockwise from 12 o'clock
+func fillSlice(img *image.RGBA, cx, cy, radius int, start, end float64, c color.Color) {
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y > radius*radius {
+				continue
+			}
+			angle := math.Atan2(float64(x), float64(-y))
+			if angle < 0 {
+				angle += 2 * math.Pi
+			}
+			if angle >= start && angle <= end {
+				img.Set(cx+x, cy+y, c)
+			}
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,32 @@
+package chatter
+
+import "github.com/pclk/waOdoo/internal/odoo"
+
+// Target is a kind of document a customer's conversation is mirrored to
+// while one of theirs is open, instead of the partner's own chatter
+type Target struct {
+	Model string
+	// Domain selects the open documents, which are also matched on the
+	// customer's commercial partner
+	Domain odoo.Domain
+}
+
+var (
+	// Quotations mirrors conversations to quotations being negotiated
+	Quotations = Target{
+		Model:  "sale.order",
+		Domain: odoo.Domain{odoo.Cond("state", "in", []string{"draft", "sent"})},
+	}
+	// Tickets mirrors conversations to open helpdesk tickets
+	Tickets = Target{
+		Model:  "helpdesk.ticket",
+		Domain: odoo.Domain{odoo.Cond("stage_id.fold", "=", false)},
+	}
+)
+
+// thread is the chatter a conversation is mirrored to
+type thread struct {
+	Model     string
+	ID        int
+	PartnerID int
+}
@@ -0,0 +1,56 @@
+package chatter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Sender is an agent.Sender that mirrors what it sends into Odoo chatter
+type Sender struct {
+	agent.Sender
+	bridge *Service
+}
+
+func NewSender(sender agent.Sender, bridge *Service) *Sender {
+	return &Sender{Sender: sender, bridge: bridge}
+}
+
+func (s *Sender) SendMessage(ctx context.Context, msg whatsapp.OutgoingMessage) (*whatsapp.MessageResponse, error) {
+	resp, err := s.Sender.SendMessage(ctx, msg)
+	if err == nil {
+		s.bridge.Mirror(ctx, msg.To, msg.Message)
+	}
+	return resp, err
+}
+
+func (s *Sender) SendList(ctx context.Context, msg whatsapp.ListMessage) (*whatsapp.MessageResponse, error) {
+	resp, err := s.Sender.SendList(ctx, msg)
+	if err == nil {
+		s.bridge.Mirror(ctx, msg.To, msg.Body)
+	}
+	return resp, err
+}
+
+func (s *Sender) SendButtons(ctx context.Context, msg whatsapp.ButtonMessage) (*whatsapp.MessageResponse, error) {
+	resp, err := s.Sender.SendButtons(ctx, msg)
+	if err == nil {
+		titles := make([]string, len(msg.Buttons))
+		for i, b := range msg.Buttons {
+			titles[i] = b.Title
+		}
+		s.bridge.Mirror(ctx, msg.To, fmt.Sprintf("%s [%s]", msg.Body, strings.Join(titles, " | ")))
+	}
+	return resp, err
+}
+
+func (s *Sender) SendTemplate(ctx context.Context, msg whatsapp.TemplateMessage) (*whatsapp.MessageResponse, error) {
+	resp, err := s.Sender.SendTemplate(ctx, msg)
+	if err == nil {
+		s.bridge.Mirror(ctx, msg.To, fmt.Sprintf("template %s (%s)", msg.Name, strings.Join(msg.BodyParameters, ", ")))
+	}
+	return resp, err
+}
@@ -0,0 +1,329 @@
+package chatter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// activeFor is how recently a document must have changed to still count as
+// the one the customer is talking about
+const activeFor = 7 * 24 * time.Hour
+
+// Service mirrors WhatsApp conversations into Odoo chatter and relays the
+// chatter messages staff mark for WhatsApp back to the customer
+type Service struct {
+	// Targets are the documents preferred over the partner's chatter
+	Targets []Target
+	// marker flags chatter messages to send on WhatsApp, e.g. "#wa"
+	marker        string
+	markerPattern *regexp.Regexp
+
+	odoo   *odoo.Client
+	sender agent.Sender
+	media  agent.MediaDownloader
+
+	mu        sync.Mutex
+	authorID  int
+	lastRelay int
+	// unsent are the messages whose relay failed, retried on the next poll
+	unsent []odoo.Record
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, media agent.MediaDownloader) *Service {
+	marker := os.Getenv("CHATTER_RELAY_MARKER")
+	if marker == "" {
+		marker = "#wa"
+	}
+	return &Service{
+		Targets:       []Target{Quotations},
+		marker:        marker,
+		markerPattern: regexp.MustCompile(`(?i)` + regexp.QuoteMeta(marker)),
+		odoo:          client,
+		sender:        sender,
+		media:         media,
+	}
+}
+
+// HandleMessage mirrors an inbound message to the customer's chatter, with
+// the customer as author and any media as attachment
+func (s *Service) HandleMessage(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	t, err := s.thread(ctx, msg.SenderID)
+	if err != nil || t == nil {
+		return err
+	}
+
+	opts := odoo.PostOptions{Internal: true, AuthorID: t.PartnerID}
+	if msg.MediaID() != "" {
+		media, err := s.media.DownloadMedia(ctx, msg.MediaID())
+		if err != nil {
+			log.Printf("Failed to download media of %s: %v", msg.MessageID, err)
+		} else {
+			attachmentID, err := s.odoo.Attach(ctx, t.Model, t.ID, msg.MediaFilename(), media.MimeType, media.Data)
+			if err != nil {
+				return err
+			}
+			opts.AttachmentIDs = []int{attachmentID}
+		}
+	}
+
+	body := "📥 WhatsApp: " + messageText(msg.Body, msg.Type)
+	if _, err := s.odoo.MessagePostWith(ctx, t.Model, t.ID, body, opts); err != nil {
+		return fmt.Errorf("failed to mirror message to %s %d: %w", t.Model, t.ID, err)
+	}
+	return nil
+}
+
+// Mirror records a message sent to a customer in their chatter
+func (s *Service) Mirror(ctx context.Context, to, text string) {
+	t, err := s.thread(ctx, digits(to))
+	if err != nil {
+		log.Printf("Failed to find chatter for %s: %v", to, err)
+		return
+	}
+	if t == nil {
+		return
+	}
+	if _, err := s.odoo.MessagePost(ctx, t.Model, t.ID, "📤 WhatsApp: "+text, true); err != nil {
+		log.Printf("Failed to mirror message to %s %d: %v", t.Model, t.ID, err)
+	}
+}
+
+// thread returns where the conversation with waID is mirrored: the most
+// recently changed open target document, or else the partner. It is nil
+// for numbers that aren't contacts.
+func (s *Service) thread(ctx context.Context, waID string) (*thread, error) {
+	partner, err := s.odoo.PartnerByPhone(ctx, waID, []string{"commercial_partner_id"})
+	if err != nil || partner == nil {
+		return nil, err
+	}
+	commercialID, _ := partner.Many2one("commercial_partner_id")
+	if commercialID == 0 {
+		commercialID = partner.ID()
+	}
+
+	best := &thread{Model: "res.partner", ID: partner.ID(), PartnerID: partner.ID()}
+	var bestDate string
+	since := time.Now().Add(-activeFor).UTC().Format(odoo.DatetimeFormat)
+	for _, target := range s.Targets {
+		domain := append(odoo.Domain{
+			odoo.Cond("partner_id", "child_of", commercialID),
+			odoo.Cond("write_date", ">=", since),
+		}, target.Domain...)
+		records, err := s.odoo.SearchRead(ctx, target.Model, domain, []string{"write_date"},
+			&odoo.SearchOptions{Limit: 1, Order: "write_date desc"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search open %s: %w", target.Model, err)
+		}
+		// Odoo datetimes sort as strings
+		if len(records) > 0 && records[0].String("write_date") > bestDate {
+			bestDate = records[0].String("write_date")
+			best.Model, best.ID = target.Model, records[0].ID()
+		}
+	}
+	return best, nil
+}
+
+// Run relays marked chatter messages to WhatsApp until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	authorID, err := s.serviceAuthor(ctx)
+	if err != nil {
+		log.Printf("Chatter relay disabled: %v", err)
+		return
+	}
+
+	models := []string{"res.partner"}
+	for _, target := range s.Targets {
+		// Replies on helpdesk tickets are relayed by the helpdesk integration
+		if target.Model != Tickets.Model {
+			models = append(models, target.Model)
+		}
+	}
+
+	watcher := &odoo.Watcher{
+		Client: s.odoo,
+		Model:  "mail.message",
+		Domain: odoo.Domain{
+			odoo.Cond("model", "in", models),
+			odoo.Cond("message_type", "=", "comment"),
+			odoo.Cond("body", "ilike", s.marker),
+			odoo.Cond("author_id.user_ids.share", "=", false),
+			// The mirrored messages are posted by the service account
+			odoo.Cond("author_id", "!=", authorID),
+		},
+		Fields: []string{"model", "res_id", "body", "author_id"},
+	}
+
+	// The watcher's cursor moves past failed messages, so they are kept
+	// and retried even when there's nothing new
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			messages, err := watcher.Changes(ctx)
+			if err != nil {
+				log.Printf("Chatter relay: %v", err)
+				continue
+			}
+			s.mu.Lock()
+			messages = append(s.unsent, messages...)
+			s.unsent = nil
+			s.mu.Unlock()
+			if len(messages) == 0 {
+				continue
+			}
+			if err := s.Relay(ctx, messages); err != nil {
+				log.Printf("Chatter relay: %v", err)
+			}
+		}
+	}
+}
+
+// Relay sends chatter messages to the customer of their document. It
+// stops at the first failure and keeps the messages left for the next call.
+func (s *Service) Relay(ctx context.Context, messages []odoo.Record) error {
+	for i, m := range messages {
+		if err := s.relay(ctx, m); err != nil {
+			s.mu.Lock()
+			s.unsent = append(s.unsent, messages[i:]...)
+			s.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// relay sends one chatter message, unless it was sent already
+func (s *Service) relay(ctx context.Context, m odoo.Record) error {
+	if s.relayed(m.ID()) {
+		return nil
+	}
+
+	text := s.stripMarker(odoo.HTMLToText(m.String("body")))
+	if text == "" {
+		s.markRelayed(m.ID())
+		return nil
+	}
+	phone, err := s.recipient(ctx, m.String("model"), m.Int("res_id"))
+	if err != nil {
+		return err
+	}
+	if phone == "" {
+		log.Printf("No WhatsApp number to relay message %d on %s %d", m.ID(), m.String("model"), m.Int("res_id"))
+		s.markRelayed(m.ID())
+		return nil
+	}
+
+	_, author := m.Many2one("author_id")
+	if _, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{
+		To:      phone,
+		Message: fmt.Sprintf("💬 *%s*:\n%s", author, text),
+	}); err != nil {
+		return fmt.Errorf("failed to relay message %d: %w", m.ID(), err)
+	}
+	s.markRelayed(m.ID())
+	return nil
+}
+
+// relayed reports whether a message was sent already
+func (s *Service) relayed(messageID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return messageID <= s.lastRelay
+}
+
+// markRelayed records that a message was sent
+func (s *Service) markRelayed(messageID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if messageID > s.lastRelay {
+		s.lastRelay = messageID
+	}
+}
+
+// recipient returns the phone number of the customer of a document
+func (s *Service) recipient(ctx context.Context, model string, id int) (string, error) {
+	partnerID := id
+	if model != "res.partner" {
+		records, err := s.odoo.Read(ctx, model, []int{id}, []string{"partner_id"}, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s %d: %w", model, id, err)
+		}
+		if len(records) == 0 {
+			return "", nil
+		}
+		partnerID, _ = records[0].Many2one("partner_id")
+		if partnerID == 0 {
+			return "", nil
+		}
+	}
+
+	partners, err := s.odoo.Read(ctx, "res.partner", []int{partnerID}, []string{"phone", "mobile"}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read partner %d: %w", partnerID, err)
+	}
+	if len(partners) == 0 {
+		return "", nil
+	}
+	if phone := partners[0].String("mobile"); phone != "" {
+		return phone, nil
+	}
+	return partners[0].String("phone"), nil
+}
+
+// serviceAuthor returns the partner of the Odoo user waOdoo logs in as
+func (s *Service) serviceAuthor(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.authorID != 0 {
+		return s.authorID, nil
+	}
+
+	uid, err := s.odoo.Authenticate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	users, err := s.odoo.Read(ctx, "res.users", []int{uid}, []string{"partner_id"}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read service user: %w", err)
+	}
+	if len(users) == 0 {
+		return 0, fmt.Errorf("service user %d not found", uid)
+	}
+	s.authorID, _ = users[0].Many2one("partner_id")
+	return s.authorID, nil
+}
+
+func (s *Service) stripMarker(text string) string {
+	return strings.TrimSpace(s.markerPattern.ReplaceAllString(text, ""))
+}
+
+// messageText returns the text of a message, or a placeholder for media
+func messageText(body, kind string) string {
+	if body != "" {
+		return body
+	}
+	return fmt.Sprintf("[%s]", kind)
+}
+
+// digits strips a phone number down to the WhatsApp id
+func digits(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
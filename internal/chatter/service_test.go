@@ -0,0 +1,159 @@
+package chatter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{Media: map[string]*whatsapp.Media{
+		"media-1": {ID: "media-1", MimeType: "image/jpeg", Data: []byte("jpeg")},
+	}}
+	service := NewService(recorder.Client(), sender, sender)
+	return service, sender, recorder
+}
+
+var partner = []map[string]interface{}{{"id": 3, "commercial_partner_id": []interface{}{1, "Azure Interior"}}}
+
+func TestHandleMessageMirrorsToQuotation(t *testing.T) {
+	a := assert.New(t)
+	service, _, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read":      partner,
+		"sale.order.search_read":       []map[string]interface{}{{"id": 12, "write_date": "2025-03-10 09:00:00"}},
+		"helpdesk.ticket.search_read":  []map[string]interface{}{{"id": 40, "write_date": "2025-03-11 09:00:00"}},
+		"ir.attachment.create":         50,
+		"helpdesk.ticket.message_post": 60,
+	})
+	service.Targets = []Target{Quotations, Tickets}
+
+	err := service.HandleMessage(context.Background(), whatsapp.WebhookMessage{
+		SenderID:  "6598765432",
+		MessageID: "wamid.1",
+		Type:      "image",
+		Body:      "the broken part",
+		Media:     map[string]interface{}{"id": "media-1", "mime_type": "image/jpeg"},
+	})
+
+	a.NoError(err)
+	search := recorder.Last("sale.order", "search_read")
+	if a.NotNil(search) {
+		a.Contains(search.Args[0], []interface{}{"partner_id", "child_of", float64(1)})
+	}
+	attach := recorder.Last("ir.attachment", "create")
+	if a.NotNil(attach) {
+		values := attach.Args[0].(map[string]interface{})
+		a.Equal("helpdesk.ticket", values["res_model"])
+		a.Equal(float64(40), values["res_id"])
+	}
+	post := recorder.Last("helpdesk.ticket", "message_post")
+	if a.NotNil(post) {
+		a.Equal([]interface{}{[]interface{}{float64(40)}}, post.Args)
+		a.Equal("📥 WhatsApp: the broken part", post.Kwargs["body"])
+		a.Equal(float64(3), post.Kwargs["author_id"])
+		a.Equal([]interface{}{float64(50)}, post.Kwargs["attachment_ids"])
+	}
+}
+
+func TestHandleMessageMirrorsToPartner(t *testing.T) {
+	a := assert.New(t)
+	service, _, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read":  partner,
+		"sale.order.search_read":   []map[string]interface{}{},
+		"res.partner.message_post": 60,
+	})
+
+	err := service.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6598765432", Type: "text", Body: "hi"})
+
+	a.NoError(err)
+	post := recorder.Last("res.partner", "message_post")
+	if a.NotNil(post) {
+		a.Equal([]interface{}{[]interface{}{float64(3)}}, post.Args)
+		a.Equal("mail.mt_note", post.Kwargs["subtype_xmlid"])
+	}
+}
+
+func TestHandleMessageIgnoresUnknownNumbers(t *testing.T) {
+	a := assert.New(t)
+	service, _, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read": []map[string]interface{}{},
+	})
+
+	a.NoError(service.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6598765432", Type: "text", Body: "hi"}))
+	a.Len(recorder.Calls(), 1)
+}
+
+func TestSenderMirrorsOutboundMessages(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"res.partner.search_read":  partner,
+		"sale.order.search_read":   []map[string]interface{}{},
+		"res.partner.message_post": 60,
+	})
+	mirrored := NewSender(sender, service)
+
+	_, err := mirrored.SendButtons(context.Background(), whatsapp.ButtonMessage{
+		To:      "+65 9876 5432",
+		Body:    "Approve?",
+		Buttons: []whatsapp.Button{{ID: "a", Title: "Yes"}, {ID: "b", Title: "No"}},
+	})
+
+	a.NoError(err)
+	a.Len(sender.Buttons, 1)
+	search := recorder.Last("res.partner", "search_read")
+	if a.NotNil(search) {
+		a.Contains(search.Args[0], []interface{}{"phone_sanitized", "=", "+6598765432"})
+	}
+	post := recorder.Last("res.partner", "message_post")
+	if a.NotNil(post) {
+		a.Equal("📤 WhatsApp: Approve? [Yes | No]", post.Kwargs["body"])
+	}
+}
+
+func TestRelay(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t, map[string]interface{}{
+		"sale.order.read":  []map[string]interface{}{{"id": 12, "partner_id": []interface{}{3, "Azure Interior, Ana"}}},
+		"res.partner.read": []map[string]interface{}{{"id": 3, "phone": "+6598765432", "mobile": false}},
+	})
+
+	messages := []odoo.Record{{
+		"id":        float64(70),
+		"model":     "sale.order",
+		"res_id":    float64(12),
+		"body":      "<p>#WA Your quotation is ready, I added the discount.</p>",
+		"author_id": []interface{}{float64(5), "Mitchell Admin"},
+	}}
+	// WhatsApp fails, so the message is kept for the next poll
+	service.sender = failingSender{sender}
+	a.Error(service.Relay(context.Background(), messages))
+	a.Len(service.unsent, 1)
+	a.Empty(sender.Messages)
+
+	service.sender = sender
+	a.NoError(service.Relay(context.Background(), messages))
+	// Already relayed
+	a.NoError(service.Relay(context.Background(), messages))
+
+	if a.Len(sender.Messages, 1) {
+		a.Equal("+6598765432", sender.Messages[0].To)
+		a.Equal("💬 *Mitchell Admin*:\nYour quotation is ready, I added the discount.", sender.Messages[0].Message)
+	}
+}
+
+// failingSender fails to send text messages
+type failingSender struct{ *agenttest.Sender }
+
+func (failingSender) SendMessage(ctx context.Context, msg whatsapp.OutgoingMessage) (*whatsapp.MessageResponse, error) {
+	return nil, errors.New("whatsapp is down")
+}
@@ -0,0 +1,142 @@
+package company
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/fuzzy"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxChoices is the number of rows a WhatsApp list message can hold
+const maxChoices = 10
+
+var switchPattern = regexp.MustCompile(`(?i)^\s*(?:switch|change)\s+compan(?:y|ies)\b(?:\s+to)?\s*(.*)$`)
+
+// Switcher stores the company a bound user works in. It is implemented by
+// *binding.Registry.
+type Switcher interface {
+	SetCompany(ctx context.Context, waID string, companyID int) error
+}
+
+// Service lets bound users switch the company they work in on a
+// multi-company database
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	switcher Switcher
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, switcher Switcher) *Service {
+	return &Service{odoo: client, sender: sender, switcher: switcher}
+}
+
+func (s *Service) Name() string {
+	return "company"
+}
+
+func (s *Service) Help() string {
+	return `"switch company" to change the company you work in`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return switchPattern.MatchString(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	user := odoo.UserFrom(ctx)
+	if user == nil {
+		return s.send(ctx, msg.SenderID, "Your number isn't linked to an Odoo user, so there is no company to switch.")
+	}
+
+	companies, current, err := s.companies(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	if msg.ReplyID != "" {
+		var companyID int
+		if _, err := fmt.Sscanf(msg.ReplyID, "company:set:%d", &companyID); err != nil {
+			return fmt.Errorf("invalid reply id %q", msg.ReplyID)
+		}
+		for _, c := range companies {
+			if c.ID() == companyID {
+				return s.switchTo(ctx, msg.SenderID, c)
+			}
+		}
+		return s.send(ctx, msg.SenderID, "You don't have access to that company.")
+	}
+
+	if len(companies) < 2 {
+		return s.send(ctx, msg.SenderID, "You only have access to one company.")
+	}
+
+	if name := strings.TrimSpace(switchPattern.FindStringSubmatch(msg.Body)[1]); name != "" {
+		names := make([]string, len(companies))
+		for i, c := range companies {
+			names[i] = c.String("name")
+		}
+		if m, ok := fuzzy.Best(name, names); ok && m.Score >= fuzzy.Threshold {
+			return s.switchTo(ctx, msg.SenderID, companies[m.Index])
+		}
+	}
+
+	rows := make([]whatsapp.ListRow, 0, maxChoices)
+	for _, c := range companies {
+		if len(rows) == maxChoices {
+			break
+		}
+		row := whatsapp.ListRow{ID: fmt.Sprintf("company:set:%d", c.ID()), Title: c.String("name")}
+		if c.ID() == current {
+			row.Description = "Current company"
+		}
+		rows = append(rows, row)
+	}
+	_, err = s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       msg.SenderID,
+		Body:     "Which company do you want to work in?",
+		Button:   "Choose company",
+		Sections: []whatsapp.ListSection{{Rows: rows}},
+	})
+	return err
+}
+
+func (s *Service) switchTo(ctx context.Context, to string, company odoo.Record) error {
+	if err := s.switcher.SetCompany(ctx, to, company.ID()); err != nil {
+		return fmt.Errorf("failed to switch company: %w", err)
+	}
+	return s.send(ctx, to, fmt.Sprintf("🏢 You're now working in *%s*.", company.String("name")))
+}
+
+// companies returns the companies the user may work in and the current one
+func (s *Service) companies(ctx context.Context, user *odoo.User) ([]odoo.Record, int, error) {
+	users, err := s.odoo.Read(ctx, "res.users", []int{user.ID}, []string{"company_id", "company_ids"}, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read user: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, 0, fmt.Errorf("user %d not found", user.ID)
+	}
+	current, _ := users[0].Many2one("company_id")
+	if user.CompanyID != 0 {
+		current = user.CompanyID
+	}
+
+	// Allow every company of the user, or the records of the others are hidden
+	ids := users[0].IDs("company_ids")
+	companies, err := s.odoo.SearchRead(ctx, "res.company", odoo.Domain{odoo.Cond("id", "in", ids)}, []string{"name"},
+		&odoo.SearchOptions{Order: "name", Context: map[string]interface{}{"allowed_company_ids": ids}})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read companies: %w", err)
+	}
+	return companies, current, nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
@@ -0,0 +1,85 @@
+package company
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSwitcher map[string]int
+
+func (f fakeSwitcher) SetCompany(ctx context.Context, waID string, companyID int) error {
+	f[waID] = companyID
+	return nil
+}
+
+// newTestService runs the service against a fake Odoo where ana works in
+// companies 1 and 3, currently in 1
+func newTestService(t *testing.T) (*Service, *agenttest.Sender, fakeSwitcher, *odootest.Server) {
+	server := odootest.NewServer(t)
+	server.Seed("res.company", odoo.Record{"id": 3, "name": "My Company (Chicago)"})
+	server.AddUser(odoo.Record{"id": 9, "login": "ana", "name": "Ana", "company_id": 1, "company_ids": []int{1, 3}}, "key")
+
+	sender := &agenttest.Sender{}
+	switcher := fakeSwitcher{}
+	return NewService(server.Client(), sender, switcher), sender, switcher, server
+}
+
+var ana = &odoo.User{ID: 9, Login: "ana", APIKey: "key"}
+
+func TestMatch(t *testing.T) {
+	a := assert.New(t)
+	service, _, _, _ := newTestService(t)
+
+	a.True(service.Match(whatsapp.WebhookMessage{Body: "switch company"}))
+	a.True(service.Match(whatsapp.WebhookMessage{Body: "Change company to Chicago"}))
+	a.False(service.Match(whatsapp.WebhookMessage{Body: "which company sells desks"}))
+}
+
+func TestHandleListsCompanies(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _, server := newTestService(t)
+	ctx := odoo.WithUser(context.Background(), ana)
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "switch company"}))
+
+	if a.Len(sender.Lists, 1) {
+		rows := sender.Lists[0].Sections[0].Rows
+		a.Equal("company:set:1", rows[0].ID)
+		a.Equal("Current company", rows[0].Description)
+		a.Equal("company:set:3", rows[1].ID)
+	}
+	// Companies are read with all of the user's companies allowed
+	a.Equal(map[string]interface{}{"allowed_company_ids": []interface{}{float64(1), float64(3)}}, server.Calls()[1].Context())
+}
+
+func TestHandleSwitchesCompany(t *testing.T) {
+	a := assert.New(t)
+	service, sender, switcher, _ := newTestService(t)
+	ctx := odoo.WithUser(context.Background(), ana)
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "change company to chicago"}))
+	a.Equal(3, switcher["6591234567"])
+	a.Equal("🏢 You're now working in *My Company (Chicago)*.", sender.LastText())
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591234567", Type: "interactive", ReplyID: "company:set:1"}))
+	a.Equal(1, switcher["6591234567"])
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591234567", Type: "interactive", ReplyID: "company:set:2"}))
+	a.Equal("You don't have access to that company.", sender.LastText())
+}
+
+func TestHandleUnboundUser(t *testing.T) {
+	a := assert.New(t)
+	service, sender, switcher, server := newTestService(t)
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{SenderID: "6591234567", Type: "text", Body: "switch company"}))
+	a.Contains(sender.LastText(), "isn't linked to an Odoo user")
+	a.Empty(switcher)
+	a.Empty(server.Calls())
+}
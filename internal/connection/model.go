@@ -0,0 +1,79 @@
+package connection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Config describes one Odoo database waOdoo serves
+type Config struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Database string `json:"database"`
+	Username string `json:"username"`
+	// APIKeyEnv names the environment variable holding the API key, so the
+	// file doesn't contain secrets
+	APIKeyEnv string `json:"api_key_env"`
+	// CompanyIDs are the allowed companies on a multi-company database, the
+	// first being the default company
+	CompanyIDs []int `json:"company_ids,omitempty"`
+	// PhoneNumberIDs are the WhatsApp business numbers whose conversations
+	// go to this database. The first one sends its notifications.
+	PhoneNumberIDs []string `json:"phone_number_ids,omitempty"`
+}
+
+// Client creates the Odoo client of the connection
+func (c Config) Client() *odoo.Client {
+	return &odoo.Client{
+		Name:       c.Name,
+		URL:        strings.TrimSuffix(c.URL, "/"),
+		Database:   c.Database,
+		Username:   c.Username,
+		APIKey:     os.Getenv(c.APIKeyEnv),
+		HTTPClient: &http.Client{},
+		CompanyIDs: c.CompanyIDs,
+		Limits:     odoo.LimitsFromEnv(),
+	}
+}
+
+// LoadConfigs reads connections from a JSON file. An empty path means the
+// single database configured by the ODOO_* environment variables.
+func LoadConfigs(path string) ([]Config, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read odoo connections: %w", err)
+	}
+
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse odoo connections: %w", err)
+	}
+
+	names := map[string]bool{}
+	phones := map[string]string{}
+	for i, c := range configs {
+		if c.Name == "" || c.URL == "" || c.Database == "" {
+			return nil, fmt.Errorf("odoo connection %d needs a name, url and database", i)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("odoo connection %s is configured twice", c.Name)
+		}
+		names[c.Name] = true
+		for _, id := range c.PhoneNumberIDs {
+			if other, ok := phones[id]; ok {
+				return nil, fmt.Errorf("phone number %s is used by both %s and %s", id, other, c.Name)
+			}
+			phones[id] = c.Name
+		}
+	}
+	return configs, nil
+}
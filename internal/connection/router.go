@@ -0,0 +1,134 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Connection is an Odoo database and the message handlers working on it
+type Connection struct {
+	Client         *odoo.Client
+	PhoneNumberIDs []string
+
+	handlers []whatsapp.MessageHandler
+}
+
+// Name returns the name of the connection
+func (c *Connection) Name() string {
+	return c.Client.Name
+}
+
+// OnMessage adds a handler for the messages routed to this connection
+func (c *Connection) OnMessage(h whatsapp.MessageHandler) {
+	c.handlers = append(c.handlers, h)
+}
+
+// Context returns a context whose messages are sent from the connection's
+// first WhatsApp number, for background workers
+func (c *Connection) Context(ctx context.Context) context.Context {
+	if len(c.PhoneNumberIDs) == 0 {
+		return ctx
+	}
+	return whatsapp.WithPhoneNumberID(ctx, c.PhoneNumberIDs[0])
+}
+
+// BindingLookup finds the connection a WhatsApp number is bound to. It is
+// implemented by *binding.Registry.
+type BindingLookup interface {
+	ConnectionOf(ctx context.Context, waID string) (string, error)
+}
+
+// Router sends each WhatsApp message to the handlers of one connection:
+// the one the sender is bound to, else the one owning the business number
+// the message was sent to, else the first one
+type Router struct {
+	// Bindings, when set, routes bound numbers to their connection
+	Bindings BindingLookup
+
+	connections []*Connection
+}
+
+// NewRouter creates a router for the configured connections, or for the
+// database configured by the environment when there are none
+func NewRouter(configs []Config) *Router {
+	if len(configs) == 0 {
+		return &Router{connections: []*Connection{{Client: odoo.NewClient()}}}
+	}
+
+	r := &Router{}
+	for _, c := range configs {
+		r.connections = append(r.connections, &Connection{Client: c.Client(), PhoneNumberIDs: c.PhoneNumberIDs})
+	}
+	return r
+}
+
+// Connections returns every connection, the default one first
+func (r *Router) Connections() []*Connection {
+	return r.connections
+}
+
+// Client returns the client of the named connection, or of the default
+// connection for "", or nil when there is no such connection
+func (r *Router) Client(name string) *odoo.Client {
+	if c := r.connection(name); c != nil {
+		return c.Client
+	}
+	return nil
+}
+
+// HandleMessage passes a message to the handlers of its connection. It has
+// the signature of whatsapp.MessageHandler.
+func (r *Router) HandleMessage(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	c, err := r.route(ctx, msg)
+	if err != nil {
+		return err
+	}
+
+	// Like the webhook, keep going when a handler fails
+	for _, handle := range c.handlers {
+		if err := handle(ctx, msg); err != nil {
+			log.Printf("Failed to handle message %s on %s: %v", msg.MessageID, c.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (r *Router) route(ctx context.Context, msg whatsapp.WebhookMessage) (*Connection, error) {
+	if r.Bindings != nil {
+		name, err := r.Bindings.ConnectionOf(ctx, msg.SenderID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up binding of %s: %w", msg.SenderID, err)
+		}
+		if name != "" {
+			if c := r.connection(name); c != nil {
+				return c, nil
+			}
+			log.Printf("%s is bound to unknown connection %s", msg.SenderID, name)
+		}
+	}
+
+	for _, c := range r.connections {
+		for _, id := range c.PhoneNumberIDs {
+			if id == msg.RecipientID {
+				return c, nil
+			}
+		}
+	}
+	return r.connections[0], nil
+}
+
+func (r *Router) connection(name string) *Connection {
+	if name == "" {
+		return r.connections[0]
+	}
+	for _, c := range r.connections {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
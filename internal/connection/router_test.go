@@ -0,0 +1,83 @@
+package connection
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBindings map[string]string
+
+func (f fakeBindings) ConnectionOf(ctx context.Context, waID string) (string, error) {
+	return f[waID], nil
+}
+
+func TestLoadConfigs(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "connections.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	configs, err := LoadConfigs("")
+	a.NoError(err)
+	a.Nil(configs)
+
+	t.Setenv("BRANCH_ODOO_KEY", "branch-secret")
+	configs, err = LoadConfigs(write(`[
+		{"name": "main", "url": "https://main.example.com/", "database": "main", "username": "bot", "api_key_env": "MAIN_ODOO_KEY", "phone_number_ids": ["111"]},
+		{"name": "branch", "url": "https://branch.example.com", "database": "branch", "username": "bot", "api_key_env": "BRANCH_ODOO_KEY", "company_ids": [2, 5]}
+	]`))
+	if a.NoError(err) && a.Len(configs, 2) {
+		client := configs[1].Client()
+		a.Equal("branch", client.Name)
+		a.Equal("branch-secret", client.APIKey)
+		a.Equal([]int{2, 5}, client.CompanyIDs)
+		a.Equal("https://main.example.com", configs[0].Client().URL)
+	}
+
+	_, err = LoadConfigs(write(`[{"name": "main", "url": "https://a", "database": "a"}, {"name": "main", "url": "https://b", "database": "b"}]`))
+	a.ErrorContains(err, "configured twice")
+
+	_, err = LoadConfigs(write(`[{"name": "a", "url": "https://a", "database": "a", "phone_number_ids": ["1"]}, {"name": "b", "url": "https://b", "database": "b", "phone_number_ids": ["1"]}]`))
+	a.ErrorContains(err, "used by both")
+}
+
+func TestRouter(t *testing.T) {
+	a := assert.New(t)
+	router := NewRouter([]Config{
+		{Name: "main", URL: "https://main", Database: "main", PhoneNumberIDs: []string{"111"}},
+		{Name: "branch", URL: "https://branch", Database: "branch", PhoneNumberIDs: []string{"222", "333"}},
+	})
+	router.Bindings = fakeBindings{"6591234567": "branch"}
+
+	var handled []string
+	for _, conn := range router.Connections() {
+		name := conn.Name()
+		conn.OnMessage(func(ctx context.Context, msg whatsapp.WebhookMessage) error {
+			handled = append(handled, name)
+			return nil
+		})
+	}
+
+	ctx := context.Background()
+	a.NoError(router.HandleMessage(ctx, whatsapp.WebhookMessage{SenderID: "6591234567", RecipientID: "111"}))
+	a.NoError(router.HandleMessage(ctx, whatsapp.WebhookMessage{SenderID: "6598765432", RecipientID: "333"}))
+	a.NoError(router.HandleMessage(ctx, whatsapp.WebhookMessage{SenderID: "6598765432", RecipientID: "999"}))
+	a.Equal([]string{"branch", "branch", "main"}, handled)
+
+	a.Equal("main", router.Client("").Name)
+	a.Equal("branch", router.Client("branch").Name)
+	a.Nil(router.Client("warehouse"))
+
+	workerCtx := router.Connections()[1].Context(ctx)
+	a.Equal("222", whatsapp.PhoneNumberIDFrom(workerCtx))
+}
@@ -0,0 +1,71 @@
+package crm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Rule assigns new leads to a sales team. Every criterion that is set must
+// match; a rule without criteria matches every lead.
+type Rule struct {
+	Name string `json:"name"`
+
+	// CountryPrefix matches the start of the sender's number, e.g. "65"
+	CountryPrefix string `json:"country_prefix,omitempty"`
+	// Keyword matches the first message, case-insensitively
+	Keyword string `json:"keyword,omitempty"`
+	// AdID matches the source_id of a click-to-WhatsApp ad referral
+	AdID string `json:"ad_id,omitempty"`
+	// FromAd matches every conversation started from an ad
+	FromAd bool `json:"from_ad,omitempty"`
+
+	// Team is the name of the crm.team the lead is assigned to
+	Team string `json:"team"`
+	// Salesperson is the login of the res.users the lead is assigned to
+	Salesperson string `json:"salesperson,omitempty"`
+}
+
+// Matches reports whether the rule applies to a lead opened by msg
+func (r Rule) Matches(msg whatsapp.WebhookMessage) bool {
+	if r.CountryPrefix != "" && !strings.HasPrefix(msg.SenderID, strings.TrimPrefix(r.CountryPrefix, "+")) {
+		return false
+	}
+	if r.Keyword != "" && !strings.Contains(strings.ToLower(msg.Body), strings.ToLower(r.Keyword)) {
+		return false
+	}
+	if r.AdID != "" && (msg.Referral == nil || msg.Referral.SourceID != r.AdID) {
+		return false
+	}
+	if r.FromAd && (msg.Referral == nil || msg.Referral.SourceType != "ad") {
+		return false
+	}
+	return true
+}
+
+// LoadRules reads assignment rules from a JSON file. An empty path means no
+// rules, in which case Odoo's own lead assignment applies.
+func LoadRules(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lead rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse lead rules: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Team == "" && rule.Salesperson == "" {
+			return nil, fmt.Errorf("lead rule %d (%s) assigns neither a team nor a salesperson", i, rule.Name)
+		}
+	}
+	return rules, nil
+}
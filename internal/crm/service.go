@@ -0,0 +1,208 @@
+package crm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Service turns conversations with unknown numbers into CRM leads
+type Service struct {
+	odoo  *odoo.Client
+	rules []Rule
+
+	// mu serializes lead lookup and creation so that a burst of messages
+	// from a new number opens a single lead
+	mu sync.Mutex
+}
+
+func NewService(client *odoo.Client, rules []Rule) *Service {
+	return &Service{odoo: client, rules: rules}
+}
+
+// HandleMessage records a message from a number that doesn't belong to a
+// known partner: the first one opens a lead, later ones are appended to its
+// chatter. It has the signature of whatsapp.MessageHandler.
+func (s *Service) HandleMessage(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	partner, err := s.odoo.PartnerByPhone(ctx, msg.SenderID, []string{"id"})
+	if err != nil {
+		return err
+	}
+	if partner != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leadID, err := s.FindLead(ctx, msg.SenderID)
+	if err != nil {
+		return err
+	}
+	if leadID != 0 {
+		if _, err := s.odoo.MessagePost(ctx, "crm.lead", leadID, formatMessage(msg), true); err != nil {
+			return fmt.Errorf("failed to append message to lead %d: %w", leadID, err)
+		}
+		return nil
+	}
+
+	leadID, err = s.CreateLead(ctx, msg)
+	if err != nil {
+		return err
+	}
+	log.Printf("Created lead %d for %s", leadID, msg.SenderID)
+	return nil
+}
+
+// FindLead returns the id of the most recent open lead for a WhatsApp number,
+// or 0 if there is none. Lost leads are archived and won leads are skipped,
+// so a returning contact gets a fresh lead.
+func (s *Service) FindLead(ctx context.Context, waID string) (int, error) {
+	domain := append(odoo.PhoneDomain(waID), odoo.Cond("stage_id.is_won", "=", false))
+	leads, err := s.odoo.SearchRead(ctx, "crm.lead", domain, []string{"id"},
+		&odoo.SearchOptions{Limit: 1, Order: "create_date desc"})
+	if err != nil {
+		return 0, fmt.Errorf("failed to search leads: %w", err)
+	}
+	if len(leads) == 0 {
+		return 0, nil
+	}
+	return leads[0].ID(), nil
+}
+
+// CreateLead opens a lead from the first message of a conversation
+func (s *Service) CreateLead(ctx context.Context, msg whatsapp.WebhookMessage) (int, error) {
+	contact := msg.SenderName
+	if contact == "" {
+		contact = odoo.E164(msg.SenderID)
+	}
+
+	values := map[string]interface{}{
+		"name":         "WhatsApp: " + contact,
+		"contact_name": msg.SenderName,
+		"phone":        odoo.E164(msg.SenderID),
+		"description":  describe(msg),
+	}
+
+	if msg.Referral != nil {
+		sourceID, err := s.findOrCreateSource(ctx, msg.Referral)
+		if err != nil {
+			return 0, err
+		}
+		values["source_id"] = sourceID
+		values["referred"] = msg.Referral.SourceURL
+	}
+
+	if rule := s.matchRule(msg); rule != nil {
+		if err := s.assign(ctx, rule, values); err != nil {
+			return 0, err
+		}
+	}
+
+	id, err := s.odoo.Create(ctx, "crm.lead", values)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create lead: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Service) matchRule(msg whatsapp.WebhookMessage) *Rule {
+	for i := range s.rules {
+		if s.rules[i].Matches(msg) {
+			return &s.rules[i]
+		}
+	}
+	return nil
+}
+
+// assign resolves the team and salesperson of a rule into lead values
+func (s *Service) assign(ctx context.Context, rule *Rule, values map[string]interface{}) error {
+	if rule.Team != "" {
+		teams, err := s.odoo.SearchRead(ctx, "crm.team", odoo.Domain{odoo.Cond("name", "=ilike", rule.Team)},
+			[]string{"id"}, &odoo.SearchOptions{Limit: 1})
+		if err != nil {
+			return fmt.Errorf("failed to search sales team: %w", err)
+		}
+		if len(teams) == 0 {
+			return fmt.Errorf("lead rule %s: sales team %q not found", rule.Name, rule.Team)
+		}
+		values["team_id"] = teams[0].ID()
+	}
+
+	if rule.Salesperson != "" {
+		users, err := s.odoo.SearchRead(ctx, "res.users", odoo.Domain{odoo.Cond("login", "=", rule.Salesperson)},
+			[]string{"id"}, &odoo.SearchOptions{Limit: 1})
+		if err != nil {
+			return fmt.Errorf("failed to search salesperson: %w", err)
+		}
+		if len(users) == 0 {
+			return fmt.Errorf("lead rule %s: salesperson %q not found", rule.Name, rule.Salesperson)
+		}
+		values["user_id"] = users[0].ID()
+	}
+	return nil
+}
+
+// findOrCreateSource returns the utm.source recording which ad or post the
+// lead came from
+func (s *Service) findOrCreateSource(ctx context.Context, referral *whatsapp.Referral) (int, error) {
+	name := fmt.Sprintf("WhatsApp %s %s", referral.SourceType, referral.SourceID)
+	if referral.Headline != "" {
+		name += ": " + referral.Headline
+	}
+
+	sources, err := s.odoo.SearchRead(ctx, "utm.source", odoo.Domain{odoo.Cond("name", "=", name)},
+		[]string{"id"}, &odoo.SearchOptions{Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to search utm source: %w", err)
+	}
+	if len(sources) > 0 {
+		return sources[0].ID(), nil
+	}
+
+	id, err := s.odoo.Create(ctx, "utm.source", map[string]interface{}{"name": name})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create utm source: %w", err)
+	}
+	return id, nil
+}
+
+// describe renders the first message and its ad referral as the lead description
+func describe(msg whatsapp.WebhookMessage) string {
+	var b strings.Builder
+	b.WriteString(messageText(msg))
+
+	if r := msg.Referral; r != nil {
+		fmt.Fprintf(&b, "\n\nStarted from %s %s", r.SourceType, r.SourceID)
+		if r.Headline != "" {
+			fmt.Fprintf(&b, "\nHeadline: %s", r.Headline)
+		}
+		if r.Body != "" {
+			fmt.Fprintf(&b, "\nText: %s", r.Body)
+		}
+		if r.SourceURL != "" {
+			fmt.Fprintf(&b, "\nURL: %s", r.SourceURL)
+		}
+		if r.CtwaClid != "" {
+			fmt.Fprintf(&b, "\nClick ID: %s", r.CtwaClid)
+		}
+	}
+	return b.String()
+}
+
+func formatMessage(msg whatsapp.WebhookMessage) string {
+	return "WhatsApp message: " + messageText(msg)
+}
+
+// messageText returns the text of a message, or a placeholder for media
+func messageText(msg whatsapp.WebhookMessage) string {
+	if msg.Body != "" {
+		return msg.Body
+	}
+	return fmt.Sprintf("[%s]", msg.Type)
+}
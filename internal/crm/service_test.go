@@ -0,0 +1,124 @@
+package crm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, rules []Rule, results map[string]interface{}) (*Service, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	return NewService(recorder.Client(), rules), recorder
+}
+
+func TestRuleMatches(t *testing.T) {
+	a := assert.New(t)
+	msg := whatsapp.WebhookMessage{
+		SenderID: "6598765432",
+		Body:     "Hi, I'd like a quote for solar panels",
+		Referral: &whatsapp.Referral{SourceID: "120200", SourceType: "ad"},
+	}
+
+	a.True(Rule{Team: "Sales"}.Matches(msg))
+	a.True(Rule{CountryPrefix: "+65", Keyword: "SOLAR", Team: "Sales"}.Matches(msg))
+	a.True(Rule{AdID: "120200", FromAd: true, Team: "Sales"}.Matches(msg))
+	a.False(Rule{CountryPrefix: "60", Team: "Sales"}.Matches(msg))
+	a.False(Rule{Keyword: "battery", Team: "Sales"}.Matches(msg))
+	a.False(Rule{FromAd: true, Team: "Sales"}.Matches(whatsapp.WebhookMessage{SenderID: "6598765432"}))
+}
+
+func TestLoadRules(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "rules.json")
+	os.WriteFile(valid, []byte(`[{"name": "Singapore", "country_prefix": "65", "team": "Singapore Sales"}, {"name": "Default", "team": "Sales"}]`), 0644)
+	rules, err := LoadRules(valid)
+	if a.NoError(err) && a.Len(rules, 2) {
+		a.Equal("Singapore Sales", rules[0].Team)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`[{"name": "Nowhere", "keyword": "hi"}]`), 0644)
+	_, err = LoadRules(invalid)
+	a.ErrorContains(err, "neither a team nor a salesperson")
+
+	rules, err = LoadRules("")
+	a.NoError(err)
+	a.Empty(rules)
+}
+
+func TestHandleMessageCreatesLead(t *testing.T) {
+	a := assert.New(t)
+	rules := []Rule{
+		{Name: "Malaysia", CountryPrefix: "60", Team: "Malaysia Sales"},
+		{Name: "Ads", FromAd: true, Team: "Online Sales", Salesperson: "ana@example.com"},
+	}
+	service, recorder := newTestService(t, rules, map[string]interface{}{
+		"crm.team.search_read":  []map[string]interface{}{{"id": 4}},
+		"res.users.search_read": []map[string]interface{}{{"id": 9}},
+		"utm.source.create":     15,
+		"crm.lead.create":       42,
+	})
+
+	err := service.HandleMessage(context.Background(), whatsapp.WebhookMessage{
+		SenderID:   "6598765432",
+		SenderName: "Jane Tan",
+		Type:       "text",
+		Body:       "Do you deliver to Jurong?",
+		Referral:   &whatsapp.Referral{SourceID: "120200", SourceType: "ad", Headline: "Free delivery"},
+	})
+
+	a.NoError(err)
+	create := recorder.Find("crm.lead", "create")
+	if a.NotNil(create, "a lead should be created") {
+		values := create.Args[0].(map[string]interface{})
+		a.Equal("WhatsApp: Jane Tan", values["name"])
+		a.Equal("+6598765432", values["phone"])
+		a.Equal(float64(4), values["team_id"])
+		a.Equal(float64(9), values["user_id"])
+		a.Equal(float64(15), values["source_id"])
+		a.Contains(values["description"], "Do you deliver to Jurong?")
+		a.Contains(values["description"], "Headline: Free delivery")
+	}
+}
+
+func TestHandleMessageAppendsToLead(t *testing.T) {
+	a := assert.New(t)
+	service, recorder := newTestService(t, nil, map[string]interface{}{
+		"crm.lead.search_read":  []map[string]interface{}{{"id": 42}},
+		"crm.lead.message_post": 100,
+	})
+
+	err := service.HandleMessage(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6598765432",
+		Type:     "text",
+		Body:     "Also, what are your opening hours?",
+	})
+
+	a.NoError(err)
+	a.Nil(recorder.Find("crm.lead", "create"), "no second lead should be created")
+	post := recorder.Find("crm.lead", "message_post")
+	if a.NotNil(post) {
+		a.Equal([]interface{}{float64(42)}, post.Args[0])
+		a.Equal("WhatsApp message: Also, what are your opening hours?", post.Kwargs["body"])
+	}
+}
+
+func TestHandleMessageIgnoresKnownPartners(t *testing.T) {
+	a := assert.New(t)
+	service, recorder := newTestService(t, nil, map[string]interface{}{
+		"res.partner.search_read": []map[string]interface{}{{"id": 3}},
+	})
+
+	a.NoError(service.HandleMessage(context.Background(), whatsapp.WebhookMessage{SenderID: "6598765432", Type: "text", Body: "Hi"}))
+	a.Len(recorder.Calls(), 1)
+}
@@ -0,0 +1,174 @@
+package custom
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Operations a model can allow
+const (
+	Search = "search"
+	Read   = "read"
+	Create = "create"
+	Update = "update"
+)
+
+// Field types, as Odoo names them
+const (
+	typeChar     = "char"
+	typeText     = "text"
+	typeInteger  = "integer"
+	typeFloat    = "float"
+	typeBoolean  = "boolean"
+	typeDate     = "date"
+	typeMany2one = "many2one"
+)
+
+// Field is a field users can set when they create or update a record
+type Field struct {
+	Name string `json:"name"`
+	// Label names the field in questions, e.g. "serial number"
+	Label string `json:"label"`
+	Type  string `json:"type,omitempty"`
+	// Relation is the model of a many2one field, whose records are matched
+	// by name
+	Relation string `json:"relation,omitempty"`
+}
+
+// Model is an Odoo model, typically of a custom module, that users reach
+// with chat commands, e.g. "equipment drill" and "new equipment"
+type Model struct {
+	Name string `json:"model"`
+	// Command is the word that starts the model's commands, e.g. "equipment"
+	Command    string   `json:"command"`
+	Operations []string `json:"operations"`
+	// Search are the fields matched by the text of a search
+	Search []string `json:"search,omitempty"`
+	// Domain always applies to searches, e.g. to leave out archived records
+	Domain odoo.Domain `json:"domain,omitempty"`
+	Order  string      `json:"order,omitempty"`
+	// Title renders a record in lists and Display on its own, with {{field}}
+	// placeholders. Title defaults to the record's name.
+	Title   string `json:"title,omitempty"`
+	Display string `json:"display,omitempty"`
+	// Fields can be set by users, Required ones when creating a record
+	Fields   []Field  `json:"fields,omitempty"`
+	Required []string `json:"required,omitempty"`
+}
+
+// Allows reports whether the model allows an operation
+func (m *Model) Allows(operation string) bool {
+	for _, o := range m.Operations {
+		if o == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// field returns the field of the model with that name
+func (m *Model) field(name string) (Field, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// placeholderPattern finds the {{field}} placeholders of templates
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+
+// title returns the model's title template
+func (m *Model) title() string {
+	if m.Title == "" {
+		return "{{display_name}}"
+	}
+	return m.Title
+}
+
+// readFields returns the fields the model's templates show
+func (m *Model) readFields() []string {
+	fields := []string{"display_name"}
+	seen := map[string]bool{"display_name": true}
+	for _, template := range []string{m.title(), m.Display} {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				fields = append(fields, match[1])
+			}
+		}
+	}
+	return fields
+}
+
+// LoadModels reads the models users can reach from a JSON file. An empty
+// path means none.
+func LoadModels(path string) ([]Model, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read custom models: %w", err)
+	}
+
+	var models []Model
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, fmt.Errorf("failed to parse custom models: %w", err)
+	}
+	commands := map[string]bool{}
+	for i, m := range models {
+		if m.Name == "" || m.Command == "" || len(m.Operations) == 0 {
+			return nil, fmt.Errorf("custom model %d needs a model, a command and operations", i)
+		}
+		command := strings.ToLower(m.Command)
+		if commands[command] {
+			return nil, fmt.Errorf("custom models share the command %q", m.Command)
+		}
+		commands[command] = true
+		models[i].Command = command
+
+		for _, o := range m.Operations {
+			switch o {
+			case Search, Read, Create, Update:
+			default:
+				return nil, fmt.Errorf("custom model %s has an unknown operation %q", m.Name, o)
+			}
+		}
+		if m.Allows(Search) && len(m.Search) == 0 {
+			return nil, fmt.Errorf("custom model %s needs search fields to be searched", m.Name)
+		}
+		if (m.Allows(Create) || m.Allows(Update)) && len(m.Fields) == 0 {
+			return nil, fmt.Errorf("custom model %s needs fields to be created or updated", m.Name)
+		}
+		for j, f := range m.Fields {
+			if f.Name == "" || f.Label == "" {
+				return nil, fmt.Errorf("a field of custom model %s needs a name and a label", m.Name)
+			}
+			switch f.Type {
+			case "":
+				models[i].Fields[j].Type = typeChar
+			case typeChar, typeText, typeInteger, typeFloat, typeBoolean, typeDate:
+			case typeMany2one:
+				if f.Relation == "" {
+					return nil, fmt.Errorf("field %s of custom model %s needs a relation", f.Name, m.Name)
+				}
+			default:
+				return nil, fmt.Errorf("field %s of custom model %s has an unsupported type %q", f.Name, m.Name, f.Type)
+			}
+		}
+		for _, name := range m.Required {
+			if _, ok := m.field(name); !ok {
+				return nil, fmt.Errorf("required field %s of custom model %s isn't one of its fields", name, m.Name)
+			}
+		}
+	}
+	return models, nil
+}
@@ -0,0 +1,415 @@
+// Package custom exposes the Odoo models declared in a config file, such as
+// those of custom modules, as chat commands: search, view, create and
+// update, as each model allows.
+package custom
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+const (
+	// maxChoices is the number of rows a WhatsApp list message can hold
+	maxChoices = 10
+	dateLayout = "2006-01-02"
+)
+
+// draft is a record being created, one required field at a time
+type draft struct {
+	Values map[string]interface{}
+	Next   int
+}
+
+// edit is a field of a record waiting for its new value
+type edit struct {
+	ID    int
+	Field Field
+}
+
+// Service answers the chat commands of one model, e.g. "equipment drill"
+// to search it and "new equipment" to create a record
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	sessions *agent.Sessions
+	model    Model
+
+	searchPattern *regexp.Regexp
+	createPattern *regexp.Regexp
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, sessions *agent.Sessions, model Model) *Service {
+	command := strings.ReplaceAll(regexp.QuoteMeta(model.Command), `\ `, `\s+`)
+	return &Service{
+		odoo:          client,
+		sender:        sender,
+		sessions:      sessions,
+		model:         model,
+		searchPattern: regexp.MustCompile(`(?i)^\s*(?:(?:find|search|show|list)\s+)?` + command + `(?:s|es)?\b\s*(.*?)\s*\??$`),
+		createPattern: regexp.MustCompile(`(?i)^\s*(?:new|add|create)\s+(?:an?\s+)?` + command + `\b`),
+	}
+}
+
+// Name is derived from the command, without the colons that separate the
+// parts of reply ids
+func (s *Service) Name() string {
+	return "custom." + strings.Join(strings.Fields(s.model.Command), "_")
+}
+
+func (s *Service) Help() string {
+	var commands []string
+	if s.model.Allows(Search) {
+		commands = append(commands, fmt.Sprintf(`"%s <search>" to find %s`, s.model.Command, s.model.Command))
+	}
+	if s.model.Allows(Create) {
+		commands = append(commands, fmt.Sprintf(`"new %s" to add one`, s.model.Command))
+	}
+	return strings.Join(commands, ", ")
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	if msg.Type != "text" {
+		return false
+	}
+	return (s.model.Allows(Create) && s.createPattern.MatchString(msg.Body)) ||
+		(s.model.Allows(Search) && s.searchPattern.MatchString(msg.Body))
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// Custom models run with the user's own access rights, which needs their
+	// API key: the service account could change any record
+	user := odoo.UserFrom(ctx)
+	if user == nil {
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("%s is only available to Odoo users.", capitalize(s.model.Command)))
+	}
+	if user.APIKey == "" {
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("To use %s from WhatsApp, link this number to your Odoo user with an API key first.", s.model.Command))
+	}
+
+	if msg.ReplyID != "" {
+		return s.handleReply(ctx, msg)
+	}
+	if session := s.sessions.Get(msg.SenderID); session != nil && session.Capability == s.Name() {
+		if strings.EqualFold(strings.TrimSpace(msg.Body), "cancel") {
+			s.sessions.End(msg.SenderID)
+			return s.send(ctx, msg.SenderID, "OK, nothing was changed.")
+		}
+		switch data := session.Data.(type) {
+		case *draft:
+			return s.continueCreate(ctx, msg, data)
+		case *edit:
+			return s.finishUpdate(ctx, msg, data)
+		}
+	}
+
+	if s.model.Allows(Create) && s.createPattern.MatchString(msg.Body) {
+		d := &draft{Values: map[string]interface{}{}}
+		if len(s.model.Required) == 0 {
+			return s.create(ctx, msg.SenderID, d)
+		}
+		s.sessions.Start(msg.SenderID, s.Name(), d)
+		return s.ask(ctx, msg.SenderID, d)
+	}
+	m := s.searchPattern.FindStringSubmatch(msg.Body)
+	return s.search(ctx, msg.SenderID, m[1])
+}
+
+func (s *Service) handleReply(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	parts := strings.Split(msg.ReplyID, ":")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid reply id %q", msg.ReplyID)
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid reply id %q: %w", msg.ReplyID, err)
+	}
+
+	switch {
+	case parts[1] == "read" && s.model.Allows(Read):
+		return s.show(ctx, msg.SenderID, id)
+	case parts[1] == "edit" && s.model.Allows(Update):
+		return s.sendFields(ctx, msg.SenderID, id)
+	case parts[1] == "field" && s.model.Allows(Update) && len(parts) == 4:
+		field, ok := s.model.field(parts[3])
+		if !ok {
+			return fmt.Errorf("invalid reply id %q: no field %s", msg.ReplyID, parts[3])
+		}
+		s.sessions.Start(msg.SenderID, s.Name(), &edit{ID: id, Field: field})
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("What is the new %s?%s\nReply *cancel* to stop.", field.Label, hint(field)))
+	}
+	return fmt.Errorf("invalid reply id %q", msg.ReplyID)
+}
+
+// search lists the records matching text, or shows the only one
+func (s *Service) search(ctx context.Context, to, text string) error {
+	domain := append(odoo.Domain{}, s.model.Domain...)
+	if text != "" {
+		for i := 1; i < len(s.model.Search); i++ {
+			domain = append(domain, "|")
+		}
+		for _, field := range s.model.Search {
+			domain = append(domain, odoo.Cond(field, "ilike", text))
+		}
+	}
+	records, err := s.odoo.SearchRead(ctx, s.model.Name, domain, s.model.readFields(),
+		&odoo.SearchOptions{Limit: maxChoices, Order: s.model.Order})
+	if err != nil {
+		return fmt.Errorf("failed to search %s: %w", s.model.Name, err)
+	}
+
+	switch {
+	case len(records) == 0 && text != "":
+		return s.send(ctx, to, fmt.Sprintf("No %s matches \"%s\".", s.model.Command, text))
+	case len(records) == 0:
+		return s.send(ctx, to, fmt.Sprintf("There is no %s yet.", s.model.Command))
+	case len(records) == 1 && s.model.Allows(Read):
+		return s.sendRecord(ctx, to, records[0])
+	case !s.model.Allows(Read):
+		// Without reading records there is nothing to pick them for
+		var b strings.Builder
+		fmt.Fprintf(&b, "🔎 *%s*", capitalize(s.model.Command))
+		for _, r := range records {
+			fmt.Fprintf(&b, "\n• %s", render(s.model.title(), r))
+		}
+		return s.send(ctx, to, b.String())
+	}
+
+	rows := make([]whatsapp.ListRow, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, whatsapp.ListRow{
+			ID:    fmt.Sprintf("%s:read:%d", s.Name(), r.ID()),
+			Title: render(s.model.title(), r),
+		})
+	}
+	body := fmt.Sprintf("%d found. Which one do you mean?", len(records))
+	if len(records) == maxChoices {
+		body = fmt.Sprintf("Here are the first %d found. Which one do you mean?", maxChoices)
+	}
+	_, err = s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     body,
+		Button:   "Choose",
+		Sections: []whatsapp.ListSection{{Title: capitalize(s.model.Command), Rows: rows}},
+	})
+	return err
+}
+
+// show reads a record and sends it
+func (s *Service) show(ctx context.Context, to string, id int) error {
+	records, err := s.odoo.Read(ctx, s.model.Name, []int{id}, s.model.readFields(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to read %s %d: %w", s.model.Name, id, err)
+	}
+	if len(records) == 0 {
+		return s.send(ctx, to, fmt.Sprintf("That %s no longer exists.", s.model.Command))
+	}
+	return s.sendRecord(ctx, to, records[0])
+}
+
+// sendRecord sends a record as its display template, with a button to edit
+// it when the model allows
+func (s *Service) sendRecord(ctx context.Context, to string, r odoo.Record) error {
+	text := "*" + render(s.model.title(), r) + "*"
+	if s.model.Display != "" {
+		text += "\n" + render(s.model.Display, r)
+	}
+	if !s.model.Allows(Update) {
+		return s.send(ctx, to, text)
+	}
+	_, err := s.sender.SendButtons(ctx, whatsapp.ButtonMessage{
+		To:      to,
+		Body:    text,
+		Buttons: []whatsapp.Button{{ID: fmt.Sprintf("%s:edit:%d", s.Name(), r.ID()), Title: "Edit"}},
+	})
+	return err
+}
+
+// sendFields asks which field of a record to change
+func (s *Service) sendFields(ctx context.Context, to string, id int) error {
+	rows := make([]whatsapp.ListRow, 0, len(s.model.Fields))
+	for _, f := range s.model.Fields {
+		if len(rows) == maxChoices {
+			break
+		}
+		rows = append(rows, whatsapp.ListRow{ID: fmt.Sprintf("%s:field:%d:%s", s.Name(), id, f.Name), Title: capitalize(f.Label)})
+	}
+	_, err := s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     "What do you want to change?",
+		Button:   "Choose field",
+		Sections: []whatsapp.ListSection{{Title: "Fields", Rows: rows}},
+	})
+	return err
+}
+
+func (s *Service) finishUpdate(ctx context.Context, msg whatsapp.WebhookMessage, e *edit) error {
+	value, problem, err := s.parse(ctx, e.Field, msg.Body)
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		return s.send(ctx, msg.SenderID, problem)
+	}
+	s.sessions.End(msg.SenderID)
+	if err := s.odoo.Write(ctx, s.model.Name, []int{e.ID}, map[string]interface{}{e.Field.Name: value}); err != nil {
+		return fmt.Errorf("failed to update %s %d: %w", s.model.Name, e.ID, err)
+	}
+	return s.send(ctx, msg.SenderID, fmt.Sprintf("✅ %s updated.", capitalize(e.Field.Label)))
+}
+
+func (s *Service) continueCreate(ctx context.Context, msg whatsapp.WebhookMessage, d *draft) error {
+	field, _ := s.model.field(s.model.Required[d.Next])
+	value, problem, err := s.parse(ctx, field, msg.Body)
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		return s.send(ctx, msg.SenderID, problem)
+	}
+	d.Values[field.Name] = value
+	d.Next++
+	if d.Next < len(s.model.Required) {
+		return s.ask(ctx, msg.SenderID, d)
+	}
+	s.sessions.End(msg.SenderID)
+	return s.create(ctx, msg.SenderID, d)
+}
+
+// ask asks for the next required field of a draft
+func (s *Service) ask(ctx context.Context, to string, d *draft) error {
+	field, _ := s.model.field(s.model.Required[d.Next])
+	text := fmt.Sprintf("What is the %s?%s", field.Label, hint(field))
+	if d.Next == 0 {
+		text = fmt.Sprintf("New %s: %s\nReply *cancel* to stop.", s.model.Command, strings.ToLower(text[:1])+text[1:])
+	}
+	return s.send(ctx, to, text)
+}
+
+func (s *Service) create(ctx context.Context, to string, d *draft) error {
+	id, err := s.odoo.Create(ctx, s.model.Name, d.Values)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.model.Name, err)
+	}
+	records, err := s.odoo.Read(ctx, s.model.Name, []int{id}, s.model.readFields(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to read %s %d: %w", s.model.Name, id, err)
+	}
+	title := fmt.Sprint(id)
+	if len(records) > 0 {
+		title = render(s.model.title(), records[0])
+	}
+	return s.send(ctx, to, fmt.Sprintf("✅ %s *%s* added.", capitalize(s.model.Command), title))
+}
+
+// parse converts an answer to the value of a field. Answers that don't fit
+// the field return the problem to tell the user.
+func (s *Service) parse(ctx context.Context, f Field, text string) (interface{}, string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Sprintf("Please send the %s as text.", f.Label), nil
+	}
+
+	switch f.Type {
+	case typeInteger:
+		if n, err := strconv.Atoi(text); err == nil {
+			return n, "", nil
+		}
+		return nil, fmt.Sprintf("The %s should be a whole number.", f.Label), nil
+	case typeFloat:
+		if n, err := strconv.ParseFloat(strings.ReplaceAll(text, ",", ""), 64); err == nil {
+			return n, "", nil
+		}
+		return nil, fmt.Sprintf("The %s should be a number.", f.Label), nil
+	case typeBoolean:
+		switch strings.ToLower(text) {
+		case "yes", "y", "true":
+			return true, "", nil
+		case "no", "n", "false":
+			return false, "", nil
+		}
+		return nil, fmt.Sprintf("Please answer *yes* or *no* for the %s.", f.Label), nil
+	case typeDate:
+		if day, err := time.Parse(dateLayout, text); err == nil {
+			return day.Format(dateLayout), "", nil
+		}
+		return nil, fmt.Sprintf("Please send the %s as YYYY-MM-DD.", f.Label), nil
+	case typeMany2one:
+		var results [][]interface{}
+		if err := s.odoo.ExecuteKW(ctx, f.Relation, "name_search", []interface{}{},
+			map[string]interface{}{"name": text, "limit": 5}, &results); err != nil {
+			return nil, "", fmt.Errorf("failed to search %s: %w", f.Relation, err)
+		}
+		var match []interface{}
+		for _, r := range results {
+			if len(r) == 2 && strings.EqualFold(fmt.Sprint(r[1]), text) {
+				match = r
+			}
+		}
+		if match == nil && len(results) == 1 {
+			match = results[0]
+		}
+		if match == nil {
+			if len(results) == 0 {
+				return nil, fmt.Sprintf("I couldn't find a %s called \"%s\". Please try again.", f.Label, text), nil
+			}
+			return nil, fmt.Sprintf("Several matches for \"%s\". Please send the full %s.", text, f.Label), nil
+		}
+		id, _ := match[0].(float64)
+		return int(id), "", nil
+	}
+	return text, "", nil
+}
+
+// hint tells how to answer for fields that take a format
+func hint(f Field) string {
+	switch f.Type {
+	case typeBoolean:
+		return " (yes or no)"
+	case typeDate:
+		return " (YYYY-MM-DD)"
+	}
+	return ""
+}
+
+// render fills the {{field}} placeholders of a template with a record's
+// values
+func render(template string, r odoo.Record) string {
+	return strings.TrimSpace(placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		field := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if _, name := r.Many2one(field); name != "" {
+			return name
+		}
+		switch v := r[field].(type) {
+		case string:
+			return v
+		case bool:
+			// Odoo encodes empty fields as false
+			if v {
+				return "yes"
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	}))
+}
+
+func capitalize(text string) string {
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
@@ -0,0 +1,139 @@
+package custom
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+var equipment = Model{
+	Name:       "x_equipment",
+	Command:    "equipment",
+	Operations: []string{Search, Read, Create, Update},
+	Search:     []string{"x_name", "x_serial"},
+	Domain:     odoo.Domain{odoo.Cond("x_active", "=", true)},
+	Order:      "x_name",
+	Title:      "{{x_name}} ({{x_serial}})",
+	Display:    "Location: {{x_location_id}}\nNext service: {{x_service_date}}",
+	Fields: []Field{
+		{Name: "x_name", Label: "name", Type: typeChar},
+		{Name: "x_serial", Label: "serial number", Type: typeChar},
+		{Name: "x_location_id", Label: "location", Type: typeMany2one, Relation: "x_location"},
+		{Name: "x_service_date", Label: "next service date", Type: typeDate},
+	},
+	Required: []string{"x_name", "x_serial", "x_location_id"},
+}
+
+func newTestService(t *testing.T) (*Service, *odootest.Server, *agenttest.Sender) {
+	server := odootest.NewServer(t)
+	server.Relate("x_equipment", "x_location_id", odootest.Relation{Model: "x_location"})
+	server.Seed("x_location", odoo.Record{"id": 1, "name": "Workshop"}, odoo.Record{"id": 2, "name": "Warehouse"})
+	server.Seed("x_equipment",
+		odoo.Record{"id": 1, "x_name": "Drill", "x_serial": "DR-01", "x_location_id": 1, "x_service_date": "2025-06-01", "x_active": true},
+		odoo.Record{"id": 2, "x_name": "Drill press", "x_serial": "DP-07", "x_location_id": 2, "x_active": true},
+		odoo.Record{"id": 3, "x_name": "Old drill", "x_serial": "DR-00", "x_active": false},
+	)
+	sender := &agenttest.Sender{}
+	return NewService(server.Client(), sender, agent.NewSessions(time.Hour), equipment), server, sender
+}
+
+func TestSearchAndUpdate(t *testing.T) {
+	a := assert.New(t)
+	service, server, sender := newTestService(t)
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: odootest.AdminID, APIKey: odootest.AdminKey})
+
+	msg := whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "equipment drill"}
+	a.True(service.Match(msg))
+	a.True(service.Match(whatsapp.WebhookMessage{Type: "text", Body: "new equipment"}))
+	a.False(service.Match(whatsapp.WebhookMessage{Type: "text", Body: "equipmentless"}))
+
+	a.NoError(service.Handle(context.Background(), msg))
+	a.Equal("Equipment is only available to Odoo users.", sender.LastText())
+	a.NoError(service.Handle(odoo.WithUser(context.Background(), &odoo.User{ID: odootest.AdminID}), msg))
+	a.Equal("To use equipment from WhatsApp, link this number to your Odoo user with an API key first.", sender.LastText())
+
+	a.NoError(service.Handle(ctx, msg))
+	if a.Len(sender.Lists, 1) {
+		rows := sender.Lists[0].Sections[0].Rows
+		if a.Len(rows, 2) {
+			a.Equal("Drill (DR-01)", rows[0].Title)
+			a.Equal("custom.equipment:read:1", rows[0].ID)
+		}
+	}
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "interactive", ReplyID: "custom.equipment:read:1"}))
+	if a.Len(sender.Buttons, 1) {
+		a.Equal("*Drill (DR-01)*\nLocation: Workshop\nNext service: 2025-06-01", sender.Buttons[0].Body)
+		a.Equal("custom.equipment:edit:1", sender.Buttons[0].Buttons[0].ID)
+	}
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "interactive", ReplyID: "custom.equipment:field:1:x_service_date"}))
+	a.Equal("What is the new next service date? (YYYY-MM-DD)\nReply *cancel* to stop.", sender.LastText())
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "next month"}))
+	a.Equal("Please send the next service date as YYYY-MM-DD.", sender.LastText())
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "2025-07-15"}))
+	a.Equal("✅ Next service date updated.", sender.LastText())
+	drills := server.Records("x_equipment", odoo.Domain{odoo.Cond("id", "=", 1)})
+	a.Equal("2025-07-15", drills[0].String("x_service_date"))
+
+	// A single match is shown right away
+	msg.Body = "find equipment DP-07"
+	a.NoError(service.Handle(ctx, msg))
+	a.Len(sender.Buttons, 2)
+}
+
+func TestCreate(t *testing.T) {
+	a := assert.New(t)
+	service, server, sender := newTestService(t)
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: odootest.AdminID, APIKey: odootest.AdminKey})
+	reply := func(text string) string {
+		a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: text}))
+		return sender.LastText()
+	}
+
+	a.Equal("New equipment: what is the name?\nReply *cancel* to stop.", reply("new equipment"))
+	a.Equal("What is the serial number?", reply("Lathe"))
+	a.Equal("What is the location?", reply("LT-02"))
+	a.Equal(`I couldn't find a location called "Garage". Please try again.`, reply("Garage"))
+	a.Equal("✅ Equipment *Lathe (LT-02)* added.", reply("warehouse"))
+
+	lathes := server.Records("x_equipment", odoo.Domain{odoo.Cond("x_name", "=", "Lathe")})
+	if a.Len(lathes, 1) {
+		a.Equal(2, lathes[0].Int("x_location_id"))
+	}
+
+	reply("add equipment")
+	a.Equal("OK, nothing was changed.", reply("cancel"))
+}
+
+func TestLoadModelsValidates(t *testing.T) {
+	a := assert.New(t)
+	path := t.TempDir() + "/models.json"
+
+	models, err := LoadModels("")
+	a.NoError(err)
+	a.Empty(models)
+
+	a.NoError(os.WriteFile(path, []byte(`[{"model": "x_equipment", "command": "Equipment", "operations": ["search"], "search": ["x_name"]}]`), 0o600))
+	models, err = LoadModels(path)
+	if a.NoError(err) && a.Len(models, 1) {
+		a.Equal("equipment", models[0].Command)
+	}
+
+	a.NoError(os.WriteFile(path, []byte(`[{"model": "x_equipment", "command": "equipment", "operations": ["delete"]}]`), 0o600))
+	_, err = LoadModels(path)
+	a.ErrorContains(err, `unknown operation "delete"`)
+
+	a.NoError(os.WriteFile(path, []byte(`[{"model": "x_equipment", "command": "equipment", "operations": ["create"],
+		"fields": [{"name": "x_name", "label": "name"}], "required": ["x_serial"]}]`), 0o600))
+	_, err = LoadModels(path)
+	a.ErrorContains(err, "required field x_serial")
+}
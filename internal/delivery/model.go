@@ -0,0 +1,14 @@
+package delivery
+
+// stateLabels describes stock.picking states to customers
+var stateLabels = map[string]string{
+	"draft":     "Being prepared",
+	"waiting":   "Waiting for another operation",
+	"confirmed": "Waiting for stock",
+	"assigned":  "Ready to ship",
+	"done":      "Shipped",
+	"cancel":    "Cancelled",
+}
+
+// carrierFields are added by Odoo's delivery app, which may not be installed
+var carrierFields = []string{"carrier_id", "carrier_tracking_ref", "carrier_tracking_url"}
@@ -0,0 +1,326 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/attachment"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxDeliveries is the number of deliveries listed in an answer
+const maxDeliveries = 5
+
+// shippedFor is how long shipped deliveries are still reported
+const shippedFor = 7 * 24 * time.Hour
+
+var trackPattern = regexp.MustCompile(`(?i)\b(?:where(?:'s|\s+is|\s+are)\s+my\s+(?:orders?|deliver(?:y|ies)|parcels?|packages?|shipments?)|track(?:ing)?(?:\s+my)?\s+(?:orders?|deliver(?:y|ies)|parcels?|packages?|shipments?))\b`)
+
+var pickingFields = []string{"name", "origin", "state", "scheduled_date", "date_done", "partner_id"}
+
+// Service tells customers where their deliveries (outgoing stock.picking)
+// are, and lets them know when one ships
+type Service struct {
+	odoo   *odoo.Client
+	sender agent.Sender
+	// template is the message template announcing shipped deliveries, with
+	// the customer, the order, the carrier and the tracking reference as
+	// parameters. Without one a text message is sent.
+	template string
+	language string
+	// now is replaced in tests
+	now func() time.Time
+
+	mu sync.Mutex
+	// carrier is whether the delivery app's fields exist, once checked
+	carrier *bool
+	// notified holds the deliveries whose shipment was announced
+	notified map[int]bool
+}
+
+func NewService(client *odoo.Client, sender agent.Sender) *Service {
+	language := os.Getenv("DELIVERY_TEMPLATE_LANGUAGE")
+	if language == "" {
+		language = "en"
+	}
+	return &Service{
+		odoo:     client,
+		sender:   sender,
+		template: os.Getenv("DELIVERY_TEMPLATE"),
+		language: language,
+		now:      time.Now,
+		notified: map[int]bool{},
+	}
+}
+
+func (s *Service) Name() string {
+	return "delivery"
+}
+
+func (s *Service) Help() string {
+	return `"where is my order" to track your deliveries`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && trackPattern.MatchString(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	partner, err := s.odoo.PartnerByPhone(ctx, msg.SenderID, []string{"commercial_partner_id", "tz"})
+	if err != nil {
+		return err
+	}
+	if partner == nil {
+		return s.send(ctx, msg.SenderID, "I couldn't find your number in Odoo, so I can't look up your orders.")
+	}
+	commercialID, _ := partner.Many2one("commercial_partner_id")
+	if commercialID == 0 {
+		commercialID = partner.ID()
+	}
+
+	domain := odoo.Domain{
+		odoo.Cond("picking_type_code", "=", "outgoing"),
+		odoo.Cond("partner_id", "child_of", commercialID),
+		odoo.Cond("state", "!=", "cancel"),
+		"|", odoo.Cond("state", "!=", "done"),
+		odoo.Cond("date_done", ">=", s.now().Add(-shippedFor).UTC().Format(odoo.DatetimeFormat)),
+	}
+	// "where is my order S00042" narrows the answer to that order
+	if refs := attachment.References(msg.Body); len(refs) > 0 {
+		var refDomain odoo.Domain
+		for i, ref := range refs {
+			if i > 0 {
+				refDomain = append(odoo.Domain{"|"}, refDomain...)
+			}
+			refDomain = append(refDomain, "|", odoo.Cond("name", "=ilike", ref), odoo.Cond("origin", "=ilike", ref))
+		}
+		domain = append(domain, refDomain...)
+	}
+
+	fields, err := s.fields(ctx)
+	if err != nil {
+		return err
+	}
+	pickings, err := s.odoo.SearchRead(ctx, "stock.picking", domain, fields,
+		&odoo.SearchOptions{Order: "scheduled_date desc", Limit: maxDeliveries})
+	if err != nil {
+		return fmt.Errorf("failed to search deliveries: %w", err)
+	}
+	if len(pickings) == 0 {
+		return s.send(ctx, msg.SenderID, "You have no deliveries on the way. If you're expecting one, please tell us the order number.")
+	}
+
+	location, err := time.LoadLocation(partner.String("tz"))
+	if err != nil || partner.String("tz") == "" {
+		location = time.UTC
+	}
+	return s.send(ctx, msg.SenderID, FormatDeliveries(pickings, location))
+}
+
+// FormatDeliveries renders deliveries with their status, dates and
+// tracking, in the customer's timezone
+func FormatDeliveries(pickings []odoo.Record, location *time.Location) string {
+	var b strings.Builder
+	b.WriteString("📦 *Your deliveries*")
+	for _, p := range pickings {
+		fmt.Fprintf(&b, "\n\n*%s*", p.String("name"))
+		if origin := p.String("origin"); origin != "" {
+			fmt.Fprintf(&b, " (%s)", origin)
+		}
+
+		state := p.String("state")
+		fmt.Fprintf(&b, "\n%s", stateLabels[state])
+		if state == "done" {
+			if date, ok := parseDatetime(p.String("date_done"), location); ok {
+				fmt.Fprintf(&b, " on %s", date.Format("Mon 2 Jan"))
+			}
+		} else if date, ok := parseDatetime(p.String("scheduled_date"), location); ok {
+			fmt.Fprintf(&b, ", scheduled for %s", date.Format("Mon 2 Jan"))
+		}
+
+		_, carrier := p.Many2one("carrier_id")
+		if ref := p.String("carrier_tracking_ref"); ref != "" {
+			if carrier != "" {
+				fmt.Fprintf(&b, "\n%s tracking: %s", carrier, ref)
+			} else {
+				fmt.Fprintf(&b, "\nTracking: %s", ref)
+			}
+		} else if carrier != "" {
+			fmt.Fprintf(&b, "\nCarrier: %s", carrier)
+		}
+		if url := p.String("carrier_tracking_url"); url != "" {
+			fmt.Fprintf(&b, "\n%s", url)
+		}
+	}
+	return b.String()
+}
+
+// Run announces deliveries validated in Odoo until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	// Deliveries validated before now were announced before a restart
+	since := s.now().UTC().Format(odoo.DatetimeFormat)
+
+	fields, err := s.fields(ctx)
+	if err != nil {
+		log.Printf("Failed to check the delivery fields: %v", err)
+		fields = pickingFields
+	}
+	watcher := &odoo.Watcher{
+		Client: s.odoo,
+		Model:  "stock.picking",
+		Domain: odoo.Domain{
+			odoo.Cond("picking_type_code", "=", "outgoing"),
+			odoo.Cond("state", "=", "done"),
+			odoo.Cond("date_done", ">=", since),
+		},
+		Fields:   fields,
+		Interval: interval,
+	}
+	watcher.Run(ctx, s.NotifyShipped)
+}
+
+// NotifyShipped tells customers that their deliveries were validated.
+// Each delivery is only announced once, even when it's written again.
+func (s *Service) NotifyShipped(ctx context.Context, pickings []odoo.Record) error {
+	for _, p := range pickings {
+		if p.String("state") != "done" {
+			continue
+		}
+		s.mu.Lock()
+		notified := s.notified[p.ID()]
+		s.notified[p.ID()] = true
+		s.mu.Unlock()
+		if notified {
+			continue
+		}
+
+		if err := s.notify(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify sends the shipment of a delivery to its recipient, or to the
+// company they belong to when they have no number
+func (s *Service) notify(ctx context.Context, picking odoo.Record) error {
+	partnerID, _ := picking.Many2one("partner_id")
+	if partnerID == 0 {
+		return nil
+	}
+	partners, err := s.odoo.Read(ctx, "res.partner", []int{partnerID}, []string{"name", "phone", "mobile", "commercial_partner_id"}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read delivery partner: %w", err)
+	}
+	if len(partners) == 0 {
+		return nil
+	}
+	partner := partners[0]
+	phone := partnerPhone(partner)
+	if commercialID, _ := partner.Many2one("commercial_partner_id"); phone == "" && commercialID != 0 && commercialID != partnerID {
+		commercial, err := s.odoo.Read(ctx, "res.partner", []int{commercialID}, []string{"phone", "mobile"}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to read delivery partner: %w", err)
+		}
+		if len(commercial) > 0 {
+			phone = partnerPhone(commercial[0])
+		}
+	}
+	if phone == "" {
+		log.Printf("Delivery %s has no phone number to notify", picking.String("name"))
+		return nil
+	}
+
+	order := picking.String("origin")
+	if order == "" {
+		order = picking.String("name")
+	}
+	_, carrier := picking.Many2one("carrier_id")
+	ref := picking.String("carrier_tracking_ref")
+
+	if s.template != "" {
+		_, err = s.sender.SendTemplate(ctx, whatsapp.TemplateMessage{
+			To:       phone,
+			Name:     s.template,
+			Language: s.language,
+			// Template parameters can't be empty
+			BodyParameters: []string{partner.String("name"), order, orDash(carrier), orDash(ref)},
+		})
+		return err
+	}
+
+	text := fmt.Sprintf("🚚 Your order %s has shipped!", order)
+	if ref != "" {
+		if carrier != "" {
+			text += fmt.Sprintf("\n%s tracking: %s", carrier, ref)
+		} else {
+			text += fmt.Sprintf("\nTracking: %s", ref)
+		}
+	}
+	if url := picking.String("carrier_tracking_url"); url != "" {
+		text += "\n" + url
+	}
+	return s.send(ctx, phone, text)
+}
+
+// fields returns the stock.picking fields to read, with the carrier ones
+// when the delivery app is installed
+func (s *Service) fields(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	carrier := s.carrier
+	s.mu.Unlock()
+
+	if carrier == nil {
+		var fields map[string]interface{}
+		if err := s.odoo.ExecuteKW(ctx, "stock.picking", "fields_get", []interface{}{carrierFields},
+			map[string]interface{}{"attributes": []string{"type"}}, &fields); err != nil {
+			return nil, fmt.Errorf("failed to read delivery fields: %w", err)
+		}
+		_, ok := fields["carrier_tracking_ref"]
+		carrier = &ok
+		s.mu.Lock()
+		s.carrier = carrier
+		s.mu.Unlock()
+	}
+
+	if !*carrier {
+		return pickingFields, nil
+	}
+	return append(append([]string{}, pickingFields...), carrierFields...), nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+func partnerPhone(partner odoo.Record) string {
+	if mobile := partner.String("mobile"); mobile != "" {
+		return mobile
+	}
+	return partner.String("phone")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// parseDatetime reads an Odoo datetime, which is in UTC, into location
+func parseDatetime(value string, location *time.Location) (time.Time, bool) {
+	t, err := time.Parse(odoo.DatetimeFormat, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.In(location), true
+}
@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+const customerPhone = "6598765432"
+
+// newTestService runs the service against a fake Odoo with a customer
+// company, its contact and their deliveries
+func newTestService(t *testing.T) (*Service, *agenttest.Sender, *odootest.Server) {
+	server := odootest.NewServer(t)
+	server.Relate("stock.picking", "carrier_id", odootest.Relation{Model: "delivery.carrier"})
+	server.Seed("res.partner",
+		odoo.Record{"id": 7, "name": "Azure Interior", "is_company": true, "commercial_partner_id": 7, "phone": "+6561234567"},
+		odoo.Record{"id": 8, "name": "Brandon Freeman", "parent_id": 7, "commercial_partner_id": 7, "mobile": "+" + customerPhone, "tz": "Asia/Singapore"},
+		odoo.Record{"id": 9, "name": "Deco Addict", "is_company": true, "commercial_partner_id": 9},
+	)
+	server.Seed("delivery.carrier", odoo.Record{"id": 1, "name": "DHL"})
+	server.Seed("stock.picking",
+		odoo.Record{"id": 1, "name": "WH/OUT/00012", "origin": "S00042", "picking_type_code": "outgoing", "partner_id": 8,
+			"state": "assigned", "scheduled_date": "2025-03-13 18:00:00", "carrier_id": 1, "carrier_tracking_ref": false},
+		odoo.Record{"id": 2, "name": "WH/OUT/00009", "origin": "S00040", "picking_type_code": "outgoing", "partner_id": 7,
+			"state": "done", "scheduled_date": "2025-03-10 02:00:00", "date_done": "2025-03-10 03:00:00",
+			"carrier_id": 1, "carrier_tracking_ref": "1Z999AA1", "carrier_tracking_url": "https://track.example/1Z999AA1"},
+		// Shipped too long ago, cancelled, another customer's and a receipt
+		odoo.Record{"id": 3, "name": "WH/OUT/00001", "picking_type_code": "outgoing", "partner_id": 7, "state": "done", "date_done": "2025-02-01 03:00:00"},
+		odoo.Record{"id": 4, "name": "WH/OUT/00011", "picking_type_code": "outgoing", "partner_id": 7, "state": "cancel"},
+		odoo.Record{"id": 5, "name": "WH/OUT/00013", "picking_type_code": "outgoing", "partner_id": 9, "state": "assigned"},
+		odoo.Record{"id": 6, "name": "WH/IN/00004", "picking_type_code": "incoming", "partner_id": 7, "state": "assigned"},
+	)
+
+	sender := &agenttest.Sender{}
+	service := NewService(server.Client(), sender)
+	service.now = func() time.Time { return time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC) }
+	return service, sender, server
+}
+
+func TestWhereIsMyOrder(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t)
+	ctx := context.Background()
+
+	msg := whatsapp.WebhookMessage{SenderID: customerPhone, Type: "text", Body: "Hi, where is my order?"}
+	a.True(service.Match(msg))
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("📦 *Your deliveries*\n\n"+
+		"*WH/OUT/00012* (S00042)\nReady to ship, scheduled for Fri 14 Mar\nCarrier: DHL\n\n"+
+		"*WH/OUT/00009* (S00040)\nShipped on Mon 10 Mar\nDHL tracking: 1Z999AA1\nhttps://track.example/1Z999AA1",
+		sender.LastText())
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: customerPhone, Type: "text", Body: "track my order S00040"}))
+	a.Contains(sender.LastText(), "WH/OUT/00009")
+	a.NotContains(sender.LastText(), "WH/OUT/00012")
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6500000000", Type: "text", Body: "where is my parcel"}))
+	a.Equal("I couldn't find your number in Odoo, so I can't look up your orders.", sender.LastText())
+}
+
+func TestWithoutDeliveryApp(t *testing.T) {
+	a := assert.New(t)
+	server := odootest.NewServer(t)
+	server.Seed("res.partner", odoo.Record{"id": 7, "name": "Azure Interior", "commercial_partner_id": 7, "mobile": "+" + customerPhone})
+	server.Seed("stock.picking", odoo.Record{"id": 1, "name": "WH/OUT/00012", "picking_type_code": "outgoing", "partner_id": 7, "state": "confirmed"})
+	sender := &agenttest.Sender{}
+	service := NewService(server.Client(), sender)
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{SenderID: customerPhone, Type: "text", Body: "where's my delivery"}))
+	a.Equal("📦 *Your deliveries*\n\n*WH/OUT/00012*\nWaiting for stock", sender.LastText())
+	for _, c := range server.Calls() {
+		if c.Method == "search_read" && c.Model == "stock.picking" {
+			a.NotContains(c.Kwargs["fields"], "carrier_tracking_ref")
+		}
+	}
+}
+
+func TestNotifyShipped(t *testing.T) {
+	a := assert.New(t)
+	service, sender, server := newTestService(t)
+	service.template = "delivery_shipped"
+	ctx := context.Background()
+
+	a.NoError(server.Update("stock.picking", 1, odoo.Record{"state": "done", "date_done": "2025-03-12 09:30:00", "carrier_tracking_ref": "1Z999AA2"}))
+	pickings, err := server.Client().Read(ctx, "stock.picking", []int{1}, append(pickingFields, carrierFields...), nil)
+	a.NoError(err)
+	picking := pickings[0]
+
+	a.NoError(service.NotifyShipped(ctx, []odoo.Record{picking}))
+	// Written again, e.g. when the tracking reference is corrected
+	a.NoError(service.NotifyShipped(ctx, []odoo.Record{picking}))
+	if a.Len(sender.Templates, 1) {
+		a.Equal(whatsapp.TemplateMessage{
+			To:             "+" + customerPhone,
+			Name:           "delivery_shipped",
+			Language:       "en",
+			BodyParameters: []string{"Brandon Freeman", "S00042", "DHL", "1Z999AA2"},
+		}, sender.Templates[0])
+	}
+
+	// Without a template, a contact without a number is reached through
+	// their company
+	service.template = ""
+	server.Seed("res.partner", odoo.Record{"id": 10, "name": "Nicole Ford", "parent_id": 7, "commercial_partner_id": 7})
+	server.Seed("stock.picking", odoo.Record{"id": 7, "name": "WH/OUT/00014", "picking_type_code": "outgoing", "partner_id": 10, "state": "done"})
+	pickings, err = server.Client().Read(ctx, "stock.picking", []int{7}, pickingFields, nil)
+	a.NoError(err)
+	a.NoError(service.NotifyShipped(ctx, pickings))
+	if a.NotEmpty(sender.Messages) {
+		last := sender.Messages[len(sender.Messages)-1]
+		a.Equal("+6561234567", last.To)
+		a.Equal("🚚 Your order WH/OUT/00014 has shipped!", last.Message)
+	}
+}
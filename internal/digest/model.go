@@ -0,0 +1,136 @@
+package digest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/chart"
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Digest is a report of Odoo figures sent to its recipients on a schedule
+type Digest struct {
+	Name string `json:"name"`
+	// Schedule is a cron expression evaluated in each recipient's timezone,
+	// e.g. "0 7 * * mon-fri"
+	Schedule string `json:"schedule"`
+	// Connection is the Odoo database queried, the first one when empty
+	Connection string      `json:"connection,omitempty"`
+	Recipients []Recipient `json:"recipients"`
+	Sections   []Section   `json:"sections"`
+
+	// Template, when set, is sent instead of a text message with the
+	// summary of each section as its parameters, so that the digest reaches
+	// recipients who haven't written in the last 24 hours
+	Template string `json:"template,omitempty"`
+	Language string `json:"language,omitempty"`
+
+	schedule *Schedule
+}
+
+// Recipient receives a digest. A recipient given by login gets it on the
+// phone and in the timezone of their Odoo user, unless set here.
+type Recipient struct {
+	Login    string `json:"login,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Section is one figure of a digest, computed with read_group. String values
+// of the domain may use placeholders computed in the recipient's timezone:
+// {{today}}, {{yesterday}}, {{tomorrow}}, {{week_start}} and {{month_start}}
+// are dates, and with a ":datetime" suffix, e.g. {{yesterday:datetime}},
+// the UTC datetime at which that day starts. {{now}} is the current UTC
+// datetime.
+type Section struct {
+	Title  string      `json:"title"`
+	Model  string      `json:"model"`
+	Domain odoo.Domain `json:"domain,omitempty"`
+	// Measure is the aggregated field, e.g. "amount_total:sum". Without one
+	// the section counts records.
+	Measure string `json:"measure,omitempty"`
+	// GroupBy breaks the figure down, e.g. "partner_id" or "date:month"
+	GroupBy string `json:"group_by,omitempty"`
+	// Limit is the number of groups listed, largest first
+	Limit int `json:"limit,omitempty"`
+	// Chart draws the groups as a "bar", "line" or "pie" chart sent after
+	// the digest. Digests sent as templates have no charts, since images
+	// can't be sent outside the 24 hour customer service window.
+	Chart string `json:"chart,omitempty"`
+}
+
+// defaultLimit is the number of groups listed when a section sets no limit
+const defaultLimit = 5
+
+// Summary is the rendered result of a section
+type Summary struct {
+	Title string
+	// Total is the figure of the whole section, e.g. "12,500.00 (8)"
+	Total string
+	// Lines break the total down by group
+	Lines []string
+	// Chart draws every group, for sections with a chart
+	Chart *chart.Chart
+}
+
+// LoadDigests reads digests from a JSON file. An empty path means no digests.
+func LoadDigests(path string) ([]Digest, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digests: %w", err)
+	}
+
+	var digests []Digest
+	if err := json.Unmarshal(data, &digests); err != nil {
+		return nil, fmt.Errorf("failed to parse digests: %w", err)
+	}
+	for i := range digests {
+		d := &digests[i]
+		if d.schedule, err = ParseSchedule(d.Schedule); err != nil {
+			return nil, fmt.Errorf("digest %d (%s): %w", i, d.Name, err)
+		}
+		if len(d.Recipients) == 0 || len(d.Sections) == 0 {
+			return nil, fmt.Errorf("digest %d (%s) needs recipients and sections", i, d.Name)
+		}
+		for _, r := range d.Recipients {
+			if r.Login == "" && r.Phone == "" {
+				return nil, fmt.Errorf("digest %d (%s) has a recipient without login or phone", i, d.Name)
+			}
+			if _, err := time.LoadLocation(r.Timezone); err != nil {
+				return nil, fmt.Errorf("digest %d (%s): %w", i, d.Name, err)
+			}
+		}
+		for _, s := range d.Sections {
+			if s.Title == "" || s.Model == "" {
+				return nil, fmt.Errorf("digest %d (%s) has a section without title or model", i, d.Name)
+			}
+			if s.Chart != "" {
+				if _, err := chart.ParseKind(s.Chart); err != nil {
+					return nil, fmt.Errorf("digest %d (%s), section %s: %w", i, d.Name, s.Title, err)
+				}
+				if s.GroupBy == "" {
+					return nil, fmt.Errorf("digest %d (%s), section %s: a chart needs a group_by", i, d.Name, s.Title)
+				}
+			}
+		}
+	}
+	return digests, nil
+}
+
+// For returns the digests that query the named connection. Digests without a
+// connection belong to the default one.
+func For(digests []Digest, connection, defaultConnection string) []Digest {
+	var matched []Digest
+	for _, d := range digests {
+		if d.Connection == connection || (d.Connection == "" && connection == defaultConnection) {
+			matched = append(matched, d)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,64 @@
+package digest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleNext(t *testing.T) {
+	a := assert.New(t)
+	singapore, _ := time.LoadLocation("Asia/Singapore")
+	// Wednesday 12 March 2025
+	wednesday := time.Date(2025, 3, 12, 7, 30, 0, 0, singapore)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 7 * * *", time.Date(2025, 3, 13, 7, 0, 0, 0, singapore)},
+		{"@hourly", time.Date(2025, 3, 12, 8, 0, 0, 0, singapore)},
+		{"*/15 * * * *", time.Date(2025, 3, 12, 7, 45, 0, 0, singapore)},
+		{"0 7 * * mon-fri", time.Date(2025, 3, 13, 7, 0, 0, 0, singapore)},
+		{"0 7 * * 7", time.Date(2025, 3, 16, 7, 0, 0, 0, singapore)},
+		{"0 9 1 * *", time.Date(2025, 4, 1, 9, 0, 0, 0, singapore)},
+		{"30 18 * jan,dec *", time.Date(2025, 12, 1, 18, 30, 0, 0, singapore)},
+		// Either day field matching is enough, as in cron
+		{"0 7 1 * fri", time.Date(2025, 3, 14, 7, 0, 0, 0, singapore)},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if a.NoError(err, tt.expr) {
+			a.Equal(tt.want, s.Next(wednesday), tt.expr)
+		}
+	}
+}
+
+func TestScheduleNextAcrossDaylightSaving(t *testing.T) {
+	a := assert.New(t)
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	s, _ := ParseSchedule("0 7 * * *")
+
+	// Clocks went forward on 30 March 2025, the digest still comes at 7am
+	next := s.Next(time.Date(2025, 3, 29, 8, 0, 0, 0, berlin))
+	a.Equal(time.Date(2025, 3, 30, 7, 0, 0, 0, berlin), next)
+	a.Equal(5, next.UTC().Hour())
+
+	s, _ = ParseSchedule("30 2 * * *")
+	a.Equal(time.Date(2025, 3, 31, 2, 30, 0, 0, berlin), s.Next(time.Date(2025, 3, 30, 1, 0, 0, 0, berlin)),
+		"2:30 doesn't exist on the day clocks go forward")
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	a := assert.New(t)
+	for _, expr := range []string{"", "0 7 * *", "60 7 * * *", "0 7 * * 8", "0 7-5 * * *", "*/0 * * * *", "0 7 * * someday"} {
+		_, err := ParseSchedule(expr)
+		a.Error(err, expr)
+	}
+
+	s, err := ParseSchedule("0 0 30 2 *")
+	if a.NoError(err) {
+		a.True(s.Next(time.Now()).IsZero(), "February never has 30 days")
+	}
+}
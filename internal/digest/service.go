@@ -0,0 +1,345 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/chart"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(\w+)(:datetime)?\s*\}\}`)
+
+// Scheduler sends digests to their recipients when they are due
+type Scheduler struct {
+	odoo    *odoo.Client
+	sender  agent.Sender
+	images  agent.ImageSender
+	digests []Digest
+	now     func() time.Time
+}
+
+func NewScheduler(client *odoo.Client, sender agent.Sender, images agent.ImageSender, digests []Digest) *Scheduler {
+	return &Scheduler{odoo: client, sender: sender, images: images, digests: digests, now: time.Now}
+}
+
+// job is a digest going to one recipient
+type job struct {
+	digest    *Digest
+	recipient Recipient
+	// location is nil until the recipient's timezone is known
+	location *time.Location
+	next     time.Time
+}
+
+// Run sends digests on their schedules until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	var jobs []*job
+	for i := range s.digests {
+		for _, r := range s.digests[i].Recipients {
+			jobs = append(jobs, &job{digest: &s.digests[i], recipient: r})
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx, jobs)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick sends the digests that are due and schedules their next run
+func (s *Scheduler) tick(ctx context.Context, jobs []*job) {
+	now := s.now()
+	for _, j := range jobs {
+		if j.location == nil {
+			// Recipients are looked up until Odoo answers
+			if err := s.resolve(ctx, j); err != nil {
+				log.Printf("Failed to look up recipient of digest %s: %v", j.digest.Name, err)
+				continue
+			}
+			j.next = j.digest.schedule.Next(now.In(j.location))
+			continue
+		}
+		if j.next.IsZero() || now.Before(j.next) {
+			continue
+		}
+
+		if err := s.Send(ctx, *j.digest, j.recipient.Phone, now.In(j.location)); err != nil {
+			log.Printf("Failed to send digest %s to %s: %v", j.digest.Name, j.recipient.Phone, err)
+		}
+		j.next = j.digest.schedule.Next(now.In(j.location))
+	}
+}
+
+// resolve completes a recipient given by login with their Odoo user's
+// phone and timezone
+func (s *Scheduler) resolve(ctx context.Context, j *job) error {
+	r := &j.recipient
+	if r.Login != "" && (r.Phone == "" || r.Timezone == "") {
+		users, err := s.odoo.SearchRead(ctx, "res.users", odoo.Domain{odoo.Cond("login", "=", r.Login)},
+			[]string{"phone", "mobile", "tz"}, &odoo.SearchOptions{Limit: 1})
+		if err != nil {
+			return fmt.Errorf("failed to search user %s: %w", r.Login, err)
+		}
+		if len(users) == 0 {
+			return fmt.Errorf("no user with login %s", r.Login)
+		}
+		if r.Phone == "" {
+			if r.Phone = users[0].String("mobile"); r.Phone == "" {
+				r.Phone = users[0].String("phone")
+			}
+		}
+		if r.Timezone == "" {
+			r.Timezone = users[0].String("tz")
+		}
+	}
+	if r.Phone == "" {
+		return fmt.Errorf("user %s has no phone number", r.Login)
+	}
+
+	location, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		log.Printf("Sending digest %s to %s in UTC: %v", j.digest.Name, r.Phone, err)
+		location = time.UTC
+	}
+	j.location = location
+	return nil
+}
+
+// Send computes a digest as of now, in the recipient's timezone, and sends it
+func (s *Scheduler) Send(ctx context.Context, d Digest, to string, now time.Time) error {
+	summaries, err := s.Render(ctx, d, now)
+	if err != nil {
+		return err
+	}
+
+	if d.Template != "" {
+		parameters := make([]string, len(summaries))
+		for i, sum := range summaries {
+			parameters[i] = sum.Total
+		}
+		_, err = s.sender.SendTemplate(ctx, whatsapp.TemplateMessage{
+			To:             to,
+			Name:           d.Template,
+			Language:       d.Language,
+			BodyParameters: parameters,
+		})
+		return err
+	}
+
+	if _, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: Format(d.Name, now, summaries)}); err != nil {
+		return err
+	}
+
+	// Charts follow the text, which already has every figure
+	for _, sum := range summaries {
+		if sum.Chart == nil || len(sum.Chart.Points) == 0 {
+			continue
+		}
+		if err := s.sendChart(ctx, to, sum); err != nil {
+			log.Printf("Failed to send chart %s of digest %s to %s: %v", sum.Title, d.Name, to, err)
+		}
+	}
+	return nil
+}
+
+// sendChart uploads the chart of a section and sends it with the section's
+// total as its caption
+func (s *Scheduler) sendChart(ctx context.Context, to string, sum Summary) error {
+	data, err := sum.Chart.PNG()
+	if err != nil {
+		return err
+	}
+	mediaID, err := s.images.UploadMedia(ctx, data, "image/png", "chart.png")
+	if err != nil {
+		return fmt.Errorf("failed to upload chart: %w", err)
+	}
+	_, err = s.images.SendImage(ctx, whatsapp.ImageMessage{
+		To:      to,
+		MediaID: mediaID,
+		Caption: fmt.Sprintf("*%s*: %s", sum.Title, sum.Total),
+	})
+	return err
+}
+
+// Render runs the read_group query of every section
+func (s *Scheduler) Render(ctx context.Context, d Digest, now time.Time) ([]Summary, error) {
+	summaries := make([]Summary, 0, len(d.Sections))
+	for _, section := range d.Sections {
+		var fields, groupBy []string
+		order := "__count desc"
+		if section.Measure != "" {
+			fields = []string{section.Measure}
+			order = measureField(section.Measure) + " desc"
+		}
+		if section.GroupBy != "" {
+			groupBy = []string{section.GroupBy}
+			if section.Measure == "" {
+				fields = groupBy
+			}
+		}
+
+		groups, err := s.odoo.ReadGroup(ctx, section.Model, Expand(section.Domain, now), fields, groupBy, &odoo.SearchOptions{Order: order})
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute %s: %w", section.Title, err)
+		}
+		summaries = append(summaries, summarize(section, groups))
+	}
+	return summaries, nil
+}
+
+// summarize totals the groups of a section and lists the largest ones
+func summarize(section Section, groups []odoo.Record) Summary {
+	field := measureField(section.Measure)
+	var total float64
+	var count int
+	for _, g := range groups {
+		total += g.Float(field)
+		count += g.Int("__count")
+	}
+
+	sum := Summary{Title: section.Title, Total: formatFigure(section, total, count)}
+	if section.GroupBy == "" {
+		return sum
+	}
+
+	kind, _ := chart.ParseKind(section.Chart)
+	if kind != chart.Line {
+		// Odoo already sorts the groups, except by many2one name for some
+		// fields. Lines keep periods in order.
+		sort.SliceStable(groups, func(i, j int) bool {
+			if field != "" {
+				return groups[i].Float(field) > groups[j].Float(field)
+			}
+			return groups[i].Int("__count") > groups[j].Int("__count")
+		})
+	}
+	if section.Chart != "" {
+		sum.Chart = &chart.Chart{Kind: kind, Title: section.Title}
+		for _, g := range groups {
+			value := float64(g.Int("__count"))
+			if field != "" {
+				value = g.Float(field)
+			}
+			sum.Chart.Points = append(sum.Chart.Points, chart.Point{Label: groupLabel(g, section.GroupBy), Value: value})
+		}
+		if section.Measure != "" {
+			sum.Chart.Format = whatsapp.FormatAmount
+		}
+	}
+	limit := section.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	for i, g := range groups {
+		if i == limit {
+			sum.Lines = append(sum.Lines, fmt.Sprintf("…and %d more", len(groups)-limit))
+			break
+		}
+		sum.Lines = append(sum.Lines, fmt.Sprintf("%s: %s", groupLabel(g, section.GroupBy), formatFigure(section, g.Float(field), g.Int("__count"))))
+	}
+	return sum
+}
+
+// Format renders a digest as a text message
+func Format(name string, now time.Time, summaries []Summary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 *%s*\n_%s_", name, now.Format("Mon 2 Jan 2006"))
+	for _, sum := range summaries {
+		fmt.Fprintf(&b, "\n\n*%s*: %s", sum.Title, sum.Total)
+		for _, line := range sum.Lines {
+			b.WriteString("\n• " + line)
+		}
+	}
+	return b.String()
+}
+
+// Expand replaces the date placeholders in the string values of a domain,
+// computing them in now's location
+func Expand(domain odoo.Domain, now time.Time) odoo.Domain {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// Weeks start on Monday
+	weekday := (int(today.Weekday()) + 6) % 7
+	days := map[string]time.Time{
+		"today":       today,
+		"yesterday":   today.AddDate(0, 0, -1),
+		"tomorrow":    today.AddDate(0, 0, 1),
+		"week_start":  today.AddDate(0, 0, -weekday),
+		"month_start": time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()),
+	}
+
+	replace := func(s string) string {
+		return placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+			m := placeholderPattern.FindStringSubmatch(p)
+			if m[1] == "now" {
+				return now.UTC().Format(odoo.DatetimeFormat)
+			}
+			day, ok := days[m[1]]
+			if !ok {
+				return p
+			}
+			if m[2] != "" {
+				return day.UTC().Format(odoo.DatetimeFormat)
+			}
+			return day.Format(time.DateOnly)
+		})
+	}
+
+	expanded := make(odoo.Domain, len(domain))
+	for i, term := range domain {
+		if cond, ok := term.([]interface{}); ok && len(cond) == 3 {
+			if value, ok := cond[2].(string); ok {
+				term = []interface{}{cond[0], cond[1], replace(value)}
+			}
+		}
+		expanded[i] = term
+	}
+	return expanded
+}
+
+// measureField returns the field name of a measure, e.g. "amount_total" for
+// "amount_total:sum"
+func measureField(measure string) string {
+	field, _, _ := strings.Cut(measure, ":")
+	return field
+}
+
+func formatFigure(section Section, total float64, count int) string {
+	if section.Measure == "" {
+		return strconv.Itoa(count)
+	}
+	return fmt.Sprintf("%s (%d)", whatsapp.FormatAmount(total), count)
+}
+
+// groupLabel returns the display value of a group, which Odoo encodes like
+// the field it groups by
+func groupLabel(group odoo.Record, groupBy string) string {
+	switch v := group[groupBy].(type) {
+	case []interface{}:
+		if _, name := group.Many2one(groupBy); name != "" {
+			return name
+		}
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "None"
+}
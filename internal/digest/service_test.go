@@ -0,0 +1,206 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestScheduler runs the scheduler against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestScheduler(t *testing.T, digests []Digest, results map[string]interface{}) (*Scheduler, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	for i := range digests {
+		digests[i].schedule, _ = ParseSchedule(digests[i].Schedule)
+	}
+	sender := &agenttest.Sender{}
+	return NewScheduler(recorder.Client(), sender, sender, digests), sender, recorder
+}
+
+var morning = Digest{
+	Name:       "Morning digest",
+	Schedule:   "0 7 * * *",
+	Recipients: []Recipient{{Login: "marc"}},
+	Sections: []Section{
+		{
+			Title:   "Yesterday's sales",
+			Model:   "sale.order",
+			Measure: "amount_total:sum",
+			GroupBy: "user_id",
+			Domain: odoo.Domain{
+				odoo.Cond("state", "=", "sale"),
+				odoo.Cond("date_order", ">=", "{{yesterday:datetime}}"),
+				odoo.Cond("date_order", "<", "{{today:datetime}}"),
+			},
+		},
+		{
+			Title:  "Overdue deliveries",
+			Model:  "stock.picking",
+			Domain: odoo.Domain{odoo.Cond("scheduled_date", "<", "{{now}}")},
+		},
+	},
+}
+
+var salesGroups = []interface{}{
+	map[string]interface{}{"user_id": []interface{}{float64(7), "Marc Demo"}, "amount_total": 2500.0, "__count": float64(2)},
+	map[string]interface{}{"user_id": []interface{}{float64(2), "Mitchell Admin"}, "amount_total": 10000.0, "__count": float64(6)},
+	map[string]interface{}{"user_id": false, "amount_total": 0.0, "__count": float64(1)},
+}
+
+func TestExpand(t *testing.T) {
+	a := assert.New(t)
+	singapore, _ := time.LoadLocation("Asia/Singapore")
+	// Wednesday 12 March 2025, 7am in Singapore
+	now := time.Date(2025, 3, 12, 7, 0, 0, 0, singapore)
+
+	domain := Expand(odoo.Domain{
+		"|",
+		odoo.Cond("date_order", ">=", "{{yesterday:datetime}}"),
+		odoo.Cond("invoice_date_due", "<", "{{today}}"),
+		odoo.Cond("date", ">=", "{{week_start}}"),
+		odoo.Cond("date", ">=", "{{ month_start }}"),
+		odoo.Cond("name", "=", "{{unknown}}"),
+		odoo.Cond("create_date", "<", "{{now}}"),
+	}, now)
+
+	a.Equal(odoo.Domain{
+		"|",
+		// Midnight in Singapore is 4pm UTC the day before
+		[]interface{}{"date_order", ">=", "2025-03-10 16:00:00"},
+		[]interface{}{"invoice_date_due", "<", "2025-03-12"},
+		[]interface{}{"date", ">=", "2025-03-10"},
+		[]interface{}{"date", ">=", "2025-03-01"},
+		[]interface{}{"name", "=", "{{unknown}}"},
+		[]interface{}{"create_date", "<", "2025-03-11 23:00:00"},
+	}, domain)
+}
+
+func TestSend(t *testing.T) {
+	a := assert.New(t)
+	scheduler, sender, recorder := newTestScheduler(t, []Digest{morning}, map[string]interface{}{
+		"sale.order.read_group":    salesGroups,
+		"stock.picking.read_group": []interface{}{map[string]interface{}{"__count": float64(3)}},
+	})
+	now := time.Date(2025, 3, 12, 7, 0, 0, 0, time.UTC)
+
+	a.NoError(scheduler.Send(context.Background(), morning, "6591112222", now))
+
+	a.Equal("📊 *Morning digest*\n_Wed 12 Mar 2025_\n\n"+
+		"*Yesterday's sales*: 12,500.00 (9)\n"+
+		"• Mitchell Admin: 10,000.00 (6)\n"+
+		"• Marc Demo: 2,500.00 (2)\n"+
+		"• None: 0.00 (1)\n\n"+
+		"*Overdue deliveries*: 3", sender.LastText())
+
+	if a.Len(recorder.Calls(), 2) {
+		sales := recorder.Calls()[0]
+		a.Equal([]interface{}{"amount_total:sum"}, sales.Args[1])
+		a.Equal([]interface{}{"user_id"}, sales.Args[2])
+		a.Equal("amount_total desc", sales.Kwargs["orderby"])
+		a.Equal([]interface{}{"date_order", ">=", "2025-03-11 00:00:00"}, sales.Args[0].([]interface{})[1])
+	}
+}
+
+func TestSendChart(t *testing.T) {
+	a := assert.New(t)
+	digest := morning
+	digest.Sections = append([]Section{}, morning.Sections...)
+	digest.Sections[0].Chart = "pie"
+	scheduler, sender, _ := newTestScheduler(t, []Digest{digest}, map[string]interface{}{
+		"sale.order.read_group":    salesGroups,
+		"stock.picking.read_group": []interface{}{map[string]interface{}{"__count": float64(3)}},
+	})
+
+	a.NoError(scheduler.Send(context.Background(), digest, "6591112222", time.Now()))
+	a.Len(sender.Messages, 1)
+	if a.Len(sender.Images, 1) {
+		image := sender.Images[0]
+		a.Equal("6591112222", image.To)
+		a.Equal("*Yesterday's sales*: 12,500.00 (9)", image.Caption)
+		if a.Contains(sender.Media, image.MediaID) {
+			a.Equal("image/png", sender.Media[image.MediaID].MimeType)
+		}
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	a := assert.New(t)
+	digest := morning
+	digest.Template = "morning_digest"
+	digest.Language = "en"
+	scheduler, sender, _ := newTestScheduler(t, []Digest{digest}, map[string]interface{}{
+		"sale.order.read_group":    salesGroups,
+		"stock.picking.read_group": []interface{}{map[string]interface{}{"__count": float64(3)}},
+	})
+
+	a.NoError(scheduler.Send(context.Background(), digest, "6591112222", time.Now()))
+	if a.Len(sender.Templates, 1) {
+		a.Equal("morning_digest", sender.Templates[0].Name)
+		a.Equal([]string{"12,500.00 (9)", "3"}, sender.Templates[0].BodyParameters)
+	}
+}
+
+func TestTickSendsInRecipientTimezone(t *testing.T) {
+	a := assert.New(t)
+	scheduler, sender, _ := newTestScheduler(t, []Digest{morning}, map[string]interface{}{
+		"res.users.search_read":    []interface{}{map[string]interface{}{"id": float64(7), "mobile": "+6591112222", "phone": false, "tz": "Asia/Singapore"}},
+		"sale.order.read_group":    []interface{}{},
+		"stock.picking.read_group": []interface{}{},
+	})
+	jobs := []*job{{digest: &scheduler.digests[0], recipient: morning.Recipients[0]}}
+	at := func(hour, minute int) {
+		scheduler.now = func() time.Time { return time.Date(2025, 3, 11, hour, minute, 0, 0, time.UTC) }
+		scheduler.tick(context.Background(), jobs)
+	}
+
+	at(22, 0)
+	a.Equal(time.Date(2025, 3, 12, 7, 0, 0, 0, jobs[0].location), jobs[0].next)
+	at(22, 59)
+	a.Empty(sender.Messages)
+
+	// 7am in Singapore is 11pm UTC
+	at(23, 0)
+	if a.Len(sender.Messages, 1) {
+		a.Equal("+6591112222", sender.Messages[0].To)
+	}
+	at(23, 1)
+	a.Len(sender.Messages, 1)
+	a.Equal(time.Date(2025, 3, 13, 7, 0, 0, 0, jobs[0].location), jobs[0].next)
+}
+
+func TestLoadDigestsValidates(t *testing.T) {
+	a := assert.New(t)
+	path := t.TempDir() + "/digests.json"
+
+	digests := []Digest{morning}
+	data, _ := json.Marshal(digests)
+	a.NoError(os.WriteFile(path, data, 0o600))
+	loaded, err := LoadDigests(path)
+	if a.NoError(err) && a.Len(loaded, 1) {
+		a.NotNil(loaded[0].schedule)
+	}
+
+	digests[0].Schedule = "every morning"
+	data, _ = json.Marshal(digests)
+	a.NoError(os.WriteFile(path, data, 0o600))
+	_, err = LoadDigests(path)
+	a.ErrorContains(err, "invalid schedule")
+
+	digests[0].Schedule = morning.Schedule
+	digests[0].Sections = []Section{{Title: "Overdue deliveries", Model: "stock.picking", Chart: "bar"}}
+	data, _ = json.Marshal(digests)
+	a.NoError(os.WriteFile(path, data, 0o600))
+	_, err = LoadDigests(path)
+	a.ErrorContains(err, "a chart needs a group_by")
+
+	a.Len(For(loaded, "main", "main"), 1)
+	a.Empty(For(loaded, "eu", "main"))
+}
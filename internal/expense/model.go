@@ -0,0 +1,25 @@
+package expense
+
+// Receipt is what the caption of a receipt photo tells about the expense,
+// e.g. "expense 42.50 taxi to the airport"
+type Receipt struct {
+	Amount      float64
+	Description string
+}
+
+// draft is an expense created from a receipt and still missing details
+type draft struct {
+	ExpenseID   int
+	EmployeeID  int
+	Description string
+	Amount      float64
+	ProductID   int
+	// Step is the detail the user is being asked for
+	Step string
+}
+
+const (
+	stepAmount   = "amount"
+	stepCategory = "category"
+	stepSubmit   = "submit"
+)
@@ -0,0 +1,283 @@
+package expense
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/fuzzy"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxChoices is the number of rows a WhatsApp list message can hold
+const maxChoices = 10
+
+var (
+	captionPattern = regexp.MustCompile(`(?i)\b(?:expense|receipt)s?\b`)
+	amountPattern  = regexp.MustCompile(`(\d+(?:[.,]\d{1,2})?)`)
+)
+
+// ParseCaption extracts the amount and description from a receipt caption
+func ParseCaption(caption string) Receipt {
+	text := captionPattern.ReplaceAllString(caption, "")
+
+	var receipt Receipt
+	if loc := amountPattern.FindStringIndex(text); loc != nil {
+		receipt.Amount, _ = parseAmount(text[loc[0]:loc[1]])
+		text = text[:loc[0]] + text[loc[1]:]
+	}
+	receipt.Description = strings.Join(strings.Fields(strings.Trim(text, " :-,")), " ")
+	return receipt
+}
+
+// Service turns receipt photos into hr.expense records for the employee
+// linked to the sender's number
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	media    agent.MediaDownloader
+	sessions *agent.Sessions
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, media agent.MediaDownloader, sessions *agent.Sessions) *Service {
+	return &Service{odoo: client, sender: sender, media: media, sessions: sessions}
+}
+
+func (s *Service) Name() string {
+	return "expense"
+}
+
+func (s *Service) Help() string {
+	return `a receipt photo captioned "expense <amount> <what for>" to claim an expense`
+}
+
+// Match accepts receipt photos and documents whose caption mentions an
+// expense or receipt
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return (msg.Type == "image" || msg.Type == "document") && captionPattern.MatchString(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	session := s.sessions.Get(msg.SenderID)
+	if msg.MediaID() != "" {
+		return s.startExpense(ctx, msg)
+	}
+	if session == nil || session.Capability != s.Name() {
+		return s.send(ctx, msg.SenderID, "That expense has expired. Please send the receipt again.")
+	}
+
+	d := session.Data.(*draft)
+	if strings.EqualFold(strings.TrimSpace(msg.Body), "cancel") && msg.ReplyID == "" {
+		s.sessions.End(msg.SenderID)
+		if err := s.odoo.Unlink(ctx, "hr.expense", []int{d.ExpenseID}); err != nil {
+			return fmt.Errorf("failed to delete expense: %w", err)
+		}
+		return s.send(ctx, msg.SenderID, "OK, I deleted that expense.")
+	}
+
+	switch d.Step {
+	case stepAmount:
+		amount, err := parseAmount(strings.TrimSpace(msg.Body))
+		if err != nil || amount <= 0 {
+			return s.send(ctx, msg.SenderID, "Please reply with the total amount, e.g. 42.50, or *cancel*.")
+		}
+		d.Amount = amount
+		if err := s.odoo.Write(ctx, "hr.expense", []int{d.ExpenseID}, map[string]interface{}{"total_amount_currency": amount}); err != nil {
+			return fmt.Errorf("failed to update expense: %w", err)
+		}
+	case stepCategory:
+		var productID int
+		if _, err := fmt.Sscanf(msg.ReplyID, "expense:category:%d", &productID); err != nil {
+			return s.askCategory(ctx, msg.SenderID, d)
+		}
+		d.ProductID = productID
+		values := map[string]interface{}{"product_id": productID}
+		// Setting the category resets the amount to the product's cost
+		if d.Amount > 0 {
+			values["total_amount_currency"] = d.Amount
+		}
+		if err := s.odoo.Write(ctx, "hr.expense", []int{d.ExpenseID}, values); err != nil {
+			return fmt.Errorf("failed to update expense: %w", err)
+		}
+	case stepSubmit:
+		s.sessions.End(msg.SenderID)
+		if msg.ReplyID != fmt.Sprintf("expense:submit:%d", d.ExpenseID) {
+			return s.send(ctx, msg.SenderID, "👍 The expense is saved as a draft in Odoo.")
+		}
+		return s.submit(ctx, msg.SenderID, d)
+	}
+
+	return s.next(ctx, msg.SenderID, d)
+}
+
+// startExpense creates a draft expense from a receipt and attaches it
+func (s *Service) startExpense(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// The employee and categories fall back on their last known values so
+	// that expenses are queued while Odoo is down
+	lookups := odoo.LastKnown(ctx)
+	employee, err := s.odoo.EmployeeByPhone(lookups, msg.SenderID, []string{"name"})
+	if err != nil {
+		return err
+	}
+	if employee == nil {
+		return s.send(ctx, msg.SenderID, "Your number isn't linked to an employee in Odoo, so I can't record expenses for you.")
+	}
+
+	media, err := s.media.DownloadMedia(ctx, msg.MediaID())
+	if err != nil {
+		log.Printf("Failed to download receipt %s from %s: %v", msg.MediaID(), msg.SenderID, err)
+		return s.send(ctx, msg.SenderID, "Sorry, I couldn't download that receipt. Please send it again.")
+	}
+
+	receipt := ParseCaption(msg.Body)
+	d := &draft{EmployeeID: employee.ID(), Description: receipt.Description, Amount: receipt.Amount}
+	if d.Description == "" {
+		d.Description = "Receipt " + time.Now().Format("2 Jan 2006")
+	}
+
+	if receipt.Description != "" {
+		products, err := s.categories(lookups)
+		if err != nil {
+			return err
+		}
+		names := make([]string, len(products))
+		for i, p := range products {
+			names[i] = p.String("name")
+		}
+		for _, word := range strings.Fields(receipt.Description) {
+			if m, ok := fuzzy.Best(word, names); ok && m.Score >= 0.8 {
+				d.ProductID = products[m.Index].ID()
+				break
+			}
+		}
+	}
+
+	values := map[string]interface{}{
+		"name":        d.Description,
+		"employee_id": d.EmployeeID,
+	}
+	if d.ProductID != 0 {
+		values["product_id"] = d.ProductID
+	}
+	if d.Amount > 0 {
+		values["total_amount_currency"] = d.Amount
+	}
+	// The expense is recorded once Odoo is back if it can't be reached now,
+	// without the receipt, which needs the expense to be attached to
+	summary := fmt.Sprintf("the expense \"%s\"", d.Description)
+	d.ExpenseID, err = s.odoo.Create(odoo.Queueable(ctx, msg.SenderID, summary), "hr.expense", values)
+	if errors.Is(err, odoo.ErrQueued) {
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("⏳ Odoo is unreachable right now. I'll record %s as soon as it's back and let you know. "+
+			"Please add the receipt to it in Odoo then.", summary))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create expense: %w", err)
+	}
+
+	if _, err := s.odoo.Attach(ctx, "hr.expense", d.ExpenseID, msg.MediaFilename(), media.MimeType, media.Data); err != nil {
+		log.Printf("Failed to attach receipt to expense %d: %v", d.ExpenseID, err)
+	}
+
+	return s.next(ctx, msg.SenderID, d)
+}
+
+// next asks for the first missing detail, or offers to submit the expense
+func (s *Service) next(ctx context.Context, to string, d *draft) error {
+	s.sessions.Start(to, s.Name(), d)
+
+	switch {
+	case d.Amount <= 0:
+		d.Step = stepAmount
+		return s.send(ctx, to, fmt.Sprintf("🧾 Got the receipt for \"%s\". How much was it in total?", d.Description))
+	case d.ProductID == 0:
+		d.Step = stepCategory
+		return s.askCategory(ctx, to, d)
+	}
+
+	d.Step = stepSubmit
+	_, err := s.sender.SendButtons(ctx, whatsapp.ButtonMessage{
+		To:   to,
+		Body: fmt.Sprintf("🧾 Expense \"%s\" for %s is recorded. Submit it to your manager now?", d.Description, whatsapp.FormatAmount(d.Amount)),
+		Buttons: []whatsapp.Button{
+			{ID: fmt.Sprintf("expense:submit:%d", d.ExpenseID), Title: "Submit"},
+			{ID: fmt.Sprintf("expense:draft:%d", d.ExpenseID), Title: "Keep as draft"},
+		},
+	})
+	return err
+}
+
+func (s *Service) askCategory(ctx context.Context, to string, d *draft) error {
+	products, err := s.categories(ctx)
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return fmt.Errorf("no expense categories are configured in Odoo")
+	}
+
+	rows := make([]whatsapp.ListRow, 0, maxChoices)
+	for _, p := range products {
+		if len(rows) == maxChoices {
+			break
+		}
+		rows = append(rows, whatsapp.ListRow{
+			ID:    fmt.Sprintf("expense:category:%d", p.ID()),
+			Title: p.String("name"),
+		})
+	}
+
+	_, err = s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     fmt.Sprintf("What kind of expense is \"%s\"?", d.Description),
+		Button:   "Choose category",
+		Sections: []whatsapp.ListSection{{Rows: rows}},
+	})
+	return err
+}
+
+// submit puts the expense in a report and submits it for approval
+func (s *Service) submit(ctx context.Context, to string, d *draft) error {
+	sheetID, err := s.odoo.Create(ctx, "hr.expense.sheet", map[string]interface{}{
+		"name":             d.Description,
+		"employee_id":      d.EmployeeID,
+		"expense_line_ids": []interface{}{[]interface{}{6, 0, []int{d.ExpenseID}}},
+	})
+	if err != nil {
+		// The expense itself is saved, which the user is told instead of the failure
+		log.Printf("Failed to create expense report for expense %d: %v", d.ExpenseID, err)
+		return s.send(ctx, to, "Sorry, I couldn't create the expense report. The expense is saved as a draft.")
+	}
+
+	if err := s.odoo.ExecuteKW(ctx, "hr.expense.sheet", "action_submit_sheet", []interface{}{[]int{sheetID}}, nil, nil); err != nil {
+		log.Printf("Failed to submit expense report %d: %v", sheetID, err)
+		return s.send(ctx, to, "Sorry, I couldn't submit the expense report. It is saved as a draft.")
+	}
+	return s.send(ctx, to, "📤 Submitted to your manager for approval.")
+}
+
+// categories returns the products that can be used on expenses
+func (s *Service) categories(ctx context.Context) ([]odoo.Record, error) {
+	products, err := s.odoo.SearchRead(ctx, "product.product", odoo.Domain{odoo.Cond("can_be_expensed", "=", true)},
+		[]string{"name"}, &odoo.SearchOptions{Order: "name"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search expense categories: %w", err)
+	}
+	return products, nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+// parseAmount accepts both 42.50 and 42,50
+func parseAmount(s string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+}
@@ -0,0 +1,211 @@
+package expense
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{Media: map[string]*whatsapp.Media{
+		"media-1": {ID: "media-1", MimeType: "image/jpeg", Data: []byte("jpeg")},
+	}}
+	return NewService(recorder.Client(), sender, sender, agent.NewSessions(time.Minute)), sender, recorder
+}
+
+var (
+	employee   = []map[string]interface{}{{"id": 4, "name": "Ana"}}
+	categories = []map[string]interface{}{{"id": 7, "name": "Meals"}, {"id": 8, "name": "Taxi"}}
+	receipt    = whatsapp.WebhookMessage{
+		SenderID:  "6598765432",
+		MessageID: "wamid.1",
+		Type:      "image",
+		Media:     map[string]interface{}{"id": "media-1", "mime_type": "image/jpeg"},
+	}
+)
+
+func TestParseCaption(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(Receipt{Amount: 42.5, Description: "taxi to the airport"}, ParseCaption("expense 42.50 taxi to the airport"))
+	a.Equal(Receipt{Amount: 12.3, Description: "lunch"}, ParseCaption("Receipt: lunch 12,30"))
+	a.Equal(Receipt{Description: "hotel"}, ParseCaption("expense hotel"))
+	a.Equal(Receipt{}, ParseCaption("receipt"))
+}
+
+func TestMatch(t *testing.T) {
+	a := assert.New(t)
+	service, _, _ := newTestService(t, nil)
+
+	msg := receipt
+	msg.Body = "expense 42.50 taxi"
+	a.True(service.Match(msg))
+
+	msg.Body = "our new office"
+	a.False(service.Match(msg))
+
+	a.False(service.Match(whatsapp.WebhookMessage{Type: "text", Body: "expense 42.50 taxi"}))
+}
+
+func TestHandleCompleteReceipt(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"hr.employee.search_read":     employee,
+		"product.product.search_read": categories,
+		"hr.expense.create":           30,
+		"ir.attachment.create":        31,
+	})
+
+	msg := receipt
+	msg.Body = "expense 42.50 taxi to the airport"
+	a.NoError(service.Handle(context.Background(), msg))
+
+	create := recorder.Last("hr.expense", "create")
+	if a.NotNil(create) {
+		values := create.Args[0].(map[string]interface{})
+		a.Equal("taxi to the airport", values["name"])
+		a.Equal(float64(4), values["employee_id"])
+		a.Equal(float64(8), values["product_id"])
+		a.Equal(42.5, values["total_amount_currency"])
+	}
+
+	attach := recorder.Last("ir.attachment", "create")
+	if a.NotNil(attach) {
+		values := attach.Args[0].(map[string]interface{})
+		a.Equal("hr.expense", values["res_model"])
+		a.Equal(float64(30), values["res_id"])
+	}
+
+	if a.Len(sender.Buttons, 1) {
+		a.Equal("expense:submit:30", sender.Buttons[0].Buttons[0].ID)
+	}
+}
+
+func TestHandleAsksForMissingDetails(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"hr.employee.search_read":     employee,
+		"product.product.search_read": categories,
+		"hr.expense.create":           30,
+		"ir.attachment.create":        31,
+		"hr.expense.write":            true,
+	})
+	ctx := context.Background()
+
+	msg := receipt
+	msg.Body = "receipt"
+	a.NoError(service.Handle(ctx, msg))
+	a.Contains(sender.LastText(), "How much")
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: msg.SenderID, Type: "text", Body: "a lot"}))
+	a.Contains(sender.LastText(), "total amount")
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: msg.SenderID, Type: "text", Body: "18,90"}))
+	write := recorder.Last("hr.expense", "write")
+	if a.NotNil(write) {
+		a.Equal(18.9, write.Args[1].(map[string]interface{})["total_amount_currency"])
+	}
+	if a.Len(sender.Lists, 1) {
+		a.Equal("expense:category:7", sender.Lists[0].Sections[0].Rows[0].ID)
+	}
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: msg.SenderID, Type: "interactive", ReplyID: "expense:category:7"}))
+	write = recorder.Last("hr.expense", "write")
+	if a.NotNil(write) {
+		values := write.Args[1].(map[string]interface{})
+		a.Equal(float64(7), values["product_id"])
+		a.Equal(18.9, values["total_amount_currency"])
+	}
+	a.Len(sender.Buttons, 1)
+}
+
+func TestHandleReceiptOnEveryVersion(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	// Before 17 the amount is the unit amount of one unit
+	amounts := map[string]string{"15.0": "unit_amount", "16.0": "unit_amount", "17.0": "total_amount_currency", "18.0": "total_amount_currency"}
+	for version, amount := range amounts {
+		server := odootest.NewServer(t)
+		server.Version = version
+		server.Seed("hr.employee", odoo.Record{"id": 4, "name": "Ana", "mobile_phone": "+" + receipt.SenderID})
+		server.Seed("product.product",
+			odoo.Record{"id": 7, "name": "Meals", "can_be_expensed": true},
+			odoo.Record{"id": 8, "name": "Taxi", "can_be_expensed": true},
+		)
+		sender := &agenttest.Sender{Media: map[string]*whatsapp.Media{
+			"media-1": {ID: "media-1", MimeType: "image/jpeg", Data: []byte("jpeg")},
+		}}
+		service := NewService(server.Client(), sender, sender, agent.NewSessions(time.Minute))
+		if _, err := service.odoo.Detect(ctx); !a.NoError(err, version) {
+			continue
+		}
+
+		msg := receipt
+		msg.Body = "receipt"
+		a.NoError(service.Handle(ctx, msg), version)
+		a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: msg.SenderID, Type: "text", Body: "18,90"}), version)
+		a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: msg.SenderID, Type: "interactive", ReplyID: "expense:category:7"}), version)
+
+		expenses := server.Records("hr.expense", nil)
+		if a.Len(expenses, 1, version) {
+			a.Equal(18.9, expenses[0][amount], version)
+			a.Equal(7, expenses[0]["product_id"], version)
+		}
+		a.Len(sender.Buttons, 1, version)
+	}
+}
+
+func TestHandleSubmitsReport(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"hr.expense.sheet.create":              40,
+		"hr.expense.sheet.action_submit_sheet": true,
+	})
+	service.sessions.Start(receipt.SenderID, "expense", &draft{
+		ExpenseID: 30, EmployeeID: 4, Description: "taxi", Amount: 42.5, ProductID: 8, Step: stepSubmit,
+	})
+
+	err := service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: receipt.SenderID,
+		Type:     "interactive",
+		ReplyID:  "expense:submit:30",
+	})
+
+	a.NoError(err)
+	create := recorder.Last("hr.expense.sheet", "create")
+	if a.NotNil(create) {
+		values := create.Args[0].(map[string]interface{})
+		a.Equal([]interface{}{[]interface{}{float64(6), float64(0), []interface{}{float64(30)}}}, values["expense_line_ids"])
+	}
+	submit := recorder.Last("hr.expense.sheet", "action_submit_sheet")
+	if a.NotNil(submit) {
+		a.Equal([]interface{}{[]interface{}{float64(40)}}, submit.Args)
+	}
+	a.Contains(sender.LastText(), "Submitted")
+	a.Nil(service.sessions.Get(receipt.SenderID))
+}
+
+func TestHandleUnknownEmployee(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"hr.employee.search_read": []map[string]interface{}{},
+	})
+
+	msg := receipt
+	msg.Body = "expense 10 parking"
+	a.NoError(service.Handle(context.Background(), msg))
+	a.Contains(sender.LastText(), "isn't linked to an employee")
+	a.Nil(recorder.Last("hr.expense", "create"))
+}
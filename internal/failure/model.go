@@ -0,0 +1,60 @@
+package failure
+
+// Kind is what went wrong, as far as the user is concerned
+type Kind string
+
+const (
+	// Validation means Odoo refused invalid values, e.g. a missing field
+	Validation Kind = "validation"
+	// Access means the user isn't allowed to read or change the records
+	Access Kind = "access"
+	// Denied means Odoo refused the credentials
+	Denied Kind = "denied"
+	// User means Odoo refused the operation with a message for the user
+	User Kind = "user"
+	// Missing means the records were deleted in the meantime
+	Missing Kind = "missing"
+	// Unavailable means Odoo can't be reached
+	Unavailable Kind = "unavailable"
+	// Timeout means Odoo didn't answer in time
+	Timeout Kind = "timeout"
+	// Internal is any other failure, whose details only go to the logs
+	Internal Kind = "internal"
+)
+
+// exceptions map the Python exceptions Odoo reports to kinds
+var exceptions = map[string]Kind{
+	"odoo.exceptions.ValidationError": Validation,
+	"odoo.exceptions.AccessError":     Access,
+	"odoo.exceptions.AccessDenied":    Denied,
+	"odoo.exceptions.UserError":       User,
+	"odoo.exceptions.RedirectWarning": User,
+	"odoo.exceptions.MissingError":    Missing,
+}
+
+// things name the records of common models in access hints, e.g. "you
+// don't have access to invoices"
+var things = map[string]string{
+	"account.move":          "invoices and bills",
+	"account.move.line":     "journal items",
+	"account.payment":       "payments",
+	"account.analytic.line": "timesheets",
+	"calendar.event":        "meetings",
+	"crm.lead":              "leads and opportunities",
+	"helpdesk.ticket":       "helpdesk tickets",
+	"hr.employee":           "employees",
+	"hr.expense":            "expenses",
+	"hr.expense.sheet":      "expense reports",
+	"hr.leave":              "time off",
+	"mail.message":          "messages",
+	"product.product":       "products",
+	"product.template":      "products",
+	"project.project":       "projects",
+	"project.task":          "tasks",
+	"purchase.order":        "purchase orders",
+	"res.partner":           "contacts",
+	"res.users":             "users",
+	"sale.order":            "sales orders",
+	"stock.picking":         "transfers",
+	"stock.quant":           "stock",
+}
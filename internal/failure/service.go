@@ -0,0 +1,164 @@
+// Package failure turns errors, Odoo faults in particular, into replies fit
+// for WhatsApp users. Replies carry the user-facing part of a fault only;
+// its traceback is logged with a reference the user can quote.
+package failure
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// maxMessage is the length of the Odoo messages quoted to users
+const maxMessage = 300
+
+// Explanation is what a user is told about a failure
+type Explanation struct {
+	Kind Kind
+	// Message is Odoo's own message, when it is meant for users
+	Message string
+	// Hint is what the user can do about it
+	Hint string
+	// Ref identifies the failure in the logs
+	Ref string
+}
+
+// Text renders the explanation as a WhatsApp reply
+func (e *Explanation) Text() string {
+	var lines []string
+	if e.Message != "" {
+		lines = append(lines, "Odoo says: "+e.Message)
+	}
+	if e.Hint != "" {
+		lines = append(lines, e.Hint)
+	}
+	if e.Ref != "" {
+		lines = append(lines, fmt.Sprintf("_Reference %s, in case you contact support._", e.Ref))
+	}
+
+	icon := "😕 "
+	switch e.Kind {
+	case Validation, User, Missing:
+		icon = "⚠️ "
+	case Access, Denied:
+		icon = "🚫 "
+	}
+	return icon + strings.Join(lines, "\n")
+}
+
+// Explain classifies an error and extracts what a user may see of it
+func Explain(err error) *Explanation {
+	switch {
+	case errors.Is(err, odoo.ErrUnavailable):
+		return &Explanation{Kind: Unavailable, Hint: "Odoo can't be reached right now. Please try again in a few minutes."}
+	case errors.Is(err, odoo.ErrTimeout):
+		return &Explanation{Kind: Timeout, Hint: "Odoo is taking too long to answer. Please try again in a few minutes."}
+	}
+
+	var fault *odoo.Fault
+	if !errors.As(err, &fault) {
+		return &Explanation{Kind: Internal, Hint: "Something went wrong on my side."}
+	}
+	kind, ok := exceptions[fault.Data.Name]
+	if !ok {
+		// Other exceptions, e.g. from the database, aren't meant for users
+		return &Explanation{Kind: Internal, Hint: "Odoo ran into an error."}
+	}
+
+	e := &Explanation{Kind: kind, Message: Message(fault)}
+	switch kind {
+	case Validation:
+		e.Hint = "Please correct it and try again."
+	case Access:
+		// The message lists the groups allowed, which users can't act on
+		e.Message = ""
+		e.Hint = fmt.Sprintf("You don't have access to %s in Odoo. Ask your Odoo administrator if you need it.", accessed(err, fault))
+	case Denied:
+		e.Message = ""
+		e.Hint = "Odoo refused the API key linked to your number. Ask your administrator to link your number again."
+	case Missing:
+		e.Message = ""
+		e.Hint = "It was deleted or archived in Odoo in the meantime. Please start again."
+	}
+	return e
+}
+
+// Report explains an error and logs it in full, traceback included, under
+// a new reference
+func Report(err error, where string) *Explanation {
+	e := Explain(err)
+	e.Ref = newRef()
+	var fault *odoo.Fault
+	if errors.As(err, &fault) && fault.Data.Debug != "" {
+		log.Printf("Failure %s in %s: %v\n%s", e.Ref, where, err, fault.Data.Debug)
+	} else {
+		log.Printf("Failure %s in %s: %v", e.Ref, where, err)
+	}
+	return e
+}
+
+// Refusal returns the message of a UserError or ValidationError, which Odoo
+// raises when it refuses an operation for a reason the user can address
+func Refusal(err error) (string, bool) {
+	e := Explain(err)
+	if (e.Kind != User && e.Kind != Validation) || e.Message == "" {
+		return "", false
+	}
+	return e.Message, true
+}
+
+// Message returns the part of a fault's message meant for users: its first
+// paragraph, without the technical details some exceptions add
+func Message(fault *odoo.Fault) string {
+	message := fault.Data.Message
+	if message == "" && len(fault.Data.Arguments) > 0 {
+		message, _ = fault.Data.Arguments[0].(string)
+	}
+	message, _, _ = strings.Cut(strings.TrimSpace(message), "\n\n")
+	message = strings.Join(strings.Fields(message), " ")
+	if utf8.RuneCountInString(message) > maxMessage {
+		message = string([]rune(message)[:maxMessage-1]) + "…"
+	}
+	return message
+}
+
+// accessPattern finds the description and model of the records an
+// AccessError is about, e.g. "'Journal Entry' (account.move)"
+var accessPattern = regexp.MustCompile(`'([^']+)' \(([a-z0-9_.]+)\)`)
+
+// accessed names the records a user was refused access to
+func accessed(err error, fault *odoo.Fault) string {
+	model, description := "", ""
+	var call *odoo.CallError
+	if m := accessPattern.FindStringSubmatch(fault.Data.Message); m != nil {
+		description, model = m[1], m[2]
+	} else if errors.As(err, &call) {
+		model = call.Model
+	}
+	if name, ok := things[model]; ok {
+		return name
+	}
+	if description != "" {
+		return description + " records"
+	}
+	return "these records"
+}
+
+// refAlphabet leaves out letters and digits that look alike
+const refAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newRef returns a short reference that is easy to read out
+func newRef() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	for i := range b {
+		b[i] = refAlphabet[int(b[i])%len(refAlphabet)]
+	}
+	return string(b)
+}
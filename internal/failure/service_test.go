@@ -0,0 +1,70 @@
+package failure
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	a := assert.New(t)
+	call := func(model string, err error) error {
+		return fmt.Errorf("failed to load: %w", &odoo.CallError{Model: model, Method: "read", Err: err})
+	}
+
+	tests := []struct {
+		err  error
+		kind Kind
+		text string
+	}{
+		{
+			call("account.move", odootest.AccessError("You are not allowed to access 'Journal Entry' (account.move) records.\n\nThis operation is allowed for the following groups:\n\t- Accounting/Billing\n\nContact your administrator to request access if necessary.")),
+			Access, "🚫 You don't have access to invoices and bills in Odoo. Ask your Odoo administrator if you need it.",
+		},
+		{
+			call("fleet.vehicle", odootest.AccessError("Sorry, you are not allowed to modify this document.")),
+			Access, "🚫 You don't have access to these records in Odoo. Ask your Odoo administrator if you need it.",
+		},
+		{
+			call("hr.expense", odootest.ValidationError("The amount must be positive.")),
+			Validation, "⚠️ Odoo says: The amount must be positive.\nPlease correct it and try again.",
+		},
+		{
+			call("sale.order", odootest.UserError("It is not allowed to confirm an order in the following states:\n  cancel")),
+			User, "⚠️ Odoo says: It is not allowed to confirm an order in the following states: cancel",
+		},
+		{
+			call("res.partner", odootest.MissingError("Record does not exist or has been deleted.\n(Record: res.partner(99,), User: 2)")),
+			Missing, "⚠️ It was deleted or archived in Odoo in the meantime. Please start again.",
+		},
+		{
+			call("res.partner", odootest.NewFault("psycopg2.errors.UniqueViolation", "duplicate key value violates unique constraint")),
+			Internal, "😕 Odoo ran into an error.",
+		},
+		{call("res.partner", fmt.Errorf("%w (status 502)", odoo.ErrUnavailable)), Unavailable, "😕 Odoo can't be reached right now. Please try again in a few minutes."},
+		{fmt.Errorf("failed to decode"), Internal, "😕 Something went wrong on my side."},
+	}
+	for _, tt := range tests {
+		e := Explain(tt.err)
+		a.Equal(tt.kind, e.Kind, tt.err.Error())
+		a.Equal(tt.text, e.Text())
+		a.NotContains(e.Text(), "Traceback")
+	}
+}
+
+func TestReport(t *testing.T) {
+	a := assert.New(t)
+	e := Report(odootest.UserError("The order is locked."), "test")
+	a.Len(e.Ref, 6)
+	a.Equal("⚠️ Odoo says: The order is locked.\n_Reference "+e.Ref+", in case you contact support._", e.Text())
+	a.NotEqual(e.Ref, Report(odootest.UserError("The order is locked."), "test").Ref)
+
+	message, ok := Refusal(&odoo.CallError{Model: "sale.order", Method: "action_confirm", Err: odootest.UserError("The order is locked.")})
+	a.True(ok)
+	a.Equal("The order is locked.", message)
+	_, ok = Refusal(odootest.AccessError("You are not allowed to access 'Contact' (res.partner) records."))
+	a.False(ok)
+}
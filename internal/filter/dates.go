@@ -0,0 +1,208 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// period is a range of days, from its first day up to but excluding end.
+// A zero bound is open.
+type period struct {
+	start, end time.Time
+	label      string
+}
+
+// parsePeriod reads a period at the start of words, relative to today, and
+// returns how many words it used, e.g. "last month", "this week",
+// "last 30 days", "in March", "in 2024", "today" or "since 1 Mar"
+func parsePeriod(words []string, today time.Time) (period, int, bool) {
+	if len(words) == 0 {
+		return period{}, 0, false
+	}
+	switch words[0] {
+	case "today":
+		return period{today, today.AddDate(0, 0, 1), "today"}, 1, true
+	case "yesterday":
+		return period{today.AddDate(0, 0, -1), today, "yesterday"}, 1, true
+	case "this", "last", "previous", "past":
+		if len(words) < 2 {
+			return period{}, 0, false
+		}
+		back := words[0] != "this"
+		if n, err := strconv.Atoi(words[1]); err == nil && back && len(words) >= 3 && n > 0 {
+			// The last 7 days end today
+			end := today.AddDate(0, 0, 1)
+			start, ok := addUnit(end, strings.TrimSuffix(words[2], "s"), -n)
+			if !ok {
+				return period{}, 0, false
+			}
+			return period{start, end, "in the last " + words[1] + " " + words[2]}, 3, true
+		}
+		unit := strings.TrimSuffix(words[1], "'s")
+		start, ok := startOf(today, unit)
+		if !ok {
+			return period{}, 0, false
+		}
+		end, _ := addUnit(start, unit, 1)
+		if back {
+			start, _ = addUnit(start, unit, -1)
+			end, _ = addUnit(end, unit, -1)
+		}
+		return period{start, end, words[0] + " " + unit}, 2, true
+	case "in", "during":
+		p, n, ok := parseMonthOrYear(words[1:], today)
+		if !ok {
+			return period{}, 0, false
+		}
+		return p, n + 1, true
+	case "since", "after", "before", "until", "on":
+		day, n, ok := parseDate(words[1:], today)
+		if !ok {
+			return period{}, 0, false
+		}
+		switch words[0] {
+		case "since":
+			return period{start: day, label: "since " + day.Format("2 Jan 2006")}, n + 1, true
+		case "after":
+			return period{start: day.AddDate(0, 0, 1), label: "after " + day.Format("2 Jan 2006")}, n + 1, true
+		case "before":
+			return period{end: day, label: "before " + day.Format("2 Jan 2006")}, n + 1, true
+		case "until":
+			return period{end: day.AddDate(0, 0, 1), label: "until " + day.Format("2 Jan 2006")}, n + 1, true
+		}
+		return period{day, day.AddDate(0, 0, 1), "on " + day.Format("2 Jan 2006")}, n + 1, true
+	}
+	return parseMonthOrYear(words, today)
+}
+
+// parseMonthOrYear reads "March", "March 2024" or "2024". A month without
+// a year is the latest one, this month included.
+func parseMonthOrYear(words []string, today time.Time) (period, int, bool) {
+	if len(words) == 0 {
+		return period{}, 0, false
+	}
+	if year, err := strconv.Atoi(words[0]); err == nil && year >= 1900 && year <= 2999 {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, today.Location())
+		return period{start, start.AddDate(1, 0, 0), "in " + words[0]}, 1, true
+	}
+
+	month, ok := parseMonth(words[0])
+	if !ok {
+		return period{}, 0, false
+	}
+	n := 1
+	year := today.Year()
+	if month > today.Month() {
+		year--
+	}
+	if len(words) > 1 {
+		if y, err := strconv.Atoi(words[1]); err == nil && y >= 1900 && y <= 2999 {
+			year, n = y, 2
+		}
+	}
+	start := time.Date(year, month, 1, 0, 0, 0, 0, today.Location())
+	return period{start, start.AddDate(0, 1, 0), "in " + start.Format("January 2006")}, n, true
+}
+
+// parseDate reads a day at the start of words: today, yesterday, an ISO
+// date, or a day and month with an optional year, e.g. "1 Mar" or
+// "March 1 2024". A day without a year is the latest one, today included.
+func parseDate(words []string, today time.Time) (time.Time, int, bool) {
+	if len(words) == 0 {
+		return time.Time{}, 0, false
+	}
+	switch words[0] {
+	case "today":
+		return today, 1, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), 1, true
+	}
+	if day, err := time.ParseInLocation(dateLayout, words[0], today.Location()); err == nil {
+		return day, 1, true
+	}
+	if len(words) < 2 {
+		return time.Time{}, 0, false
+	}
+
+	// "1 Mar" or "Mar 1"
+	dayWord, monthWord := words[0], words[1]
+	if _, err := strconv.Atoi(dayWord); err != nil {
+		dayWord, monthWord = words[1], words[0]
+	}
+	day, err := strconv.Atoi(strings.TrimRight(dayWord, "stndrh"))
+	month, ok := parseMonth(monthWord)
+	if err != nil || !ok || day < 1 || day > 31 {
+		return time.Time{}, 0, false
+	}
+
+	if len(words) > 2 {
+		if year, err := strconv.Atoi(words[2]); err == nil && year >= 1900 && year <= 2999 {
+			return time.Date(year, month, day, 0, 0, 0, 0, today.Location()), 3, true
+		}
+	}
+	date := time.Date(today.Year(), month, day, 0, 0, 0, 0, today.Location())
+	if date.After(today) {
+		date = date.AddDate(-1, 0, 0)
+	}
+	return date, 2, true
+}
+
+func parseMonth(word string) (time.Month, bool) {
+	if len(word) < 3 {
+		return 0, false
+	}
+	month, ok := months[word[:3]]
+	if !ok {
+		return 0, false
+	}
+	// Reject words that merely start like a month, e.g. "decor"
+	name := strings.ToLower(month.String())
+	if word != name[:3] && word != name && !(month == time.September && word == "sept") {
+		return 0, false
+	}
+	return month, true
+}
+
+// startOf returns the first day of the day, week (starting on Monday),
+// month, quarter or year containing today
+func startOf(today time.Time, unit string) (time.Time, bool) {
+	switch unit {
+	case "day":
+		return today, true
+	case "week":
+		return today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7)), true
+	case "month":
+		return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location()), true
+	case "quarter":
+		return time.Date(today.Year(), (today.Month()-1)/3*3+1, 1, 0, 0, 0, 0, today.Location()), true
+	case "year":
+		return time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, today.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// addUnit adds n days, weeks, months, quarters or years to t
+func addUnit(t time.Time, unit string, n int) (time.Time, bool) {
+	switch unit {
+	case "day":
+		return t.AddDate(0, 0, n), true
+	case "week":
+		return t.AddDate(0, 0, 7*n), true
+	case "month":
+		return t.AddDate(0, n, 0), true
+	case "quarter":
+		return t.AddDate(0, 3*n, 0), true
+	case "year":
+		return t.AddDate(n, 0, 0), true
+	}
+	return time.Time{}, false
+}
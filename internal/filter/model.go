@@ -0,0 +1,269 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Field types, as Odoo names them
+const (
+	typeChar      = "char"
+	typeNumber    = "float"
+	typeMonetary  = "monetary"
+	typeDate      = "date"
+	typeDatetime  = "datetime"
+	typeSelection = "selection"
+	typeBoolean   = "boolean"
+	typeMany2one  = "many2one"
+)
+
+// Field is a field users can filter on by one of its aliases, e.g.
+// "due date before 1 Apr"
+type Field struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Aliases []string `json:"aliases"`
+	// Relation is the model of a many2one field, whose records are matched
+	// by name
+	Relation string `json:"relation,omitempty"`
+}
+
+// Model is an Odoo model that can be searched with filters, e.g. "unpaid
+// invoices over 1000 from last month for Acme"
+type Model struct {
+	Name string `json:"model"`
+	// Nouns name the records in messages, the first one in answers
+	Nouns []string `json:"nouns"`
+	// Domain always applies, e.g. to tell invoices from bills
+	Domain odoo.Domain `json:"domain,omitempty"`
+	Fields []Field     `json:"fields,omitempty"`
+	// Keywords add conditions, e.g. "unpaid". Their values may use the
+	// date placeholders of digests, such as {{today}}.
+	Keywords map[string]odoo.Domain `json:"keywords,omitempty"`
+
+	// The fields behind "for Acme", "over 1000", "last month", "my" or
+	// "by Mitchell", and "with Desk"
+	PartnerField string `json:"partner_field,omitempty"`
+	AmountField  string `json:"amount_field,omitempty"`
+	DateField    string `json:"date_field,omitempty"`
+	UserField    string `json:"user_field,omitempty"`
+	ProductField string `json:"product_field,omitempty"`
+
+	// Display are the fields shown for each record found
+	Display []string `json:"display"`
+	Order   string   `json:"order,omitempty"`
+}
+
+// field returns the field of the model with that name
+func (m *Model) field(name string) (Field, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// fieldType returns the type of a field of the model, or def when it isn't
+// declared
+func (m *Model) fieldType(name, def string) string {
+	if f, ok := m.field(name); ok {
+		return f.Type
+	}
+	return def
+}
+
+var invoiceFields = []Field{
+	{Name: "name", Type: typeChar, Aliases: []string{"number", "reference"}},
+	{Name: "amount_total", Type: typeMonetary, Aliases: []string{"amount", "total"}},
+	{Name: "amount_residual", Type: typeMonetary, Aliases: []string{"amount due", "balance"}},
+	{Name: "invoice_date", Type: typeDate, Aliases: []string{"date", "invoice date"}},
+	{Name: "invoice_date_due", Type: typeDate, Aliases: []string{"due date", "due"}},
+	{Name: "invoice_user_id", Type: typeMany2one, Relation: "res.users", Aliases: []string{"salesperson"}},
+	{Name: "currency_id", Type: typeMany2one, Relation: "res.currency", Aliases: []string{"currency"}},
+}
+
+var invoiceKeywords = map[string]odoo.Domain{
+	"draft":          {odoo.Cond("state", "=", "draft")},
+	"posted":         {odoo.Cond("state", "=", "posted")},
+	"cancelled":      {odoo.Cond("state", "=", "cancel")},
+	"unpaid":         {odoo.Cond("state", "=", "posted"), odoo.Cond("payment_state", "in", []string{"not_paid", "partial"})},
+	"open":           {odoo.Cond("state", "=", "posted"), odoo.Cond("payment_state", "in", []string{"not_paid", "partial"})},
+	"partially paid": {odoo.Cond("payment_state", "=", "partial")},
+	"paid":           {odoo.Cond("payment_state", "in", []string{"paid", "in_payment"})},
+	"overdue": {
+		odoo.Cond("state", "=", "posted"),
+		odoo.Cond("payment_state", "in", []string{"not_paid", "partial"}),
+		odoo.Cond("invoice_date_due", "<", "{{today}}"),
+	},
+}
+
+// DefaultModels can be searched when no models are configured
+var DefaultModels = []Model{
+	{
+		Name:         "account.move",
+		Nouns:        []string{"invoices", "invoice", "customer invoices"},
+		Domain:       odoo.Domain{odoo.Cond("move_type", "=", "out_invoice")},
+		Fields:       append([]Field{{Name: "partner_id", Type: typeMany2one, Relation: "res.partner", Aliases: []string{"customer"}}}, invoiceFields...),
+		Keywords:     invoiceKeywords,
+		PartnerField: "partner_id",
+		AmountField:  "amount_total",
+		DateField:    "invoice_date",
+		UserField:    "invoice_user_id",
+		ProductField: "invoice_line_ids.product_id",
+		Display:      []string{"name", "partner_id", "invoice_date", "amount_total", "payment_state"},
+		Order:        "invoice_date desc, id desc",
+	},
+	{
+		Name:         "account.move",
+		Nouns:        []string{"bills", "bill", "vendor bills"},
+		Domain:       odoo.Domain{odoo.Cond("move_type", "=", "in_invoice")},
+		Fields:       append([]Field{{Name: "partner_id", Type: typeMany2one, Relation: "res.partner", Aliases: []string{"vendor", "supplier"}}}, invoiceFields...),
+		Keywords:     invoiceKeywords,
+		PartnerField: "partner_id",
+		AmountField:  "amount_total",
+		DateField:    "invoice_date",
+		UserField:    "invoice_user_id",
+		ProductField: "invoice_line_ids.product_id",
+		Display:      []string{"name", "partner_id", "invoice_date", "amount_total", "payment_state"},
+		Order:        "invoice_date desc, id desc",
+	},
+	{
+		Name:   "sale.order",
+		Nouns:  []string{"sales orders", "sales order", "sale orders", "sale order", "orders", "order"},
+		Domain: odoo.Domain{odoo.Cond("state", "=", "sale")},
+		Fields: []Field{
+			{Name: "name", Type: typeChar, Aliases: []string{"number", "reference"}},
+			{Name: "partner_id", Type: typeMany2one, Relation: "res.partner", Aliases: []string{"customer"}},
+			{Name: "amount_total", Type: typeMonetary, Aliases: []string{"amount", "total"}},
+			{Name: "date_order", Type: typeDatetime, Aliases: []string{"date", "order date"}},
+			{Name: "user_id", Type: typeMany2one, Relation: "res.users", Aliases: []string{"salesperson"}},
+			{Name: "team_id", Type: typeMany2one, Relation: "crm.team", Aliases: []string{"sales team", "team"}},
+		},
+		Keywords: map[string]odoo.Domain{
+			"to invoice": {odoo.Cond("invoice_status", "=", "to invoice")},
+			"invoiced":   {odoo.Cond("invoice_status", "=", "invoiced")},
+			"locked":     {odoo.Cond("locked", "=", true)},
+		},
+		PartnerField: "partner_id",
+		AmountField:  "amount_total",
+		DateField:    "date_order",
+		UserField:    "user_id",
+		ProductField: "order_line.product_id",
+		Display:      []string{"name", "partner_id", "date_order", "amount_total"},
+		Order:        "date_order desc, id desc",
+	},
+	{
+		Name:   "sale.order",
+		Nouns:  []string{"quotations", "quotation", "quotes", "quote"},
+		Domain: odoo.Domain{odoo.Cond("state", "in", []string{"draft", "sent"})},
+		Fields: []Field{
+			{Name: "name", Type: typeChar, Aliases: []string{"number", "reference"}},
+			{Name: "partner_id", Type: typeMany2one, Relation: "res.partner", Aliases: []string{"customer"}},
+			{Name: "amount_total", Type: typeMonetary, Aliases: []string{"amount", "total"}},
+			{Name: "date_order", Type: typeDatetime, Aliases: []string{"date"}},
+			{Name: "validity_date", Type: typeDate, Aliases: []string{"expiration", "validity"}},
+			{Name: "user_id", Type: typeMany2one, Relation: "res.users", Aliases: []string{"salesperson"}},
+		},
+		Keywords: map[string]odoo.Domain{
+			"sent":    {odoo.Cond("state", "=", "sent")},
+			"draft":   {odoo.Cond("state", "=", "draft")},
+			"expired": {odoo.Cond("validity_date", "<", "{{today}}")},
+		},
+		PartnerField: "partner_id",
+		AmountField:  "amount_total",
+		DateField:    "date_order",
+		UserField:    "user_id",
+		ProductField: "order_line.product_id",
+		Display:      []string{"name", "partner_id", "date_order", "amount_total"},
+		Order:        "date_order desc, id desc",
+	},
+	{
+		Name:  "purchase.order",
+		Nouns: []string{"purchase orders", "purchase order", "purchases", "purchase"},
+		Fields: []Field{
+			{Name: "name", Type: typeChar, Aliases: []string{"number", "reference"}},
+			{Name: "partner_id", Type: typeMany2one, Relation: "res.partner", Aliases: []string{"vendor", "supplier"}},
+			{Name: "amount_total", Type: typeMonetary, Aliases: []string{"amount", "total"}},
+			{Name: "date_order", Type: typeDatetime, Aliases: []string{"date", "order date"}},
+			{Name: "date_planned", Type: typeDatetime, Aliases: []string{"expected arrival", "arrival"}},
+			{Name: "user_id", Type: typeMany2one, Relation: "res.users", Aliases: []string{"buyer"}},
+		},
+		Keywords: map[string]odoo.Domain{
+			"rfq":        {odoo.Cond("state", "in", []string{"draft", "sent"})},
+			"to approve": {odoo.Cond("state", "=", "to approve")},
+			"confirmed":  {odoo.Cond("state", "in", []string{"purchase", "done"})},
+			"cancelled":  {odoo.Cond("state", "=", "cancel")},
+			"to bill":    {odoo.Cond("invoice_status", "=", "to invoice")},
+			"late":       {odoo.Cond("state", "=", "purchase"), odoo.Cond("date_planned", "<", "{{today:datetime}}")},
+		},
+		PartnerField: "partner_id",
+		AmountField:  "amount_total",
+		DateField:    "date_order",
+		UserField:    "user_id",
+		ProductField: "order_line.product_id",
+		Display:      []string{"name", "partner_id", "date_order", "amount_total", "state"},
+		Order:        "date_order desc, id desc",
+	},
+	{
+		Name:  "crm.lead",
+		Nouns: []string{"opportunities", "opportunity", "leads", "lead"},
+		Fields: []Field{
+			{Name: "name", Type: typeChar, Aliases: []string{"title"}},
+			{Name: "partner_id", Type: typeMany2one, Relation: "res.partner", Aliases: []string{"customer"}},
+			{Name: "expected_revenue", Type: typeMonetary, Aliases: []string{"revenue", "amount"}},
+			{Name: "probability", Type: typeNumber, Aliases: []string{"probability"}},
+			{Name: "create_date", Type: typeDatetime, Aliases: []string{"created", "date"}},
+			{Name: "date_deadline", Type: typeDate, Aliases: []string{"expected closing", "deadline"}},
+			{Name: "stage_id", Type: typeMany2one, Relation: "crm.stage", Aliases: []string{"stage"}},
+			{Name: "user_id", Type: typeMany2one, Relation: "res.users", Aliases: []string{"salesperson"}},
+			{Name: "city", Type: typeChar, Aliases: []string{"city"}},
+		},
+		Keywords: map[string]odoo.Domain{
+			"won":  {odoo.Cond("stage_id.is_won", "=", true)},
+			"open": {odoo.Cond("stage_id.is_won", "=", false)},
+			"hot":  {odoo.Cond("priority", ">=", "2")},
+		},
+		PartnerField: "partner_id",
+		AmountField:  "expected_revenue",
+		DateField:    "create_date",
+		UserField:    "user_id",
+		Display:      []string{"name", "partner_id", "expected_revenue", "stage_id"},
+		Order:        "create_date desc, id desc",
+	},
+}
+
+// LoadModels reads the searchable models from a JSON file. An empty path
+// means the DefaultModels.
+func LoadModels(path string) ([]Model, error) {
+	if path == "" {
+		return DefaultModels, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter models: %w", err)
+	}
+
+	var models []Model
+	if err := json.Unmarshal(data, &models); err != nil {
+		return nil, fmt.Errorf("failed to parse filter models: %w", err)
+	}
+	for i, m := range models {
+		if m.Name == "" || len(m.Nouns) == 0 || len(m.Display) == 0 {
+			return nil, fmt.Errorf("filter model %d needs a model, nouns and display fields", i)
+		}
+		for _, f := range m.Fields {
+			if f.Name == "" || len(f.Aliases) == 0 {
+				return nil, fmt.Errorf("a field of filter model %s needs a name and aliases", m.Name)
+			}
+			if f.Type == typeMany2one && f.Relation == "" {
+				return nil, fmt.Errorf("field %s of filter model %s needs a relation", f.Name, m.Name)
+			}
+		}
+	}
+	return models, nil
+}
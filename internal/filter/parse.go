@@ -0,0 +1,741 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pclk/waOdoo/internal/digest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxMatches is the number of records listed when a name is ambiguous
+const maxMatches = 5
+
+// Error is a filter term the compiler couldn't make sense of, worded for
+// the user
+type Error struct {
+	Term    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Query is a compiled filter
+type Query struct {
+	Model  *Model
+	Domain odoo.Domain
+	// Keywords and Terms describe the conditions as understood, with names
+	// resolved
+	Keywords []string
+	Terms    []string
+}
+
+// Describe restates the query, e.g. "unpaid invoices over 1,000.00 last
+// month for Azure Interior"
+func (q *Query) Describe() string {
+	words := append(append(append([]string{}, q.Keywords...), q.Model.Nouns[0]), q.Terms...)
+	return strings.Join(words, " ")
+}
+
+// Compiler turns filters such as "unpaid invoices over 1000 from last month
+// for Acme" into Odoo domains. Names of partners, products and other
+// records are looked up in Odoo.
+type Compiler struct {
+	odoo   *odoo.Client
+	models []Model
+	// nouns are every model's nouns, longest first
+	nouns []noun
+}
+
+type noun struct {
+	words []string
+	model *Model
+}
+
+func NewCompiler(client *odoo.Client, models []Model) *Compiler {
+	c := &Compiler{odoo: client, models: models}
+	for i := range c.models {
+		for _, n := range c.models[i].Nouns {
+			c.nouns = append(c.nouns, noun{words: strings.Fields(strings.ToLower(n)), model: &c.models[i]})
+		}
+	}
+	sort.SliceStable(c.nouns, func(i, j int) bool { return len(c.nouns[i].words) > len(c.nouns[j].words) })
+	return c
+}
+
+// Nouns returns the first noun of each model, to tell users what they can
+// search
+func (c *Compiler) Nouns() []string {
+	nouns := make([]string, len(c.models))
+	for i, m := range c.models {
+		nouns[i] = m.Nouns[0]
+	}
+	return nouns
+}
+
+// Find returns the model a filter is about, or nil
+func (c *Compiler) Find(text string) *Model {
+	words := lowerWords(tokenize(text))
+	for i := range words {
+		if n, ok := c.nounAt(words, i); ok {
+			return n.model
+		}
+	}
+	return nil
+}
+
+// Compile turns a filter into a query. Relative dates are relative to now,
+// in its location. An *Error is returned when a term isn't understood.
+func (c *Compiler) Compile(ctx context.Context, text string, now time.Time) (*Query, error) {
+	tokens := tokenize(text)
+	words := lowerWords(tokens)
+
+	start := -1
+	var found noun
+	for i := range words {
+		if n, ok := c.nounAt(words, i); ok {
+			start, found = i, n
+			break
+		}
+	}
+	if start < 0 {
+		return nil, &Error{Message: fmt.Sprintf("I don't know what to search for. Try %s.", joinOr(c.Nouns()))}
+	}
+
+	p := &parser{
+		ctx:   ctx,
+		odoo:  c.odoo,
+		model: found.model,
+		today: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
+		now:   now,
+	}
+	p.domain = append(p.domain, found.model.Domain...)
+
+	// Words before the noun are adjectives like "unpaid" or "my", those
+	// after it are the other conditions
+	if err := p.parse(tokens[:start]); err != nil {
+		return nil, err
+	}
+	if err := p.parse(tokens[start+len(found.words):]); err != nil {
+		return nil, err
+	}
+	return &Query{Model: found.model, Domain: p.domain, Keywords: p.keywords, Terms: p.terms}, nil
+}
+
+func (c *Compiler) nounAt(words []string, i int) (noun, bool) {
+	for _, n := range c.nouns {
+		if hasPrefix(words[i:], n.words) {
+			return n, true
+		}
+	}
+	return noun{}, false
+}
+
+// token is a word of a filter, or a quoted phrase
+type token struct {
+	text  string
+	lower string
+}
+
+// tokenize splits a filter into words, keeping "quoted names" together and
+// separating comparison operators such as ">1000"
+func tokenize(text string) []token {
+	var tokens []token
+	add := func(s string) {
+		s = strings.TrimFunc(s, func(r rune) bool { return strings.ContainsRune(",.?!;:", r) })
+		if s != "" {
+			tokens = append(tokens, token{text: s, lower: strings.ToLower(s)})
+		}
+	}
+
+	for len(text) > 0 {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			break
+		}
+		if quote := text[0]; quote == '"' || quote == '\'' {
+			if end := strings.IndexByte(text[1:], quote); end >= 0 {
+				tokens = append(tokens, token{text: text[1 : end+1], lower: strings.ToLower(text[1 : end+1])})
+				text = text[end+2:]
+				continue
+			}
+		}
+
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		word := text[:end]
+		text = text[end:]
+		if op := leadingOperator(word); op != "" {
+			tokens = append(tokens, token{text: op, lower: op})
+			word = word[len(op):]
+		}
+		add(word)
+	}
+	return tokens
+}
+
+func leadingOperator(word string) string {
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(word, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func lowerWords(tokens []token) []string {
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.lower
+	}
+	return words
+}
+
+// fillers are skipped wherever they appear
+var fillers = map[string]bool{
+	"show": true, "list": true, "find": true, "search": true, "get": true, "give": true, "me": true,
+	"all": true, "the": true, "any": true, "and": true, "that": true, "which": true, "are": true,
+	"were": true, "was": true, "is": true, "what": true, "where": true, "whose": true, "please": true,
+}
+
+// stopWords end a name, since they start another condition
+var stopWords = map[string]bool{
+	"from": true, "for": true, "of": true, "to": true, "by": true, "with": true, "containing": true,
+	"including": true, "over": true, "above": true, "under": true, "below": true, "more": true,
+	"less": true, "greater": true, "between": true, "since": true, "before": true, "after": true,
+	"until": true, "on": true, "in": true, "during": true, "today": true, "yesterday": true,
+	"this": true, "last": true, "and": true, "that": true, "which": true, "where": true, "whose": true,
+	"my": true, ">": true, "<": true, ">=": true, "<=": true,
+}
+
+// comparisons are the words comparing amounts and their operators
+var comparisons = []struct {
+	words    []string
+	operator string
+}{
+	{[]string{"more", "than"}, ">"}, {[]string{"greater", "than"}, ">"}, {[]string{"over"}, ">"},
+	{[]string{"above"}, ">"}, {[]string{">"}, ">"},
+	{[]string{"at", "least"}, ">="}, {[]string{">="}, ">="},
+	{[]string{"less", "than"}, "<"}, {[]string{"under"}, "<"}, {[]string{"below"}, "<"}, {[]string{"<"}, "<"},
+	{[]string{"at", "most"}, "<="}, {[]string{"<="}, "<="},
+}
+
+// operators compare a field to a value in "<field> <operator> <value>"
+var operators = []struct {
+	words    []string
+	operator string
+}{
+	{[]string{"is", "not"}, "!="}, {[]string{"isn't"}, "!="}, {[]string{"!="}, "!="},
+	{[]string{"contains"}, "ilike"}, {[]string{"like"}, "ilike"},
+	{[]string{"is", "before"}, "<"}, {[]string{"is", "after"}, ">"}, {[]string{"before"}, "<"}, {[]string{"after"}, ">"},
+	{[]string{"is"}, "="}, {[]string{"="}, "="}, {[]string{"equals"}, "="},
+}
+
+// relationLabels name the records of a model in error messages
+var relationLabels = map[string]string{
+	"res.partner":     "contact",
+	"res.users":       "user",
+	"product.product": "product",
+}
+
+// parser compiles the conditions of one filter
+type parser struct {
+	ctx      context.Context
+	odoo     *odoo.Client
+	model    *Model
+	today    time.Time
+	now      time.Time
+	domain   odoo.Domain
+	keywords []string
+	terms    []string
+}
+
+func (p *parser) parse(tokens []token) error {
+	words := lowerWords(tokens)
+	for i := 0; i < len(words); {
+		n, err := p.condition(tokens[i:], words[i:])
+		if err != nil {
+			return err
+		}
+		i += n
+	}
+	return nil
+}
+
+// condition compiles the condition at the start of words and returns how
+// many words it used
+func (p *parser) condition(tokens []token, words []string) (int, error) {
+	m := p.model
+	w := words[0]
+
+	if keyword, n := p.keywordAt(words); n > 0 {
+		p.domain = append(p.domain, digest.Expand(m.Keywords[keyword], p.now)...)
+		p.keywords = append(p.keywords, keyword)
+		return n, nil
+	}
+	if f, n := p.fieldAt(words); n > 0 {
+		used, err := p.compare(f, tokens[n:], words[n:])
+		return n + used, err
+	}
+
+	// "with revenue over 10k"
+	if w == "with" || w == "where" || w == "whose" {
+		if _, n := p.fieldAt(words[1:]); n > 0 {
+			return 1, nil
+		}
+	}
+
+	switch {
+	case fillers[w]:
+		return 1, nil
+
+	case w == "my" || w == "mine":
+		user := odoo.UserFrom(p.ctx)
+		if m.UserField == "" || user == nil {
+			return 0, &Error{Term: w, Message: fmt.Sprintf("I can't tell which %s are yours.", m.Nouns[0])}
+		}
+		p.add(odoo.Domain{odoo.Cond(m.UserField, "=", user.ID)}, "assigned to me")
+		return 1, nil
+
+	case w == "between":
+		return p.between(words)
+
+	case w == "by":
+		if m.UserField == "" {
+			break
+		}
+		used, err := p.relation(m.UserField, "res.users", "by", tokens[1:], words[1:])
+		return used + 1, err
+
+	case w == "with" || w == "containing" || w == "including":
+		if m.ProductField == "" {
+			break
+		}
+		n := 1
+		if len(words) > 1 && (words[1] == "product" || words[1] == "products") {
+			n++
+		}
+		used, err := p.relation(m.ProductField, "product.product", "with", tokens[n:], words[n:])
+		return n + used, err
+
+	case w == "from" || w == "for" || w == "of" || w == "to" || w == "customer" || w == "vendor" || w == "supplier":
+		// "from last month" is a date, "from Acme" a partner
+		if per, n, ok := parsePeriod(words[1:], p.today); ok && m.DateField != "" {
+			p.period(m.DateField, per)
+			return n + 1, nil
+		}
+		if m.PartnerField == "" {
+			break
+		}
+		used, err := p.relation(m.PartnerField, "res.partner", "for", tokens[1:], words[1:])
+		return used + 1, err
+	}
+
+	for _, c := range comparisons {
+		if hasPrefix(words, c.words) && m.AmountField != "" {
+			n := len(c.words)
+			amount, ok := parseNumber(wordAt(words, n))
+			if !ok {
+				return 0, &Error{Term: wordAt(words, n), Message: fmt.Sprintf("I expected an amount after \"%s\".", strings.Join(c.words, " "))}
+			}
+			p.add(odoo.Domain{odoo.Cond(m.AmountField, c.operator, amount)}, strings.Join(c.words, " ")+" "+whatsapp.FormatAmount(amount))
+			return n + 1, nil
+		}
+	}
+
+	if per, n, ok := parsePeriod(words, p.today); ok && m.DateField != "" {
+		p.period(m.DateField, per)
+		return n, nil
+	}
+
+	return 0, &Error{Term: tokens[0].text, Message: fmt.Sprintf("I don't understand \"%s\" in a search for %s.%s", tokens[0].text, m.Nouns[0], p.hint())}
+}
+
+// hint lists what a model can be filtered by
+func (p *parser) hint() string {
+	m := p.model
+	var parts []string
+	if len(m.Keywords) > 0 {
+		keywords := make([]string, 0, len(m.Keywords))
+		for k := range m.Keywords {
+			keywords = append(keywords, k)
+		}
+		sort.Strings(keywords)
+		parts = append(parts, strings.Join(keywords, ", "))
+	}
+	if m.PartnerField != "" {
+		parts = append(parts, `"for <name>"`)
+	}
+	if m.AmountField != "" {
+		parts = append(parts, `"over <amount>"`)
+	}
+	if m.DateField != "" {
+		parts = append(parts, `"last month"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " You can use " + joinOr(parts) + "."
+}
+
+func (p *parser) add(domain odoo.Domain, term string) {
+	p.domain = append(p.domain, domain...)
+	p.terms = append(p.terms, term)
+}
+
+func (p *parser) keywordAt(words []string) (string, int) {
+	var best string
+	var n int
+	for k := range p.model.Keywords {
+		kw := strings.Fields(k)
+		if len(kw) > n && hasPrefix(words, kw) {
+			best, n = k, len(kw)
+		}
+	}
+	return best, n
+}
+
+func (p *parser) fieldAt(words []string) (Field, int) {
+	var best Field
+	var n int
+	for _, f := range p.model.Fields {
+		for _, alias := range f.Aliases {
+			aw := strings.Fields(strings.ToLower(alias))
+			// A field is only compared when an operator follows, so that
+			// "customer Acme" is left to the partner condition
+			if len(aw) > n && hasPrefix(words, aw) && p.operatorAt(words[len(aw):]) != "" {
+				best, n = f, len(aw)
+			}
+		}
+	}
+	return best, n
+}
+
+func (p *parser) operatorAt(words []string) string {
+	for _, o := range operators {
+		if hasPrefix(words, o.words) {
+			return o.operator
+		}
+	}
+	for _, c := range comparisons {
+		if hasPrefix(words, c.words) {
+			return c.operator
+		}
+	}
+	return ""
+}
+
+func operatorLength(words []string) int {
+	for _, o := range operators {
+		if hasPrefix(words, o.words) {
+			return len(o.words)
+		}
+	}
+	for _, c := range comparisons {
+		if hasPrefix(words, c.words) {
+			return len(c.words)
+		}
+	}
+	return 0
+}
+
+// compare compiles "<operator> <value>" for a field
+func (p *parser) compare(f Field, tokens []token, words []string) (int, error) {
+	operator := p.operatorAt(words)
+	n := operatorLength(words)
+	alias := f.Aliases[0]
+
+	switch f.Type {
+	case typeMany2one:
+		used, err := p.relation(f.Name, f.Relation, alias+" "+strings.Join(words[:n], " "), tokens[n:], words[n:])
+		if err == nil && operator == "!=" {
+			// Negate the condition that was just added
+			p.domain = append(p.domain[:len(p.domain)-1], append(odoo.Domain{"!"}, p.domain[len(p.domain)-1])...)
+		}
+		return n + used, err
+
+	case typeNumber, typeMonetary:
+		value, ok := parseNumber(wordAt(words, n))
+		if !ok {
+			return 0, &Error{Term: wordAt(words, n), Message: fmt.Sprintf("I expected a number after \"%s %s\".", alias, strings.Join(words[:n], " "))}
+		}
+		if operator == "ilike" {
+			operator = "="
+		}
+		p.add(odoo.Domain{odoo.Cond(f.Name, operator, value)}, fmt.Sprintf("with %s %s %s", alias, operator, whatsapp.FormatAmount(value)))
+		return n + 1, nil
+
+	case typeDate, typeDatetime:
+		day, used, ok := parseDate(words[n:], p.today)
+		if !ok {
+			return 0, &Error{Term: wordAt(words, n), Message: fmt.Sprintf("I expected a date after \"%s %s\", e.g. 1 Mar.", alias, strings.Join(words[:n], " "))}
+		}
+		per := period{day, day.AddDate(0, 0, 1), alias + " on " + day.Format("2 Jan 2006")}
+		switch operator {
+		case "<", "<=":
+			per = period{end: day, label: alias + " before " + day.Format("2 Jan 2006")}
+			if operator == "<=" {
+				per.end = day.AddDate(0, 0, 1)
+			}
+		case ">", ">=":
+			per = period{start: day.AddDate(0, 0, 1), label: alias + " after " + day.Format("2 Jan 2006")}
+			if operator == ">=" {
+				per.start = day
+			}
+		case "!=":
+			return 0, &Error{Term: alias, Message: fmt.Sprintf("Please use before or after to filter on %s.", alias)}
+		}
+		p.period(f.Name, per)
+		return n + used, nil
+
+	case typeBoolean:
+		value, ok := map[string]bool{"true": true, "yes": true, "set": true, "false": false, "no": false}[wordAt(words, n)]
+		if !ok {
+			return 0, &Error{Term: wordAt(words, n), Message: fmt.Sprintf("Please say yes or no for %s.", alias)}
+		}
+		if operator == "!=" {
+			value = !value
+		}
+		p.add(odoo.Domain{odoo.Cond(f.Name, "=", value)}, fmt.Sprintf("with %s %t", alias, value))
+		return n + 1, nil
+
+	case typeSelection:
+		used, name := nameAt(tokens[n:], words[n:])
+		if used == 0 {
+			return 0, &Error{Term: alias, Message: fmt.Sprintf("What should %s be?", alias)}
+		}
+		if operator != "!=" {
+			operator = "="
+		}
+		value := strings.ReplaceAll(strings.ToLower(name), " ", "_")
+		p.add(odoo.Domain{odoo.Cond(f.Name, operator, value)}, fmt.Sprintf("with %s %s %s", alias, operator, name))
+		return n + used, nil
+	}
+
+	used, value := nameAt(tokens[n:], words[n:])
+	if used == 0 {
+		return 0, &Error{Term: alias, Message: fmt.Sprintf("What should %s be?", alias)}
+	}
+	switch operator {
+	case "=":
+		operator = "=ilike"
+	case "!=":
+		operator = "not ilike"
+	}
+	p.add(odoo.Domain{odoo.Cond(f.Name, operator, value)}, fmt.Sprintf("with %s %s %s", alias, strings.Join(words[:n], " "), value))
+	return n + used, nil
+}
+
+// between compiles "between 100 and 500" on the amount, or "between 1 Mar
+// and 15 Mar" on the date
+func (p *parser) between(words []string) (int, error) {
+	m := p.model
+	if low, ok := parseNumber(wordAt(words, 1)); ok && wordAt(words, 2) == "and" && m.AmountField != "" {
+		high, ok := parseNumber(wordAt(words, 3))
+		if !ok {
+			return 0, &Error{Term: wordAt(words, 3), Message: "I expected an amount after \"and\"."}
+		}
+		p.add(odoo.Domain{odoo.Cond(m.AmountField, ">=", low), odoo.Cond(m.AmountField, "<=", high)},
+			fmt.Sprintf("between %s and %s", whatsapp.FormatAmount(low), whatsapp.FormatAmount(high)))
+		return 4, nil
+	}
+
+	if m.DateField != "" {
+		if from, n, ok := parseDate(words[1:], p.today); ok && wordAt(words, n+1) == "and" {
+			if to, m, ok := parseDate(words[n+2:], p.today); ok {
+				p.period(p.model.DateField, period{from, to.AddDate(0, 0, 1),
+					fmt.Sprintf("between %s and %s", from.Format("2 Jan 2006"), to.Format("2 Jan 2006"))})
+				return n + m + 2, nil
+			}
+		}
+	}
+	return 0, &Error{Term: "between", Message: `Please write "between 100 and 500" or "between 1 Mar and 15 Mar".`}
+}
+
+// period restricts a date or datetime field to a period. Datetimes are
+// stored in UTC, so the period's days are converted from their location.
+func (p *parser) period(field string, per period) {
+	format := func(t time.Time) string { return t.Format(dateLayout) }
+	if p.model.fieldType(field, typeDate) == typeDatetime {
+		format = func(t time.Time) string { return t.UTC().Format(odoo.DatetimeFormat) }
+	}
+
+	var domain odoo.Domain
+	if !per.start.IsZero() {
+		domain = append(domain, odoo.Cond(field, ">=", format(per.start)))
+	}
+	if !per.end.IsZero() {
+		domain = append(domain, odoo.Cond(field, "<", format(per.end)))
+	}
+	p.add(domain, per.label)
+}
+
+// relation compiles a name into a condition on a many2one field, e.g. "for
+// Acme" on partner_id. A partner matches with its contacts.
+func (p *parser) relation(field, model, label string, tokens []token, words []string) (int, error) {
+	used, name := nameAt(tokens, words)
+	if used == 0 {
+		return 0, &Error{Term: label, Message: fmt.Sprintf("I expected a name after \"%s\".", label)}
+	}
+
+	ids, display, err := p.resolve(model, name)
+	if err != nil {
+		return 0, err
+	}
+	if model == "res.partner" {
+		p.add(odoo.Domain{odoo.Cond(field, "child_of", ids)}, label+" "+display)
+	} else {
+		p.add(odoo.Domain{odoo.Cond(field, "in", ids)}, label+" "+display)
+	}
+	return used, nil
+}
+
+// resolve finds the records of a model called name: those whose name is
+// exactly name, or the single one containing it. Contacts of the same
+// company count as one partner.
+func (p *parser) resolve(model, name string) ([]int, string, error) {
+	var results [][]interface{}
+	if err := p.odoo.ExecuteKW(p.ctx, model, "name_search", []interface{}{},
+		map[string]interface{}{"name": name, "limit": 20}, &results); err != nil {
+		return nil, "", fmt.Errorf("failed to search %s: %w", model, err)
+	}
+
+	label := relationLabels[model]
+	if label == "" {
+		label = "record"
+	}
+	if len(results) == 0 {
+		return nil, "", &Error{Term: name, Message: fmt.Sprintf("I couldn't find a %s called \"%s\".", label, name)}
+	}
+
+	type match struct {
+		id   int
+		name string
+	}
+	var matches, exact []match
+	for _, r := range results {
+		if len(r) < 2 {
+			continue
+		}
+		id, _ := r[0].(float64)
+		display, _ := r[1].(string)
+		matches = append(matches, match{int(id), display})
+		if strings.EqualFold(display, name) {
+			exact = append(exact, match{int(id), display})
+		}
+	}
+	if len(exact) > 0 {
+		matches = exact
+	}
+
+	if model == "res.partner" && len(matches) > 1 {
+		ids := make([]int, len(matches))
+		for i, m := range matches {
+			ids[i] = m.id
+		}
+		partners, err := p.odoo.Read(p.ctx, "res.partner", ids, []string{"commercial_partner_id"}, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read partners: %w", err)
+		}
+		seen := map[int]bool{}
+		var companies []match
+		for _, partner := range partners {
+			id, display := partner.Many2one("commercial_partner_id")
+			if id != 0 && !seen[id] {
+				seen[id] = true
+				companies = append(companies, match{id, display})
+			}
+		}
+		if len(companies) > 0 {
+			matches = companies
+		}
+	}
+
+	if len(matches) == 1 || len(exact) > 0 {
+		ids := make([]int, len(matches))
+		for i, m := range matches {
+			ids[i] = m.id
+		}
+		return ids, matches[0].name, nil
+	}
+
+	names := make([]string, 0, maxMatches)
+	for i, m := range matches {
+		if i == maxMatches {
+			break
+		}
+		names = append(names, m.name)
+	}
+	return nil, "", &Error{Term: name, Message: fmt.Sprintf("\"%s\" matches several %ss: %s. Please be more specific.", name, label, strings.Join(names, "; "))}
+}
+
+// nameAt reads a name up to the next condition and returns how many words
+// it used
+func nameAt(tokens []token, words []string) (int, string) {
+	var parts []string
+	for i, w := range words {
+		if stopWords[w] && i > 0 {
+			break
+		}
+		if stopWords[w] {
+			return 0, ""
+		}
+		parts = append(parts, tokens[i].text)
+	}
+	return len(parts), strings.Join(parts, " ")
+}
+
+// parseNumber reads an amount such as 1000, 1,000.50, $1000, 1.5k or 2m
+func parseNumber(word string) (float64, bool) {
+	word = strings.TrimLeft(word, "$€£¥")
+	word = strings.ReplaceAll(word, ",", "")
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(word, "k"):
+		multiplier, word = 1e3, strings.TrimSuffix(word, "k")
+	case strings.HasSuffix(word, "m"):
+		multiplier, word = 1e6, strings.TrimSuffix(word, "m")
+	}
+	value, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value * multiplier, true
+}
+
+func hasPrefix(words, prefix []string) bool {
+	if len(words) < len(prefix) {
+		return false
+	}
+	for i, w := range prefix {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+func wordAt(words []string, i int) string {
+	if i < len(words) {
+		return words[i]
+	}
+	return ""
+}
+
+// joinOr joins items as "a, b or c"
+func joinOr(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
@@ -0,0 +1,180 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCompiler compiles the default models against a fake Odoo with a
+// few partners, products and users
+func newTestCompiler(t *testing.T) (*Compiler, *odootest.Server) {
+	server := odootest.NewServer(t)
+	server.Seed("res.partner",
+		odoo.Record{"id": 7, "name": "Acme Corp", "is_company": true, "commercial_partner_id": 7},
+		odoo.Record{"id": 8, "name": "Brandon Freeman", "parent_id": 7, "commercial_partner_id": 7},
+		odoo.Record{"id": 9, "name": "Acme Logistics", "is_company": true, "commercial_partner_id": 9},
+		odoo.Record{"id": 10, "name": "Deco Addict", "is_company": true, "commercial_partner_id": 10},
+	)
+	server.Seed("product.product", odoo.Record{"id": 5, "name": "Office Desk"}, odoo.Record{"id": 6, "name": "Office Chair"})
+	server.AddUser(odoo.Record{"id": 6, "name": "Marc Demo", "login": "demo"}, "demo")
+	return NewCompiler(server.Client(), DefaultModels), server
+}
+
+// now is Wednesday 12 March 2025, 09:00 in Singapore
+var now = time.Date(2025, 3, 12, 9, 0, 0, 0, time.FixedZone("SGT", 8*3600))
+
+func TestCompile(t *testing.T) {
+	a := assert.New(t)
+	compiler, _ := newTestCompiler(t)
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 2, Login: "admin"})
+
+	tests := []struct {
+		text     string
+		model    string
+		domain   odoo.Domain
+		describe string
+	}{
+		{
+			"unpaid invoices over 1000 from last month for Acme Corp",
+			"account.move",
+			odoo.Domain{
+				odoo.Cond("move_type", "=", "out_invoice"),
+				odoo.Cond("state", "=", "posted"), odoo.Cond("payment_state", "in", []string{"not_paid", "partial"}),
+				odoo.Cond("amount_total", ">", 1000.0),
+				odoo.Cond("invoice_date", ">=", "2025-02-01"), odoo.Cond("invoice_date", "<", "2025-03-01"),
+				odoo.Cond("partner_id", "child_of", []int{7}),
+			},
+			"unpaid invoices over 1,000.00 last month for Acme Corp",
+		},
+		{
+			"show my overdue bills under $2.5k",
+			"account.move",
+			odoo.Domain{
+				odoo.Cond("move_type", "=", "in_invoice"),
+				odoo.Cond("invoice_user_id", "=", 2),
+				odoo.Cond("state", "=", "posted"), odoo.Cond("payment_state", "in", []string{"not_paid", "partial"}),
+				odoo.Cond("invoice_date_due", "<", "2025-03-12"),
+				odoo.Cond("amount_total", "<", 2500.0),
+			},
+			"overdue bills assigned to me under 2,500.00",
+		},
+		{
+			// Datetimes are compared in UTC
+			`purchase orders this week with "office desk" by Marc Demo`,
+			"purchase.order",
+			odoo.Domain{
+				odoo.Cond("date_order", ">=", "2025-03-09 16:00:00"), odoo.Cond("date_order", "<", "2025-03-16 16:00:00"),
+				odoo.Cond("order_line.product_id", "in", []int{5}),
+				odoo.Cond("user_id", "in", []int{6}),
+			},
+			"purchase orders this week with Office Desk by Marc Demo",
+		},
+		{
+			"quotations with total >= 500 and due date... no, expiration before 1 Apr",
+			"", nil, "",
+		},
+		{
+			"sales orders between 100 and 500 since 1 Jan customer is deco addict",
+			"sale.order",
+			odoo.Domain{
+				odoo.Cond("state", "=", "sale"),
+				odoo.Cond("amount_total", ">=", 100.0), odoo.Cond("amount_total", "<=", 500.0),
+				odoo.Cond("date_order", ">=", "2024-12-31 16:00:00"),
+				odoo.Cond("partner_id", "child_of", []int{10}),
+			},
+			"sales orders between 100.00 and 500.00 since 1 Jan 2025 customer is Deco Addict",
+		},
+		{
+			"leads in february 2024 with revenue over 10k",
+			"crm.lead",
+			odoo.Domain{
+				odoo.Cond("create_date", ">=", "2024-01-31 16:00:00"), odoo.Cond("create_date", "<", "2024-02-29 16:00:00"),
+				odoo.Cond("expected_revenue", ">", 10000.0),
+			},
+			"opportunities in February 2024 with revenue > 10,000.00",
+		},
+	}
+	for _, tt := range tests {
+		query, err := compiler.Compile(ctx, tt.text, now)
+		if tt.model == "" {
+			a.Error(err, tt.text)
+			continue
+		}
+		if a.NoError(err, tt.text) {
+			a.Equal(tt.model, query.Model.Name, tt.text)
+			a.Equal(tt.domain, query.Domain, tt.text)
+			a.Equal(tt.describe, query.Describe(), tt.text)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	a := assert.New(t)
+	compiler, _ := newTestCompiler(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		text    string
+		message string
+	}{
+		{"how are you", "I don't know what to search for. Try invoices, bills, sales orders, quotations, purchase orders or opportunities."},
+		{"invoices for Acme", `"Acme" matches several contacts: Acme Corp; Acme Logistics. Please be more specific.`},
+		{"invoices for Globex", `I couldn't find a contact called "Globex".`},
+		{"frobbed invoices", `I don't understand "frobbed" in a search for invoices. You can use cancelled, draft, open, overdue, paid, partially paid, posted, unpaid, "for <name>", "over <amount>" or "last month".`},
+		{"invoices over lots", `I expected an amount after "over".`},
+		{"my invoices", "I can't tell which invoices are yours."},
+	}
+	for _, tt := range tests {
+		_, err := compiler.Compile(ctx, tt.text, now)
+		var filterErr *Error
+		if a.True(errors.As(err, &filterErr), tt.text) {
+			a.Equal(tt.message, filterErr.Message, tt.text)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	a := assert.New(t)
+	today := time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		text       string
+		start, end string
+	}{
+		{"today", "2025-03-12", "2025-03-13"},
+		{"this month", "2025-03-01", "2025-04-01"},
+		{"last quarter", "2024-10-01", "2025-01-01"},
+		{"last year", "2024-01-01", "2025-01-01"},
+		{"last 7 days", "2025-03-06", "2025-03-13"},
+		{"in may", "2024-05-01", "2024-06-01"},
+		{"march", "2025-03-01", "2025-04-01"},
+		{"in 2024", "2024-01-01", "2025-01-01"},
+		{"on 2025-03-03", "2025-03-03", "2025-03-04"},
+		{"before 1 mar", "", "2025-03-01"},
+		{"since march 20", "2024-03-20", ""},
+	}
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(dateLayout)
+	}
+	for _, tt := range tests {
+		words := lowerWords(tokenize(tt.text))
+		p, n, ok := parsePeriod(words, today)
+		if a.True(ok, tt.text) {
+			a.Equal(len(words), n, tt.text)
+			a.Equal(tt.start, format(p.start), tt.text)
+			a.Equal(tt.end, format(p.end), tt.text)
+		}
+	}
+
+	_, _, ok := parsePeriod([]string{"decor"}, today)
+	a.False(ok)
+}
@@ -0,0 +1,153 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxResults is how many records a search answer lists
+const maxResults = 10
+
+var searchPattern = regexp.MustCompile(`(?i)^\s*(?:show|list|find|search(?:\s+for)?|get|give\s+me)\b`)
+
+// Service answers searches such as "show unpaid invoices over 1000 from
+// last month for Acme" with the records found in Odoo
+type Service struct {
+	compiler *Compiler
+	odoo     *odoo.Client
+	sender   agent.Sender
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, models []Model) *Service {
+	return &Service{compiler: NewCompiler(client, models), odoo: client, sender: sender, now: time.Now}
+}
+
+func (s *Service) Name() string {
+	return "search"
+}
+
+func (s *Service) Help() string {
+	return `"show unpaid invoices over 1000 from last month for Acme" to search Odoo`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && searchPattern.MatchString(msg.Body) && s.compiler.Find(msg.Body) != nil
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// Searches run with the user's own access rights, which needs their API
+	// key: the service account could read any record
+	user := odoo.UserFrom(ctx)
+	if user == nil {
+		return s.send(ctx, msg.SenderID, "Searches are only available to Odoo users.")
+	}
+	if user.APIKey == "" {
+		return s.send(ctx, msg.SenderID, "To search Odoo from WhatsApp, link this number to your Odoo user with an API key first.")
+	}
+
+	now, err := s.userNow(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	query, err := s.compiler.Compile(ctx, msg.Body, now)
+	var filterErr *Error
+	if errors.As(err, &filterErr) {
+		return s.send(ctx, msg.SenderID, filterErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	model := query.Model
+	records, err := s.odoo.SearchRead(ctx, model.Name, query.Domain, model.Display,
+		&odoo.SearchOptions{Limit: maxResults, Order: model.Order})
+	if err != nil {
+		return fmt.Errorf("failed to search %s: %w", model.Name, err)
+	}
+	total := len(records)
+	if total == maxResults {
+		if err := s.odoo.ExecuteKW(ctx, model.Name, "search_count", []interface{}{query.Domain}, nil, &total); err != nil {
+			return fmt.Errorf("failed to count %s: %w", model.Name, err)
+		}
+	}
+	return s.send(ctx, msg.SenderID, Format(query, records, total))
+}
+
+// Format renders the records found by a query, one line each with the
+// model's display fields
+func Format(query *Query, records []odoo.Record, total int) string {
+	var b strings.Builder
+	description := query.Describe()
+	fmt.Fprintf(&b, "🔎 *%s*", strings.ToUpper(description[:1])+description[1:])
+	if total == 0 {
+		b.WriteString("\nNothing found.")
+		return b.String()
+	}
+	fmt.Fprintf(&b, ": %d found\n", total)
+
+	for _, r := range records {
+		var values []string
+		for _, field := range query.Model.Display {
+			if v := formatValue(query.Model, field, r); v != "" {
+				values = append(values, v)
+			}
+		}
+		fmt.Fprintf(&b, "\n• %s", strings.Join(values, " · "))
+	}
+	if total > len(records) {
+		fmt.Fprintf(&b, "\n…and %d more. Add conditions to narrow the search.", total-len(records))
+	}
+	return b.String()
+}
+
+// formatValue renders a field of a record, or "" when it's empty
+func formatValue(m *Model, field string, r odoo.Record) string {
+	if _, name := r.Many2one(field); name != "" {
+		return name
+	}
+	switch v := r[field].(type) {
+	case float64:
+		if m.fieldType(field, typeMonetary) == typeMonetary {
+			return whatsapp.FormatAmount(v)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		// Datetimes are shown as their day
+		if _, err := time.Parse(odoo.DatetimeFormat, v); err == nil {
+			return v[:len(dateLayout)]
+		}
+		return strings.ReplaceAll(v, "_", " ")
+	}
+	return ""
+}
+
+// userNow returns the current time in the user's timezone
+func (s *Service) userNow(ctx context.Context, userID int) (time.Time, error) {
+	users, err := s.odoo.Read(ctx, "res.users", []int{userID}, []string{"tz"}, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read user: %w", err)
+	}
+	location := time.UTC
+	if len(users) > 0 && users[0].String("tz") != "" {
+		if l, err := time.LoadLocation(users[0].String("tz")); err == nil {
+			location = l
+		}
+	}
+	return s.now().In(location), nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceHandle(t *testing.T) {
+	a := assert.New(t)
+	_, server := newTestCompiler(t)
+	invoice := func(id int, name string, partner int, date string, amount float64, state string) odoo.Record {
+		return odoo.Record{
+			"id": id, "name": name, "move_type": "out_invoice", "state": "posted", "payment_state": state,
+			"partner_id": partner, "invoice_date": date, "amount_total": amount,
+		}
+	}
+	server.Seed("account.move",
+		invoice(1, "INV/2025/00001", 8, "2025-02-03", 1500, "not_paid"),
+		invoice(2, "INV/2025/00002", 7, "2025-02-20", 2750.5, "partial"),
+		invoice(3, "INV/2025/00003", 7, "2025-02-21", 400, "not_paid"),
+		invoice(4, "INV/2025/00004", 7, "2025-02-22", 3000, "paid"),
+		invoice(5, "INV/2025/00005", 10, "2025-02-23", 5000, "not_paid"),
+	)
+	a.NoError(server.Update("res.users", 6, odoo.Record{"tz": "Asia/Singapore"}))
+
+	sender := &agenttest.Sender{}
+	service := NewService(server.Client(), sender, DefaultModels)
+	service.now = func() time.Time { return now }
+
+	msg := whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "show unpaid invoices over 1000 from last month for Acme Corp"}
+	a.True(service.Match(msg))
+	a.False(service.Match(whatsapp.WebhookMessage{Type: "text", Body: "show me the way"}))
+	a.False(service.Match(whatsapp.WebhookMessage{Type: "text", Body: "I sent the invoices"}))
+
+	a.NoError(service.Handle(context.Background(), msg))
+	a.Equal("Searches are only available to Odoo users.", sender.LastText())
+
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 6, Login: "demo"})
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("To search Odoo from WhatsApp, link this number to your Odoo user with an API key first.", sender.LastText())
+
+	ctx = odoo.WithUser(context.Background(), &odoo.User{ID: 6, Login: "demo", APIKey: "demo"})
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("🔎 *Unpaid invoices over 1,000.00 last month for Acme Corp*: 2 found\n"+
+		"\n• INV/2025/00002 · Acme Corp · 2025-02-20 · 2,750.50 · partial"+
+		"\n• INV/2025/00001 · Acme Corp, Brandon Freeman · 2025-02-03 · 1,500.00 · not paid", sender.LastText())
+
+	msg.Body = "show invoices for Acme"
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal(`"Acme" matches several contacts: Acme Corp; Acme Logistics. Please be more specific.`, sender.LastText())
+
+	msg.Body = "list paid invoices for deco addict"
+	a.NoError(service.Handle(ctx, msg))
+	a.Equal("🔎 *Paid invoices for Deco Addict*\nNothing found.", sender.LastText())
+}
@@ -0,0 +1,114 @@
+// Package fuzzy ranks names against what users type in chat, which is often
+// abbreviated, reordered or misspelled
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Threshold is the score below which a candidate is not considered a match
+const Threshold = 0.6
+
+// Match is a candidate and its score between 0 and 1
+type Match struct {
+	Index int
+	Name  string
+	Score float64
+}
+
+// Score rates how well name matches query: 1 for the same words, 0.9 when
+// query is contained in name, otherwise the share of query words found in
+// name or the edit-distance similarity, whichever is higher
+func Score(query, name string) float64 {
+	q, n := normalize(query), normalize(name)
+	if q == "" || n == "" {
+		return 0
+	}
+	if q == n {
+		return 1
+	}
+	if strings.Contains(n, q) {
+		return 0.9
+	}
+
+	nameWords := strings.Fields(n)
+	var found float64
+	queryWords := strings.Fields(q)
+	for _, qw := range queryWords {
+		best := 0.0
+		for _, nw := range nameWords {
+			if s := similarity(qw, nw); s > best {
+				best = s
+			}
+		}
+		found += best
+	}
+	words := 0.85 * found / float64(len(queryWords))
+
+	if s := similarity(q, n); s > words {
+		return s
+	}
+	return words
+}
+
+// Rank returns the names that match query, best first
+func Rank(query string, names []string) []Match {
+	var matches []Match
+	for i, name := range names {
+		if s := Score(query, name); s >= Threshold {
+			matches = append(matches, Match{Index: i, Name: name, Score: s})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// Best returns the single best match, or false when nothing matches or the
+// top two matches are too close to tell apart
+func Best(query string, names []string) (Match, bool) {
+	matches := Rank(query, names)
+	if len(matches) == 0 {
+		return Match{}, false
+	}
+	if len(matches) > 1 && matches[0].Score-matches[1].Score < 0.05 {
+		return matches[0], false
+	}
+	return matches[0], true
+}
+
+// normalize lowercases and reduces punctuation to single spaces
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// similarity is 1 minus the Levenshtein distance relative to the longer string
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	longest := max(len(ra), len(rb))
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
@@ -0,0 +1,33 @@
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(1.0, Score("website redesign", "Website  Redesign"))
+	a.Equal(0.9, Score("redesign", "Website Redesign"))
+	a.Greater(Score("websit redesing", "Website Redesign"), Threshold)
+	a.Less(Score("payroll", "Website Redesign"), Threshold)
+}
+
+func TestBest(t *testing.T) {
+	a := assert.New(t)
+	projects := []string{"Office Design", "Website Redesign", "Research & Development"}
+
+	m, ok := Best("web redesign", projects)
+	if a.True(ok) {
+		a.Equal("Website Redesign", m.Name)
+		a.Equal(1, m.Index)
+	}
+
+	_, ok = Best("pump", projects)
+	a.False(ok)
+
+	_, ok = Best("design", []string{"Office Design", "Garden Design"})
+	a.False(ok, "equally good matches are ambiguous")
+}
@@ -0,0 +1,32 @@
+package helpdesk
+
+import (
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Ticket is a helpdesk.ticket opened from WhatsApp
+type Ticket struct {
+	ID      int
+	Ref     string
+	Subject string
+}
+
+// draft collects the messages of a ticket being reported
+type draft struct {
+	Lines []string
+	Media []whatsapp.WebhookMessage
+}
+
+// subject is the first line of the description, shortened to fit a title
+func (d *draft) subject() string {
+	if len(d.Lines) == 0 {
+		return "WhatsApp support request"
+	}
+	subject, _, _ := strings.Cut(d.Lines[0], "\n")
+	if len([]rune(subject)) > 80 {
+		subject = string([]rune(subject)[:79]) + "…"
+	}
+	return subject
+}
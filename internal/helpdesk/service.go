@@ -0,0 +1,331 @@
+package helpdesk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// ticketTag marks tickets opened from WhatsApp; only their customers are
+// notified of updates
+const ticketTag = "WhatsApp"
+
+var startPattern = regexp.MustCompile(`(?i)^\s*(?:report\s+(?:a\s+)?problem|(?:new|open)\s+(?:a\s+)?ticket|support)\b[\s:,-]*(.*)$`)
+
+// Service opens helpdesk tickets from WhatsApp conversations and keeps the
+// customer posted on their progress
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	media    agent.MediaDownloader
+	sessions *agent.Sessions
+	team     string
+
+	// stages holds the last known stage of each WhatsApp ticket
+	mu     sync.Mutex
+	stages map[int]int
+	// lastMessageID is the newest chatter message relayed to a customer
+	lastMessageID int
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, media agent.MediaDownloader, sessions *agent.Sessions) *Service {
+	return &Service{
+		odoo:     client,
+		sender:   sender,
+		media:    media,
+		sessions: sessions,
+		team:     os.Getenv("HELPDESK_TEAM"),
+		stages:   map[int]int{},
+	}
+}
+
+func (s *Service) Name() string {
+	return "helpdesk"
+}
+
+func (s *Service) Help() string {
+	return `"report a problem" to open a support ticket`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && startPattern.MatchString(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	session := s.sessions.Get(msg.SenderID)
+	if session == nil || session.Capability != s.Name() {
+		d := &draft{}
+		if m := startPattern.FindStringSubmatch(msg.Body); m != nil && strings.TrimSpace(m[1]) != "" {
+			d.Lines = append(d.Lines, strings.TrimSpace(m[1]))
+		}
+		s.sessions.Start(msg.SenderID, s.Name(), d)
+		return s.send(ctx, msg.SenderID, "Please describe the problem. You can also send photos or documents.\n"+
+			"Reply *submit* when you're done, or *cancel* to stop.")
+	}
+
+	d := session.Data.(*draft)
+	switch strings.ToLower(strings.TrimSpace(msg.Body)) {
+	case "cancel":
+		s.sessions.End(msg.SenderID)
+		return s.send(ctx, msg.SenderID, "OK, no ticket was opened.")
+	case "submit", "done", "send":
+		if len(d.Lines) == 0 && len(d.Media) == 0 {
+			return s.send(ctx, msg.SenderID, "Please describe the problem before submitting.")
+		}
+		s.sessions.End(msg.SenderID)
+
+		ticket, err := s.CreateTicket(ctx, msg.SenderID, msg.SenderName, d)
+		if errors.Is(err, odoo.ErrQueued) {
+			text := fmt.Sprintf("⏳ Our system is unreachable right now. I'll open your ticket \"%s\" as soon as it's back and let you know.", d.subject())
+			if len(d.Media) > 0 {
+				text += "\nPlease send your files again once it's open."
+			}
+			return s.send(ctx, msg.SenderID, text)
+		}
+		if err != nil {
+			return err
+		}
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("✅ Ticket *#%s* opened: %s\nWe'll message you here when there's an update.",
+			ticket.Ref, ticket.Subject))
+	}
+
+	if msg.MediaID() != "" {
+		d.Media = append(d.Media, msg)
+		if msg.Body != "" {
+			d.Lines = append(d.Lines, msg.Body)
+		}
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("📎 Got %s. Send more or reply *submit*.", msg.MediaFilename()))
+	}
+	if msg.Body != "" {
+		d.Lines = append(d.Lines, msg.Body)
+	}
+	return nil
+}
+
+// CreateTicket opens a helpdesk.ticket for the sender with the collected
+// description and attaches the media they sent. When Odoo can't be reached
+// the ticket is queued without its media and odoo.ErrQueued is returned.
+func (s *Service) CreateTicket(ctx context.Context, waID, name string, d *draft) (*Ticket, error) {
+	subject := d.subject()
+
+	// Lookups fall back on their last known results so that the ticket
+	// itself reaches the queue while Odoo is down
+	lookups := odoo.LastKnown(ctx)
+	tagID, err := s.findOrCreateTag(lookups)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{
+		"name":          subject,
+		"description":   strings.Join(d.Lines, "\n"),
+		"partner_phone": odoo.E164(waID),
+		"tag_ids":       []interface{}{[]interface{}{6, 0, []int{tagID}}},
+	}
+
+	// A customer that can't be looked up is named on the ticket instead
+	partner, err := s.odoo.PartnerByPhone(lookups, waID, []string{"id"})
+	if err != nil && !errors.Is(err, odoo.ErrUnavailable) {
+		return nil, err
+	}
+	if partner != nil {
+		values["partner_id"] = partner.ID()
+	} else {
+		values["partner_name"] = name
+	}
+
+	if s.team != "" {
+		teams, err := s.odoo.SearchRead(lookups, "helpdesk.team", odoo.Domain{odoo.Cond("name", "=ilike", s.team)},
+			[]string{"id"}, &odoo.SearchOptions{Limit: 1})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search helpdesk team: %w", err)
+		}
+		if len(teams) == 0 {
+			return nil, fmt.Errorf("helpdesk team %q not found", s.team)
+		}
+		values["team_id"] = teams[0].ID()
+	}
+
+	summary := fmt.Sprintf("your ticket \"%s\"", subject)
+	id, err := s.odoo.Create(odoo.Queueable(ctx, waID, summary), "helpdesk.ticket", values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ticket: %w", err)
+	}
+
+	// A missing attachment shouldn't lose the ticket, so failures are only logged
+	for _, m := range d.Media {
+		media, err := s.media.DownloadMedia(ctx, m.MediaID())
+		if err != nil {
+			log.Printf("Failed to download media for ticket %d: %v", id, err)
+			continue
+		}
+		if _, err := s.odoo.Attach(ctx, "helpdesk.ticket", id, m.MediaFilename(), media.MimeType, media.Data); err != nil {
+			log.Printf("Failed to attach media to ticket %d: %v", id, err)
+		}
+	}
+
+	ticket := &Ticket{ID: id, Ref: fmt.Sprint(id), Subject: subject}
+	records, err := s.odoo.Read(ctx, "helpdesk.ticket", []int{id}, []string{"ticket_ref", "stage_id"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ticket: %w", err)
+	}
+	if len(records) > 0 {
+		if ref := records[0].String("ticket_ref"); ref != "" {
+			ticket.Ref = ref
+		}
+		stageID, _ := records[0].Many2one("stage_id")
+		s.setStage(id, stageID)
+	}
+	return ticket, nil
+}
+
+// Run notifies customers of stage changes and public replies on their
+// tickets until ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	tagDomain := odoo.Domain{odoo.Cond("tag_ids.name", "=", ticketTag)}
+
+	// Seed the known stages so that only changes made from now on are sent
+	tickets, err := s.odoo.SearchRead(ctx, "helpdesk.ticket", tagDomain, []string{"stage_id"}, nil)
+	if err != nil {
+		log.Printf("Failed to load WhatsApp tickets: %v", err)
+	}
+	for _, t := range tickets {
+		stageID, _ := t.Many2one("stage_id")
+		s.setStage(t.ID(), stageID)
+	}
+
+	ticketWatcher := &odoo.Watcher{
+		Client:   s.odoo,
+		Model:    "helpdesk.ticket",
+		Domain:   tagDomain,
+		Fields:   []string{"name", "ticket_ref", "stage_id", "partner_phone"},
+		Interval: interval,
+	}
+	messageWatcher := &odoo.Watcher{
+		Client: s.odoo,
+		Model:  "mail.message",
+		Domain: odoo.Domain{
+			odoo.Cond("model", "=", "helpdesk.ticket"),
+			odoo.Cond("message_type", "=", "comment"),
+			odoo.Cond("subtype_id.internal", "=", false),
+			odoo.Cond("author_id.user_ids.share", "=", false),
+		},
+		Fields:   []string{"res_id", "body", "author_id"},
+		Interval: interval,
+	}
+
+	go messageWatcher.Run(ctx, s.NotifyReplies)
+	ticketWatcher.Run(ctx, s.NotifyStageChanges)
+}
+
+// NotifyStageChanges tells customers that their ticket moved to a new stage
+func (s *Service) NotifyStageChanges(ctx context.Context, tickets []odoo.Record) error {
+	for _, t := range tickets {
+		stageID, stage := t.Many2one("stage_id")
+		previous, known := s.setStage(t.ID(), stageID)
+		if !known || previous == stageID {
+			continue
+		}
+
+		text := fmt.Sprintf("🔔 Your ticket *#%s* (%s) is now *%s*.", ticketRef(t), t.String("name"), stage)
+		if err := s.notify(ctx, t, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifyReplies relays public replies that agents post on WhatsApp tickets
+func (s *Service) NotifyReplies(ctx context.Context, messages []odoo.Record) error {
+	byTicket := map[int][]odoo.Record{}
+	var ticketIDs []int
+	for _, m := range messages {
+		if m.ID() <= s.lastMessageID {
+			continue
+		}
+		s.lastMessageID = m.ID()
+		if _, ok := byTicket[m.Int("res_id")]; !ok {
+			ticketIDs = append(ticketIDs, m.Int("res_id"))
+		}
+		byTicket[m.Int("res_id")] = append(byTicket[m.Int("res_id")], m)
+	}
+	if len(ticketIDs) == 0 {
+		return nil
+	}
+
+	tickets, err := s.odoo.SearchRead(ctx, "helpdesk.ticket", odoo.Domain{
+		odoo.Cond("id", "in", ticketIDs),
+		odoo.Cond("tag_ids.name", "=", ticketTag),
+	}, []string{"name", "ticket_ref", "partner_phone"}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read tickets: %w", err)
+	}
+
+	for _, t := range tickets {
+		for _, m := range byTicket[t.ID()] {
+			_, author := m.Many2one("author_id")
+			text := fmt.Sprintf("💬 *%s* replied on ticket *#%s*:\n%s", author, ticketRef(t), odoo.HTMLToText(m.String("body")))
+			if err := s.notify(ctx, t, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setStage records a ticket's stage and returns the one it replaces
+func (s *Service) setStage(ticketID, stageID int) (previous int, known bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, known = s.stages[ticketID]
+	s.stages[ticketID] = stageID
+	return previous, known
+}
+
+func (s *Service) notify(ctx context.Context, ticket odoo.Record, text string) error {
+	phone := ticket.String("partner_phone")
+	if phone == "" {
+		log.Printf("Ticket %d has no phone number to notify", ticket.ID())
+		return nil
+	}
+	return s.send(ctx, phone, text)
+}
+
+func (s *Service) findOrCreateTag(ctx context.Context) (int, error) {
+	tags, err := s.odoo.SearchRead(ctx, "helpdesk.tag", odoo.Domain{odoo.Cond("name", "=", ticketTag)},
+		[]string{"id"}, &odoo.SearchOptions{Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to search helpdesk tag: %w", err)
+	}
+	if len(tags) > 0 {
+		return tags[0].ID(), nil
+	}
+
+	id, err := s.odoo.Create(ctx, "helpdesk.tag", map[string]interface{}{"name": ticketTag})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create helpdesk tag: %w", err)
+	}
+	return id, nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+func ticketRef(t odoo.Record) string {
+	if ref := t.String("ticket_ref"); ref != "" {
+		return ref
+	}
+	return fmt.Sprint(t.ID())
+}
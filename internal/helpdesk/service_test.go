@@ -0,0 +1,115 @@
+package helpdesk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{}
+	return NewService(recorder.Client(), sender, sender, agent.NewSessions(time.Minute)), sender, recorder
+}
+
+func TestTicketFlow(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"helpdesk.tag.search_read": []map[string]interface{}{{"id": 5}},
+		"helpdesk.ticket.create":   31,
+		"helpdesk.ticket.read":     []map[string]interface{}{{"id": 31, "ticket_ref": "00031", "stage_id": []interface{}{1, "New"}}},
+		"ir.attachment.create":     80,
+	})
+	sender.Media = map[string]*whatsapp.Media{
+		"media-1": {ID: "media-1", MimeType: "image/jpeg", Data: []byte("jpeg")},
+	}
+	ctx := context.Background()
+	from := whatsapp.WebhookMessage{SenderID: "6598765432", SenderName: "Jane Tan", Type: "text"}
+
+	start := from
+	start.Body = "report a problem: pump leaking"
+	a.True(service.Match(start))
+	a.NoError(service.Handle(ctx, start))
+
+	photo := from
+	photo.Type = "image"
+	photo.MessageID = "wamid.photo"
+	photo.Body = "water under the unit"
+	photo.Media = map[string]interface{}{"id": "media-1", "mime_type": "image/jpeg"}
+	a.NoError(service.Handle(ctx, photo))
+
+	submit := from
+	submit.Body = "Submit"
+	a.NoError(service.Handle(ctx, submit))
+
+	create := recorder.Find("helpdesk.ticket", "create")
+	if a.NotNil(create) {
+		values := create.Args[0].(map[string]interface{})
+		a.Equal("pump leaking", values["name"])
+		a.Equal("pump leaking\nwater under the unit", values["description"])
+		a.Equal("Jane Tan", values["partner_name"])
+		a.Equal("+6598765432", values["partner_phone"])
+	}
+	attach := recorder.Find("ir.attachment", "create")
+	if a.NotNil(attach) {
+		values := attach.Args[0].(map[string]interface{})
+		a.Equal("image-wamid.photo.jpg", values["name"])
+		a.Equal(float64(31), values["res_id"])
+	}
+	a.Contains(sender.LastText(), "Ticket *#00031* opened: pump leaking")
+	a.Nil(service.sessions.Get("6598765432"), "session should end after submitting")
+}
+
+func TestNotifyStageChanges(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t, nil)
+	service.stages[31] = 1
+
+	ticket := func(stageID int, stage string) odoo.Record {
+		return odoo.Record{
+			"id":            float64(31),
+			"name":          "pump leaking",
+			"ticket_ref":    "00031",
+			"stage_id":      []interface{}{float64(stageID), stage},
+			"partner_phone": "+65 9876 5432",
+		}
+	}
+
+	a.NoError(service.NotifyStageChanges(context.Background(), []odoo.Record{ticket(1, "New")}))
+	a.Empty(sender.Messages, "an unchanged stage shouldn't notify")
+
+	a.NoError(service.NotifyStageChanges(context.Background(), []odoo.Record{ticket(2, "In Progress")}))
+	if a.Len(sender.Messages, 1) {
+		a.Equal("+65 9876 5432", sender.Messages[0].To)
+		a.Equal("🔔 Your ticket *#00031* (pump leaking) is now *In Progress*.", sender.Messages[0].Message)
+	}
+}
+
+func TestNotifyReplies(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t, map[string]interface{}{
+		"helpdesk.ticket.search_read": []map[string]interface{}{
+			{"id": 31, "name": "pump leaking", "ticket_ref": "00031", "partner_phone": "+6598765432"},
+		},
+	})
+
+	messages := []odoo.Record{
+		{"id": float64(200), "res_id": float64(31), "author_id": []interface{}{float64(3), "Marc Demo"}, "body": "<p>A technician is on the way.</p>"},
+	}
+	a.NoError(service.NotifyReplies(context.Background(), messages))
+	a.NoError(service.NotifyReplies(context.Background(), messages))
+
+	if a.Len(sender.Messages, 1, "each reply should be relayed once") {
+		a.Equal("💬 *Marc Demo* replied on ticket *#00031*:\nA technician is on the way.", sender.Messages[0].Message)
+	}
+}
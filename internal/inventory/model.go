@@ -0,0 +1,41 @@
+package inventory
+
+// Query is a parsed stock question such as "how many desks in stock at Main WH"
+type Query struct {
+	Product   string
+	Warehouse string
+}
+
+// Product is a product.product variant with its company-wide quantities
+type Product struct {
+	ID       int
+	Name     string
+	Code     string
+	Barcode  string
+	UoM      string
+	OnHand   float64
+	Forecast float64
+}
+
+// Warehouse is a stock.warehouse
+type Warehouse struct {
+	ID   int
+	Name string
+	Code string
+}
+
+// LocationStock is the quantity of a product held in one internal location
+type LocationStock struct {
+	Location  string
+	Warehouse string
+	Quantity  float64
+	Reserved  float64
+}
+
+// Availability is the stock picture of a product, optionally restricted to
+// a warehouse. OnHand and Forecast on Product are then per warehouse.
+type Availability struct {
+	Product   Product
+	Warehouse *Warehouse
+	Locations []LocationStock
+}
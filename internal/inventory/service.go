@@ -0,0 +1,344 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxChoices is the number of rows a WhatsApp list message can hold
+const maxChoices = 10
+
+var queryPattern = regexp.MustCompile(`(?i)^\s*(?:stock(?:\s+of)?|how\s+(?:many|much)|availability(?:\s+of)?)\s+(.+?)` +
+	`(?:\s+(?:do\s+we\s+have|are\s+there|is\s+there))?` +
+	`(?:\s+(?:in\s+stock|on\s+hand|available))?` +
+	`(?:\s+(?:at|in)\s+(.+?))?\s*\??\s*$`)
+
+// ParseQuery extracts the product and optional warehouse from a stock question
+func ParseQuery(text string) (Query, bool) {
+	m := queryPattern.FindStringSubmatch(text)
+	if m == nil {
+		return Query{}, false
+	}
+	return Query{
+		Product:   strings.TrimSpace(m[1]),
+		Warehouse: strings.TrimSpace(m[2]),
+	}, true
+}
+
+// Service answers stock availability questions from Odoo inventory
+type Service struct {
+	odoo   *odoo.Client
+	sender agent.Sender
+}
+
+func NewService(client *odoo.Client, sender agent.Sender) *Service {
+	return &Service{odoo: client, sender: sender}
+}
+
+func (s *Service) Name() string {
+	return "inventory"
+}
+
+func (s *Service) Help() string {
+	return `"how many <product> in stock at <warehouse>"`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	if msg.Type != "text" {
+		return false
+	}
+	_, ok := ParseQuery(msg.Body)
+	return ok
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// The user picked a product from a disambiguation list
+	if msg.ReplyID != "" {
+		var productID, warehouseID int
+		if _, err := fmt.Sscanf(msg.ReplyID, "inventory:product:%d:%d", &productID, &warehouseID); err != nil {
+			return fmt.Errorf("invalid reply id %q: %w", msg.ReplyID, err)
+		}
+
+		var warehouse *Warehouse
+		if warehouseID != 0 {
+			warehouses, err := s.warehouses(ctx, odoo.Domain{odoo.Cond("id", "=", warehouseID)})
+			if err != nil {
+				return err
+			}
+			if len(warehouses) > 0 {
+				warehouse = &warehouses[0]
+			}
+		}
+		return s.reply(ctx, msg.SenderID, productID, warehouse)
+	}
+
+	query, _ := ParseQuery(msg.Body)
+
+	var warehouse *Warehouse
+	if query.Warehouse != "" {
+		w, err := s.FindWarehouse(ctx, query.Warehouse)
+		if err != nil {
+			return err
+		}
+		if w == nil {
+			return s.send(ctx, msg.SenderID, fmt.Sprintf("I couldn't find a warehouse called \"%s\".", query.Warehouse))
+		}
+		warehouse = w
+	}
+
+	products, err := s.FindProducts(ctx, query.Product)
+	if err != nil {
+		return err
+	}
+
+	switch len(products) {
+	case 0:
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("No product matches \"%s\".", query.Product))
+	case 1:
+		return s.reply(ctx, msg.SenderID, products[0].ID, warehouse)
+	default:
+		return s.sendChoices(ctx, msg.SenderID, query.Product, products, warehouse)
+	}
+}
+
+// FindProducts looks up products by name, internal reference or barcode. An
+// exact reference or barcode match is returned on its own.
+func (s *Service) FindProducts(ctx context.Context, term string) ([]Product, error) {
+	domain := odoo.Domain{
+		"|", "|",
+		odoo.Cond("name", "ilike", term),
+		odoo.Cond("default_code", "=ilike", term),
+		odoo.Cond("barcode", "=", term),
+	}
+	records, err := s.odoo.SearchRead(ctx, "product.product", domain,
+		[]string{"display_name", "default_code", "barcode", "uom_id", "qty_available", "virtual_available"},
+		&odoo.SearchOptions{Limit: maxChoices, Order: "default_code, name"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	products := make([]Product, 0, len(records))
+	for _, r := range records {
+		p := productFromRecord(r)
+		if strings.EqualFold(p.Code, term) || p.Barcode == term {
+			return []Product{p}, nil
+		}
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+// FindWarehouse looks up a warehouse by short code or name
+func (s *Service) FindWarehouse(ctx context.Context, term string) (*Warehouse, error) {
+	warehouses, err := s.warehouses(ctx, odoo.Domain{
+		"|",
+		odoo.Cond("code", "=ilike", term),
+		odoo.Cond("name", "ilike", term),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(warehouses) == 0 {
+		return nil, nil
+	}
+	for i := range warehouses {
+		if strings.EqualFold(warehouses[i].Code, term) || strings.EqualFold(warehouses[i].Name, term) {
+			return &warehouses[i], nil
+		}
+	}
+	return &warehouses[0], nil
+}
+
+// GetAvailability reads the on-hand and forecast quantities of a product and
+// its breakdown per internal location
+func (s *Service) GetAvailability(ctx context.Context, productID int, warehouse *Warehouse) (*Availability, error) {
+	// Odoo computes qty_available and virtual_available for the warehouse
+	// passed in the context, under a key that depends on the version
+	var stockContext map[string]interface{}
+	if warehouse != nil {
+		stockContext = map[string]interface{}{"warehouse_id": warehouse.ID}
+	}
+	records, err := s.odoo.Read(ctx, "product.product", []int{productID},
+		[]string{"display_name", "default_code", "barcode", "uom_id", "qty_available", "virtual_available"},
+		stockContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read product: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("product %d not found", productID)
+	}
+
+	domain := odoo.Domain{
+		odoo.Cond("product_id", "=", productID),
+		odoo.Cond("location_id.usage", "=", "internal"),
+	}
+	if warehouse != nil {
+		domain = append(domain, odoo.Cond("location_id.warehouse_id", "=", warehouse.ID))
+	}
+	quants, err := s.odoo.SearchRead(ctx, "stock.quant", domain,
+		[]string{"location_id", "warehouse_id", "quantity", "reserved_quantity"},
+		&odoo.SearchOptions{Order: "location_id"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search quants: %w", err)
+	}
+
+	// A product can have several quants per location (lots, packages, owners)
+	byLocation := map[string]*LocationStock{}
+	var locations []*LocationStock
+	for _, q := range quants {
+		_, location := q.Many2one("location_id")
+		_, warehouseName := q.Many2one("warehouse_id")
+		ls, ok := byLocation[location]
+		if !ok {
+			ls = &LocationStock{Location: location, Warehouse: warehouseName}
+			byLocation[location] = ls
+			locations = append(locations, ls)
+		}
+		ls.Quantity += q.Float("quantity")
+		ls.Reserved += q.Float("reserved_quantity")
+	}
+
+	availability := &Availability{
+		Product:   productFromRecord(records[0]),
+		Warehouse: warehouse,
+	}
+	for _, ls := range locations {
+		if ls.Quantity != 0 || ls.Reserved != 0 {
+			availability.Locations = append(availability.Locations, *ls)
+		}
+	}
+	return availability, nil
+}
+
+// FormatAvailability renders an Availability as a WhatsApp message
+func FormatAvailability(a *Availability) string {
+	var b strings.Builder
+
+	b.WriteString("*")
+	if a.Product.Code != "" && !strings.HasPrefix(a.Product.Name, "[") {
+		fmt.Fprintf(&b, "[%s] ", a.Product.Code)
+	}
+	b.WriteString(a.Product.Name)
+	b.WriteString("*")
+	if a.Warehouse != nil {
+		fmt.Fprintf(&b, " at %s", a.Warehouse.Name)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "On hand: %s %s\n", whatsapp.FormatQuantity(a.Product.OnHand), a.Product.UoM)
+	fmt.Fprintf(&b, "Forecast: %s %s", whatsapp.FormatQuantity(a.Product.Forecast), a.Product.UoM)
+
+	if len(a.Locations) == 0 {
+		b.WriteString("\n\nNothing in stock in any internal location.")
+		return b.String()
+	}
+
+	// Group locations under their warehouse, keeping Odoo's location order
+	var warehouses []string
+	byWarehouse := map[string][]LocationStock{}
+	for _, ls := range a.Locations {
+		if _, ok := byWarehouse[ls.Warehouse]; !ok {
+			warehouses = append(warehouses, ls.Warehouse)
+		}
+		byWarehouse[ls.Warehouse] = append(byWarehouse[ls.Warehouse], ls)
+	}
+	sort.SliceStable(warehouses, func(i, j int) bool { return warehouses[i] < warehouses[j] })
+
+	for _, w := range warehouses {
+		name := w
+		if name == "" {
+			name = "No warehouse"
+		}
+		var total float64
+		for _, ls := range byWarehouse[w] {
+			total += ls.Quantity
+		}
+		fmt.Fprintf(&b, "\n\n📦 *%s*: %s", name, whatsapp.FormatQuantity(total))
+		for _, ls := range byWarehouse[w] {
+			fmt.Fprintf(&b, "\n• %s: %s", ls.Location, whatsapp.FormatQuantity(ls.Quantity))
+			if ls.Reserved > 0 {
+				fmt.Fprintf(&b, " (%s reserved)", whatsapp.FormatQuantity(ls.Reserved))
+			}
+		}
+	}
+	return b.String()
+}
+
+func (s *Service) reply(ctx context.Context, to string, productID int, warehouse *Warehouse) error {
+	availability, err := s.GetAvailability(ctx, productID, warehouse)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to, FormatAvailability(availability))
+}
+
+func (s *Service) sendChoices(ctx context.Context, to, term string, products []Product, warehouse *Warehouse) error {
+	warehouseID := 0
+	if warehouse != nil {
+		warehouseID = warehouse.ID
+	}
+
+	rows := make([]whatsapp.ListRow, 0, len(products))
+	for _, p := range products {
+		description := fmt.Sprintf("%s %s on hand", whatsapp.FormatQuantity(p.OnHand), p.UoM)
+		if p.Code != "" {
+			description = p.Code + " · " + description
+		}
+		rows = append(rows, whatsapp.ListRow{
+			ID:          fmt.Sprintf("inventory:product:%d:%d", p.ID, warehouseID),
+			Title:       p.Name,
+			Description: description,
+		})
+	}
+
+	body := fmt.Sprintf("%d products match \"%s\". Which one do you mean?", len(products), term)
+	if len(products) == maxChoices {
+		body = fmt.Sprintf("Several products match \"%s\"; here are the first %d. Which one do you mean?", term, maxChoices)
+	}
+
+	_, err := s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:     to,
+		Body:   body,
+		Button: "Choose product",
+		Sections: []whatsapp.ListSection{
+			{Title: "Products", Rows: rows},
+		},
+	})
+	return err
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+func (s *Service) warehouses(ctx context.Context, domain odoo.Domain) ([]Warehouse, error) {
+	records, err := s.odoo.SearchRead(ctx, "stock.warehouse", domain, []string{"name", "code"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search warehouses: %w", err)
+	}
+	warehouses := make([]Warehouse, 0, len(records))
+	for _, r := range records {
+		warehouses = append(warehouses, Warehouse{ID: r.ID(), Name: r.String("name"), Code: r.String("code")})
+	}
+	return warehouses, nil
+}
+
+func productFromRecord(r odoo.Record) Product {
+	_, uom := r.Many2one("uom_id")
+	return Product{
+		ID:       r.ID(),
+		Name:     r.String("display_name"),
+		Code:     r.String("default_code"),
+		Barcode:  r.String("barcode"),
+		UoM:      uom,
+		OnHand:   r.Float("qty_available"),
+		Forecast: r.Float("virtual_available"),
+	}
+}
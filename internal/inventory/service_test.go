@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender) {
+	recorder := odootest.NewRecorder(t, results)
+	sender := &agenttest.Sender{}
+	return NewService(recorder.Client(), sender), sender
+}
+
+func TestParseQuery(t *testing.T) {
+	a := assert.New(t)
+
+	tests := []struct {
+		text  string
+		query Query
+		ok    bool
+	}{
+		{"how many office chairs in stock at Main WH?", Query{Product: "office chairs", Warehouse: "Main WH"}, true},
+		{"How much FURN_001 do we have", Query{Product: "FURN_001"}, true},
+		{"stock of desk combination in WH2", Query{Product: "desk combination", Warehouse: "WH2"}, true},
+		{"stock 5901234123457", Query{Product: "5901234123457"}, true},
+		{"hello there", Query{}, false},
+	}
+
+	for _, tt := range tests {
+		query, ok := ParseQuery(tt.text)
+		a.Equal(tt.ok, ok, tt.text)
+		a.Equal(tt.query, query, tt.text)
+	}
+}
+
+func TestFormatAvailability(t *testing.T) {
+	a := assert.New(t)
+
+	text := FormatAvailability(&Availability{
+		Product: Product{Name: "Office Chair", Code: "FURN_7777", UoM: "Units", OnHand: 30, Forecast: 27.5},
+		Locations: []LocationStock{
+			{Location: "WH/Stock", Warehouse: "Main WH", Quantity: 26, Reserved: 2.5},
+			{Location: "WH2/Stock", Warehouse: "Backup WH", Quantity: 4},
+		},
+	})
+
+	a.Equal("*[FURN_7777] Office Chair*\n"+
+		"On hand: 30 Units\n"+
+		"Forecast: 27.5 Units\n\n"+
+		"📦 *Backup WH*: 4\n"+
+		"• WH2/Stock: 4\n\n"+
+		"📦 *Main WH*: 26\n"+
+		"• WH/Stock: 26 (2.5 reserved)", text)
+}
+
+func TestHandleSendsListForSeveralProducts(t *testing.T) {
+	a := assert.New(t)
+	service, sender := newTestService(t, map[string]interface{}{
+		"stock.warehouse.search_read": []map[string]interface{}{{"id": 1, "name": "Main WH", "code": "WH"}},
+		"product.product.search_read": []map[string]interface{}{
+			{"id": 10, "display_name": "Office Chair", "default_code": "FURN_7777", "uom_id": []interface{}{1, "Units"}, "qty_available": 30},
+			{"id": 11, "display_name": "Office Chair Black", "default_code": false, "uom_id": []interface{}{1, "Units"}, "qty_available": 0},
+		},
+	})
+
+	err := service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6591234567",
+		Type:     "text",
+		Body:     "how many office chair in stock at WH",
+	})
+
+	a.NoError(err)
+	if a.Len(sender.Lists, 1) {
+		rows := sender.Lists[0].Sections[0].Rows
+		a.Len(rows, 2)
+		a.Equal("inventory:product:10:1", rows[0].ID)
+		a.Equal("FURN_7777 · 30 Units on hand", rows[0].Description)
+	}
+}
+
+func TestHandleReplyReportsAvailability(t *testing.T) {
+	a := assert.New(t)
+	service, sender := newTestService(t, map[string]interface{}{
+		"product.product.read": []map[string]interface{}{
+			{"id": 10, "display_name": "Office Chair", "uom_id": []interface{}{1, "Units"}, "qty_available": 3, "virtual_available": 3},
+		},
+		"stock.quant.search_read": []map[string]interface{}{
+			{"location_id": []interface{}{8, "WH/Stock"}, "warehouse_id": []interface{}{1, "Main WH"}, "quantity": 1, "reserved_quantity": 0},
+			{"location_id": []interface{}{8, "WH/Stock"}, "warehouse_id": []interface{}{1, "Main WH"}, "quantity": 2, "reserved_quantity": 1},
+		},
+	})
+
+	err := service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6591234567",
+		Type:     "interactive",
+		ReplyID:  "inventory:product:10:0",
+	})
+
+	a.NoError(err)
+	a.Contains(sender.LastText(), "• WH/Stock: 3 (1 reserved)")
+}
@@ -0,0 +1,43 @@
+package leave
+
+import (
+	"time"
+)
+
+// Balance is how much of a leave type an employee can still take
+type Balance struct {
+	TypeID int
+	Name   string
+	// Allocated is false for leave types that don't need an allocation,
+	// which can be taken without a balance
+	Allocated bool
+	Days      float64
+	Taken     float64
+}
+
+// Remaining returns the allocated days that haven't been taken
+func (b Balance) Remaining() float64 {
+	return b.Days - b.Taken
+}
+
+// request is a leave request the employee is putting together
+type request struct {
+	EmployeeID   int
+	EmployeeName string
+	// ManagerID is the res.users id of the employee's time off approver
+	ManagerID int
+	Location  *time.Location
+	Balances  []Balance
+	TypeID    int
+	TypeName  string
+}
+
+// stateLabels describes hr.leave states in messages
+var stateLabels = map[string]string{
+	"draft":     "withdrawn",
+	"confirm":   "waiting for approval",
+	"refuse":    "refused",
+	"validate1": "waiting for a second approval",
+	"validate":  "approved",
+	"cancel":    "cancelled",
+}
@@ -0,0 +1,110 @@
+package leave
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	// Requests start with a verb, e.g. "can I take a day off?", or are
+	// the keyword alone, e.g. "leave balance", so that messages merely
+	// mentioning leave aren't taken for requests
+	requestPattern = regexp.MustCompile(`(?i)^\s*(?:(?:can|could|may)\s+i\s+)?` +
+		`(?:request|take|book|apply\s+for|i(?:'d|\s+would)\s+like(?:\s+to\s+(?:take|request|book))?|i\s+(?:want|need)(?:\s+to\s+(?:take|request|book))?)\s+` +
+		`(?:an?\s+|some\s+)?(?:leave|time\s+off|days?\s+off|vacation|holiday)s?\b`)
+	keywordPattern = regexp.MustCompile(`(?i)^\s*(?:my\s+)?(?:leave|time\s+off|days?\s+off|vacation|holiday)s?(?:\s+(?:balances?|requests?))?\s*[?.!]*\s*$`)
+	rangePattern   = regexp.MustCompile(`(?i)\s+(?:to|until|till)\s+|\s*[-–]\s+|\s+[-–]\s*`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// dayLayouts are the accepted ways of writing a date without a year
+var dayLayouts = []string{"2 Jan", "2 January", "Jan 2", "January 2"}
+
+// IsRequest reports whether a message asks for time off
+func IsRequest(text string) bool {
+	return requestPattern.MatchString(text) || keywordPattern.MatchString(text)
+}
+
+// ParseDates reads the first and last day of a leave, e.g. "tomorrow",
+// "fri", "24 Mar to 28 Mar" or "2025-03-24 - 2025-03-28"
+func ParseDates(text string, today time.Time) (time.Time, time.Time, error) {
+	text = strings.TrimSpace(text)
+	parts := rangePattern.Split(text, 2)
+
+	from, err := parseDate(parts[0], today)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if len(parts) == 1 {
+		return from, from, nil
+	}
+
+	to, err := parseDate(parts[1], from)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("The last day %s is before the first day %s.", to.Format("2 Jan"), from.Format("2 Jan"))
+	}
+	return from, to, nil
+}
+
+// parseDate resolves today, tomorrow, a weekday (the next one, today
+// included), a day and month (the next one) or an ISO date. Dates are
+// relative to after.
+func parseDate(s string, after time.Time) (time.Time, error) {
+	s = strings.Trim(strings.TrimSpace(s), ".,")
+	lower := strings.ToLower(s)
+	switch {
+	case lower == "today":
+		return after, nil
+	case lower == "tomorrow":
+		return after.AddDate(0, 0, 1), nil
+	case len(lower) >= 3 && !strings.ContainsAny(lower, "0123456789"):
+		if day, ok := weekdays[lower[:3]]; ok {
+			offset := (int(day) - int(after.Weekday()) + 7) % 7
+			return after.AddDate(0, 0, offset), nil
+		}
+	}
+
+	if date, err := time.ParseInLocation(dateLayout, s, after.Location()); err == nil {
+		return date, nil
+	}
+	for _, layout := range dayLayouts {
+		if date, err := time.ParseInLocation(layout+" 2006", s, after.Location()); err == nil {
+			return date, nil
+		}
+		if date, err := time.ParseInLocation(layout, s, after.Location()); err == nil {
+			date = time.Date(after.Year(), date.Month(), date.Day(), 0, 0, 0, 0, after.Location())
+			if date.Before(after) {
+				date = date.AddDate(1, 0, 0)
+			}
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("I couldn't read the date %q.", s)
+}
+
+// formatDays prints a number of leave days, e.g. "1 day" or "2.5 days"
+func formatDays(days float64) string {
+	if days == 1 {
+		return "1 day"
+	}
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", days), "0"), ".") + " days"
+}
+
+// formatPeriod prints the days of a leave, e.g. "Mon 24 Mar to Fri 28 Mar"
+func formatPeriod(from, to time.Time) string {
+	if from.Equal(to) {
+		return from.Format("Mon 2 Jan")
+	}
+	return from.Format("Mon 2 Jan") + " to " + to.Format("Mon 2 Jan")
+}
@@ -0,0 +1,62 @@
+package leave
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDates(t *testing.T) {
+	a := assert.New(t)
+	// Wednesday
+	today := time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		text     string
+		from, to string
+	}{
+		{"tomorrow", "2025-03-13", "2025-03-13"},
+		{"Friday", "2025-03-14", "2025-03-14"},
+		{"wed", "2025-03-12", "2025-03-12"},
+		{"fri to mon", "2025-03-14", "2025-03-17"},
+		{"24 Mar to 28 Mar", "2025-03-24", "2025-03-28"},
+		{"March 24 - March 25", "2025-03-24", "2025-03-25"},
+		{"2 Jan", "2026-01-02", "2026-01-02"},
+		{"30 Dec - 2 Jan", "2025-12-30", "2026-01-02"},
+		{"2025-04-01 - 2025-04-03", "2025-04-01", "2025-04-03"},
+		{"1 Apr 2025 until 3 Apr 2025", "2025-04-01", "2025-04-03"},
+	}
+	for _, tt := range tests {
+		from, to, err := ParseDates(tt.text, today)
+		if a.NoError(err, tt.text) {
+			a.Equal(tt.from, from.Format(dateLayout), tt.text)
+			a.Equal(tt.to, to.Format(dateLayout), tt.text)
+		}
+	}
+
+	_, _, err := ParseDates("28 Mar to 24 Mar 2025", today)
+	a.EqualError(err, "The last day 24 Mar is before the first day 28 Mar.")
+	_, _, err = ParseDates("soon", today)
+	a.EqualError(err, `I couldn't read the date "soon".`)
+}
+
+func TestIsRequest(t *testing.T) {
+	a := assert.New(t)
+	a.True(IsRequest("Can I take a day off?"))
+	a.True(IsRequest("leave balance"))
+	a.True(IsRequest("request vacation next week"))
+	a.True(IsRequest("I'd like some time off"))
+	a.True(IsRequest("time off"))
+	a.False(IsRequest("what's the stock of desks"))
+	a.False(IsRequest("please leave the parcel at reception"))
+	a.False(IsRequest("is the office closed for the holiday?"))
+}
+
+func TestFormatDays(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("1 day", formatDays(1))
+	a.Equal("0.5 days", formatDays(0.5))
+	a.Equal("15.5 days", formatDays(15.5))
+	a.Equal("20 days", formatDays(20))
+}
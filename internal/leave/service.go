@@ -0,0 +1,472 @@
+package leave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/failure"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxChoices is the number of rows a WhatsApp list message can hold
+const maxChoices = 10
+
+var leaveFields = []string{"state", "employee_id", "holiday_status_id", "request_date_from", "request_date_to", "number_of_days"}
+
+// Service lets employees request time off (hr.leave) from WhatsApp and their
+// managers approve or refuse it
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	sessions *agent.Sessions
+	// now is replaced in tests
+	now func() time.Time
+
+	mu sync.Mutex
+	// requesters holds the number each leave was requested from, to tell
+	// the employee how it was decided
+	requesters map[int]string
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, sessions *agent.Sessions) *Service {
+	return &Service{odoo: client, sender: sender, sessions: sessions, now: time.Now, requesters: map[int]string{}}
+}
+
+func (s *Service) Name() string {
+	return "leave"
+}
+
+func (s *Service) Help() string {
+	return `"time off" to see your leave balances and request leave`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && IsRequest(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	if msg.ReplyID != "" {
+		action, id, err := parseReplyID(msg.ReplyID)
+		if err != nil {
+			return err
+		}
+		if action == "type" {
+			return s.chooseType(ctx, msg.SenderID, id)
+		}
+		return s.decide(ctx, msg.SenderID, action, id)
+	}
+
+	if session := s.sessions.Get(msg.SenderID); session != nil && session.Capability == s.Name() && session.Capture {
+		return s.request(ctx, msg.SenderID, session.Data.(*request), msg.Body)
+	}
+	return s.start(ctx, msg.SenderID)
+}
+
+// start shows the employee's balances and asks which leave type to take
+func (s *Service) start(ctx context.Context, to string) error {
+	// The employee and balances fall back on their last known values so that
+	// leaves are queued while Odoo is down
+	lookups := odoo.LastKnown(ctx)
+	employee, err := s.odoo.EmployeeByPhone(lookups, to, []string{"name", "tz", "leave_manager_id"})
+	if err != nil {
+		return err
+	}
+	if employee == nil {
+		return s.send(ctx, to, "Your number isn't linked to an employee in Odoo, so I can't request time off for you.")
+	}
+
+	location, err := time.LoadLocation(employee.String("tz"))
+	if err != nil || employee.String("tz") == "" {
+		location = time.UTC
+	}
+	balances, err := s.Balances(lookups, employee.ID(), today(s.now(), location))
+	if err != nil {
+		return err
+	}
+	if len(balances) == 0 {
+		return s.send(ctx, to, "You don't have any time off allocated in Odoo.")
+	}
+
+	managerID, _ := employee.Many2one("leave_manager_id")
+	r := &request{
+		EmployeeID:   employee.ID(),
+		EmployeeName: employee.String("name"),
+		ManagerID:    managerID,
+		Location:     location,
+		Balances:     balances,
+	}
+	s.sessions.Hold(to, s.Name(), r)
+
+	rows := make([]whatsapp.ListRow, 0, len(balances))
+	for i, b := range balances {
+		if i == maxChoices {
+			break
+		}
+		description := "No allocation needed"
+		if b.Allocated {
+			description = formatDays(b.Remaining()) + " left"
+		}
+		rows = append(rows, whatsapp.ListRow{ID: fmt.Sprintf("leave:type:%d", b.TypeID), Title: b.Name, Description: description})
+	}
+	_, err = s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     FormatBalances(balances) + "\n\nWhich time off would you like to take?",
+		Button:   "Choose type",
+		Sections: []whatsapp.ListSection{{Rows: rows}},
+	})
+	return err
+}
+
+// chooseType records the leave type and asks for the dates
+func (s *Service) chooseType(ctx context.Context, to string, typeID int) error {
+	session := s.sessions.Get(to)
+	if session == nil || session.Capability != s.Name() {
+		return s.send(ctx, to, `That choice has expired, please send "time off" again.`)
+	}
+	r := session.Data.(*request)
+
+	for _, b := range r.Balances {
+		if b.TypeID != typeID {
+			continue
+		}
+		if b.Allocated && b.Remaining() <= 0 {
+			s.sessions.End(to)
+			return s.send(ctx, to, fmt.Sprintf("You don't have any %s left.", b.Name))
+		}
+		r.TypeID, r.TypeName = b.TypeID, b.Name
+		s.sessions.Start(to, s.Name(), r)
+		return s.send(ctx, to, fmt.Sprintf("When would you like to take *%s*? Reply with a day or a range, e.g. *tomorrow* or *24 Mar to 28 Mar*, or *cancel*.", b.Name))
+	}
+	return fmt.Errorf("leave type %d was not offered", typeID)
+}
+
+// request creates the leave for the dates the employee sent and asks their
+// manager to approve it
+func (s *Service) request(ctx context.Context, to string, r *request, text string) error {
+	if strings.EqualFold(strings.TrimSpace(text), "cancel") {
+		s.sessions.End(to)
+		return s.send(ctx, to, "OK, I didn't request any time off.")
+	}
+
+	from, until, err := ParseDates(text, today(s.now(), r.Location))
+	if err != nil {
+		return s.send(ctx, to, err.Error()+" Please reply with a day or a range, e.g. *24 Mar to 28 Mar*, or *cancel*.")
+	}
+
+	// The leave is requested once Odoo is back if it can't be reached now,
+	// its manager is then told by Odoo alone
+	summary := fmt.Sprintf("your %s for %s", r.TypeName, formatPeriod(from, until))
+	leaveID, err := s.odoo.Create(odoo.Queueable(ctx, to, summary), "hr.leave", map[string]interface{}{
+		"employee_id":       r.EmployeeID,
+		"holiday_status_id": r.TypeID,
+		"request_date_from": from.Format(dateLayout),
+		"request_date_to":   until.Format(dateLayout),
+	})
+	if errors.Is(err, odoo.ErrQueued) {
+		s.sessions.End(to)
+		return s.send(ctx, to, fmt.Sprintf("⏳ Odoo is unreachable right now. I'll request %s as soon as it's back and let you know.", summary))
+	}
+	if message, ok := failure.Refusal(err); ok {
+		// Overlapping leaves and insufficient balances are refused by Odoo,
+		// so the employee can try other dates
+		return s.send(ctx, to, fmt.Sprintf("Odoo refused that request: %s\nPlease reply with other dates, or *cancel*.", message))
+	}
+	if err != nil {
+		s.sessions.End(to)
+		return fmt.Errorf("failed to create leave: %w", err)
+	}
+	s.sessions.End(to)
+
+	leave, err := s.leave(ctx, leaveID)
+	if err != nil {
+		return err
+	}
+	if leave == nil {
+		return fmt.Errorf("leave %d disappeared after it was created", leaveID)
+	}
+	days := formatDays(leave.Float("number_of_days"))
+
+	if leave.String("state") == "validate" {
+		return s.send(ctx, to, fmt.Sprintf("✅ Your %s for %s (%s) is approved.", r.TypeName, formatPeriod(from, until), days))
+	}
+
+	s.mu.Lock()
+	s.requesters[leaveID] = to
+	s.mu.Unlock()
+
+	manager, err := s.notifyManager(ctx, r, leaveID, from, until, days)
+	if err != nil {
+		log.Printf("Failed to ask for approval of leave %d: %v", leaveID, err)
+	}
+	text = fmt.Sprintf("📝 Requested %s for %s (%s).", r.TypeName, formatPeriod(from, until), days)
+	if manager != "" {
+		text += fmt.Sprintf(" I'll let you know when %s answers.", manager)
+	} else {
+		text += " It's waiting for approval in Odoo."
+	}
+	return s.send(ctx, to, text)
+}
+
+// notifyManager sends the request with Approve/Refuse buttons to the
+// employee's time off approver and returns their name, or "" when they
+// can't be reached on WhatsApp
+func (s *Service) notifyManager(ctx context.Context, r *request, leaveID int, from, until time.Time, days string) (string, error) {
+	if r.ManagerID == 0 {
+		return "", nil
+	}
+	users, err := s.odoo.Read(ctx, "res.users", []int{r.ManagerID}, []string{"name", "phone", "mobile"}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read time off approver: %w", err)
+	}
+	if len(users) == 0 {
+		return "", nil
+	}
+	phone := users[0].String("mobile")
+	if phone == "" {
+		phone = users[0].String("phone")
+	}
+	if phone == "" {
+		return "", nil
+	}
+
+	_, err = s.sender.SendButtons(ctx, whatsapp.ButtonMessage{
+		To:     phone,
+		Header: "Time off request",
+		Body:   fmt.Sprintf("*%s* requests %s for %s (%s).", r.EmployeeName, r.TypeName, formatPeriod(from, until), days),
+		Buttons: []whatsapp.Button{
+			{ID: fmt.Sprintf("leave:approve:%d", leaveID), Title: "Approve"},
+			{ID: fmt.Sprintf("leave:refuse:%d", leaveID), Title: "Refuse"},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return users[0].String("name"), nil
+}
+
+// decide approves or refuses a leave for its employee's time off approver
+// and tells the employee
+func (s *Service) decide(ctx context.Context, to, action string, leaveID int) error {
+	leave, err := s.leave(ctx, leaveID)
+	if err != nil {
+		return err
+	}
+	if leave == nil {
+		return s.send(ctx, to, "This time off request no longer exists.")
+	}
+
+	employeeID, employeeName := leave.Many2one("employee_id")
+	employees, err := s.odoo.Read(ctx, "hr.employee", []int{employeeID}, []string{"leave_manager_id", "mobile_phone"}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read employee: %w", err)
+	}
+	if len(employees) == 0 {
+		return s.send(ctx, to, "This time off request no longer exists.")
+	}
+	managerID, managerName := employees[0].Many2one("leave_manager_id")
+
+	userIDs, err := s.userIDs(ctx, to)
+	if err != nil {
+		return err
+	}
+	if managerID == 0 || !contains(userIDs, managerID) {
+		return s.send(ctx, to, fmt.Sprintf("Sorry, only %s's time off approver can decide on this request.", employeeName))
+	}
+	// Without their API key the leave would be decided by the service
+	// account, bypassing the approver's own rights
+	if user := odoo.UserFrom(ctx); user == nil || user.APIKey == "" || user.ID != managerID {
+		return s.send(ctx, to, "To decide on time off from WhatsApp, link this number to your Odoo user with an API key first. You can still decide on the request in Odoo.")
+	}
+
+	state := leave.String("state")
+	if state != "confirm" && state != "validate1" {
+		return s.send(ctx, to, fmt.Sprintf("This request was already %s.", stateLabels[state]))
+	}
+
+	method := "action_refuse"
+	if action == "approve" {
+		method = "action_approve"
+		if state == "validate1" {
+			method = "action_validate"
+		}
+	}
+	if err := s.odoo.ExecuteKW(ctx, "hr.leave", method, []interface{}{[]int{leaveID}}, nil, nil); err != nil {
+		if message, ok := failure.Refusal(err); ok {
+			return s.send(ctx, to, fmt.Sprintf("Odoo refused that: %s", message))
+		}
+		return fmt.Errorf("failed to %s leave: %w", action, err)
+	}
+
+	leave, err = s.leave(ctx, leaveID)
+	if err != nil {
+		return err
+	}
+	if leave == nil {
+		return s.send(ctx, to, "This time off request no longer exists.")
+	}
+	state = leave.String("state")
+
+	note := fmt.Sprintf("%s via WhatsApp by %s", strings.ToUpper(stateLabels[state][:1])+stateLabels[state][1:], managerName)
+	if _, err := s.odoo.MessagePost(ctx, "hr.leave", leaveID, note, true); err != nil {
+		log.Printf("Failed to log decision on leave %d: %v", leaveID, err)
+	}
+
+	if err := s.send(ctx, to, fmt.Sprintf("Done, %s's time off is %s.", employeeName, stateLabels[state])); err != nil {
+		return err
+	}
+	if state == "validate1" {
+		// The employee hears back once the second approval is given
+		return nil
+	}
+
+	s.mu.Lock()
+	requester := s.requesters[leaveID]
+	delete(s.requesters, leaveID)
+	s.mu.Unlock()
+	if requester == "" {
+		requester = employees[0].String("mobile_phone")
+	}
+	if requester == "" {
+		return nil
+	}
+	return s.send(ctx, requester, FormatDecision(leave, managerName))
+}
+
+// FormatDecision tells an employee how their leave was decided
+func FormatDecision(leave odoo.Record, by string) string {
+	_, typeName := leave.Many2one("holiday_status_id")
+	from, _ := time.Parse(dateLayout, leave.String("request_date_from"))
+	until, _ := time.Parse(dateLayout, leave.String("request_date_to"))
+
+	icon := "✅"
+	if leave.String("state") == "refuse" {
+		icon = "❌"
+	}
+	return fmt.Sprintf("%s Your %s for %s (%s) was %s by %s.", icon, typeName, formatPeriod(from, until),
+		formatDays(leave.Float("number_of_days")), stateLabels[leave.String("state")], by)
+}
+
+// Balances returns the leave types an employee can take on day: those
+// with a valid allocation, with what is left of it, and those that don't
+// need one
+func (s *Service) Balances(ctx context.Context, employeeID int, day time.Time) ([]Balance, error) {
+	allocations, err := s.odoo.SearchRead(ctx, "hr.leave.allocation", odoo.Domain{
+		odoo.Cond("employee_id", "=", employeeID),
+		odoo.Cond("state", "=", "validate"),
+		odoo.Cond("date_from", "<=", day.Format(dateLayout)),
+		"|", odoo.Cond("date_to", "=", false), odoo.Cond("date_to", ">=", day.Format(dateLayout)),
+	}, []string{"holiday_status_id", "number_of_days", "leaves_taken"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search leave allocations: %w", err)
+	}
+
+	var balances []Balance
+	byType := map[int]int{}
+	for _, a := range allocations {
+		typeID, name := a.Many2one("holiday_status_id")
+		i, ok := byType[typeID]
+		if !ok {
+			i = len(balances)
+			byType[typeID] = i
+			balances = append(balances, Balance{TypeID: typeID, Name: name, Allocated: true})
+		}
+		balances[i].Days += a.Float("number_of_days")
+		balances[i].Taken += a.Float("leaves_taken")
+	}
+	sort.SliceStable(balances, func(i, j int) bool { return balances[i].Name < balances[j].Name })
+
+	types, err := s.odoo.SearchRead(ctx, "hr.leave.type", odoo.Domain{
+		odoo.Cond("requires_allocation", "=", "no"),
+	}, []string{"name"}, &odoo.SearchOptions{Order: "sequence, name"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search leave types: %w", err)
+	}
+	for _, t := range types {
+		if _, ok := byType[t.ID()]; !ok {
+			balances = append(balances, Balance{TypeID: t.ID(), Name: t.String("name")})
+		}
+	}
+	return balances, nil
+}
+
+// FormatBalances renders an employee's leave balances
+func FormatBalances(balances []Balance) string {
+	var b strings.Builder
+	b.WriteString("*Your time off*")
+	for _, balance := range balances {
+		if balance.Allocated {
+			fmt.Fprintf(&b, "\n• %s: %s left of %s", balance.Name, formatDays(balance.Remaining()), formatDays(balance.Days))
+		}
+	}
+	return b.String()
+}
+
+// leave reads a leave, or returns nil when it doesn't exist
+func (s *Service) leave(ctx context.Context, id int) (odoo.Record, error) {
+	leaves, err := s.odoo.Read(ctx, "hr.leave", []int{id}, leaveFields, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leave: %w", err)
+	}
+	if len(leaves) == 0 {
+		return nil, nil
+	}
+	return leaves[0], nil
+}
+
+// userIDs returns the Odoo users messaging from waID. A number bound to an
+// Odoo user is that user, otherwise users are matched by phone.
+func (s *Service) userIDs(ctx context.Context, waID string) ([]int, error) {
+	if user := odoo.UserFrom(ctx); user != nil {
+		return []int{user.ID}, nil
+	}
+	users, err := s.odoo.SearchRead(ctx, "res.users", odoo.PhoneDomain(waID), []string{"id"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = u.ID()
+	}
+	return ids, nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+// today returns the date of now at midnight in location
+func today(now time.Time, location *time.Location) time.Time {
+	now = now.In(location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+}
+
+// parseReplyID splits "leave:approve:12" into its action and id
+func parseReplyID(replyID string) (string, int, error) {
+	parts := strings.Split(replyID, ":")
+	if len(parts) != 3 || (parts[1] != "type" && parts[1] != "approve" && parts[1] != "refuse") {
+		return "", 0, fmt.Errorf("invalid reply id %q", replyID)
+	}
+	var id int
+	if _, err := fmt.Sscanf(parts[2], "%d", &id); err != nil {
+		return "", 0, fmt.Errorf("invalid reply id %q: %w", replyID, err)
+	}
+	return parts[1], id, nil
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
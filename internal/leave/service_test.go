@@ -0,0 +1,182 @@
+package leave
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/outbox"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	employeePhone = "6598765432"
+	managerPhone  = "6591112222"
+)
+
+// newTestService runs the service against a fake Odoo with an employee,
+// their manager and two leave types, one of them allocated
+func newTestService(t *testing.T) (*Service, *agenttest.Sender, *odootest.Server) {
+	server := odootest.NewServer(t)
+	server.Relate("hr.employee", "leave_manager_id", odootest.Relation{Model: "res.users"})
+	server.Relate("hr.leave", "holiday_status_id", odootest.Relation{Model: "hr.leave.type"})
+	server.Relate("hr.leave.allocation", "holiday_status_id", odootest.Relation{Model: "hr.leave.type"})
+
+	managerID := server.AddUser(odoo.Record{"name": "Bob", "login": "bob", "mobile": "+" + managerPhone}, "bob-key")
+	server.Seed("hr.employee", odoo.Record{"id": 4, "name": "Ana", "tz": "Asia/Singapore", "mobile_phone": "+" + employeePhone, "leave_manager_id": managerID})
+	server.Seed("hr.leave.type",
+		odoo.Record{"id": 1, "name": "Paid Time Off", "requires_allocation": "yes", "sequence": 1},
+		odoo.Record{"id": 2, "name": "Unpaid", "requires_allocation": "no", "sequence": 2},
+	)
+	server.Seed("hr.leave.allocation",
+		odoo.Record{"employee_id": 4, "holiday_status_id": 1, "state": "validate", "date_from": "2025-01-01", "date_to": false, "number_of_days": 20, "leaves_taken": 4.5},
+		odoo.Record{"employee_id": 4, "holiday_status_id": 1, "state": "validate", "date_from": "2024-01-01", "date_to": "2024-12-31", "number_of_days": 5, "leaves_taken": 0},
+	)
+
+	// Odoo computes the duration and asks for approval
+	server.Handle("hr.leave", "create", func(s *odootest.Server, call *odootest.Call) (interface{}, error) {
+		values := odoo.Record(call.Args[0].(map[string]interface{}))
+		from, _ := time.Parse(dateLayout, values.String("request_date_from"))
+		to, _ := time.Parse(dateLayout, values.String("request_date_to"))
+		values["state"] = "confirm"
+		values["number_of_days"] = to.Sub(from).Hours()/24 + 1
+		return s.Seed("hr.leave", values)[0], nil
+	})
+	server.Handle("hr.leave", "action_approve", func(s *odootest.Server, call *odootest.Call) (interface{}, error) {
+		return true, s.Update("hr.leave", 1, odoo.Record{"state": "validate"})
+	})
+
+	sender := &agenttest.Sender{}
+	service := NewService(server.Client(), sender, agent.NewSessions(time.Minute))
+	// Wednesday 12 March 2025, 01:00 in Singapore
+	service.now = func() time.Time { return time.Date(2025, 3, 11, 17, 0, 0, 0, time.UTC) }
+	return service, sender, server
+}
+
+func TestRequestAndApprove(t *testing.T) {
+	a := assert.New(t)
+	service, sender, server := newTestService(t)
+	ctx := context.Background()
+
+	a.True(service.Match(whatsapp.WebhookMessage{Type: "text", Body: "I'd like some time off"}))
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "time off"}))
+	if a.Len(sender.Lists, 1) {
+		list := sender.Lists[0]
+		a.Contains(list.Body, "Paid Time Off: 15.5 days left of 20 days")
+		rows := list.Sections[0].Rows
+		if a.Len(rows, 2) {
+			a.Equal(whatsapp.ListRow{ID: "leave:type:1", Title: "Paid Time Off", Description: "15.5 days left"}, rows[0])
+			a.Equal("No allocation needed", rows[1].Description)
+		}
+	}
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "interactive", ReplyID: "leave:type:1", Body: "Paid Time Off"}))
+	a.Contains(sender.LastText(), "When would you like to take *Paid Time Off*?")
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "whenever"}))
+	a.Contains(sender.LastText(), `I couldn't read the date "whenever".`)
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "24 Mar to 26 Mar"}))
+	leave := server.Record("hr.leave", 1)
+	if a.NotNil(leave) {
+		a.Equal("2025-03-24", leave["request_date_from"])
+		a.Equal("2025-03-26", leave["request_date_to"])
+		a.Equal(4, leave["employee_id"])
+	}
+	a.Equal("📝 Requested Paid Time Off for Mon 24 Mar to Wed 26 Mar (3 days). I'll let you know when Bob answers.", sender.LastText())
+	a.Nil(service.sessions.Get(employeePhone))
+	if a.Len(sender.Buttons, 1) {
+		a.Equal("+"+managerPhone, sender.Buttons[0].To)
+		a.Equal("*Ana* requests Paid Time Off for Mon 24 Mar to Wed 26 Mar (3 days).", sender.Buttons[0].Body)
+		a.Equal("leave:approve:1", sender.Buttons[0].Buttons[0].ID)
+	}
+
+	// Only the employee's approver may decide
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "interactive", ReplyID: "leave:approve:1"}))
+	a.Equal("Sorry, only Ana's time off approver can decide on this request.", sender.LastText())
+	a.Equal("confirm", server.Record("hr.leave", 1)["state"])
+
+	// The approver decides with their own rights
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: managerPhone, Type: "interactive", ReplyID: "leave:approve:1"}))
+	a.Equal("To decide on time off from WhatsApp, link this number to your Odoo user with an API key first. You can still decide on the request in Odoo.", sender.LastText())
+	a.Equal("confirm", server.Record("hr.leave", 1)["state"])
+
+	bob := server.Records("res.users", odoo.Domain{odoo.Cond("login", "=", "bob")})[0].ID()
+	managerCtx := odoo.WithUser(ctx, &odoo.User{ID: bob, Login: "bob", APIKey: "bob-key"})
+	a.NoError(service.Handle(managerCtx, whatsapp.WebhookMessage{SenderID: managerPhone, Type: "interactive", ReplyID: "leave:approve:1"}))
+	a.Equal("validate", server.Record("hr.leave", 1)["state"])
+	for _, c := range server.Calls() {
+		if c.Method == "action_approve" {
+			a.Equal(bob, c.UID)
+		}
+	}
+	n := len(sender.Messages)
+	if a.GreaterOrEqual(n, 2) {
+		a.Equal(managerPhone, sender.Messages[n-2].To)
+		a.Equal("Done, Ana's time off is approved.", sender.Messages[n-2].Message)
+		a.Equal(employeePhone, sender.Messages[n-1].To)
+		a.Equal("✅ Your Paid Time Off for Mon 24 Mar to Wed 26 Mar (3 days) was approved by Bob.", sender.Messages[n-1].Message)
+	}
+	a.Len(server.Records("mail.message", odoo.Domain{odoo.Cond("model", "=", "hr.leave")}), 1)
+
+	a.NoError(service.Handle(managerCtx, whatsapp.WebhookMessage{SenderID: managerPhone, Type: "interactive", ReplyID: "leave:refuse:1"}))
+	a.Equal("This request was already approved.", sender.LastText())
+}
+
+func TestRequestRefusedByOdoo(t *testing.T) {
+	a := assert.New(t)
+	service, sender, server := newTestService(t)
+	server.Inject(odootest.Injection{Model: "hr.leave", Method: "create", Times: 1,
+		Fault: odootest.ValidationError("You can not set two time off that overlap on the same day.")})
+	ctx := context.Background()
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "day off"}))
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "interactive", ReplyID: "leave:type:2"}))
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "fri"}))
+	a.Contains(sender.LastText(), "Odoo refused that request: You can not set two time off that overlap on the same day.")
+
+	// The employee can try other dates
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "cancel"}))
+	a.Equal("OK, I didn't request any time off.", sender.LastText())
+	a.Empty(server.Records("hr.leave", nil))
+}
+
+func TestRequestQueuedWhileOdooIsDown(t *testing.T) {
+	a := assert.New(t)
+	service, sender, server := newTestService(t)
+	store := outbox.NewMemoryStore()
+	writes := outbox.New(service.odoo, store, sender, nil)
+	service.odoo.Queue = writes
+	ctx := context.Background()
+
+	// The employee's balances were seen before Odoo went down
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "day off"}))
+	server.Inject(odootest.Injection{Status: http.StatusBadGateway})
+	calls := len(server.Calls())
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "day off"}))
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "interactive", ReplyID: "leave:type:2"}))
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: employeePhone, Type: "text", Body: "fri"}))
+	a.Equal("⏳ Odoo is unreachable right now. I'll request your Unpaid for Fri 14 Mar as soon as it's back and let you know.", sender.LastText())
+	a.Equal(calls, len(server.Calls()), "no call reached Odoo")
+	a.Empty(server.Records("hr.leave", nil))
+
+	server.ClearInjections()
+	a.NoError(writes.Replay(ctx))
+	a.Len(server.Records("hr.leave", nil), 1)
+	a.Equal("✅ Odoo is back and your Unpaid for Fri 14 Mar is saved.", sender.LastText())
+}
+
+func TestUnknownEmployee(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t)
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{SenderID: "6500000000", Type: "text", Body: "time off"}))
+	a.Equal("Your number isn't linked to an employee in Odoo, so I can't request time off for you.", sender.LastText())
+}
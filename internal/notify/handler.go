@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Handler receives record events from Odoo automated actions
+type Handler struct {
+	services          map[string]*Service
+	defaultConnection string
+	token             string
+}
+
+// NewHandler creates a handler for the notification services of each
+// connection. Events go to the connection named by the connection query
+// parameter, or else to defaultConnection. Requests must carry the
+// ODOO_WEBHOOK_TOKEN, either as a bearer token or as the token query
+// parameter, since Odoo's webhook action can't set headers. Access logs must
+// write request URIs with LoggedURI so that the token stays out of them.
+func NewHandler(services map[string]*Service, defaultConnection string) *Handler {
+	return &Handler{
+		services:          services,
+		defaultConnection: defaultConnection,
+		token:             os.Getenv("ODOO_WEBHOOK_TOKEN"),
+	}
+}
+
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	group := e.Group("/odoo")
+	group.POST("/events", h.ReceiveEvent)
+}
+
+// Response reports how an event was handled
+type Response struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Sent    int    `json:"sent"`
+}
+
+// ReceiveEvent handles record events sent by Odoo
+// @Summary      Receive an Odoo record event
+// @Description  Sends the WhatsApp notifications configured for a record change in Odoo
+// @Param        event       body      Event   true   "Record event"
+// @Param        connection  query     string  false  "Odoo connection the event comes from"
+// @Tags         odoo
+// @Success      200    {object}  Response
+// @Failure      400    {object}  Response
+// @Failure      401    {object}  Response
+// @Failure      404    {object}  Response
+// @Failure      500    {object}  Response
+// @Router       /odoo/events [post]
+func (h *Handler) ReceiveEvent(c echo.Context) error {
+	if !h.authorized(c.Request()) {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Success: false,
+			Message: "Invalid or missing token",
+		})
+	}
+
+	var event Event
+	if err := c.Bind(&event); err != nil || event.Model == "" || event.ID == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "Both 'model' and 'id' fields are required",
+		})
+	}
+
+	name := c.QueryParam("connection")
+	if name == "" {
+		name = h.defaultConnection
+	}
+	service, ok := h.services[name]
+	if !ok {
+		return c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Message: "Unknown connection",
+		})
+	}
+
+	sent, err := service.Dispatch(c.Request().Context(), event)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Message: err.Error(),
+			Sent:    sent,
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Sent %d notification(s)", sent),
+		Sent:    sent,
+	})
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// LoggedURI returns the URI of a request for access logs, with the value of
+// the token query parameter hidden
+func LoggedURI(r *http.Request) string {
+	query := r.URL.Query()
+	if !query.Has("token") {
+		return r.RequestURI
+	}
+	query.Set("token", "REDACTED")
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveEvent(t *testing.T) {
+	a := assert.New(t)
+	rules := []Rule{{Name: "welcome", Model: "res.partner", Event: "created", Message: "Welcome {{name}}!"}}
+	service, sender, _ := newTestService(t, rules, map[string]interface{}{
+		"res.partner.read": []map[string]interface{}{{"id": 3, "name": "Azure Interior", "phone": "+6598765432"}},
+	})
+	h := NewHandler(map[string]*Service{"main": service}, "main")
+	h.token = "s3cret"
+	e := echo.New()
+
+	tests := []struct {
+		name   string
+		target string
+		auth   string
+		body   string
+		status int
+	}{
+		{"missing token", "/odoo/events", "", `{"model":"res.partner","id":3,"event":"created"}`, http.StatusUnauthorized},
+		{"wrong token", "/odoo/events", "Bearer nope", `{"model":"res.partner","id":3,"event":"created"}`, http.StatusUnauthorized},
+		{"missing id", "/odoo/events", "Bearer s3cret", `{"model":"res.partner","event":"created"}`, http.StatusBadRequest},
+		{"bearer token", "/odoo/events", "Bearer s3cret", `{"model":"res.partner","id":3,"event":"created","payload":{"name":"Azure"}}`, http.StatusOK},
+		{"query token", "/odoo/events?token=s3cret&connection=main", "", `{"_model":"res.partner","_id":3,"_action":"created"}`, http.StatusOK},
+		{"unknown connection", "/odoo/events?connection=branch", "Bearer s3cret", `{"model":"res.partner","id":3,"event":"created"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+
+		if a.NoError(h.ReceiveEvent(e.NewContext(req, rec)), tt.name) {
+			a.Equal(tt.status, rec.Code, tt.name)
+		}
+	}
+
+	if a.Len(sender.Messages, 2) {
+		a.Equal("Welcome Azure!", sender.Messages[0].Message)
+		a.Equal("Welcome Azure Interior!", sender.Messages[1].Message)
+	}
+}
+
+func TestReceiveEventWithoutConfiguredToken(t *testing.T) {
+	a := assert.New(t)
+	service, _, _ := newTestService(t, nil, nil)
+	h := NewHandler(map[string]*Service{"main": service}, "main")
+	h.token = ""
+
+	req := httptest.NewRequest(http.MethodPost, "/odoo/events", strings.NewReader(`{"model":"res.partner","id":3}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	if a.NoError(h.ReceiveEvent(echo.New().NewContext(req, rec))) {
+		a.Equal(http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestLoggedURI(t *testing.T) {
+	a := assert.New(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/odoo/events?token=s3cret&connection=main", nil)
+	a.Equal("/odoo/events?connection=main&token=REDACTED", LoggedURI(req))
+
+	req = httptest.NewRequest(http.MethodPost, "/odoo/events?connection=main", nil)
+	a.Equal("/odoo/events?connection=main", LoggedURI(req))
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Event is a record change reported by an Odoo automated action
+type Event struct {
+	Model   string                 `json:"model"`
+	ID      int                    `json:"id"`
+	Name    string                 `json:"event"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// UnmarshalJSON accepts both the documented event format and the body of
+// Odoo's own "Send Webhook Notification" action, which puts the record's
+// fields next to _model, _id and _action
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if _, ok := raw["_model"]; ok {
+		e.Model, _ = raw["_model"].(string)
+		id, _ := raw["_id"].(float64)
+		e.ID = int(id)
+		e.Name, _ = raw["_action"].(string)
+		e.Payload = make(map[string]interface{}, len(raw))
+		for k, v := range raw {
+			if k != "_model" && k != "_id" && k != "_action" && k != "_name" {
+				e.Payload[k] = v
+			}
+		}
+		return nil
+	}
+
+	type event Event
+	return json.Unmarshal(data, (*event)(e))
+}
+
+const (
+	RecipientPartner = "partner"
+	RecipientUser    = "user"
+)
+
+// Rule turns matching events into a WhatsApp message. Placeholders like
+// {{name}} are replaced with the event payload, or else with the record's
+// field of that name.
+type Rule struct {
+	Name string `json:"name"`
+
+	Model string `json:"model"`
+	// Event matches the event name; empty matches every event of the model
+	Event string `json:"event,omitempty"`
+
+	// Template is the name of an approved message template, whose body
+	// parameters are filled from Parameters. Without a template, Message is
+	// sent as free-form text, which WhatsApp only delivers within 24 hours
+	// of the recipient's last message.
+	Template   string   `json:"template,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	Parameters []string `json:"parameters,omitempty"`
+	Message    string   `json:"message,omitempty"`
+
+	// Recipient is "partner" (the default) or "user"
+	Recipient string `json:"recipient,omitempty"`
+	// Field is the many2one pointing at the recipient, partner_id or user_id
+	// by default. Events on res.partner notify the partner itself.
+	Field string `json:"field,omitempty"`
+}
+
+// Matches reports whether the rule applies to event
+func (r Rule) Matches(event Event) bool {
+	return r.Model == event.Model && (r.Event == "" || r.Event == event.Name)
+}
+
+// recipientField returns the field holding the recipient, or "" when the
+// record is the recipient
+func (r Rule) recipientField() string {
+	switch {
+	case r.Field != "":
+		return r.Field
+	case r.Recipient == RecipientUser:
+		return "user_id"
+	case r.Model == "res.partner":
+		return ""
+	}
+	return "partner_id"
+}
+
+// LoadRules reads notification rules from a JSON file. An empty path means
+// no rules, so every event is ignored.
+func LoadRules(path string) ([]Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse notification rules: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Model == "" {
+			return nil, fmt.Errorf("notification rule %d (%s) has no model", i, rule.Name)
+		}
+		if rule.Template == "" && rule.Message == "" {
+			return nil, fmt.Errorf("notification rule %d (%s) has neither a template nor a message", i, rule.Name)
+		}
+		if rule.Recipient != "" && rule.Recipient != RecipientPartner && rule.Recipient != RecipientUser {
+			return nil, fmt.Errorf("notification rule %d (%s) has unknown recipient %q", i, rule.Name, rule.Recipient)
+		}
+	}
+	return rules, nil
+}
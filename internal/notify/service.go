@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Service delivers Odoo record events to WhatsApp according to rules
+type Service struct {
+	// PhoneNumberID is the WhatsApp number notifications are sent from,
+	// the account's first one by default
+	PhoneNumberID string
+
+	odoo   *odoo.Client
+	sender agent.Sender
+	rules  []Rule
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, rules []Rule) *Service {
+	return &Service{odoo: client, sender: sender, rules: rules}
+}
+
+// Dispatch sends the messages of every rule matching event and returns how
+// many were sent
+func (s *Service) Dispatch(ctx context.Context, event Event) (int, error) {
+	if s.PhoneNumberID != "" {
+		ctx = whatsapp.WithPhoneNumberID(ctx, s.PhoneNumberID)
+	}
+
+	var sent int
+	var errs []error
+	for _, rule := range s.rules {
+		if !rule.Matches(event) {
+			continue
+		}
+		if err := s.deliver(ctx, rule, event); err != nil {
+			log.Printf("Failed to deliver %s notification for %s %d: %v", rule.Name, event.Model, event.ID, err)
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.Name, err))
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+func (s *Service) deliver(ctx context.Context, rule Rule, event Event) error {
+	values, err := s.values(ctx, rule, event)
+	if err != nil {
+		return err
+	}
+
+	to, err := s.recipient(ctx, rule, event, values)
+	if err != nil {
+		return err
+	}
+
+	if rule.Template != "" {
+		parameters := make([]string, len(rule.Parameters))
+		for i, p := range rule.Parameters {
+			parameters[i] = interpolate(p, values)
+		}
+		_, err = s.sender.SendTemplate(ctx, whatsapp.TemplateMessage{
+			To:             to,
+			Name:           rule.Template,
+			Language:       rule.Language,
+			BodyParameters: parameters,
+		})
+		return err
+	}
+
+	_, err = s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: interpolate(rule.Message, values)})
+	return err
+}
+
+// values returns the event payload completed with the record fields the
+// rule needs that the payload doesn't have
+func (s *Service) values(ctx context.Context, rule Rule, event Event) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(event.Payload))
+	for k, v := range event.Payload {
+		values[k] = v
+	}
+
+	var missing []string
+	need := func(field string) {
+		if _, ok := values[field]; !ok && field != "" {
+			values[field] = nil
+			missing = append(missing, field)
+		}
+	}
+	need(rule.recipientField())
+	for _, text := range append([]string{rule.Message}, rule.Parameters...) {
+		for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			need(m[1])
+		}
+	}
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	records, err := s.odoo.Read(ctx, event.Model, []int{event.ID}, missing, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %d: %w", event.Model, event.ID, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s %d not found", event.Model, event.ID)
+	}
+	for _, field := range missing {
+		values[field] = records[0][field]
+	}
+	return values, nil
+}
+
+// recipient returns the WhatsApp number of the partner or user on record
+func (s *Service) recipient(ctx context.Context, rule Rule, event Event, values map[string]interface{}) (string, error) {
+	model := "res.partner"
+	if rule.Recipient == RecipientUser {
+		model = "res.users"
+	}
+
+	id := event.ID
+	if field := rule.recipientField(); field != "" {
+		record := odoo.Record(values)
+		id = record.Int(field)
+		if id == 0 {
+			id, _ = record.Many2one(field)
+		}
+		// For a many2many like user_ids, the first one is responsible
+		if ids := record.IDs(field); id == 0 && len(ids) > 0 {
+			id = ids[0]
+		}
+		if id == 0 {
+			return "", fmt.Errorf("%s %d has no %s", event.Model, event.ID, field)
+		}
+	}
+
+	// res.users inherits the phone numbers of its partner
+	records, err := s.odoo.Read(ctx, model, []int{id}, []string{"name", "phone", "mobile"}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read recipient: %w", err)
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("%s %d not found", model, id)
+	}
+
+	phone := records[0].String("mobile")
+	if phone == "" {
+		phone = records[0].String("phone")
+	}
+	if phone == "" {
+		return "", fmt.Errorf("%s has no phone number", records[0].String("name"))
+	}
+	return phone, nil
+}
+
+// interpolate replaces the {{field}} placeholders of text with values
+func interpolate(text string, values map[string]interface{}) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		field := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return formatValue(values[field])
+	})
+}
+
+// formatValue renders a field value the way Odoo displays it
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		// Odoo encodes empty fields as false
+		if !v {
+			return ""
+		}
+		return "yes"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		// many2one fields come as [id, name]
+		if len(v) == 2 {
+			if name, ok := v[1].(string); ok {
+				return name
+			}
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, rules []Rule, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{}
+	return NewService(recorder.Client(), sender, rules), sender, recorder
+}
+
+func TestEventUnmarshal(t *testing.T) {
+	a := assert.New(t)
+
+	var event Event
+	a.NoError(json.Unmarshal([]byte(`{"model":"sale.order","id":7,"event":"confirmed","payload":{"name":"S00007"}}`), &event))
+	a.Equal(Event{Model: "sale.order", ID: 7, Name: "confirmed", Payload: map[string]interface{}{"name": "S00007"}}, event)
+
+	event = Event{}
+	a.NoError(json.Unmarshal([]byte(`{"_model":"sale.order","_id":7,"_action":"Notify customer(#12)","_name":"S00007","name":"S00007","amount_total":99.5}`), &event))
+	a.Equal(Event{Model: "sale.order", ID: 7, Name: "Notify customer(#12)", Payload: map[string]interface{}{"name": "S00007", "amount_total": 99.5}}, event)
+}
+
+func TestRuleMatches(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(Rule{Model: "sale.order"}.Matches(Event{Model: "sale.order", Name: "confirmed"}))
+	a.True(Rule{Model: "sale.order", Event: "confirmed"}.Matches(Event{Model: "sale.order", Name: "confirmed"}))
+	a.False(Rule{Model: "sale.order", Event: "cancelled"}.Matches(Event{Model: "sale.order", Name: "confirmed"}))
+	a.False(Rule{Model: "purchase.order"}.Matches(Event{Model: "sale.order"}))
+}
+
+func TestInterpolate(t *testing.T) {
+	a := assert.New(t)
+
+	values := map[string]interface{}{
+		"name":             "S00007",
+		"amount_total":     1250.5,
+		"partner_id":       []interface{}{float64(3), "Azure Interior"},
+		"client_order_ref": false,
+	}
+	a.Equal("Order S00007 for Azure Interior: 1250.5 (ref )", interpolate("Order {{name}} for {{ partner_id }}: {{amount_total}} (ref {{client_order_ref}})", values))
+}
+
+func TestDispatchTemplateToPartner(t *testing.T) {
+	a := assert.New(t)
+	rules := []Rule{{
+		Name:       "order confirmed",
+		Model:      "sale.order",
+		Event:      "confirmed",
+		Template:   "order_confirmed",
+		Parameters: []string{"{{partner_id}}", "{{name}}", "{{amount_total}}"},
+	}}
+	service, sender, recorder := newTestService(t, rules, map[string]interface{}{
+		"sale.order.read":  []map[string]interface{}{{"id": 7, "partner_id": []interface{}{3, "Azure Interior"}, "amount_total": 99.5}},
+		"res.partner.read": []map[string]interface{}{{"id": 3, "name": "Azure Interior", "phone": "+65 9876 5432", "mobile": false}},
+	})
+
+	sent, err := service.Dispatch(context.Background(), Event{
+		Model:   "sale.order",
+		ID:      7,
+		Name:    "confirmed",
+		Payload: map[string]interface{}{"name": "S00007"},
+	})
+
+	a.NoError(err)
+	a.Equal(1, sent)
+	if a.Len(recorder.Calls(), 2) {
+		// The payload already has the name, so only the rest is read
+		a.ElementsMatch([]interface{}{"partner_id", "amount_total"}, recorder.Calls()[0].Kwargs["fields"])
+		a.Equal([]interface{}{[]interface{}{float64(3)}}, recorder.Calls()[1].Args)
+	}
+	if a.Len(sender.Templates, 1) {
+		a.Equal("+65 9876 5432", sender.Templates[0].To)
+		a.Equal("order_confirmed", sender.Templates[0].Name)
+		a.Equal([]string{"Azure Interior", "S00007", "99.5"}, sender.Templates[0].BodyParameters)
+	}
+}
+
+func TestDispatchMessageToUser(t *testing.T) {
+	a := assert.New(t)
+	rules := []Rule{{
+		Name:      "task assigned",
+		Model:     "project.task",
+		Message:   "You were assigned {{name}}",
+		Recipient: RecipientUser,
+		Field:     "user_ids",
+	}, {
+		Name:     "other model",
+		Model:    "sale.order",
+		Template: "order_confirmed",
+	}}
+	service, sender, recorder := newTestService(t, rules, map[string]interface{}{
+		"res.users.read": []map[string]interface{}{{"id": 9, "name": "Ana", "phone": false, "mobile": "+6591234567"}},
+	})
+
+	sent, err := service.Dispatch(context.Background(), Event{
+		Model:   "project.task",
+		ID:      20,
+		Payload: map[string]interface{}{"name": "Fix footer links", "user_ids": []interface{}{float64(9), float64(12)}},
+	})
+
+	a.NoError(err)
+	a.Equal(1, sent)
+	a.Len(recorder.Calls(), 1)
+	if a.Len(sender.Messages, 1) {
+		a.Equal("+6591234567", sender.Messages[0].To)
+		a.Equal("You were assigned Fix footer links", sender.Messages[0].Message)
+	}
+}
+
+func TestDispatchWithoutRecipient(t *testing.T) {
+	a := assert.New(t)
+	rules := []Rule{{Name: "order confirmed", Model: "sale.order", Message: "Thanks!"}}
+	service, sender, _ := newTestService(t, rules, map[string]interface{}{
+		"sale.order.read": []map[string]interface{}{{"id": 7, "partner_id": false}},
+	})
+
+	sent, err := service.Dispatch(context.Background(), Event{Model: "sale.order", ID: 7})
+
+	a.ErrorContains(err, "has no partner_id")
+	a.Zero(sent)
+	a.Empty(sender.Messages)
+}
@@ -0,0 +1,23 @@
+package odoo
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// Attach stores a file as an ir.attachment linked to a record, so it shows up
+// in the record's chatter and attachment list
+func (c *Client) Attach(ctx context.Context, model string, id int, filename, mimeType string, data []byte) (int, error) {
+	attachmentID, err := c.Create(ctx, "ir.attachment", map[string]interface{}{
+		"name":      filename,
+		"mimetype":  mimeType,
+		"datas":     base64.StdEncoding.EncodeToString(data),
+		"res_model": model,
+		"res_id":    id,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach %s: %w", filename, err)
+	}
+	return attachmentID, nil
+}
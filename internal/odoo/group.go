@@ -0,0 +1,39 @@
+package odoo
+
+import "context"
+
+// ReadGroup aggregates the records of model matching domain, e.g. fields
+// "amount_total:sum" grouped by "partner_id". Groups are not lazy: every
+// groupBy level is applied at once and each group's record count is in
+// "__count".
+func (c *Client) ReadGroup(ctx context.Context, model string, domain Domain, fields, groupBy []string, opts *SearchOptions) ([]Record, error) {
+	if domain == nil {
+		domain = Domain{}
+	}
+	if groupBy == nil {
+		groupBy = []string{}
+	}
+	kwargs := map[string]interface{}{
+		"lazy": false,
+	}
+	if opts != nil {
+		if opts.Limit > 0 {
+			kwargs["limit"] = opts.Limit
+		}
+		if opts.Offset > 0 {
+			kwargs["offset"] = opts.Offset
+		}
+		if opts.Order != "" {
+			kwargs["orderby"] = opts.Order
+		}
+		if opts.Context != nil {
+			kwargs["context"] = opts.Context
+		}
+	}
+
+	var groups []Record
+	if err := c.ExecuteKW(ctx, model, "read_group", []interface{}{domain, fields, groupBy}, kwargs, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
@@ -0,0 +1,24 @@
+package odoo
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	blockTags  = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</h[1-6]>`)
+	anyTag     = regexp.MustCompile(`<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText converts the HTML of an Odoo html field or chatter message to
+// plain text suitable for WhatsApp
+func HTMLToText(s string) string {
+	s = blockTags.ReplaceAllString(s, "\n")
+	s = anyTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = strings.ReplaceAll(s, " ", " ")
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,186 @@
+package odoo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits protect waOdoo from a slow or restarting Odoo server. The zero
+// value has no limits.
+type Limits struct {
+	// Timeout is how long a call may take, waiting for a free slot included
+	Timeout time.Duration
+	// MaxConcurrent is how many calls are in flight at once
+	MaxConcurrent int
+	// CacheTTL is how long read results are reused, 0 to always ask Odoo.
+	// Any write made through the client empties the cache, but changes made
+	// in Odoo itself are only seen once the results expire.
+	CacheTTL time.Duration
+}
+
+// LimitsFromEnv reads ODOO_TIMEOUT, ODOO_MAX_CONCURRENCY and
+// ODOO_CACHE_TTL, with defaults for the unset ones. Reads are only cached
+// when ODOO_CACHE_TTL is set.
+func LimitsFromEnv() Limits {
+	return Limits{
+		Timeout:       envDuration("ODOO_TIMEOUT", 30*time.Second),
+		MaxConcurrent: envInt("ODOO_MAX_CONCURRENCY", 8),
+		CacheTTL:      envDuration("ODOO_CACHE_TTL", 0),
+	}
+}
+
+type freshKey struct{}
+
+// Fresh returns a context whose reads skip the cache, for reads that decide
+// a change, such as the state of an order before approving it
+func Fresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+type lastKnownKey struct{}
+
+// lastKnownFor is how long a read result may stand in for Odoo while it
+// can't be reached
+const lastKnownFor = 24 * time.Hour
+
+// LastKnown returns a context whose reads are answered with their last
+// known result while Odoo can't be reached, for the lookups a queueable
+// write depends on, such as the employee of a number. Odoo checks the
+// write itself when the queue replays it.
+func LastKnown(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lastKnownKey{}, true)
+}
+
+func isLastKnown(ctx context.Context) bool {
+	lastKnown, _ := ctx.Value(lastKnownKey{}).(bool)
+	return lastKnown
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
+
+func envInt(name string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+var (
+	// ErrUnavailable means the request never reached Odoo, e.g. while it
+	// restarts, so it is safe to try again
+	ErrUnavailable = errors.New("odoo is unreachable")
+	// ErrTimeout means Odoo didn't answer in time. A write may still have
+	// been applied.
+	ErrTimeout = errors.New("odoo took too long to answer")
+)
+
+// unreachable reports whether a failed request couldn't connect to Odoo
+func unreachable(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// acquire waits for a free call slot and returns the function releasing it
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	if c.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	c.slotsOnce.Do(func() { c.slots = make(chan struct{}, c.MaxConcurrent) })
+	select {
+	case c.slots <- struct{}{}:
+		return func() { <-c.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readMethods don't change records, so their results can be cached
+var readMethods = map[string]bool{
+	"read":                true,
+	"search":              true,
+	"search_read":         true,
+	"search_count":        true,
+	"read_group":          true,
+	"name_search":         true,
+	"fields_get":          true,
+	"check_access_rights": true,
+}
+
+// maxCached is the number of results kept before expired ones are swept
+const maxCached = 1000
+
+// readCache keeps raw results of read calls for a while
+type readCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResult
+}
+
+type cachedResult struct {
+	data    json.RawMessage
+	expires time.Time
+}
+
+// cacheKey identifies a call by everything sent to Odoo, so that users with
+// different access rights or companies don't share results
+func cacheKey(args []interface{}) (string, bool) {
+	key, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+func (r *readCache) get(key string, now time.Time) (json.RawMessage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[key]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+func (r *readCache) put(key string, data json.RawMessage, now time.Time, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		r.entries = map[string]cachedResult{}
+	}
+	if len(r.entries) >= maxCached {
+		for k, entry := range r.entries {
+			if now.After(entry.expires) {
+				delete(r.entries, k)
+			}
+		}
+	}
+	if len(r.entries) < maxCached {
+		r.entries[key] = cachedResult{data: data, expires: now.Add(ttl)}
+	}
+}
+
+// clear forgets every result. Writes can change computed fields of other
+// models, such as the total of an order when a line is added, so they
+// invalidate the whole cache rather than their model's results.
+func (r *readCache) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
@@ -0,0 +1,47 @@
+package odoo
+
+import (
+	"context"
+)
+
+// PostOptions are the optional arguments of MessagePostWith
+type PostOptions struct {
+	// Internal posts a note only visible to employees
+	Internal bool
+	// AuthorID is the res.partner shown as author, the caller by default
+	AuthorID int
+	// AttachmentIDs are ir.attachment records shown with the message
+	AttachmentIDs []int
+}
+
+// MessagePost posts a message in the chatter of a mail.thread record and
+// returns the id of the new mail.message. Internal notes are only visible to
+// employees; other messages notify the record's followers.
+func (c *Client) MessagePost(ctx context.Context, model string, id int, body string, internal bool) (int, error) {
+	return c.MessagePostWith(ctx, model, id, body, PostOptions{Internal: internal})
+}
+
+// MessagePostWith is MessagePost with an author and attachments
+func (c *Client) MessagePostWith(ctx context.Context, model string, id int, body string, opts PostOptions) (int, error) {
+	subtype := "mail.mt_comment"
+	if opts.Internal {
+		subtype = "mail.mt_note"
+	}
+	kwargs := map[string]interface{}{
+		"body":          body,
+		"message_type":  "comment",
+		"subtype_xmlid": subtype,
+	}
+	if opts.AuthorID != 0 {
+		kwargs["author_id"] = opts.AuthorID
+	}
+	if len(opts.AttachmentIDs) > 0 {
+		kwargs["attachment_ids"] = opts.AttachmentIDs
+	}
+
+	var messageID int
+	if err := c.ExecuteKW(ctx, model, "message_post", []interface{}{[]int{id}}, kwargs, &messageID); err != nil {
+		return 0, err
+	}
+	return messageID, nil
+}
@@ -0,0 +1,142 @@
+package odoo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Record is a single row returned by Odoo's read and search_read methods.
+// Odoo encodes empty values as false, so the typed getters below treat any
+// value of the wrong type as the zero value.
+type Record map[string]interface{}
+
+// ID returns the record's database id
+func (r Record) ID() int {
+	return r.Int("id")
+}
+
+// String returns a char, text or selection field
+func (r Record) String(field string) string {
+	if v, ok := r[field].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Int returns an integer field
+func (r Record) Int(field string) int {
+	switch v := r[field].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// Float returns a float or monetary field
+func (r Record) Float(field string) float64 {
+	switch v := r[field].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// Bool returns a boolean field
+func (r Record) Bool(field string) bool {
+	v, _ := r[field].(bool)
+	return v
+}
+
+// Many2one returns the id and display name of a many2one field, which Odoo
+// encodes as an [id, name] pair
+func (r Record) Many2one(field string) (int, string) {
+	pair, ok := r[field].([]interface{})
+	if !ok || len(pair) < 2 {
+		return 0, ""
+	}
+	id, _ := pair[0].(float64)
+	name, _ := pair[1].(string)
+	return int(id), name
+}
+
+// IDs returns the ids of a one2many or many2many field
+func (r Record) IDs(field string) []int {
+	list, ok := r[field].([]interface{})
+	if !ok {
+		return nil
+	}
+	ids := make([]int, 0, len(list))
+	for _, v := range list {
+		if id, ok := v.(float64); ok {
+			ids = append(ids, int(id))
+		}
+	}
+	return ids
+}
+
+// Domain is an Odoo search domain in prefix notation, e.g.
+// Domain{"|", Cond("name", "ilike", "desk"), Cond("barcode", "=", "123")}
+type Domain []interface{}
+
+// Cond builds a single (field, operator, value) domain term
+func Cond(field, operator string, value interface{}) []interface{} {
+	return []interface{}{field, operator, value}
+}
+
+// SearchOptions holds the optional keyword arguments of search_read
+type SearchOptions struct {
+	Limit   int
+	Offset  int
+	Order   string
+	Context map[string]interface{}
+}
+
+// VersionInfo is the result of the common service's version call
+type VersionInfo struct {
+	ServerVersion     string        `json:"server_version"`
+	ServerVersionInfo []interface{} `json:"server_version_info"`
+	ServerSerie       string        `json:"server_serie"`
+	ProtocolVersion   int           `json:"protocol_version"`
+}
+
+// Fault is an error returned by the Odoo server
+type Fault struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    FaultData `json:"data"`
+}
+
+// FaultData carries the Python exception details of a Fault
+type FaultData struct {
+	Name          string        `json:"name"`
+	Debug         string        `json:"debug"`
+	Message       string        `json:"message"`
+	Arguments     []interface{} `json:"arguments"`
+	ExceptionType string        `json:"exception_type"`
+}
+
+func (f *Fault) Error() string {
+	if f.Data.Message != "" {
+		return fmt.Sprintf("odoo fault %s: %s", f.Data.Name, strings.TrimSpace(f.Data.Message))
+	}
+	return fmt.Sprintf("odoo fault %d: %s", f.Code, f.Message)
+}
+
+// CallError is the failure of a model method call
+type CallError struct {
+	Model  string
+	Method string
+	Err    error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("%s.%s failed: %v", e.Model, e.Method, e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,408 @@
+package odootest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// predicate tells whether a record matches part of a domain
+type predicate func(record odoo.Record) bool
+
+// compile turns a domain in Odoo's prefix notation into a predicate. Terms
+// without an operator are joined with "&", as in Odoo.
+func (s *Server) compile(model string, domain []interface{}) (predicate, error) {
+	var stack []predicate
+	pop := func() predicate {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return p
+	}
+
+	for i := len(domain) - 1; i >= 0; i-- {
+		switch term := domain[i].(type) {
+		case string:
+			arity := 2
+			if term == "!" {
+				arity = 1
+			} else if term != "&" && term != "|" {
+				return nil, ValidationError(fmt.Sprintf("Invalid domain operator %q", term))
+			}
+			if len(stack) < arity {
+				return nil, ValidationError(fmt.Sprintf("Invalid domain: %q is missing operands", term))
+			}
+			switch term {
+			case "!":
+				p := pop()
+				stack = append(stack, func(r odoo.Record) bool { return !p(r) })
+			case "&":
+				a, b := pop(), pop()
+				stack = append(stack, func(r odoo.Record) bool { return a(r) && b(r) })
+			case "|":
+				a, b := pop(), pop()
+				stack = append(stack, func(r odoo.Record) bool { return a(r) || b(r) })
+			}
+		case []interface{}:
+			p, err := s.leaf(model, term)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, p)
+		default:
+			return nil, ValidationError(fmt.Sprintf("Invalid domain term %v", term))
+		}
+	}
+
+	return func(r odoo.Record) bool {
+		for _, p := range stack {
+			if !p(r) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// leaf compiles a (field, operator, value) term. Fields may be paths
+// through relational fields, e.g. "partner_id.country_id.code".
+func (s *Server) leaf(model string, term []interface{}) (predicate, error) {
+	if len(term) != 3 {
+		return nil, ValidationError(fmt.Sprintf("Invalid domain term %v", term))
+	}
+	operator, _ := term[1].(string)
+	path, ok := term[0].(string)
+	if !ok {
+		// TRUE_LEAF (1, "=", 1) and FALSE_LEAF (0, "=", 1)
+		matches := toInt(term[0]) == toInt(term[2])
+		return func(odoo.Record) bool { return matches }, nil
+	}
+	switch operator {
+	case "=", "!=", "<", "<=", ">", ">=", "=?", "in", "not in", "like", "ilike", "not like", "not ilike", "=like", "=ilike", "child_of", "parent_of":
+	default:
+		return nil, ValidationError(fmt.Sprintf("Invalid domain operator %q", operator))
+	}
+	if err := s.checkField(model, path); err != nil {
+		return nil, err
+	}
+	value := term[2]
+	return func(r odoo.Record) bool { return s.match(model, r, path, operator, value) }, nil
+}
+
+// match evaluates a term against a record
+func (s *Server) match(model string, record odoo.Record, path, operator string, value interface{}) bool {
+	field, rest, _ := strings.Cut(path, ".")
+	rel, relational := s.relation(model, field)
+	if field == "id" {
+		rel, relational = Relation{Model: model}, true
+	}
+	stored := record[field]
+	if field == "id" {
+		stored = record.ID()
+	}
+
+	// Paths continue on the related records, any of which may match
+	if rest != "" {
+		if !relational {
+			return false
+		}
+		targets := s.table(rel.Model).records
+		for _, id := range toInts(stored) {
+			if target, ok := targets[id]; ok && s.match(rel.Model, target, rest, operator, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if relational {
+		ids := toInts(stored)
+		switch operator {
+		case "child_of", "parent_of":
+			related := s.hierarchy(rel.Model, toInts(value), operator == "child_of")
+			for _, id := range ids {
+				if related[id] {
+					return true
+				}
+			}
+			return false
+		}
+		// Names are matched against the display name of the related records
+		if name, ok := value.(string); ok && operator != "in" && operator != "not in" {
+			names := make([]interface{}, len(ids))
+			for i, id := range ids {
+				names[i] = s.displayName(rel.Model, id)
+			}
+			return compareAny(names, operator, name)
+		}
+		if rel.Many || field == "id" {
+			values := make([]interface{}, len(ids))
+			for i, id := range ids {
+				values[i] = id
+			}
+			return compareAny(values, operator, value)
+		}
+		if id := toInt(stored); id != 0 {
+			stored = id
+		} else {
+			stored = false
+		}
+	}
+	return compare(stored, operator, value)
+}
+
+// compareAny matches a term against the values of an x2many field: positive
+// operators need one match, negative ones need none
+func compareAny(values []interface{}, operator string, value interface{}) bool {
+	negative := map[string]string{"!=": "=", "not in": "in", "not like": "like", "not ilike": "ilike"}
+	if positive, ok := negative[operator]; ok {
+		return !compareAny(values, positive, value)
+	}
+	if len(values) == 0 {
+		return compare(false, operator, value)
+	}
+	for _, v := range values {
+		if compare(v, operator, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hierarchy returns the given records and their descendants, or their
+// ancestors, through parent_id
+func (s *Server) hierarchy(model string, ids []int, descendants bool) map[int]bool {
+	records := s.table(model).records
+	found := map[int]bool{}
+	queue := append([]int{}, ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if found[id] {
+			continue
+		}
+		found[id] = true
+		if descendants {
+			for childID, child := range records {
+				if toInt(child["parent_id"]) == id {
+					queue = append(queue, childID)
+				}
+			}
+		} else if parentID := toInt(records[id]["parent_id"]); parentID != 0 {
+			queue = append(queue, parentID)
+		}
+	}
+	return found
+}
+
+// compare applies an operator to a stored value the way PostgreSQL does:
+// empty values only match = false and the negative operators
+func compare(stored interface{}, operator string, value interface{}) bool {
+	switch operator {
+	case "=":
+		return equal(stored, value)
+	case "!=":
+		return !equal(stored, value)
+	case "=?":
+		return !truthy(value) || equal(stored, value)
+	case "in", "not in":
+		in := false
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, v := range list {
+			if equal(stored, v) {
+				in = true
+				break
+			}
+		}
+		return in == (operator == "in")
+	case "<", "<=", ">", ">=":
+		if isEmpty(stored) {
+			return false
+		}
+		c, ok := order(stored, value)
+		if !ok {
+			return false
+		}
+		switch operator {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	case "like", "ilike", "not like", "not ilike":
+		text, _ := stored.(string)
+		pattern := fmt.Sprint(value)
+		if strings.HasPrefix(operator, "not") && isEmpty(stored) {
+			return true
+		}
+		if strings.HasSuffix(operator, "ilike") {
+			text, pattern = strings.ToLower(text), strings.ToLower(pattern)
+		}
+		found := !isEmpty(stored) && strings.Contains(text, pattern)
+		return found != strings.HasPrefix(operator, "not")
+	case "=like", "=ilike":
+		text, _ := stored.(string)
+		if isEmpty(stored) {
+			return false
+		}
+		return likePattern(fmt.Sprint(value), operator == "=ilike").MatchString(text)
+	}
+	return false
+}
+
+// likePattern converts an SQL LIKE pattern to a regular expression
+func likePattern(pattern string, fold bool) *regexp.Regexp {
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func isEmpty(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !x
+	case string:
+		return x == ""
+	}
+	return false
+}
+
+func equal(a, b interface{}) bool {
+	if isEmpty(b) {
+		if _, isBool := b.(bool); isBool || b == nil {
+			return isEmpty(a) || a == b
+		}
+	}
+	switch a.(type) {
+	case int, int64, float64:
+		switch b.(type) {
+		case int, int64, float64:
+			return toFloat(a) == toFloat(b)
+		}
+		return false
+	}
+	return a == b
+}
+
+// order compares two values of the same kind
+func order(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case int, int64, float64:
+		switch b.(type) {
+		case int, int64, float64:
+		default:
+			return 0, false
+		}
+		fa, fb := toFloat(x), toFloat(b)
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// sortRecords orders records by an Odoo order clause such as
+// "write_date desc, id". Empty values come last in ascending order, as in
+// PostgreSQL.
+func (s *Server) sortRecords(model string, records []odoo.Record, clause string) error {
+	type key struct {
+		field string
+		desc  bool
+	}
+	var keys []key
+	for _, part := range strings.Split(clause, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		k := key{field: fields[0]}
+		if len(fields) > 1 {
+			switch strings.ToLower(fields[1]) {
+			case "desc":
+				k.desc = true
+			case "asc":
+			default:
+				return ValidationError(fmt.Sprintf("Invalid order %q", clause))
+			}
+		}
+		keys = append(keys, k)
+	}
+	keys = append(keys, key{field: "id"})
+
+	sortValue := func(r odoo.Record, field string) interface{} {
+		if field == "id" {
+			return r.ID()
+		}
+		v := r[field]
+		if rel, ok := s.relation(model, field); ok && !rel.Many {
+			return toInt(v)
+		}
+		return v
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := sortValue(records[i], k.field), sortValue(records[j], k.field)
+			emptyA, emptyB := isEmpty(a) || a == 0, isEmpty(b) || b == 0
+			if emptyA || emptyB {
+				if emptyA == emptyB {
+					continue
+				}
+				return emptyB != k.desc
+			}
+			c, ok := order(a, b)
+			if !ok || c == 0 {
+				continue
+			}
+			return (c < 0) != k.desc
+		}
+		return false
+	})
+	return nil
+}
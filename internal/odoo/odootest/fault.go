@@ -0,0 +1,80 @@
+package odootest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// exceptionTypes are the exception_type Odoo reports for its exceptions
+var exceptionTypes = map[string]string{
+	"odoo.exceptions.UserError":       "user_error",
+	"odoo.exceptions.ValidationError": "validation_error",
+	"odoo.exceptions.AccessError":     "access_error",
+	"odoo.exceptions.AccessDenied":    "access_denied",
+	"odoo.exceptions.MissingError":    "missing_error",
+}
+
+// NewFault builds the fault Odoo returns when a call raises the given Python
+// exception, e.g. "odoo.exceptions.UserError"
+func NewFault(exception, message string) *odoo.Fault {
+	exceptionType, ok := exceptionTypes[exception]
+	if !ok {
+		exceptionType = "internal_error"
+	}
+	return &odoo.Fault{
+		Code:    200,
+		Message: "Odoo Server Error",
+		Data: odoo.FaultData{
+			Name:          exception,
+			Message:       message,
+			Debug:         fmt.Sprintf("Traceback (most recent call last):\n  File \"odoo/http.py\", line 1, in _dispatch\n%s: %s\n", exception, message),
+			Arguments:     []interface{}{message},
+			ExceptionType: exceptionType,
+		},
+	}
+}
+
+func UserError(message string) *odoo.Fault {
+	return NewFault("odoo.exceptions.UserError", message)
+}
+
+func ValidationError(message string) *odoo.Fault {
+	return NewFault("odoo.exceptions.ValidationError", message)
+}
+
+func AccessError(message string) *odoo.Fault {
+	return NewFault("odoo.exceptions.AccessError", message)
+}
+
+func MissingError(message string) *odoo.Fault {
+	return NewFault("odoo.exceptions.MissingError", message)
+}
+
+// AccessDenied is the fault of calls with invalid credentials
+func AccessDenied() *odoo.Fault {
+	return NewFault("odoo.exceptions.AccessDenied", "Access Denied")
+}
+
+// Injection makes matching calls fail or slow down
+type Injection struct {
+	// Model and Method select the calls, e.g. "sale.order" and "write". An
+	// empty value matches any; common service calls have no model.
+	Model  string
+	Method string
+
+	// Fault is returned instead of the result
+	Fault *odoo.Fault
+	// Status, when set, answers with this HTTP status instead, like a proxy
+	// in front of an unavailable Odoo
+	Status int
+	// Delay holds the response back, e.g. to exercise timeouts
+	Delay time.Duration
+	// Times is the number of calls affected, every call when zero
+	Times int
+}
+
+func (i *Injection) matches(model, method string) bool {
+	return (i.Model == "" || i.Model == model) && (i.Method == "" || i.Method == method)
+}
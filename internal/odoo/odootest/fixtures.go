@@ -0,0 +1,77 @@
+package odootest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Fixtures seed a server with records, e.g.
+//
+//	{
+//	  "relations": {"res.partner": {"category_id": "many2many:res.partner.category"}},
+//	  "records": {"res.partner": [{"id": 7, "name": "Azure Interior", "phone": "+65 9876 5432"}]},
+//	  "users": [{"login": "marc", "name": "Marc Demo", "api_key": "marc-key"}]
+//	}
+//
+// Relations only need declaring for relational fields that aren't common
+// ones such as partner_id, user_id or company_id.
+type Fixtures struct {
+	Relations map[string]map[string]string `json:"relations,omitempty"`
+	Records   map[string][]odoo.Record     `json:"records,omitempty"`
+	// Users can log in with their api_key
+	Users []odoo.Record `json:"users,omitempty"`
+}
+
+// LoadFile seeds the server from a JSON fixtures file
+func (s *Server) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var fixtures Fixtures
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+	return s.Load(fixtures)
+}
+
+// Load seeds the server with fixtures
+func (s *Server) Load(fixtures Fixtures) error {
+	for model, fields := range fixtures.Relations {
+		for field, spec := range fields {
+			s.Relate(model, field, ParseRelation(field, spec))
+		}
+	}
+
+	models := make([]string, 0, len(fixtures.Records))
+	for model := range fixtures.Records {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	s.mu.Lock()
+	for _, model := range models {
+		for _, r := range fixtures.Records[model] {
+			if _, err := s.insert(model, r, AdminID); err != nil {
+				s.mu.Unlock()
+				return fmt.Errorf("failed to load %s fixture: %w", model, err)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, u := range fixtures.Users {
+		values := copyRecord(u)
+		apiKey, _ := values["api_key"].(string)
+		delete(values, "api_key")
+		if values.String("login") == "" {
+			return fmt.Errorf("user fixture without login: %v", u)
+		}
+		s.AddUser(values, apiKey)
+	}
+	return nil
+}
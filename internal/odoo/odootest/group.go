@@ -0,0 +1,285 @@
+package odootest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// aggregatePattern parses read_group field specs: "amount", "amount:sum" or
+// "total:sum(amount)"
+var aggregatePattern = regexp.MustCompile(`^(\w+)(?::(\w+)(?:\((\w+)\))?)?$`)
+
+// aggregate is a field spec of read_group
+type aggregate struct {
+	name, function, field string
+}
+
+// grouping is a groupby spec of read_group, e.g. "date_order:month"
+type grouping struct {
+	spec, field, interval string
+}
+
+// group collects the records of one read_group row
+type group struct {
+	values  []interface{}
+	sortKey []interface{}
+	domain  []interface{}
+	records []odoo.Record
+}
+
+// readGroup aggregates records like Odoo's read_group
+func (s *Server) readGroup(model string, records []odoo.Record, domain []interface{}, fieldSpecs, groupBy []string, lazy bool, orderBy string) ([]odoo.Record, error) {
+	if lazy && len(groupBy) > 1 {
+		groupBy = groupBy[:1]
+	}
+
+	var groupings []grouping
+	for _, spec := range groupBy {
+		field, interval, _ := strings.Cut(spec, ":")
+		groupings = append(groupings, grouping{spec: spec, field: field, interval: interval})
+	}
+
+	var aggregates []aggregate
+	for _, spec := range fieldSpecs {
+		m := aggregatePattern.FindStringSubmatch(spec)
+		if m == nil {
+			return nil, ValidationError(fmt.Sprintf("Invalid field specification %q", spec))
+		}
+		a := aggregate{name: m[1], function: m[2], field: m[3]}
+		if a.field == "" {
+			a.field = a.name
+		}
+		if a.function == "" {
+			a.function = "sum"
+		}
+		if a.name == "__count" || isGrouped(groupings, a.field) {
+			continue
+		}
+		aggregates = append(aggregates, a)
+	}
+
+	var groups []*group
+	index := map[string]*group{}
+	for _, r := range records {
+		var key strings.Builder
+		values := make([]interface{}, len(groupings))
+		sortKey := make([]interface{}, len(groupings))
+		groupDomain := append([]interface{}{}, domain...)
+		for i, g := range groupings {
+			var terms []interface{}
+			values[i], sortKey[i], terms = s.groupValue(model, r, g)
+			groupDomain = append(groupDomain, terms...)
+			fmt.Fprintf(&key, "%v|", sortKey[i])
+		}
+		grp, ok := index[key.String()]
+		if !ok {
+			grp = &group{values: values, sortKey: sortKey, domain: groupDomain}
+			index[key.String()] = grp
+			groups = append(groups, grp)
+		}
+		grp.records = append(grp.records, r)
+	}
+	// Without groupby, read_group returns a single row for all records
+	if len(groupings) == 0 && len(groups) == 0 {
+		groups = append(groups, &group{})
+	}
+
+	countKey := "__count"
+	if lazy && len(groupings) > 0 {
+		countKey = groupings[0].field + "_count"
+	}
+
+	rows := make([]odoo.Record, len(groups))
+	for i, grp := range groups {
+		row := odoo.Record{countKey: len(grp.records)}
+		for j, g := range groupings {
+			row[g.spec] = grp.values[j]
+		}
+		row["__domain"] = grp.domain
+		if row["__domain"] == nil {
+			row["__domain"] = append([]interface{}{}, domain...)
+		}
+		for _, a := range aggregates {
+			row[a.name] = s.aggregate(model, grp.records, a)
+		}
+		rows[i] = row
+	}
+
+	if err := sortGroups(rows, groups, groupings, orderBy); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func isGrouped(groupings []grouping, field string) bool {
+	for _, g := range groupings {
+		if g.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// groupValue returns the value a record is grouped under, as read_group
+// returns it, a value to sort groups by and the domain terms of the group
+func (s *Server) groupValue(model string, r odoo.Record, g grouping) (interface{}, interface{}, []interface{}) {
+	v := s.value(model, r, g.field)
+	if pair, ok := v.([]interface{}); ok && len(pair) == 2 {
+		return pair, pair[1], []interface{}{[]interface{}{g.field, "=", pair[0]}}
+	}
+	equals := []interface{}{[]interface{}{g.field, "=", v}}
+	text, ok := v.(string)
+	if !ok {
+		return v, v, equals
+	}
+
+	// Dates and datetimes are grouped by month unless told otherwise
+	layout := odoo.DatetimeFormat
+	t, err := parseDatetime(text)
+	if err != nil {
+		layout = time.DateOnly
+		if t, err = parseDate(text); err != nil {
+			return v, v, equals
+		}
+	}
+
+	var label string
+	var start, end time.Time
+	switch g.interval {
+	case "day":
+		start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 0, 1)
+		label = start.Format("02 Jan 2006")
+	case "week":
+		start = time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 0, 7)
+		year, week := start.ISOWeek()
+		label = fmt.Sprintf("W%d %d", week, year)
+	case "quarter":
+		start = time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 3, 0)
+		label = fmt.Sprintf("Q%d %d", (int(t.Month())-1)/3+1, t.Year())
+	case "year":
+		start = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(1, 0, 0)
+		label = start.Format("2006")
+	default:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+		label = start.Format("January 2006")
+	}
+	return label, start.Format(layout), []interface{}{
+		"&",
+		[]interface{}{g.field, ">=", start.Format(layout)},
+		[]interface{}{g.field, "<", end.Format(layout)},
+	}
+}
+
+// aggregate computes one aggregate over the records of a group
+func (s *Server) aggregate(model string, records []odoo.Record, a aggregate) interface{} {
+	var values []interface{}
+	for _, r := range records {
+		if v := r[a.field]; !isEmpty(v) {
+			values = append(values, v)
+		}
+	}
+
+	switch a.function {
+	case "count":
+		return len(values)
+	case "count_distinct":
+		distinct := map[interface{}]bool{}
+		for _, v := range values {
+			distinct[fmt.Sprint(v)] = true
+		}
+		return len(distinct)
+	case "min", "max":
+		if len(values) == 0 {
+			return false
+		}
+		best := values[0]
+		for _, v := range values[1:] {
+			if c, ok := order(v, best); ok && (c < 0) == (a.function == "min") && c != 0 {
+				best = v
+			}
+		}
+		return best
+	case "avg":
+		if len(values) == 0 {
+			return false
+		}
+		var sum float64
+		for _, v := range values {
+			sum += toFloat(v)
+		}
+		return sum / float64(len(values))
+	}
+	var sum float64
+	for _, v := range values {
+		sum += toFloat(v)
+	}
+	return sum
+}
+
+// sortGroups orders read_group rows by orderby, or by the grouped fields
+func sortGroups(rows []odoo.Record, groups []*group, groupings []grouping, orderBy string) error {
+	type key struct {
+		name string
+		desc bool
+	}
+	var keys []key
+	for _, part := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		keys = append(keys, key{name: fields[0], desc: len(fields) > 1 && strings.EqualFold(fields[1], "desc")})
+	}
+	for _, g := range groupings {
+		keys = append(keys, key{name: g.spec})
+	}
+
+	positions := map[string]int{}
+	for i, g := range groupings {
+		positions[g.spec] = i
+		positions[g.field] = i
+	}
+	type row struct {
+		record odoo.Record
+		group  *group
+	}
+	sorted := make([]row, len(rows))
+	for i := range rows {
+		sorted[i] = row{rows[i], groups[i]}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, k := range keys {
+			var a, b interface{}
+			if pos, ok := positions[k.name]; ok {
+				a, b = sorted[i].group.sortKey[pos], sorted[j].group.sortKey[pos]
+			} else {
+				a, b = sorted[i].record[k.name], sorted[j].record[k.name]
+			}
+			if isEmpty(a) || isEmpty(b) {
+				if isEmpty(a) == isEmpty(b) {
+					continue
+				}
+				return isEmpty(b) != k.desc
+			}
+			if c, ok := order(a, b); ok && c != 0 {
+				return (c < 0) != k.desc
+			}
+		}
+		return false
+	})
+	for i := range sorted {
+		rows[i] = sorted[i].record
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package odootest
+
+import (
+	"fmt"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// arg returns a positional argument, or the keyword argument of that name
+func (c *Call) arg(i int, name string) interface{} {
+	if i >= 0 && i < len(c.Args) {
+		return c.Args[i]
+	}
+	return c.Kwargs[name]
+}
+
+// execute runs one of the built-in ORM methods
+func (s *Server) execute(c *Call) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch c.Method {
+	case "search_read":
+		records, err := s.find(c.Model, c.arg(0, "domain"), c.Context(), c.arg(2, "offset"), c.arg(3, "limit"), c.arg(4, "order"))
+		if err != nil {
+			return nil, err
+		}
+		fields := toStrings(c.arg(1, "fields"))
+		result := make([]odoo.Record, len(records))
+		for i, r := range records {
+			result[i] = s.read(c.Model, r, fields)
+		}
+		return result, nil
+
+	case "search":
+		records, err := s.find(c.Model, c.arg(0, "domain"), c.Context(), c.arg(1, "offset"), c.arg(2, "limit"), c.arg(3, "order"))
+		if err != nil {
+			return nil, err
+		}
+		if truthy(c.Kwargs["count"]) {
+			return len(records), nil
+		}
+		return ids(records), nil
+
+	case "search_count":
+		records, err := s.find(c.Model, c.arg(0, "domain"), c.Context(), nil, c.arg(1, "limit"), nil)
+		if err != nil {
+			return nil, err
+		}
+		return len(records), nil
+
+	case "read":
+		records, err := s.browse(c.UID, c.Model, c.arg(0, "ids"))
+		if err != nil {
+			return nil, err
+		}
+		fields := toStrings(c.arg(1, "fields"))
+		result := make([]odoo.Record, len(records))
+		for i, r := range records {
+			result[i] = s.read(c.Model, r, fields)
+		}
+		return result, nil
+
+	case "create":
+		switch values := c.arg(0, "vals_list").(type) {
+		case map[string]interface{}:
+			return s.insert(c.Model, odoo.Record(values), c.UID)
+		case []interface{}:
+			created := make([]int, 0, len(values))
+			for _, v := range values {
+				m, _ := v.(map[string]interface{})
+				id, err := s.insert(c.Model, odoo.Record(m), c.UID)
+				if err != nil {
+					return nil, err
+				}
+				created = append(created, id)
+			}
+			return created, nil
+		}
+		return nil, NewFault("builtins.TypeError", "create() expects a dict or a list of dicts")
+
+	case "write":
+		records, err := s.browse(c.UID, c.Model, c.arg(0, "ids"))
+		if err != nil {
+			return nil, err
+		}
+		values, _ := c.arg(1, "vals").(map[string]interface{})
+		now := s.Now().UTC().Format(odoo.DatetimeFormat)
+		for _, r := range records {
+			if err := s.update(c.Model, r, odoo.Record(values)); err != nil {
+				return nil, err
+			}
+			r["write_date"], r["write_uid"] = now, c.UID
+		}
+		return true, nil
+
+	case "unlink":
+		records, err := s.browse(c.UID, c.Model, c.arg(0, "ids"))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			delete(s.table(c.Model).records, r.ID())
+		}
+		return true, nil
+
+	case "read_group":
+		records, err := s.search(c.Model, c.arg(0, "domain"), c.Context())
+		if err != nil {
+			return nil, err
+		}
+		domain, _ := c.arg(0, "domain").([]interface{})
+		lazy := true
+		if v, ok := c.arg(6, "lazy").(bool); ok {
+			lazy = v
+		}
+		order, _ := c.arg(5, "orderby").(string)
+		groups, err := s.readGroup(c.Model, records, domain, toStrings(c.arg(1, "fields")), toStrings(c.arg(2, "groupby")), lazy, order)
+		if err != nil {
+			return nil, err
+		}
+		return paginate(groups, c.arg(3, "offset"), c.arg(4, "limit")), nil
+
+	case "name_search":
+		name, _ := c.arg(0, "name").(string)
+		operator, _ := c.arg(2, "operator").(string)
+		if operator == "" {
+			operator = "ilike"
+		}
+		limit := c.arg(3, "limit")
+		if limit == nil {
+			limit = 100
+		}
+		domain, _ := c.arg(1, "args").([]interface{})
+		records, err := s.find(c.Model, domain, c.Context(), nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result []interface{}
+		for _, r := range records {
+			if len(result) == toInt(limit) {
+				break
+			}
+			if display := s.displayName(c.Model, r.ID()); name == "" || compare(display, operator, name) {
+				result = append(result, []interface{}{r.ID(), display})
+			}
+		}
+		return result, nil
+
+	case "fields_get":
+		return s.fieldsGet(c.Model), nil
+
+	case "message_post":
+		return s.messagePost(c)
+
+	case "check_access_rights":
+		return true, nil
+	}
+
+	return nil, NewFault("builtins.AttributeError", fmt.Sprintf("The method '%s' does not exist on the model '%s'", c.Method, c.Model))
+}
+
+// search returns the records of a model matching a domain, in id order.
+// Archived records are left out unless the domain mentions active or the
+// context sets active_test to false. The caller holds s.mu.
+func (s *Server) search(model string, domainArg interface{}, context map[string]interface{}) ([]odoo.Record, error) {
+	domain, ok := domainArg.([]interface{})
+	if domainArg != nil && !ok {
+		if d, ok := domainArg.(odoo.Domain); ok {
+			domain = d
+		} else {
+			return nil, ValidationError(fmt.Sprintf("Invalid domain %v", domainArg))
+		}
+	}
+	match, err := s.compile(model, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	activeTest := true
+	if v, ok := context["active_test"].(bool); ok {
+		activeTest = v
+	}
+	for _, term := range domain {
+		if leaf, ok := term.([]interface{}); ok && len(leaf) == 3 && leaf[0] == "active" {
+			activeTest = false
+		}
+	}
+
+	t := s.table(model)
+	var records []odoo.Record
+	for _, id := range t.sortedIDs() {
+		r := t.records[id]
+		if activeTest {
+			if active, ok := r["active"]; ok && !truthy(active) {
+				continue
+			}
+		}
+		if match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// find searches, sorts and paginates records
+func (s *Server) find(model string, domain interface{}, context map[string]interface{}, offset, limit, order interface{}) ([]odoo.Record, error) {
+	records, err := s.search(model, domain, context)
+	if err != nil {
+		return nil, err
+	}
+	if clause, _ := order.(string); clause != "" {
+		if err := s.sortRecords(model, records, clause); err != nil {
+			return nil, err
+		}
+	}
+	return paginate(records, offset, limit), nil
+}
+
+// browse returns the records with the given ids, failing like Odoo when
+// one doesn't exist
+func (s *Server) browse(uid int, model string, idsArg interface{}) ([]odoo.Record, error) {
+	t := s.table(model)
+	var records []odoo.Record
+	var missing []int
+	for _, id := range toInts(idsArg) {
+		if r, ok := t.records[id]; ok {
+			records = append(records, r)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, MissingError(fmt.Sprintf("Record does not exist or has been deleted.\n(Record: %s%v, User: %d)", model, missing, uid))
+	}
+	return records, nil
+}
+
+// messagePost stores a mail.message on the record, like mail.thread does
+func (s *Server) messagePost(c *Call) (interface{}, error) {
+	records, err := s.browse(c.UID, c.Model, c.arg(0, "ids"))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, ValidationError("message_post expects a single record")
+	}
+
+	values := odoo.Record{
+		"model":         c.Model,
+		"res_id":        records[0].ID(),
+		"body":          c.Kwargs["body"],
+		"message_type":  "comment",
+		"subtype_xmlid": "mail.mt_note",
+	}
+	if v, ok := c.Kwargs["message_type"]; ok {
+		values["message_type"] = v
+	}
+	if v, ok := c.Kwargs["subtype_xmlid"]; ok {
+		values["subtype_xmlid"] = v
+	}
+	author := c.Kwargs["author_id"]
+	if author == nil {
+		author = s.table("res.users").records[c.UID]["partner_id"]
+	}
+	values["author_id"] = author
+	if v, ok := c.Kwargs["attachment_ids"]; ok {
+		values["attachment_ids"] = toInts(v)
+	}
+	return s.insert("mail.message", values, c.UID)
+}
+
+// fieldsGet describes the fields seen in a model's records, guessing their
+// type from the stored values
+func (s *Server) fieldsGet(model string) map[string]interface{} {
+	fields := map[string]interface{}{
+		"id":           map[string]interface{}{"type": "integer", "string": "ID"},
+		"display_name": map[string]interface{}{"type": "char", "string": "Display Name"},
+	}
+	for _, r := range s.table(model).records {
+		for name, v := range r {
+			if _, ok := fields[name]; ok && !isEmpty(v) {
+				continue
+			}
+			field := map[string]interface{}{"string": name, "type": guessType(v)}
+			if rel, ok := s.relation(model, name); ok {
+				field["relation"] = rel.Model
+				field["type"] = "many2one"
+				if rel.Many {
+					field["type"] = "many2many"
+				}
+			}
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+func guessType(v interface{}) string {
+	switch x := v.(type) {
+	case bool:
+		return "boolean"
+	case int, int64:
+		return "integer"
+	case float64:
+		if x == float64(int64(x)) {
+			return "integer"
+		}
+		return "float"
+	case string:
+		if _, err := parseDatetime(x); err == nil {
+			return "datetime"
+		}
+		if _, err := parseDate(x); err == nil {
+			return "date"
+		}
+	}
+	return "char"
+}
+
+func paginate[T any](items []T, offset, limit interface{}) []T {
+	start := toInt(offset)
+	if start > len(items) {
+		start = len(items)
+	}
+	items = items[start:]
+	if n := toInt(limit); n > 0 && n < len(items) {
+		items = items[:n]
+	}
+	return items
+}
+
+func ids(records []odoo.Record) []int {
+	result := make([]int, len(records))
+	for i, r := range records {
+		result[i] = r.ID()
+	}
+	return result
+}
+
+func toStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		return []string{list}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package odootest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Recorder is a fake Odoo for tests that only check the calls a service
+// makes. It answers model method calls with canned results, whatever their
+// arguments, and records them. Unlike Server it keeps no records.
+type Recorder struct {
+	mu      sync.Mutex
+	results map[string]interface{}
+	queued  map[string][]interface{}
+	calls   []Call
+
+	http *httptest.Server
+}
+
+// NewRecorder starts a recorder for the duration of a test, answering with
+// results keyed by "model.method". Calls without a result get null.
+func NewRecorder(t testing.TB, results map[string]interface{}) *Recorder {
+	if results == nil {
+		results = map[string]interface{}{}
+	}
+	r := &Recorder{results: results, queued: map[string][]interface{}{}}
+	r.http = httptest.NewServer(r)
+	t.Cleanup(r.http.Close)
+	return r
+}
+
+// Queue answers the next calls of a model method with results in turn,
+// before the result given for it if any
+func (r *Recorder) Queue(model, method string, results ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := model + "." + method
+	r.queued[key] = append(r.queued[key], results...)
+}
+
+// Client returns a client of the recorder, logged in as the administrator
+func (r *Recorder) Client() *odoo.Client {
+	return &odoo.Client{Name: "test", URL: r.http.URL, Database: "test", Username: AdminLogin, APIKey: AdminKey}
+}
+
+// Calls returns the model method calls received so far
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// Find returns the first call of a model method, or nil
+func (r *Recorder) Find(model, method string) *Call {
+	calls := r.Calls()
+	for i := range calls {
+		if calls[i].Model == model && calls[i].Method == method {
+			return &calls[i]
+		}
+	}
+	return nil
+}
+
+// Last returns the last call of a model method, or nil
+func (r *Recorder) Last(model, method string) *Call {
+	calls := r.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].Model == model && calls[i].Method == method {
+			return &calls[i]
+		}
+	}
+	return nil
+}
+
+// ServeHTTP answers /jsonrpc. The common service logs everyone in as the
+// administrator.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		ID     interface{} `json:"id"`
+		Params struct {
+			Service string        `json:"service"`
+			Method  string        `json:"method"`
+			Args    []interface{} `json:"args"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	var result interface{} = AdminID
+	if args := body.Params.Args; body.Params.Service == "object" && len(args) >= 5 {
+		result = r.answer(callOf(args))
+	} else if body.Params.Method == "version" {
+		result = map[string]interface{}{"server_version": "17.0", "server_version_info": []interface{}{17, 0, 0, "final", 0, ""}, "server_serie": "17.0"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": body.ID, "result": result})
+}
+
+// answer records a call and returns its result
+func (r *Recorder) answer(call Call) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+	key := call.Model + "." + call.Method
+	if queued := r.queued[key]; len(queued) > 0 {
+		r.queued[key] = queued[1:]
+		return queued[0]
+	}
+	return r.results[key]
+}
+
+// callOf reads the model method call of execute_kw arguments
+func callOf(args []interface{}) Call {
+	call := Call{UID: toInt(args[1]), Args: []interface{}{}, Kwargs: map[string]interface{}{}}
+	call.Model, _ = args[3].(string)
+	call.Method, _ = args[4].(string)
+	if len(args) > 5 {
+		if positional, ok := args[5].([]interface{}); ok {
+			call.Args = positional
+		}
+	}
+	if len(args) > 6 {
+		if kwargs, ok := args[6].(map[string]interface{}); ok {
+			call.Kwargs = kwargs
+		}
+	}
+	return call
+}
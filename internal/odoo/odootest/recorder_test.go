@@ -0,0 +1,39 @@
+package odootest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	a := assert.New(t)
+	r := NewRecorder(t, map[string]interface{}{
+		"res.partner.search_read": []map[string]interface{}{{"id": 7, "name": "Azure Interior"}},
+	})
+	r.Queue("crm.lead", "create", 42, 43)
+	client := r.Client()
+	ctx := context.Background()
+
+	partners, err := client.SearchRead(ctx, "res.partner", odoo.Domain{odoo.Cond("name", "ilike", "azure")}, []string{"name"}, nil)
+	if a.NoError(err) && a.Len(partners, 1) {
+		a.Equal("Azure Interior", partners[0].String("name"))
+	}
+
+	// Queued results are answered in turn, then null
+	for _, want := range []int{42, 43, 0} {
+		id, err := client.Create(ctx, "crm.lead", odoo.Record{"name": "Solar panels"})
+		a.NoError(err)
+		a.Equal(want, id)
+	}
+
+	a.Len(r.Calls(), 4)
+	if first := r.Find("crm.lead", "create"); a.NotNil(first) {
+		a.Equal(AdminID, first.UID)
+		a.Equal([]interface{}{map[string]interface{}{"name": "Solar panels"}}, first.Args)
+	}
+	a.Equal(&r.Calls()[3], r.Last("crm.lead", "create"))
+	a.Nil(r.Find("crm.lead", "write"))
+}
@@ -0,0 +1,471 @@
+// Package odootest provides an in-memory Odoo server for tests and local
+// development. It serves the external JSON-RPC and XML-RPC APIs from a
+// store of records seeded by the test or from fixtures, evaluates search
+// domains and implements the common ORM methods. Other methods can be
+// handled with Handle, and failures injected with Inject.
+package odootest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+const (
+	// AdminID is the user id of the seeded administrator, as in Odoo
+	AdminID = 2
+	// AdminLogin and AdminKey are the administrator's credentials
+	AdminLogin = "admin"
+	AdminKey   = "admin"
+
+	// initialDate is the create_date and write_date of the initial records
+	initialDate = "2000-01-01 00:00:00"
+)
+
+// Call is a model method call received by the server
+type Call struct {
+	UID    int
+	Model  string
+	Method string
+	Args   []interface{}
+	Kwargs map[string]interface{}
+}
+
+// Context returns the context keyword argument of the call
+func (c *Call) Context() map[string]interface{} {
+	context, _ := c.Kwargs["context"].(map[string]interface{})
+	return context
+}
+
+// Method implements a model method the server doesn't know, e.g.
+// "sale.order.action_confirm". Returning an *odoo.Fault sends it as is.
+type Method func(s *Server, call *Call) (interface{}, error)
+
+// Server is a fake Odoo
+type Server struct {
+	// Database is the only database the server accepts
+	Database string
+	// Version is the reported server version, e.g. "17.0". Fields the
+	// version doesn't have are refused, as Odoo does.
+	Version string
+	// Now is the clock of create_date and write_date
+	Now func() time.Time
+
+	mu        sync.Mutex
+	tables    map[string]*table
+	relations map[string]map[string]Relation
+	keys      map[int]string
+	methods   map[string]Method
+	faults    []*Injection
+	calls     []Call
+
+	http *httptest.Server
+}
+
+// New creates a server holding the main company, its administrator and
+// their contacts
+func New() *Server {
+	s := &Server{
+		Database:  "test",
+		Version:   "17.0",
+		Now:       time.Now,
+		tables:    map[string]*table{},
+		relations: map[string]map[string]Relation{},
+		keys:      map[int]string{},
+		methods:   map[string]Method{},
+	}
+	// The initial records predate anything a test creates
+	created := odoo.Record{"create_date": initialDate, "write_date": initialDate}
+	s.Seed("res.company", with(created, odoo.Record{"id": 1, "name": "My Company", "partner_id": 1, "currency_id": 1}))
+	s.Seed("res.currency", with(created, odoo.Record{"id": 1, "name": "USD", "symbol": "$"}))
+	s.Seed("res.partner",
+		with(created, odoo.Record{"id": 1, "name": "My Company", "is_company": true, "active": true}),
+		with(created, odoo.Record{"id": 3, "name": "Mitchell Admin", "email": "admin@example.com", "active": true}),
+	)
+	s.AddUser(with(created, odoo.Record{"id": AdminID, "login": AdminLogin, "partner_id": 3, "name": "Mitchell Admin", "tz": "UTC"}), AdminKey)
+	return s
+}
+
+// NewServer starts a server for the duration of a test
+func NewServer(t testing.TB) *Server {
+	s := New()
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Start serves the API on a local port
+func (s *Server) Start() {
+	s.http = httptest.NewServer(s)
+}
+
+// Close stops serving
+func (s *Server) Close() {
+	if s.http != nil {
+		s.http.Close()
+	}
+}
+
+// URL is the base URL of a started server
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Client returns a client of a started server, logged in as the administrator
+func (s *Server) Client() *odoo.Client {
+	return &odoo.Client{Name: "test", URL: s.URL(), Database: s.Database, Username: AdminLogin, APIKey: AdminKey}
+}
+
+// Seed stores records as they are, keeping their ids when they have one,
+// and returns their ids
+func (s *Server) Seed(model string, records ...odoo.Record) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int, len(records))
+	for i, r := range records {
+		id, err := s.insert(model, r, AdminID)
+		if err != nil {
+			panic(fmt.Sprintf("odootest: failed to seed %s: %v", model, err))
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// AddUser creates a res.users record that can log in with apiKey and
+// returns its id
+func (s *Server) AddUser(values odoo.Record, apiKey string) int {
+	values = copyRecord(values)
+	if _, ok := values["active"]; !ok {
+		values["active"] = true
+	}
+	if _, ok := values["share"]; !ok {
+		values["share"] = false
+	}
+	if _, ok := values["company_id"]; !ok {
+		values["company_id"] = 1
+		values["company_ids"] = []int{1}
+	}
+	uid := s.Seed("res.users", values)[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[uid] = apiKey
+	return uid
+}
+
+// Relate declares a relational field that isn't one of the usual ones
+func (s *Server) Relate(model, field string, relation Relation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.relations[model] == nil {
+		s.relations[model] = map[string]Relation{}
+	}
+	s.relations[model][field] = relation
+}
+
+// Handle implements a model method, replacing the built-in one if any
+func (s *Server) Handle(model, method string, fn Method) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[model+"."+method] = fn
+}
+
+// Inject makes the matching calls fail or slow down. Injections are
+// checked in order and the first matching one applies.
+func (s *Server) Inject(injection Injection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &injection)
+}
+
+// ClearInjections makes calls succeed again, e.g. once Odoo is back
+func (s *Server) ClearInjections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Calls returns the model method calls received so far
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call{}, s.calls...)
+}
+
+// Record returns a copy of a stored record, or nil
+func (s *Server) Record(model string, id int) odoo.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.table(model).records[id]; ok {
+		return copyRecord(r)
+	}
+	return nil
+}
+
+// Update writes values on a stored record, e.g. from a Method
+func (s *Server) Update(model string, id int, values odoo.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.browse(AdminID, model, id)
+	if err != nil {
+		return err
+	}
+	return s.update(model, records[0], values)
+}
+
+// Records returns copies of the stored records of a model matching
+// domain, archived ones included
+func (s *Server) Records(model string, domain odoo.Domain) []odoo.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.search(model, domain, map[string]interface{}{"active_test": false})
+	if err != nil {
+		panic(fmt.Sprintf("odootest: %v", err))
+	}
+	copies := make([]odoo.Record, len(records))
+	for i, r := range records {
+		copies[i] = copyRecord(r)
+	}
+	return copies
+}
+
+// with returns a copy of r with the values of other added
+func with(r, other odoo.Record) odoo.Record {
+	c := copyRecord(r)
+	for k, v := range other {
+		c[k] = v
+	}
+	return c
+}
+
+func copyRecord(r odoo.Record) odoo.Record {
+	c := make(odoo.Record, len(r))
+	for k, v := range r {
+		if ids, ok := v.([]int); ok {
+			v = append([]int{}, ids...)
+		}
+		c[k] = v
+	}
+	return c
+}
+
+// ServeHTTP answers /jsonrpc and the /xmlrpc/2 endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/jsonrpc":
+		s.serveJSONRPC(w, r)
+	case strings.HasPrefix(r.URL.Path, "/xmlrpc/"):
+		s.serveXMLRPC(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveJSONRPC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     interface{} `json:"id"`
+		Params struct {
+			Service string        `json:"service"`
+			Method  string        `json:"method"`
+			Args    []interface{} `json:"args"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	result, status, fault := s.dispatch(r.Context(), req.Params.Service, req.Params.Method, req.Params.Args)
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if fault != nil {
+		resp["error"] = fault
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// dispatch runs a call of one of the external services, applying injected
+// failures. A non-zero status is an HTTP error to answer with instead.
+func (s *Server) dispatch(ctx context.Context, service, method string, args []interface{}) (interface{}, int, *odoo.Fault) {
+	model, modelMethod := "", method
+	if service == "object" && len(args) >= 5 {
+		model, _ = args[3].(string)
+		modelMethod, _ = args[4].(string)
+	}
+
+	if injection := s.injection(model, modelMethod); injection != nil {
+		if injection.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, 0, nil
+			case <-time.After(injection.Delay):
+			}
+		}
+		if injection.Status != 0 {
+			return nil, injection.Status, nil
+		}
+		if injection.Fault != nil {
+			return nil, 0, injection.Fault
+		}
+	}
+
+	var result interface{}
+	var err error
+	switch service {
+	case "common":
+		result, err = s.common(method, args)
+	case "object":
+		result, err = s.object(method, args)
+	default:
+		err = NewFault("builtins.KeyError", fmt.Sprintf("'%s'", service))
+	}
+	if err != nil {
+		if fault, ok := err.(*odoo.Fault); ok {
+			return nil, 0, fault
+		}
+		return nil, 0, NewFault("builtins.Exception", err.Error())
+	}
+	return result, 0, nil
+}
+
+// injection returns the injected failure for a call, if any
+func (s *Server) injection(model, method string) *Injection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, injection := range s.faults {
+		if !injection.matches(model, method) {
+			continue
+		}
+		if injection.Times > 0 {
+			if injection.Times--; injection.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return injection
+	}
+	return nil
+}
+
+// common implements the common service: version, authenticate and login
+func (s *Server) common(method string, args []interface{}) (interface{}, error) {
+	switch method {
+	case "version":
+		major, minor := s.versionInfo()
+		return map[string]interface{}{
+			"server_version":      s.Version,
+			"server_version_info": []interface{}{major, minor, 0, "final", 0, ""},
+			"server_serie":        fmt.Sprintf("%d.%d", major, minor),
+			"protocol_version":    1,
+		}, nil
+	case "authenticate", "login":
+		if len(args) < 3 {
+			return nil, NewFault("builtins.TypeError", method+"() missing required arguments")
+		}
+		db, _ := args[0].(string)
+		login, _ := args[1].(string)
+		key, _ := args[2].(string)
+		if db != s.Database {
+			return nil, NewFault("psycopg2.OperationalError", fmt.Sprintf("database %q does not exist", db))
+		}
+		if uid := s.uid(login, key); uid != 0 {
+			return uid, nil
+		}
+		// Odoo answers false rather than a fault for wrong credentials
+		return false, nil
+	}
+	return nil, NewFault("builtins.NameError", fmt.Sprintf("method %q is not supported by the common service", method))
+}
+
+// versionInfo returns the major and minor version
+func (s *Server) versionInfo() (int, int) {
+	major, minor, _ := strings.Cut(strings.TrimPrefix(s.Version, "saas~"), ".")
+	m, _ := strconv.Atoi(major)
+	n, _ := strconv.Atoi(minor)
+	return m, n
+}
+
+// uid returns the active user with these credentials, or 0
+func (s *Server) uid(login, key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, user := range s.table("res.users").records {
+		if user["login"] == login && s.keys[id] == key && truthy(user["active"]) {
+			return id
+		}
+	}
+	return 0
+}
+
+// object implements the object service: execute_kw and execute
+func (s *Server) object(method string, args []interface{}) (interface{}, error) {
+	if method != "execute_kw" && method != "execute" {
+		return nil, NewFault("builtins.NameError", fmt.Sprintf("method %q is not supported by the object service", method))
+	}
+	if len(args) < 5 {
+		return nil, NewFault("builtins.TypeError", method+"() missing required arguments")
+	}
+	db, _ := args[0].(string)
+	if db != s.Database {
+		return nil, NewFault("psycopg2.OperationalError", fmt.Sprintf("database %q does not exist", db))
+	}
+	uid := toInt(args[1])
+	key, _ := args[2].(string)
+	s.mu.Lock()
+	valid := uid != 0 && s.keys[uid] == key
+	s.mu.Unlock()
+	if !valid {
+		return nil, AccessDenied()
+	}
+
+	call := Call{UID: uid, Kwargs: map[string]interface{}{}}
+	call.Model, _ = args[3].(string)
+	call.Method, _ = args[4].(string)
+	if method == "execute_kw" {
+		if len(args) > 5 {
+			call.Args, _ = args[5].([]interface{})
+		}
+		if len(args) > 6 {
+			if kwargs, ok := args[6].(map[string]interface{}); ok {
+				call.Kwargs = kwargs
+			}
+		}
+	} else {
+		call.Args = args[5:]
+	}
+	if call.Args == nil {
+		call.Args = []interface{}{}
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	fn := s.methods[call.Model+"."+call.Method]
+	err := s.checkFields(&call)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		return fn(s, &call)
+	}
+	return s.execute(&call)
+}
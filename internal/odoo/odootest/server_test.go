@@ -0,0 +1,315 @@
+package odootest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/stretchr/testify/assert"
+)
+
+func seedPartners(s *Server) {
+	s.Seed("res.partner",
+		odoo.Record{"id": 7, "name": "Azure Interior", "is_company": true, "city": "Singapore", "active": true, "credit_limit": 5000.0},
+		odoo.Record{"id": 8, "name": "Brandon Freeman", "parent_id": 7, "phone": "+65 9876 5432", "active": true},
+		odoo.Record{"id": 9, "name": "Deco Addict", "is_company": true, "city": "Kuala Lumpur", "active": true, "credit_limit": 1000.0},
+		odoo.Record{"id": 10, "name": "Old Supplier", "is_company": true, "active": false},
+	)
+}
+
+func names(records []odoo.Record) []string {
+	var result []string
+	for _, r := range records {
+		result = append(result, r.String("name"))
+	}
+	return result
+}
+
+func TestSearchReadDomains(t *testing.T) {
+	a := assert.New(t)
+	s := NewServer(t)
+	seedPartners(s)
+	client := s.Client()
+	ctx := context.Background()
+
+	tests := []struct {
+		domain odoo.Domain
+		want   []string
+	}{
+		{odoo.Domain{odoo.Cond("name", "ilike", "azure")}, []string{"Azure Interior"}},
+		// As in Odoo, != also matches empty values
+		{odoo.Domain{odoo.Cond("is_company", "=", true), odoo.Cond("city", "!=", "Singapore")}, []string{"My Company", "Deco Addict"}},
+		{odoo.Domain{"|", odoo.Cond("city", "=", "Singapore"), odoo.Cond("city", "=", "Kuala Lumpur")}, []string{"Azure Interior", "Deco Addict"}},
+		{odoo.Domain{"!", odoo.Cond("is_company", "=", true)}, []string{"Mitchell Admin", "Brandon Freeman"}},
+		{odoo.Domain{odoo.Cond("id", "child_of", 7)}, []string{"Azure Interior", "Brandon Freeman"}},
+		{odoo.Domain{odoo.Cond("parent_id.city", "=", "Singapore")}, []string{"Brandon Freeman"}},
+		{odoo.Domain{odoo.Cond("parent_id", "ilike", "azure")}, []string{"Brandon Freeman"}},
+		{odoo.Domain{odoo.Cond("phone", "=", false), odoo.Cond("id", "in", []int{1, 8, 9})}, []string{"My Company", "Deco Addict"}},
+		{odoo.Domain{odoo.Cond("credit_limit", ">=", 1000)}, []string{"Azure Interior", "Deco Addict"}},
+		{odoo.Domain{odoo.Cond("name", "=ilike", "d%t")}, []string{"Deco Addict"}},
+		{odoo.Domain{odoo.Cond("active", "=", false)}, []string{"Old Supplier"}},
+	}
+	for _, tt := range tests {
+		records, err := client.SearchRead(ctx, "res.partner", tt.domain, []string{"name"}, nil)
+		if a.NoError(err, "%v", tt.domain) {
+			a.Equal(tt.want, names(records), "%v", tt.domain)
+		}
+	}
+
+	records, err := client.SearchRead(ctx, "res.partner", odoo.Domain{odoo.Cond("is_company", "=", true)}, []string{"name", "parent_id"},
+		&odoo.SearchOptions{Order: "name desc", Limit: 2, Context: map[string]interface{}{"active_test": false}})
+	if a.NoError(err) {
+		a.Equal([]string{"Old Supplier", "My Company"}, names(records))
+	}
+
+	records, err = client.SearchRead(ctx, "res.partner", odoo.Domain{odoo.Cond("id", "=", 8)}, []string{"display_name", "parent_id"}, nil)
+	if a.NoError(err) && a.Len(records, 1) {
+		a.Equal("Azure Interior, Brandon Freeman", records[0].String("display_name"))
+		id, name := records[0].Many2one("parent_id")
+		a.Equal(7, id)
+		a.Equal("Azure Interior", name)
+	}
+
+	_, err = client.SearchRead(ctx, "res.partner", odoo.Domain{odoo.Cond("name", "~", "x")}, []string{"name"}, nil)
+	a.ErrorContains(err, "Invalid domain operator")
+}
+
+func TestCreateWriteUnlink(t *testing.T) {
+	a := assert.New(t)
+	s := NewServer(t)
+	seedPartners(s)
+	s.Now = func() time.Time { return time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC) }
+	s.Seed("res.partner.category", odoo.Record{"id": 1, "name": "VIP"}, odoo.Record{"id": 2, "name": "Reseller"})
+	s.Relate("res.partner", "category_id", ParseRelation("category_id", "many2many:res.partner.category"))
+	client := s.Client()
+	ctx := context.Background()
+
+	id, err := client.Create(ctx, "res.partner", map[string]interface{}{
+		"name":        "Gemini Furniture",
+		"parent_id":   7,
+		"category_id": []interface{}{[]interface{}{6, 0, []int{1}}},
+	})
+	a.NoError(err)
+	a.Equal(11, id, "ids follow the seeded ones")
+
+	a.NoError(client.Write(ctx, "res.partner", []int{id}, map[string]interface{}{
+		"city":        "Singapore",
+		"category_id": []interface{}{[]interface{}{4, 2}, []interface{}{3, 1}},
+	}))
+	record := s.Record("res.partner", id)
+	a.Equal("Singapore", record["city"])
+	a.Equal([]int{2}, record["category_id"])
+	a.Equal("2025-03-12 09:00:00", record["write_date"])
+	a.Equal(AdminID, record["write_uid"])
+
+	a.NoError(client.Unlink(ctx, "res.partner", []int{id}))
+	a.Nil(s.Record("res.partner", id))
+
+	var fault *odoo.Fault
+	err = client.Write(ctx, "res.partner", []int{id}, map[string]interface{}{"city": "Paris"})
+	if a.True(errors.As(err, &fault)) {
+		a.Equal("odoo.exceptions.MissingError", fault.Data.Name)
+	}
+}
+
+func TestReadGroup(t *testing.T) {
+	a := assert.New(t)
+	s := NewServer(t)
+	seedPartners(s)
+	s.Seed("sale.order",
+		odoo.Record{"name": "S00001", "partner_id": 7, "amount_total": 100.0, "date_order": "2025-02-20 10:00:00", "state": "sale"},
+		odoo.Record{"name": "S00002", "partner_id": 9, "amount_total": 250.0, "date_order": "2025-03-02 10:00:00", "state": "sale"},
+		odoo.Record{"name": "S00003", "partner_id": 7, "amount_total": 300.0, "date_order": "2025-03-10 10:00:00", "state": "sale"},
+		odoo.Record{"name": "S00004", "partner_id": 9, "amount_total": 999.0, "date_order": "2025-03-11 10:00:00", "state": "cancel"},
+	)
+	client := s.Client()
+	ctx := context.Background()
+	sold := odoo.Domain{odoo.Cond("state", "=", "sale")}
+
+	groups, err := client.ReadGroup(ctx, "sale.order", sold, []string{"amount_total:sum"}, []string{"partner_id"},
+		&odoo.SearchOptions{Order: "amount_total desc"})
+	if a.NoError(err) && a.Len(groups, 2) {
+		_, name := groups[0].Many2one("partner_id")
+		a.Equal("Azure Interior", name)
+		a.Equal(400.0, groups[0].Float("amount_total"))
+		a.Equal(2, groups[0].Int("__count"))
+	}
+
+	groups, err = client.ReadGroup(ctx, "sale.order", sold, []string{"amount_total:sum"}, []string{"date_order:month"}, nil)
+	if a.NoError(err) && a.Len(groups, 2) {
+		a.Equal("February 2025", groups[0].String("date_order:month"))
+		a.Equal("March 2025", groups[1].String("date_order:month"))
+		a.Equal(550.0, groups[1].Float("amount_total"))
+	}
+
+	groups, err = client.ReadGroup(ctx, "sale.order", sold, []string{"amount_total:max"}, nil, nil)
+	if a.NoError(err) && a.Len(groups, 1) {
+		a.Equal(300.0, groups[0].Float("amount_total"))
+		a.Equal(3, groups[0].Int("__count"))
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	a := assert.New(t)
+	s := NewServer(t)
+	uid := s.AddUser(odoo.Record{"login": "marc", "name": "Marc Demo"}, "marc-key")
+	client := s.Client()
+	ctx := context.Background()
+
+	got, err := client.Login(ctx, "marc", "marc-key")
+	a.NoError(err)
+	a.Equal(uid, got)
+	_, err = client.Login(ctx, "marc", "wrong")
+	a.ErrorContains(err, "invalid credentials")
+
+	// Calls as a user need their own key
+	userCtx := odoo.WithUser(ctx, &odoo.User{ID: uid, APIKey: "admin"})
+	_, err = client.SearchRead(userCtx, "res.partner", nil, []string{"name"}, nil)
+	a.ErrorContains(err, "Access Denied")
+
+	userCtx = odoo.WithUser(ctx, &odoo.User{ID: uid, APIKey: "marc-key"})
+	_, err = client.SearchRead(userCtx, "res.partner", nil, []string{"name"}, nil)
+	a.NoError(err)
+	calls := s.Calls()
+	a.Equal(uid, calls[len(calls)-1].UID)
+
+	info, err := client.Version(ctx)
+	if a.NoError(err) {
+		a.Equal("17.0", info.ServerSerie)
+	}
+}
+
+func TestInjectAndHandle(t *testing.T) {
+	a := assert.New(t)
+	s := NewServer(t)
+	seedPartners(s)
+	client := s.Client()
+	ctx := context.Background()
+
+	s.Inject(Injection{Model: "res.partner", Method: "write", Fault: ValidationError("The phone number is invalid"), Times: 1})
+	err := client.Write(ctx, "res.partner", []int{7}, map[string]interface{}{"phone": "x"})
+	a.ErrorContains(err, "The phone number is invalid")
+	a.NoError(client.Write(ctx, "res.partner", []int{7}, map[string]interface{}{"phone": "x"}), "the injection only applied once")
+
+	s.Inject(Injection{Status: 502, Times: 1})
+	_, err = client.SearchRead(ctx, "res.partner", nil, []string{"name"}, nil)
+	a.ErrorContains(err, "status 502")
+
+	s.Inject(Injection{Method: "search_read", Delay: time.Second, Times: 1})
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = client.SearchRead(timeout, "res.partner", nil, []string{"name"}, nil)
+	a.ErrorIs(err, context.DeadlineExceeded)
+
+	err = client.ExecuteKW(ctx, "sale.order", "action_confirm", []interface{}{[]int{1}}, nil, nil)
+	a.ErrorContains(err, "The method 'action_confirm' does not exist")
+
+	s.Seed("sale.order", odoo.Record{"id": 1, "name": "S00001", "state": "draft"})
+	s.Handle("sale.order", "action_confirm", func(s *Server, call *Call) (interface{}, error) {
+		for _, id := range toInts(call.Args[0]) {
+			if err := s.Update("sale.order", id, odoo.Record{"state": "sale"}); err != nil {
+				return nil, err
+			}
+		}
+		return true, nil
+	})
+	a.NoError(client.ExecuteKW(ctx, "sale.order", "action_confirm", []interface{}{[]int{1}}, nil, nil))
+	a.Equal("sale", s.Record("sale.order", 1)["state"])
+
+	messageID, err := client.MessagePost(ctx, "sale.order", 1, "Confirmed on WhatsApp", true)
+	a.NoError(err)
+	message := s.Record("mail.message", messageID)
+	a.Equal("Confirmed on WhatsApp", message["body"])
+	a.Equal(3, message["author_id"], "the administrator's partner")
+}
+
+func TestLoadFile(t *testing.T) {
+	a := assert.New(t)
+	path := t.TempDir() + "/fixtures.json"
+	a.NoError(os.WriteFile(path, []byte(`{
+		"relations": {"res.partner": {"category_id": "many2many:res.partner.category"}},
+		"records": {
+			"res.partner.category": [{"id": 1, "name": "VIP"}],
+			"res.partner": [{"id": 7, "name": "Azure Interior", "category_id": [1]}]
+		},
+		"users": [{"login": "marc", "name": "Marc Demo", "api_key": "marc-key"}]
+	}`), 0o600))
+
+	s := NewServer(t)
+	a.NoError(s.LoadFile(path))
+	a.Equal([]int{1}, s.Record("res.partner", 7)["category_id"])
+
+	records, err := s.Client().SearchRead(context.Background(), "res.partner", odoo.Domain{odoo.Cond("category_id.name", "=", "VIP")}, []string{"name"}, nil)
+	if a.NoError(err) {
+		a.Equal([]string{"Azure Interior"}, names(records))
+	}
+	_, err = s.Client().Login(context.Background(), "marc", "marc-key")
+	a.NoError(err)
+}
+
+func TestVersions(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	for _, version := range []string{"15.0", "16.0", "17.0", "18.0"} {
+		s := NewServer(t)
+		s.Version = version
+		s.Seed("res.partner", odoo.Record{"id": 8, "name": "Brandon Freeman", "phone": "+6598765432"})
+		client := s.Client()
+
+		adapter, err := client.Detect(ctx)
+		if !a.NoError(err, version) {
+			continue
+		}
+		a.True(adapter.Supported(), version)
+
+		partner, err := client.PartnerByPhone(ctx, "6598765432", []string{"name", "mobile"})
+		if a.NoError(err, version) && a.NotNil(partner, version) {
+			a.Equal("Brandon Freeman", partner.String("name"), version)
+		}
+		_, err = client.SearchRead(ctx, "helpdesk.ticket", nil, []string{"name", "ticket_ref"}, nil)
+		a.NoError(err, version)
+
+		// Locked orders are found whether they have a state or a flag
+		locked := odoo.Record{"id": 3, "name": "S00003", "state": "sale", "locked": true}
+		if adapter.Major < 17 {
+			locked = odoo.Record{"id": 3, "name": "S00003", "state": "done"}
+		}
+		s.Seed("sale.order", odoo.Record{"id": 2, "name": "S00002", "state": "sale"}, locked)
+		orders, err := client.SearchRead(ctx, "sale.order", odoo.Domain{odoo.Cond("locked", "=", true)}, []string{"name", "locked"}, nil)
+		if a.NoError(err, version) && a.Len(orders, 1, version) {
+			a.Equal("S00003", orders[0].String("name"), version)
+		}
+		orders, err = client.SearchRead(ctx, "sale.order", odoo.Domain{odoo.Cond("state", "=", "sale")}, []string{"name"}, nil)
+		if a.NoError(err, version) {
+			a.Len(orders, 2, version)
+		}
+
+		_, err = client.Create(ctx, "hr.leave", odoo.Record{"employee_id": 4, "request_date_from": "2025-03-14", "request_date_to": "2025-03-14"})
+		a.NoError(err, version)
+	}
+
+	// Versions refuse the states and missing times they don't have
+	s := NewServer(t)
+	s.Version = "16.0"
+	_, err := s.Client().Create(ctx, "sale.order", odoo.Record{"name": "S00004", "state": "done"})
+	a.NoError(err)
+	s.Version = "17.0"
+	_, err = s.Client().Create(ctx, "sale.order", odoo.Record{"name": "S00005", "state": "done"})
+	a.ErrorContains(err, "Wrong value for sale.order.state: 'done'")
+	s.Version = "15.0"
+	_, err = s.Client().Create(ctx, "hr.leave", odoo.Record{"employee_id": 4, "request_date_from": "2025-03-14", "request_date_to": "2025-03-14"})
+	a.ErrorContains(err, `null value in column "date_from" of relation "hr_leave"`)
+
+	// Until the version is detected calls go out as they are
+	s = NewServer(t)
+	s.Version = "18.0"
+	_, err = s.Client().PartnerByPhone(ctx, "6598765432", []string{"name"})
+	a.ErrorContains(err, "Invalid field 'mobile' on model 'res.partner'")
+	a.Equal("warehouse_id", s.WarehouseKey())
+	s.Version = "16.0"
+	a.Equal("warehouse", s.WarehouseKey())
+}
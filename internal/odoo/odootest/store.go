@@ -0,0 +1,366 @@
+package odootest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Relation describes a relational field: a many2one when Many is false,
+// otherwise a one2many or many2many holding a list of ids
+type Relation struct {
+	Model string
+	Many  bool
+}
+
+// ParseRelation parses the relation of a fixture, e.g. "res.partner",
+// "many2one:res.partner" or "many2many:res.partner.category". A bare model
+// is a many2many for fields ending in _ids.
+func ParseRelation(field, spec string) Relation {
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok {
+		return Relation{Model: spec, Many: strings.HasSuffix(field, "_ids")}
+	}
+	return Relation{Model: target, Many: kind != "many2one"}
+}
+
+// defaultRelations are the relational fields most models share, so that
+// fixtures only declare the others
+var defaultRelations = map[string]Relation{
+	"partner_id":            {Model: "res.partner"},
+	"commercial_partner_id": {Model: "res.partner"},
+	"author_id":             {Model: "res.partner"},
+	"user_id":               {Model: "res.users"},
+	"create_uid":            {Model: "res.users"},
+	"write_uid":             {Model: "res.users"},
+	"company_id":            {Model: "res.company"},
+	"currency_id":           {Model: "res.currency"},
+	"country_id":            {Model: "res.country"},
+	"product_id":            {Model: "product.product"},
+	"product_tmpl_id":       {Model: "product.template"},
+	"uom_id":                {Model: "uom.uom"},
+	"employee_id":           {Model: "hr.employee"},
+	"partner_ids":           {Model: "res.partner", Many: true},
+	"user_ids":              {Model: "res.users", Many: true},
+	"company_ids":           {Model: "res.company", Many: true},
+	"groups_id":             {Model: "res.groups", Many: true},
+	"attachment_ids":        {Model: "ir.attachment", Many: true},
+}
+
+// table holds the records of one model
+type table struct {
+	records map[int]odoo.Record
+	nextID  int
+}
+
+func (s *Server) table(model string) *table {
+	t, ok := s.tables[model]
+	if !ok {
+		t = &table{records: map[int]odoo.Record{}, nextID: 1}
+		s.tables[model] = t
+	}
+	return t
+}
+
+// relation returns the relation of a field, if it is relational
+func (s *Server) relation(model, field string) (Relation, bool) {
+	if r, ok := s.relations[model][field]; ok {
+		return r, true
+	}
+	if field == "parent_id" {
+		return Relation{Model: model}, true
+	}
+	if field == "child_ids" {
+		return Relation{Model: model, Many: true}, true
+	}
+	r, ok := defaultRelations[field]
+	return r, ok
+}
+
+// sortedIDs returns the ids of a model's records in ascending order
+func (t *table) sortedIDs() []int {
+	ids := make([]int, 0, len(t.records))
+	for id := range t.records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// insert stores a new record and returns its id. The caller holds s.mu.
+func (s *Server) insert(model string, values odoo.Record, uid int) (int, error) {
+	t := s.table(model)
+	id := toInt(values["id"])
+	if id == 0 {
+		id = t.nextID
+	}
+	if _, exists := t.records[id]; exists {
+		return 0, ValidationError(fmt.Sprintf("%s(%d) already exists", model, id))
+	}
+	if id >= t.nextID {
+		t.nextID = id + 1
+	}
+
+	now := s.Now().UTC().Format(odoo.DatetimeFormat)
+	record := odoo.Record{"id": id, "create_date": now, "write_date": now, "create_uid": uid, "write_uid": uid}
+	t.records[id] = record
+	if err := s.update(model, record, values); err != nil {
+		delete(t.records, id)
+		return 0, err
+	}
+	return id, nil
+}
+
+// update writes values on a stored record. The caller holds s.mu.
+func (s *Server) update(model string, record odoo.Record, values odoo.Record) error {
+	for field, value := range values {
+		if field == "id" {
+			continue
+		}
+		stored, err := s.normalize(model, field, record[field], value)
+		if err != nil {
+			return err
+		}
+		record[field] = stored
+	}
+	return nil
+}
+
+// normalize turns a written value into its stored form: ids for many2one
+// fields and id lists for x2many fields, applying Odoo's x2many commands
+func (s *Server) normalize(model, field string, current, value interface{}) (interface{}, error) {
+	rel, ok := s.relation(model, field)
+	if !ok {
+		return value, nil
+	}
+	if !rel.Many {
+		if pair, ok := value.([]interface{}); ok && len(pair) > 0 {
+			value = pair[0]
+		}
+		if id := toInt(value); id != 0 {
+			return id, nil
+		}
+		return false, nil
+	}
+
+	ids := toInts(current)
+	list, _ := value.([]interface{})
+	if ints, ok := value.([]int); ok {
+		return ints, nil
+	}
+	for _, item := range list {
+		command, ok := item.([]interface{})
+		if !ok {
+			// A plain list of ids replaces the current ones
+			return toInts(list), nil
+		}
+		if len(command) == 0 {
+			continue
+		}
+		var arg1, arg2 interface{}
+		if len(command) > 1 {
+			arg1 = command[1]
+		}
+		if len(command) > 2 {
+			arg2 = command[2]
+		}
+
+		switch toInt(command[0]) {
+		case 0: // create
+			values, _ := arg2.(map[string]interface{})
+			id, err := s.insert(rel.Model, odoo.Record(values), 0)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		case 1: // update
+			target, ok := s.table(rel.Model).records[toInt(arg1)]
+			if !ok {
+				return nil, MissingError(fmt.Sprintf("%s(%d) does not exist", rel.Model, toInt(arg1)))
+			}
+			values, _ := arg2.(map[string]interface{})
+			if err := s.update(rel.Model, target, odoo.Record(values)); err != nil {
+				return nil, err
+			}
+		case 2: // delete
+			delete(s.table(rel.Model).records, toInt(arg1))
+			ids = without(ids, toInt(arg1))
+		case 3: // unlink
+			ids = without(ids, toInt(arg1))
+		case 4: // link
+			if !contains(ids, toInt(arg1)) {
+				ids = append(ids, toInt(arg1))
+			}
+		case 5: // clear
+			ids = nil
+		case 6: // set
+			ids = toInts(arg2)
+		}
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	return ids, nil
+}
+
+// read returns the given fields of a record the way Odoo's read does, or
+// all of its fields when none are given. The caller holds s.mu.
+func (s *Server) read(model string, record odoo.Record, fields []string) odoo.Record {
+	if len(fields) == 0 {
+		for field := range record {
+			fields = append(fields, field)
+		}
+		fields = append(fields, "display_name")
+	}
+
+	result := odoo.Record{"id": record.ID()}
+	for _, field := range fields {
+		result[field] = s.value(model, record, field)
+	}
+	return result
+}
+
+// value returns one field of a record as Odoo returns it: [id, name] for
+// many2one fields and false for empty values
+func (s *Server) value(model string, record odoo.Record, field string) interface{} {
+	if field == "display_name" {
+		return s.displayName(model, record.ID())
+	}
+	v, ok := record[field]
+	if !ok || v == nil {
+		if rel, ok := s.relation(model, field); ok && rel.Many {
+			return []int{}
+		}
+		return false
+	}
+
+	rel, ok := s.relation(model, field)
+	switch {
+	case !ok:
+		return v
+	case rel.Many:
+		return toInts(v)
+	}
+	id := toInt(v)
+	if id == 0 {
+		return false
+	}
+	return []interface{}{id, s.displayName(rel.Model, id)}
+}
+
+// displayName returns a record's display_name, computed from its name like
+// Odoo does when it isn't stored
+func (s *Server) displayName(model string, id int) string {
+	record, ok := s.table(model).records[id]
+	if !ok {
+		return ""
+	}
+	if name, ok := record["display_name"].(string); ok && name != "" {
+		return name
+	}
+	name, _ := record["name"].(string)
+	if name == "" {
+		return fmt.Sprintf("%s,%d", model, id)
+	}
+	// Contacts of a company are shown with it
+	if model == "res.partner" && !truthy(record["is_company"]) {
+		if parentID := toInt(record["parent_id"]); parentID != 0 && parentID != id {
+			return s.displayName(model, parentID) + ", " + name
+		}
+	}
+	return name
+}
+
+func parseDatetime(s string) (time.Time, error) {
+	return time.Parse(odoo.DatetimeFormat, s)
+}
+
+func parseDate(s string) (time.Time, error) {
+	return time.Parse(time.DateOnly, s)
+}
+
+// toInt converts the numbers JSON-RPC and XML-RPC decode to an int
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// toInts converts an id or a list of ids to a slice of ints
+func toInts(v interface{}) []int {
+	switch list := v.(type) {
+	case []int:
+		return append([]int{}, list...)
+	case []interface{}:
+		ids := make([]int, 0, len(list))
+		for _, item := range list {
+			if id := toInt(item); id != 0 {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	if id := toInt(v); id != 0 {
+		return []int{id}
+	}
+	return []int{}
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func without(ids []int, id int) []int {
+	kept := ids[:0]
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// truthy reports whether a value is set in Odoo's sense
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		return x != ""
+	case int, int64, float64:
+		return toFloat(x) != 0
+	case []int:
+		return len(x) > 0
+	case []interface{}:
+		return len(x) > 0
+	}
+	return true
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
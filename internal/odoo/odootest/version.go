@@ -0,0 +1,126 @@
+package odootest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// missingFields are the fields some versions of Odoo don't have, by model,
+// with the versions that have them
+var missingFields = map[string]map[string]func(major int) bool{
+	"res.partner":     {"mobile": before(18)},
+	"res.users":       {"mobile": before(18)},
+	"helpdesk.ticket": {"ticket_ref": since(16)},
+	"sale.order":      {"locked": since(17)},
+	"hr.expense":      {"total_amount_currency": since(17)},
+}
+
+// missingStates are the selection values some versions don't have, by model
+// and field, with the versions that have them
+var missingStates = map[string]map[string]map[string]func(major int) bool{
+	"sale.order":   {"state": {"done": before(17)}},
+	"sale.report":  {"state": {"done": before(17)}},
+	"account.move": {"payment_state": {"blocked": since(18)}},
+}
+
+// computedFields are the fields Odoo computes on create in some versions
+// only, by model, with the versions that need them set
+var computedFields = map[string]map[string]func(major int) bool{
+	// Leaves get their times from the request dates since 16
+	"hr.leave": {"date_from": before(16), "date_to": before(16)},
+}
+
+func before(major int) func(int) bool { return func(m int) bool { return m < major } }
+func since(major int) func(int) bool  { return func(m int) bool { return m >= major } }
+
+// hasField reports whether the emulated version has a field of a model
+func (s *Server) hasField(model, field string) bool {
+	has, ok := missingFields[model][field]
+	if !ok {
+		return true
+	}
+	major, _ := s.versionInfo()
+	return has(major)
+}
+
+// WarehouseKey is the context key stock quantities are computed for a
+// warehouse with in the emulated version, for methods that compute them
+func (s *Server) WarehouseKey() string {
+	if major, _ := s.versionInfo(); major < 17 {
+		return "warehouse"
+	}
+	return "warehouse_id"
+}
+
+// checkFields refuses the calls that name fields or states the emulated
+// version doesn't have, or that leave out fields it doesn't compute, as Odoo
+// does. Domains are checked when compiled.
+func (s *Server) checkFields(c *Call) error {
+	var fields []string
+	var written []map[string]interface{}
+	switch c.Method {
+	case "search_read", "read":
+		fields = toStrings(c.arg(1, "fields"))
+	case "read_group":
+		fields = append(toStrings(c.arg(1, "fields")), toStrings(c.arg(2, "groupby"))...)
+	case "create":
+		switch values := c.arg(0, "vals_list").(type) {
+		case map[string]interface{}:
+			written = append(written, values)
+		case []interface{}:
+			for _, v := range values {
+				m, _ := v.(map[string]interface{})
+				written = append(written, m)
+			}
+		}
+	case "write":
+		values, _ := c.arg(1, "vals").(map[string]interface{})
+		written = append(written, values)
+	}
+	for _, values := range written {
+		fields = append(fields, keys(values)...)
+	}
+	for _, f := range fields {
+		if err := s.checkField(c.Model, f); err != nil {
+			return err
+		}
+	}
+
+	major, _ := s.versionInfo()
+	for _, values := range written {
+		for field, value := range values {
+			state, _ := value.(string)
+			if has, ok := missingStates[c.Model][field][state]; ok && !has(major) {
+				return NewFault("builtins.ValueError", fmt.Sprintf("Wrong value for %s.%s: '%s'", c.Model, field, state))
+			}
+		}
+		if c.Method != "create" {
+			continue
+		}
+		for field, needed := range computedFields[c.Model] {
+			if _, set := values[field]; !set && needed(major) {
+				return NewFault("psycopg2.errors.NotNullViolation", fmt.Sprintf(
+					`null value in column "%s" of relation "%s" violates not-null constraint`, field, strings.ReplaceAll(c.Model, ".", "_")))
+			}
+		}
+	}
+	return nil
+}
+
+// checkField refuses a field, or the first field of a path
+func (s *Server) checkField(model, path string) error {
+	field, _, _ := strings.Cut(path, ".")
+	field, _, _ = strings.Cut(field, ":")
+	if !s.hasField(model, field) {
+		return NewFault("builtins.ValueError", fmt.Sprintf("Invalid field '%s' on model '%s'", field, model))
+	}
+	return nil
+}
+
+func keys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
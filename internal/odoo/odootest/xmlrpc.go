@@ -0,0 +1,228 @@
+package odootest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// xmlValue is an XML-RPC value of any type
+type xmlValue struct {
+	Int      *string    `xml:"int"`
+	I4       *string    `xml:"i4"`
+	I8       *string    `xml:"i8"`
+	Boolean  *string    `xml:"boolean"`
+	String   *string    `xml:"string"`
+	Double   *string    `xml:"double"`
+	DateTime *string    `xml:"dateTime.iso8601"`
+	Base64   *string    `xml:"base64"`
+	Nil      *struct{}  `xml:"nil"`
+	Array    *xmlArray  `xml:"array"`
+	Struct   *xmlStruct `xml:"struct"`
+	Text     string     `xml:",chardata"`
+}
+
+type xmlArray struct {
+	Values []xmlValue `xml:"data>value"`
+}
+
+type xmlStruct struct {
+	Members []struct {
+		Name  string   `xml:"name"`
+		Value xmlValue `xml:"value"`
+	} `xml:"member"`
+}
+
+type methodCall struct {
+	Method string     `xml:"methodName"`
+	Params []xmlValue `xml:"params>param>value"`
+}
+
+// decode converts an XML-RPC value to the types JSON decoding produces,
+// except that integers stay ints
+func (v xmlValue) decode() (interface{}, error) {
+	switch {
+	case v.Int != nil, v.I4 != nil, v.I8 != nil:
+		text := firstOf(v.Int, v.I4, v.I8)
+		n, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %q", text)
+		}
+		return n, nil
+	case v.Boolean != nil:
+		return strings.TrimSpace(*v.Boolean) == "1", nil
+	case v.String != nil:
+		return *v.String, nil
+	case v.Double != nil:
+		f, err := strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double %q", *v.Double)
+		}
+		return f, nil
+	case v.DateTime != nil:
+		return strings.TrimSpace(*v.DateTime), nil
+	case v.Base64 != nil:
+		return strings.TrimSpace(*v.Base64), nil
+	case v.Nil != nil:
+		return nil, nil
+	case v.Array != nil:
+		list := make([]interface{}, len(v.Array.Values))
+		for i, item := range v.Array.Values {
+			decoded, err := item.decode()
+			if err != nil {
+				return nil, err
+			}
+			list[i] = decoded
+		}
+		return list, nil
+	case v.Struct != nil:
+		m := make(map[string]interface{}, len(v.Struct.Members))
+		for _, member := range v.Struct.Members {
+			decoded, err := member.Value.decode()
+			if err != nil {
+				return nil, err
+			}
+			m[member.Name] = decoded
+		}
+		return m, nil
+	}
+	// A value without a type is a string
+	return v.Text, nil
+}
+
+func firstOf(values ...*string) string {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return ""
+}
+
+// serveXMLRPC answers /xmlrpc/2/common and /xmlrpc/2/object
+func (s *Server) serveXMLRPC(w http.ResponseWriter, r *http.Request) {
+	var call methodCall
+	if err := xml.NewDecoder(r.Body).Decode(&call); err != nil {
+		http.Error(w, "invalid XML-RPC request", http.StatusBadRequest)
+		return
+	}
+	args := make([]interface{}, len(call.Params))
+	for i, p := range call.Params {
+		v, err := p.decode()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args[i] = v
+	}
+
+	result, status, fault := s.dispatch(r.Context(), path.Base(r.URL.Path), call.Method, args)
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?>` + "\n<methodResponse>")
+	if fault != nil {
+		b.WriteString("<fault>")
+		code, text := xmlFault(fault)
+		writeXMLValue(&b, map[string]interface{}{"faultCode": code, "faultString": text})
+		b.WriteString("</fault>")
+	} else {
+		// Results are normalized like a JSON-RPC response would be
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var normalized interface{}
+		json.Unmarshal(data, &normalized)
+		b.WriteString("<params><param>")
+		writeXMLValue(&b, normalized)
+		b.WriteString("</param></params>")
+	}
+	b.WriteString("</methodResponse>\n")
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(b.Bytes())
+}
+
+// xmlFault returns the faultCode and faultString Odoo sends for a fault:
+// 3 for invalid credentials, 2 with the message for the exceptions meant
+// for users, and 1 with the traceback for the others
+func xmlFault(fault *odoo.Fault) (int, string) {
+	switch {
+	case fault.Data.Name == "odoo.exceptions.AccessDenied":
+		return 3, fault.Data.Message
+	case exceptionTypes[fault.Data.Name] != "":
+		return 2, fault.Data.Message
+	case fault.Data.Debug != "":
+		return 1, fault.Data.Debug
+	}
+	return 1, fault.Message
+}
+
+func writeXMLValue(b *bytes.Buffer, v interface{}) {
+	b.WriteString("<value>")
+	switch x := v.(type) {
+	case nil:
+		b.WriteString("<nil/>")
+	case bool:
+		if x {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case int:
+		fmt.Fprintf(b, "<int>%d</int>", x)
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<31 {
+			fmt.Fprintf(b, "<int>%d</int>", int64(x))
+		} else {
+			fmt.Fprintf(b, "<double>%s</double>", strconv.FormatFloat(x, 'f', -1, 64))
+		}
+	case string:
+		b.WriteString("<string>")
+		xml.EscapeText(b, []byte(x))
+		b.WriteString("</string>")
+	case []byte:
+		fmt.Fprintf(b, "<base64>%s</base64>", base64.StdEncoding.EncodeToString(x))
+	case []interface{}:
+		b.WriteString("<array><data>")
+		for _, item := range x {
+			writeXMLValue(b, item)
+		}
+		b.WriteString("</data></array>")
+	case map[string]interface{}:
+		names := make([]string, 0, len(x))
+		for name := range x {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("<struct>")
+		for _, name := range names {
+			b.WriteString("<member><name>")
+			xml.EscapeText(b, []byte(name))
+			b.WriteString("</name>")
+			writeXMLValue(b, x[name])
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	default:
+		b.WriteString("<string>")
+		xml.EscapeText(b, []byte(fmt.Sprint(x)))
+		b.WriteString("</string>")
+	}
+	b.WriteString("</value>")
+}
@@ -0,0 +1,66 @@
+package odootest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, url, body string) string {
+	resp, err := http.Post(url, "text/xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return string(data)
+}
+
+func TestXMLRPC(t *testing.T) {
+	a := assert.New(t)
+	s := NewServer(t)
+	s.Seed("res.partner", odoo.Record{"id": 7, "name": "Azure & Co", "credit_limit": 2500.5, "active": true})
+
+	resp := post(t, s.URL()+"/xmlrpc/2/common", `<?xml version="1.0"?>
+<methodCall><methodName>authenticate</methodName><params>
+<param><value><string>test</string></value></param>
+<param><value><string>admin</string></value></param>
+<param><value><string>admin</string></value></param>
+<param><value><struct></struct></value></param>
+</params></methodCall>`)
+	a.Contains(resp, "<params><param><value><int>2</int></value></param></params>")
+
+	resp = post(t, s.URL()+"/xmlrpc/2/object", `<?xml version="1.0"?>
+<methodCall><methodName>execute_kw</methodName><params>
+<param><value><string>test</string></value></param>
+<param><value><int>2</int></value></param>
+<param><value>admin</value></param>
+<param><value><string>res.partner</string></value></param>
+<param><value><string>search_read</string></value></param>
+<param><value><array><data><value><array><data><value><array><data>
+  <value><string>name</string></value><value><string>ilike</string></value><value><string>azure</string></value>
+</data></array></value></data></array></value></data></array></value></param>
+<param><value><struct><member><name>fields</name><value><array><data>
+  <value><string>name</string></value><value><string>credit_limit</string></value>
+</data></array></value></member></struct></value></param>
+</params></methodCall>`)
+	a.Contains(resp, "<member><name>credit_limit</name><value><double>2500.5</double></value></member>")
+	a.Contains(resp, "<member><name>id</name><value><int>7</int></value></member>")
+	a.Contains(resp, "<string>Azure &amp; Co</string>")
+
+	resp = post(t, s.URL()+"/xmlrpc/2/object", `<?xml version="1.0"?>
+<methodCall><methodName>execute_kw</methodName><params>
+<param><value><string>test</string></value></param>
+<param><value><int>2</int></value></param>
+<param><value><string>wrong</string></value></param>
+<param><value><string>res.partner</string></value></param>
+<param><value><string>search</string></value></param>
+<param><value><array><data></data></array></value></param>
+</params></methodCall>`)
+	a.Contains(resp, "<fault>")
+	a.Contains(resp, "<member><name>faultCode</name><value><int>3</int></value></member>")
+}
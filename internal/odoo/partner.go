@@ -0,0 +1,60 @@
+package odoo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// E164 formats a WhatsApp id (country code and number, no plus) the way Odoo
+// stores sanitized phone numbers
+func E164(waID string) string {
+	return "+" + strings.TrimPrefix(waID, "+")
+}
+
+// PhoneDomain matches records whose phone or mobile number is the given
+// WhatsApp id
+func PhoneDomain(waID string) Domain {
+	number := E164(waID)
+	return Domain{
+		"|", "|",
+		Cond("phone_sanitized", "=", number),
+		Cond("phone", "=", number),
+		Cond("mobile", "=", number),
+	}
+}
+
+// PartnerByPhone returns the contact reachable on the given WhatsApp id, or
+// nil when the number is unknown
+func (c *Client) PartnerByPhone(ctx context.Context, waID string, fields []string) (Record, error) {
+	records, err := c.SearchRead(ctx, "res.partner", PhoneDomain(waID), fields, &SearchOptions{Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search partner: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+// EmployeeByPhone returns the employee reachable on the given WhatsApp id,
+// either through the phone of their Odoo user or their own work numbers, or
+// nil when the number doesn't belong to an employee
+func (c *Client) EmployeeByPhone(ctx context.Context, waID string, fields []string) (Record, error) {
+	number := E164(waID)
+	domain := Domain{
+		"|", "|",
+		Cond("user_id.phone_sanitized", "=", number),
+		Cond("mobile_phone", "=", number),
+		Cond("work_phone", "=", number),
+	}
+
+	records, err := c.SearchRead(ctx, "hr.employee", domain, fields, &SearchOptions{Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search employee: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
@@ -0,0 +1,64 @@
+package odoo
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// WriteQueue keeps the writes made while Odoo is unreachable, to replay
+// them once it is back. It is implemented by *outbox.Outbox.
+type WriteQueue interface {
+	Enqueue(ctx context.Context, call QueuedCall) error
+}
+
+// QueuedCall is a write waiting for Odoo
+type QueuedCall struct {
+	Model  string                 `json:"model"`
+	Method string                 `json:"method"`
+	Args   []interface{}          `json:"args"`
+	Kwargs map[string]interface{} `json:"kwargs"`
+	// UserID is the user the call was made as, or 0 for the service account
+	UserID int `json:"user_id,omitempty"`
+	// Requester is the WhatsApp id told of the outcome
+	Requester string `json:"requester"`
+	// Summary describes the write to the requester, e.g. "2h on Website"
+	Summary string `json:"summary"`
+}
+
+// ErrQueued means a write was saved to be replayed when Odoo is back
+var ErrQueued = errors.New("odoo is unreachable, the write is queued")
+
+type queueKey struct{}
+
+type queued struct {
+	requester string
+	summary   string
+}
+
+// Queueable returns a context whose writes are queued when Odoo can't be
+// reached, telling requester of the outcome of summary once they are
+// replayed. Writes are only queued when the caller doesn't need their
+// result, such as a timesheet that is logged and forgotten.
+func Queueable(ctx context.Context, requester, summary string) context.Context {
+	return context.WithValue(ctx, queueKey{}, queued{requester: requester, summary: summary})
+}
+
+// enqueue queues a write that failed because Odoo is unreachable, when its
+// context allows it, and returns ErrQueued once it is
+func (c *Client) enqueue(ctx context.Context, model, method string, args []interface{}, kwargs map[string]interface{}) error {
+	q, ok := ctx.Value(queueKey{}).(queued)
+	if !ok || c.Queue == nil {
+		return nil
+	}
+
+	call := QueuedCall{Model: model, Method: method, Args: args, Kwargs: kwargs, Requester: q.requester, Summary: q.summary}
+	if user := UserFrom(ctx); user != nil && user.APIKey != "" {
+		call.UserID = user.ID
+	}
+	if err := c.Queue.Enqueue(ctx, call); err != nil {
+		log.Printf("Failed to queue %s.%s: %v", model, method, err)
+		return nil
+	}
+	return ErrQueued
+}
@@ -0,0 +1,398 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client talks to an Odoo server over its external JSON-RPC API
+type Client struct {
+	// Name identifies the connection when waOdoo serves several databases
+	Name       string
+	URL        string
+	Database   string
+	Username   string
+	APIKey     string
+	HTTPClient *http.Client
+	// CompanyIDs, when set, are the allowed_company_ids of every call on a
+	// multi-company database, the first being the current company
+	CompanyIDs []int
+	Limits
+	// Queue, when set, keeps the writes of Queueable contexts made while
+	// Odoo is unreachable
+	Queue WriteQueue
+
+	mu        sync.Mutex
+	uid       int
+	requestID atomic.Int64
+	slotsOnce sync.Once
+	slots     chan struct{}
+	reads     readCache
+	known     readCache
+	adapter   atomic.Pointer[Adapter]
+}
+
+// NewClient creates an Odoo client configured from the environment
+func NewClient() *Client {
+	return &Client{
+		Name:       "default",
+		URL:        strings.TrimSuffix(os.Getenv("ODOO_URL"), "/"),
+		Database:   os.Getenv("ODOO_DB"),
+		Username:   os.Getenv("ODOO_USERNAME"),
+		APIKey:     os.Getenv("ODOO_API_KEY"),
+		HTTPClient: &http.Client{},
+		CompanyIDs: parseIDs(os.Getenv("ODOO_COMPANY_IDS")),
+		Limits:     LimitsFromEnv(),
+	}
+}
+
+// parseIDs parses a comma-separated list of ids, skipping invalid ones
+func parseIDs(s string) []int {
+	var ids []int
+	for _, field := range strings.Split(s, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(field)); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// call invokes a method of one of Odoo's external services (common, object,
+// db) and decodes its result into result, which may be nil
+func (c *Client) call(ctx context.Context, service, method string, args []interface{}, result interface{}) error {
+	data, err := c.send(ctx, service, method, args)
+	if err != nil {
+		return err
+	}
+	return c.decode(service, method, data, result)
+}
+
+func (c *Client) decode(service, method string, data json.RawMessage, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("failed to decode %s.%s result: %w", service, method, err)
+	}
+	return nil
+}
+
+// send posts a JSON-RPC request within the client's limits and returns the
+// raw result
+func (c *Client) send(ctx context.Context, service, method string, args []interface{}) (json.RawMessage, error) {
+	requestBody := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "call",
+		"params": map[string]interface{}{
+			"service": service,
+			"method":  method,
+			"args":    args,
+		},
+		"id": c.requestID.Add(1),
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	callCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	// A deadline of the call rather than of the caller means Odoo is slow
+	timedOut := func(err error) error {
+		if ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %s", ErrTimeout, c.Timeout)
+		}
+		return err
+	}
+
+	release, err := c.acquire(callCtx)
+	if err != nil {
+		return nil, timedOut(fmt.Errorf("failed to wait for odoo: %w", err))
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(callCtx, "POST", c.URL+"/jsonrpc", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if unreachable(err) {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if err != nil {
+		return nil, timedOut(fmt.Errorf("failed to send request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, timedOut(fmt.Errorf("failed to read response: %w", err))
+	}
+
+	// Proxies in front of Odoo answer these while it restarts
+	if resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("%w (status %d)", ErrUnavailable, resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("odoo error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var rpcResp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Fault          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &rpcResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if rpcResp.Error != nil {
+		return nil, rpcResp.Error
+	}
+	return rpcResp.Result, nil
+}
+
+// Version returns the server version reported by the common service
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if err := c.call(ctx, "common", "version", []interface{}{}, &info); err != nil {
+		return nil, fmt.Errorf("failed to get odoo version: %w", err)
+	}
+	return &info, nil
+}
+
+// Authenticate logs in with the configured credentials and caches the user id
+func (c *Client) Authenticate(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.uid != 0 {
+		return c.uid, nil
+	}
+
+	uid, err := c.Login(ctx, c.Username, c.APIKey)
+	if err != nil {
+		return 0, err
+	}
+	c.uid = uid
+	return c.uid, nil
+}
+
+// Login checks the credentials of any user and returns their user id
+func (c *Client) Login(ctx context.Context, login, apiKey string) (int, error) {
+	// Odoo answers false instead of a fault when the credentials are wrong
+	var result interface{}
+	args := []interface{}{c.Database, login, apiKey, map[string]interface{}{}}
+	if err := c.call(ctx, "common", "authenticate", args, &result); err != nil {
+		return 0, fmt.Errorf("failed to authenticate: %w", err)
+	}
+	uid, ok := result.(float64)
+	if !ok || uid == 0 {
+		return 0, fmt.Errorf("failed to authenticate: invalid credentials for %s", login)
+	}
+	return int(uid), nil
+}
+
+// ExecuteKW calls a model method through the object service and decodes the
+// result into result, which may be nil when the caller doesn't need it. The
+// call is made as the user of ctx when it has one with an API key.
+func (c *Client) ExecuteKW(ctx context.Context, model, method string, args []interface{}, kwargs map[string]interface{}, result interface{}) error {
+	uid, apiKey := 0, c.APIKey
+	if user := UserFrom(ctx); user != nil && user.APIKey != "" {
+		uid, apiKey = user.ID, user.APIKey
+	} else {
+		var err error
+		if uid, err = c.Authenticate(ctx); err != nil {
+			return err
+		}
+	}
+
+	if args == nil {
+		args = []interface{}{}
+	}
+	if kwargs == nil {
+		kwargs = map[string]interface{}{}
+	}
+	// Queued writes keep waOdoo's names, the version may change meanwhile
+	sentArgs, sentKwargs := c.Adapter().adapt(model, method, args, kwargs)
+	if companies := c.companies(ctx); len(companies) > 0 {
+		sentKwargs = withCompanies(sentKwargs, companies)
+	}
+
+	callArgs := []interface{}{c.Database, uid, apiKey, model, method, sentArgs, sentKwargs}
+	cached := readMethods[method] && c.CacheTTL > 0
+	lastKnown := readMethods[method] && isLastKnown(ctx)
+	var key string
+	if cached || lastKnown {
+		var ok bool
+		if key, ok = cacheKey(callArgs); !ok {
+			cached, lastKnown = false, false
+		}
+	}
+	if cached && !isFresh(ctx) {
+		if data, ok := c.reads.get(key, time.Now()); ok {
+			return c.decode(model, method, data, result)
+		}
+	}
+
+	data, err := c.send(ctx, "object", "execute_kw", callArgs)
+	if err != nil {
+		if lastKnown && errors.Is(err, ErrUnavailable) {
+			if data, ok := c.known.get(key, time.Now()); ok {
+				return c.decode(model, method, data, result)
+			}
+		}
+		if !readMethods[method] && errors.Is(err, ErrUnavailable) {
+			if queued := c.enqueue(ctx, model, method, args, kwargs); queued != nil {
+				return &CallError{Model: model, Method: method, Err: queued}
+			}
+		}
+		return &CallError{Model: model, Method: method, Err: err}
+	}
+	if lastKnown {
+		c.known.put(key, data, time.Now(), lastKnownFor)
+	}
+	if cached {
+		c.reads.put(key, data, time.Now(), c.CacheTTL)
+	} else if !readMethods[method] {
+		c.reads.clear()
+	}
+	return c.decode(model, method, data, result)
+}
+
+// companies returns the allowed companies of calls made with ctx: the
+// active company of its user, or else the client's
+func (c *Client) companies(ctx context.Context) []int {
+	if user := UserFrom(ctx); user != nil && user.CompanyID != 0 {
+		return []int{user.CompanyID}
+	}
+	return c.CompanyIDs
+}
+
+// withCompanies returns a copy of kwargs whose context has
+// allowed_company_ids, unless the caller already set them
+func withCompanies(kwargs map[string]interface{}, companies []int) map[string]interface{} {
+	odooContext := map[string]interface{}{}
+	if existing, ok := kwargs["context"].(map[string]interface{}); ok {
+		if _, ok := existing["allowed_company_ids"]; ok {
+			return kwargs
+		}
+		for k, v := range existing {
+			odooContext[k] = v
+		}
+	}
+	odooContext["allowed_company_ids"] = companies
+
+	copied := make(map[string]interface{}, len(kwargs)+1)
+	for k, v := range kwargs {
+		copied[k] = v
+	}
+	copied["context"] = odooContext
+	return copied
+}
+
+// SearchRead returns the records of model matching domain
+func (c *Client) SearchRead(ctx context.Context, model string, domain Domain, fields []string, opts *SearchOptions) ([]Record, error) {
+	if domain == nil {
+		domain = Domain{}
+	}
+	kwargs := map[string]interface{}{
+		"fields": fields,
+	}
+	if opts != nil {
+		if opts.Limit > 0 {
+			kwargs["limit"] = opts.Limit
+		}
+		if opts.Offset > 0 {
+			kwargs["offset"] = opts.Offset
+		}
+		if opts.Order != "" {
+			kwargs["order"] = opts.Order
+		}
+		if opts.Context != nil {
+			kwargs["context"] = opts.Context
+		}
+	}
+
+	var records []Record
+	if err := c.ExecuteKW(ctx, model, "search_read", []interface{}{domain}, kwargs, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Read returns the given fields of the records with the given ids
+func (c *Client) Read(ctx context.Context, model string, ids []int, fields []string, odooContext map[string]interface{}) ([]Record, error) {
+	kwargs := map[string]interface{}{
+		"fields": fields,
+	}
+	if odooContext != nil {
+		kwargs["context"] = odooContext
+	}
+
+	var records []Record
+	if err := c.ExecuteKW(ctx, model, "read", []interface{}{ids}, kwargs, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Create creates a record and returns its id
+func (c *Client) Create(ctx context.Context, model string, values map[string]interface{}) (int, error) {
+	var id int
+	if err := c.ExecuteKW(ctx, model, "create", []interface{}{values}, nil, &id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Write updates the records with the given ids
+func (c *Client) Write(ctx context.Context, model string, ids []int, values map[string]interface{}) error {
+	return c.ExecuteKW(ctx, model, "write", []interface{}{ids, values}, nil, nil)
+}
+
+// Unlink deletes the records with the given ids
+func (c *Client) Unlink(ctx context.Context, model string, ids []int) error {
+	return c.ExecuteKW(ctx, model, "unlink", []interface{}{ids}, nil, nil)
+}
+
+// Ref returns the database id of a record from its external id, e.g.
+// "purchase.group_purchase_manager"
+func (c *Client) Ref(ctx context.Context, xmlID string) (int, error) {
+	module, name, ok := strings.Cut(xmlID, ".")
+	if !ok {
+		return 0, fmt.Errorf("invalid external id %q", xmlID)
+	}
+
+	records, err := c.SearchRead(ctx, "ir.model.data", Domain{
+		Cond("module", "=", module),
+		Cond("name", "=", name),
+	}, []string{"res_id"}, &SearchOptions{Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve %s: %w", xmlID, err)
+	}
+	if len(records) == 0 {
+		return 0, fmt.Errorf("external id %s not found", xmlID)
+	}
+	return records[0].Int("res_id"), nil
+}
@@ -0,0 +1,365 @@
+package odoo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer answers JSON-RPC calls with handle's result, or with a fault
+// when handle returns one
+func newTestServer(t *testing.T, handle func(service, method string, args []interface{}) (interface{}, *Fault)) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64 `json:"id"`
+			Params struct {
+				Service string        `json:"service"`
+				Method  string        `json:"method"`
+				Args    []interface{} `json:"args"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("invalid request: %v", err)
+		}
+
+		result, fault := handle(req.Params.Service, req.Params.Method, req.Params.Args)
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if fault != nil {
+			resp["error"] = fault
+		} else {
+			resp["result"] = result
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return &Client{URL: server.URL, Database: "test", Username: "admin", APIKey: "secret"}
+}
+
+func TestSearchRead(t *testing.T) {
+	a := assert.New(t)
+	var executeArgs []interface{}
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" && method == "authenticate" {
+			return 2, nil
+		}
+		executeArgs = args
+		return []map[string]interface{}{
+			{"id": 7, "name": "Desk", "uom_id": []interface{}{1, "Units"}, "barcode": false},
+		}, nil
+	})
+
+	records, err := client.SearchRead(context.Background(), "product.product",
+		Domain{Cond("name", "ilike", "desk")}, []string{"name", "uom_id", "barcode"}, &SearchOptions{Limit: 5})
+
+	if a.NoError(err) && a.Len(records, 1) {
+		a.Equal(7, records[0].ID())
+		a.Equal("Desk", records[0].String("name"))
+		a.Equal("", records[0].String("barcode"))
+		id, name := records[0].Many2one("uom_id")
+		a.Equal(1, id)
+		a.Equal("Units", name)
+	}
+
+	// execute_kw receives db, uid, key, model, method, args, kwargs
+	if a.Len(executeArgs, 7) {
+		a.Equal(float64(2), executeArgs[1])
+		a.Equal("product.product", executeArgs[3])
+		a.Equal("search_read", executeArgs[4])
+		a.Equal(float64(5), executeArgs[6].(map[string]interface{})["limit"])
+	}
+}
+
+func TestReadGroup(t *testing.T) {
+	a := assert.New(t)
+	var executeArgs []interface{}
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" && method == "authenticate" {
+			return 2, nil
+		}
+		executeArgs = args
+		return []map[string]interface{}{
+			{"user_id": []interface{}{2, "Mitchell Admin"}, "amount_total": 1500.0, "__count": 3},
+		}, nil
+	})
+
+	groups, err := client.ReadGroup(context.Background(), "sale.order", nil,
+		[]string{"amount_total:sum"}, []string{"user_id"}, &SearchOptions{Order: "amount_total desc"})
+	if a.NoError(err) && a.Len(groups, 1) {
+		a.Equal(3, groups[0].Int("__count"))
+		a.Equal(1500.0, groups[0].Float("amount_total"))
+	}
+
+	if a.Len(executeArgs, 7) {
+		a.Equal("read_group", executeArgs[4])
+		a.Equal([]interface{}{[]interface{}{}, []interface{}{"amount_total:sum"}, []interface{}{"user_id"}}, executeArgs[5])
+		kwargs := executeArgs[6].(map[string]interface{})
+		a.Equal(false, kwargs["lazy"])
+		a.Equal("amount_total desc", kwargs["orderby"])
+	}
+}
+
+func TestAuthenticateInvalidCredentials(t *testing.T) {
+	a := assert.New(t)
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		return false, nil
+	})
+
+	_, err := client.Authenticate(context.Background())
+	a.ErrorContains(err, "invalid credentials")
+}
+
+func TestExecuteKWFault(t *testing.T) {
+	a := assert.New(t)
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" {
+			return 2, nil
+		}
+		return nil, &Fault{
+			Code:    200,
+			Message: "Odoo Server Error",
+			Data: FaultData{
+				Name:    "odoo.exceptions.AccessError",
+				Message: "You are not allowed to access 'Product' (product.product) records.",
+			},
+		}
+	})
+
+	_, err := client.Create(context.Background(), "product.product", map[string]interface{}{"name": "Desk"})
+
+	var fault *Fault
+	if a.True(errors.As(err, &fault), "error should wrap a *Fault") {
+		a.Equal("odoo.exceptions.AccessError", fault.Data.Name)
+	}
+	a.Contains(err.Error(), "product.product.create failed")
+}
+
+func TestExecuteKWAsUser(t *testing.T) {
+	a := assert.New(t)
+	var authenticated bool
+	var executeArgs []interface{}
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" && method == "authenticate" {
+			authenticated = true
+			return 2, nil
+		}
+		executeArgs = args
+		return true, nil
+	})
+
+	ctx := WithUser(context.Background(), &User{ID: 9, Login: "ana", APIKey: "ana-key"})
+	a.NoError(client.Write(ctx, "res.partner", []int{3}, map[string]interface{}{"name": "Azure"}))
+	a.False(authenticated)
+	if a.Len(executeArgs, 7) {
+		a.Equal(float64(9), executeArgs[1])
+		a.Equal("ana-key", executeArgs[2])
+	}
+
+	// Without an API key the service account is used
+	ctx = WithUser(context.Background(), &User{ID: 9, Login: "ana"})
+	a.NoError(client.Write(ctx, "res.partner", []int{3}, map[string]interface{}{"name": "Azure"}))
+	a.True(authenticated)
+	if a.Len(executeArgs, 7) {
+		a.Equal(float64(2), executeArgs[1])
+		a.Equal("secret", executeArgs[2])
+	}
+}
+
+func TestExecuteKWAllowedCompanies(t *testing.T) {
+	a := assert.New(t)
+	var kwargs map[string]interface{}
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" {
+			return 2, nil
+		}
+		kwargs = args[6].(map[string]interface{})
+		return []interface{}{}, nil
+	})
+	client.CompanyIDs = []int{1, 3}
+	ctx := context.Background()
+
+	_, err := client.SearchRead(ctx, "sale.order", nil, []string{"name"}, &SearchOptions{Context: map[string]interface{}{"lang": "fr_FR"}})
+	a.NoError(err)
+	a.Equal(map[string]interface{}{"lang": "fr_FR", "allowed_company_ids": []interface{}{float64(1), float64(3)}}, kwargs["context"])
+
+	// The user's active company wins over the client's
+	_, err = client.SearchRead(WithUser(ctx, &User{ID: 9, CompanyID: 3}), "sale.order", nil, []string{"name"}, nil)
+	a.NoError(err)
+	a.Equal(map[string]interface{}{"allowed_company_ids": []interface{}{float64(3)}}, kwargs["context"])
+
+	// Callers can still choose the companies themselves
+	_, err = client.SearchRead(ctx, "res.company", nil, []string{"name"}, &SearchOptions{Context: map[string]interface{}{"allowed_company_ids": []int{1, 2, 3}}})
+	a.NoError(err)
+	a.Equal(map[string]interface{}{"allowed_company_ids": []interface{}{float64(1), float64(2), float64(3)}}, kwargs["context"])
+}
+
+func TestExecuteKWCachesReads(t *testing.T) {
+	a := assert.New(t)
+	calls := map[string]int{}
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" {
+			return 2, nil
+		}
+		calls[args[4].(string)]++
+		if args[4] == "write" {
+			return true, nil
+		}
+		return []map[string]interface{}{{"id": 7, "name": "Desk"}}, nil
+	})
+	client.CacheTTL = time.Minute
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		records, err := client.Read(ctx, "product.product", []int{7}, []string{"name"}, nil)
+		a.NoError(err)
+		a.Equal("Desk", records[0].String("name"))
+	}
+	a.Equal(1, calls["read"])
+
+	// Other arguments and writes miss the cache
+	_, err := client.Read(ctx, "product.product", []int{8}, []string{"name"}, nil)
+	a.NoError(err)
+	a.NoError(client.Write(ctx, "product.product", []int{7}, map[string]interface{}{"name": "Desk XL"}))
+	a.NoError(client.Write(ctx, "product.product", []int{7}, map[string]interface{}{"name": "Desk XL"}))
+	_, err = client.Read(ctx, "product.product", []int{7}, []string{"name"}, nil)
+	a.NoError(err)
+	a.Equal(3, calls["read"])
+	a.Equal(2, calls["write"])
+
+	// Fresh reads always ask Odoo
+	_, err = client.Read(Fresh(ctx), "product.product", []int{7}, []string{"name"}, nil)
+	a.NoError(err)
+	a.Equal(4, calls["read"])
+}
+
+func TestExecuteKWLastKnown(t *testing.T) {
+	a := assert.New(t)
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" {
+			return 2, nil
+		}
+		return []map[string]interface{}{{"id": 7, "name": "Ana Lopez"}}, nil
+	})
+	ctx := context.Background()
+	_, err := client.SearchRead(LastKnown(ctx), "hr.employee", nil, []string{"name"}, nil)
+	a.NoError(err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+	client.URL = server.URL
+
+	employees, err := client.SearchRead(LastKnown(ctx), "hr.employee", nil, []string{"name"}, nil)
+	if a.NoError(err) && a.Len(employees, 1) {
+		a.Equal("Ana Lopez", employees[0].String("name"))
+	}
+
+	// Other reads still fail, as do last known reads never made before
+	_, err = client.SearchRead(ctx, "hr.employee", nil, []string{"name"}, nil)
+	a.ErrorIs(err, ErrUnavailable)
+	_, err = client.SearchRead(LastKnown(ctx), "hr.employee", nil, []string{"name", "work_phone"}, nil)
+	a.ErrorIs(err, ErrUnavailable)
+}
+
+func TestExecuteKWTimeout(t *testing.T) {
+	a := assert.New(t)
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "object" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return 2, nil
+	})
+	client.Timeout = 50 * time.Millisecond
+	client.MaxConcurrent = 1
+
+	_, err := client.SearchRead(context.Background(), "res.partner", nil, []string{"name"}, nil)
+	a.ErrorIs(err, ErrTimeout)
+}
+
+func TestExecuteKWUnavailable(t *testing.T) {
+	a := assert.New(t)
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		return 2, nil
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+	client.URL = server.URL
+
+	_, err := client.Version(context.Background())
+	a.ErrorIs(err, ErrUnavailable)
+
+	server.Close()
+	_, err = client.Version(context.Background())
+	a.ErrorIs(err, ErrUnavailable)
+}
+
+func TestAdapt(t *testing.T) {
+	a := assert.New(t)
+	args := []interface{}{Domain{"|", Cond("mobile", "=", "+6591112222"), Cond("parent_id.mobile", "=", "+6591112222")}, []string{"name", "phone", "mobile"}}
+	kwargs := map[string]interface{}{"context": map[string]interface{}{"warehouse_id": 1}}
+
+	// 17 is waOdoo's own
+	sent, sentKwargs := NewAdapter("17.0", 17).adapt("res.partner", "search_read", args, kwargs)
+	a.Equal(args, sent)
+	a.Equal(kwargs, sentKwargs)
+
+	sent, sentKwargs = NewAdapter("18.0", 18).adapt("res.partner", "search_read", args, kwargs)
+	a.Equal(Domain{"|", []interface{}{"phone", "=", "+6591112222"}, Cond("parent_id.mobile", "=", "+6591112222")}, sent[0])
+	a.Equal(kwargs, sentKwargs)
+
+	sent, _ = NewAdapter("18.0", 18).adapt("res.partner", "read", []interface{}{[]int{7}, []string{"name", "phone", "mobile"}}, nil)
+	a.Equal([]string{"name", "phone"}, sent[1])
+
+	_, sentKwargs = NewAdapter("16.0", 16).adapt("product.product", "search_read", args, kwargs)
+	a.Equal(map[string]interface{}{"warehouse": 1}, sentKwargs["context"])
+
+	sent, _ = NewAdapter("15.0", 15).adapt("helpdesk.ticket", "create", []interface{}{map[string]interface{}{"name": "Broken desk", "ticket_ref": "42"}}, nil)
+	a.Equal([]interface{}{map[string]interface{}{"name": "Broken desk"}}, sent)
+
+	// Replayed calls carry their fields as []interface{}
+	sent, _ = NewAdapter("18.0", 18).adapt("res.partner", "read", []interface{}{[]interface{}{7}, []interface{}{"name", "mobile"}}, nil)
+	a.Equal([]string{"name", "phone"}, sent[1])
+
+	// Locked sale orders were in the "done" state before 17
+	orders := Domain{Cond("state", "=", "sale"), Cond("locked", "=", true)}
+	sent, sentKwargs = NewAdapter("16.0", 16).adapt("sale.order", "search_read", []interface{}{orders}, map[string]interface{}{"fields": []string{"name", "locked"}})
+	a.Equal(Domain{[]interface{}{"state", "in", []string{"sale", "done"}}, []interface{}{"state", "=", "done"}}, sent[0])
+	a.Equal([]string{"name"}, sentKwargs["fields"])
+	sent, _ = NewAdapter("15.0", 15).adapt("sale.order", "search", []interface{}{Domain{Cond("locked", "!=", true)}}, nil)
+	a.Equal(Domain{[]interface{}{"state", "!=", "done"}}, sent[0])
+
+	// Unpaid invoices include those on hold since 18
+	unpaid := Domain{Cond("payment_state", "in", []string{"not_paid", "partial"})}
+	sent, _ = NewAdapter("18.0", 18).adapt("account.move", "search_read", []interface{}{unpaid}, nil)
+	a.Equal(Domain{[]interface{}{"payment_state", "in", []string{"not_paid", "blocked", "partial"}}}, sent[0])
+	sent, _ = NewAdapter("16.0", 16).adapt("account.move", "search_read", []interface{}{unpaid}, nil)
+	a.Equal(unpaid, sent[0])
+
+	// Leaves need their times before 16
+	leave := map[string]interface{}{"employee_id": 4, "request_date_from": "2025-03-14", "request_date_to": "2025-03-17"}
+	sent, _ = NewAdapter("15.0", 15).adapt("hr.leave", "create", []interface{}{leave}, nil)
+	a.Equal("2025-03-14 00:00:00", sent[0].(map[string]interface{})["date_from"])
+	a.Equal("2025-03-17 23:59:59", sent[0].(map[string]interface{})["date_to"])
+	sent, _ = NewAdapter("16.0", 16).adapt("hr.leave", "create", []interface{}{leave}, nil)
+	a.NotContains(sent[0], "date_from")
+
+	// The caller's arguments are left as they are
+	a.NotContains(leave, "date_from")
+	a.Equal(Cond("mobile", "=", "+6591112222"), args[0].(Domain)[1])
+	a.Equal(map[string]interface{}{"warehouse_id": 1}, kwargs["context"])
+}
@@ -0,0 +1,30 @@
+package odoo
+
+import "context"
+
+// User is the Odoo user a WhatsApp number is bound to. Calls made with a
+// context carrying a User with an API key run as that user, so Odoo's access
+// rights and record rules apply; without a key the user is only known by
+// name and calls run as the configured service account.
+type User struct {
+	ID     int
+	Login  string
+	Name   string
+	APIKey string
+	// CompanyID is the company the user works in on a multi-company
+	// database, or 0 for the client's default
+	CompanyID int
+}
+
+type userKey struct{}
+
+// WithUser returns a context whose Odoo calls are made on behalf of user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user set by WithUser, or nil
+func UserFrom(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey{}).(*User)
+	return user
+}
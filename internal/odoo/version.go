@@ -0,0 +1,416 @@
+package odoo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinVersion and MaxVersion are the major versions of Odoo waOdoo
+	// supports
+	MinVersion = 15
+	MaxVersion = 18
+	// baseVersion is the version whose names waOdoo's calls use
+	baseVersion = 17
+)
+
+// Adapter translates the calls waOdoo makes, which use the field names and
+// context keys of Odoo 17, to those of the server's version
+type Adapter struct {
+	// Version is the version the server reports, e.g. "16.0+e"
+	Version string
+	Major   int
+
+	// fields renames fields by model. An empty name means the version has
+	// no such field, and it is left out of the fields read.
+	fields map[string]map[string]string
+	// states expands the selection values searched for, by model and field:
+	// a value stands for all of its expansion in the version
+	states map[string]map[string]map[string][]string
+	// flags are boolean fields that the version keeps as a state instead,
+	// by model
+	flags map[string]map[string]flag
+	// leaveDates sets the times of new leaves, which Odoo only computes from
+	// their request dates since 16
+	leaveDates bool
+	// contextKeys renames keys of the context
+	contextKeys map[string]string
+}
+
+// flag is the state a version keeps instead of a boolean field
+type flag struct {
+	field string
+	value string
+}
+
+// NewAdapter creates the adapter of a major version
+func NewAdapter(version string, major int) *Adapter {
+	a := &Adapter{
+		Version:     version,
+		Major:       major,
+		fields:      map[string]map[string]string{},
+		states:      map[string]map[string]map[string][]string{},
+		flags:       map[string]map[string]flag{},
+		contextKeys: map[string]string{},
+	}
+	if major < 16 {
+		// Tickets got a reference in 16
+		a.rename("helpdesk.ticket", "ticket_ref", "")
+		a.leaveDates = true
+	}
+	if major < 17 {
+		// Stock quantities were computed for the "warehouse" of the context
+		a.contextKeys["warehouse_id"] = "warehouse"
+		// Locked sale orders were in their own "done" state
+		a.rename("sale.order", "locked", "")
+		a.flags["sale.order"] = map[string]flag{"locked": {field: "state", value: "done"}}
+		a.expand("sale.order", "state", "sale", "done")
+		a.expand("sale.report", "state", "sale", "done")
+		// Expenses were entered as a unit amount, of one unit by default
+		a.rename("hr.expense", "total_amount_currency", "unit_amount")
+	}
+	if major >= 18 {
+		// Contacts and users only have a phone number since 18
+		a.rename("res.partner", "mobile", "phone")
+		a.rename("res.users", "mobile", "phone")
+		// Invoices and bills on hold are "blocked" since 18, still unpaid
+		a.expand("account.move", "payment_state", "not_paid", "blocked")
+	}
+	return a
+}
+
+func (a *Adapter) rename(model, from, to string) {
+	if a.fields[model] == nil {
+		a.fields[model] = map[string]string{}
+	}
+	a.fields[model][from] = to
+}
+
+// expand makes searches for a state of a field also match the version's
+// other states
+func (a *Adapter) expand(model, field, state string, others ...string) {
+	if a.states[model] == nil {
+		a.states[model] = map[string]map[string][]string{}
+	}
+	if a.states[model][field] == nil {
+		a.states[model][field] = map[string][]string{}
+	}
+	a.states[model][field][state] = append([]string{state}, others...)
+}
+
+// Supported reports whether waOdoo supports the version
+func (a *Adapter) Supported() bool {
+	return a.Major >= MinVersion && a.Major <= MaxVersion
+}
+
+// Detect reads the version of the server, so that the calls made from then
+// on are adapted to it
+func (c *Client) Detect(ctx context.Context) (*Adapter, error) {
+	info, err := c.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	major := majorVersion(info)
+	if major == 0 {
+		return nil, fmt.Errorf("failed to parse odoo version %q", info.ServerVersion)
+	}
+	a := NewAdapter(info.ServerVersion, major)
+	c.adapter.Store(a)
+	return a, nil
+}
+
+// Adapter returns the adapter of the detected version, or nil before
+// Detect succeeded
+func (c *Client) Adapter() *Adapter {
+	return c.adapter.Load()
+}
+
+// majorVersion returns the major version of the server, e.g. 17 for
+// "saas~17.2"
+func majorVersion(info *VersionInfo) int {
+	if len(info.ServerVersionInfo) > 0 {
+		if major, ok := info.ServerVersionInfo[0].(float64); ok {
+			return int(major)
+		}
+	}
+	serie := strings.TrimPrefix(info.ServerSerie, "saas~")
+	major, _ := strconv.Atoi(strings.Split(serie, ".")[0])
+	return major
+}
+
+// adapt returns the arguments of a call translated to the server's version.
+// The caller's arguments are left as they are.
+func (a *Adapter) adapt(model, method string, args []interface{}, kwargs map[string]interface{}) ([]interface{}, map[string]interface{}) {
+	if a == nil || a.Major == baseVersion {
+		return args, kwargs
+	}
+
+	args = append([]interface{}{}, args...)
+	adapted := make(map[string]interface{}, len(kwargs))
+	for k, v := range kwargs {
+		adapted[k] = v
+	}
+	kwargs = adapted
+
+	switch method {
+	case "search_read", "search", "search_count", "read_group":
+		if len(args) > 0 {
+			args[0] = a.domain(model, args[0])
+		}
+		if method == "read_group" {
+			for i := 1; i < len(args) && i < 3; i++ {
+				args[i] = a.fieldList(model, args[i])
+			}
+		}
+	case "read":
+		if len(args) > 1 {
+			args[1] = a.fieldList(model, args[1])
+		}
+	case "create":
+		if len(args) > 0 {
+			args[0] = a.values(model, args[0])
+			if a.leaveDates && model == "hr.leave" {
+				args[0] = leaveTimes(args[0])
+			}
+		}
+	case "write":
+		if len(args) > 1 {
+			args[1] = a.values(model, args[1])
+		}
+	}
+	for _, key := range []string{"fields", "groupby"} {
+		if v, ok := kwargs[key]; ok {
+			kwargs[key] = a.fieldList(model, v)
+		}
+	}
+	if v, ok := kwargs["domain"]; ok {
+		kwargs["domain"] = a.domain(model, v)
+	}
+	if odooContext, ok := kwargs["context"].(map[string]interface{}); ok {
+		kwargs["context"] = a.context(odooContext)
+	}
+	return args, kwargs
+}
+
+// field returns the name of a field in the server's version, and false
+// when it has no such field
+func (a *Adapter) field(model, name string) (string, bool) {
+	renamed, ok := a.fields[model][name]
+	if !ok {
+		return name, true
+	}
+	return renamed, renamed != ""
+}
+
+// fieldList adapts fields to read or group by, which may have an
+// aggregate or a date granularity, e.g. "amount_total:sum". Queued calls
+// carry them as []interface{} once they are stored.
+func (a *Adapter) fieldList(model string, v interface{}) interface{} {
+	var fields []string
+	switch list := v.(type) {
+	case []string:
+		fields = list
+	case []interface{}:
+		for _, f := range list {
+			name, ok := f.(string)
+			if !ok {
+				return v
+			}
+			fields = append(fields, name)
+		}
+	default:
+		return v
+	}
+	adapted := make([]string, 0, len(fields))
+	seen := map[string]bool{}
+	for _, f := range fields {
+		name, spec, _ := strings.Cut(f, ":")
+		name, ok := a.field(model, name)
+		if !ok {
+			continue
+		}
+		if spec != "" {
+			name += ":" + spec
+		}
+		if !seen[name] {
+			seen[name] = true
+			adapted = append(adapted, name)
+		}
+	}
+	return adapted
+}
+
+// domain adapts the fields of a domain's conditions, the first field of a
+// path only since the models further on aren't known
+func (a *Adapter) domain(model string, v interface{}) interface{} {
+	var terms []interface{}
+	switch d := v.(type) {
+	case Domain:
+		terms = d
+	case []interface{}:
+		terms = d
+	default:
+		return v
+	}
+
+	adapted := make(Domain, len(terms))
+	for i, term := range terms {
+		adapted[i] = term
+		if leaf, ok := term.([]interface{}); ok && len(leaf) == 3 {
+			adapted[i] = a.leaf(model, leaf)
+		}
+	}
+	return adapted
+}
+
+// leaf adapts a condition of a domain
+func (a *Adapter) leaf(model string, leaf []interface{}) []interface{} {
+	path, ok := leaf[0].(string)
+	if !ok {
+		return leaf
+	}
+	operator, _ := leaf[1].(string)
+
+	if f, ok := a.flags[model][path]; ok {
+		set, _ := leaf[2].(bool)
+		switch operator {
+		case "=":
+		case "!=":
+			set = !set
+		default:
+			return leaf
+		}
+		if set {
+			return []interface{}{f.field, "=", f.value}
+		}
+		return []interface{}{f.field, "!=", f.value}
+	}
+	if states, ok := a.states[model][path]; ok {
+		return expandStates(leaf, states)
+	}
+
+	first, rest, nested := strings.Cut(path, ".")
+	if name, ok := a.field(model, first); ok && name != first {
+		if nested {
+			name += "." + rest
+		}
+		return []interface{}{name, leaf[1], leaf[2]}
+	}
+	return leaf
+}
+
+// expandStates adapts a condition on a selection field whose states the
+// version splits
+func expandStates(leaf []interface{}, states map[string][]string) []interface{} {
+	operator, _ := leaf[1].(string)
+	var values []string
+	switch v := leaf[2].(type) {
+	case string:
+		values = []string{v}
+	case []string:
+		values = v
+	case []interface{}:
+		for _, value := range v {
+			state, ok := value.(string)
+			if !ok {
+				return leaf
+			}
+			values = append(values, state)
+		}
+	default:
+		return leaf
+	}
+
+	switch operator {
+	case "=", "in":
+		operator = "in"
+	case "!=", "not in":
+		operator = "not in"
+	default:
+		return leaf
+	}
+	var expanded []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		others, ok := states[value]
+		if !ok {
+			others = []string{value}
+		}
+		for _, state := range others {
+			if !seen[state] {
+				seen[state] = true
+				expanded = append(expanded, state)
+			}
+		}
+	}
+	if len(expanded) == len(values) {
+		return leaf
+	}
+	return []interface{}{leaf[0], operator, expanded}
+}
+
+// values adapts the values of create or write, leaving out the fields the
+// version doesn't have
+func (a *Adapter) values(model string, v interface{}) interface{} {
+	switch values := v.(type) {
+	case map[string]interface{}:
+		adapted := make(map[string]interface{}, len(values))
+		for k, value := range values {
+			if name, ok := a.field(model, k); ok {
+				if _, set := adapted[name]; !set || name == k {
+					adapted[name] = value
+				}
+			}
+		}
+		return adapted
+	case Record:
+		return a.values(model, map[string]interface{}(values))
+	case []interface{}:
+		adapted := make([]interface{}, len(values))
+		for i, value := range values {
+			adapted[i] = a.values(model, value)
+		}
+		return adapted
+	}
+	return v
+}
+
+// leaveTimes sets the times of new leaves to the whole days requested, in
+// UTC, which is what the time off form did before Odoo computed them
+func leaveTimes(v interface{}) interface{} {
+	switch values := v.(type) {
+	case map[string]interface{}:
+		from, fromOK := values["request_date_from"].(string)
+		to, toOK := values["request_date_to"].(string)
+		if !fromOK || !toOK {
+			return values
+		}
+		if _, ok := values["date_from"]; !ok {
+			values["date_from"] = from + " 00:00:00"
+		}
+		if _, ok := values["date_to"]; !ok {
+			values["date_to"] = to + " 23:59:59"
+		}
+		return values
+	case []interface{}:
+		adapted := make([]interface{}, len(values))
+		for i, value := range values {
+			adapted[i] = leaveTimes(value)
+		}
+		return adapted
+	}
+	return v
+}
+
+func (a *Adapter) context(odooContext map[string]interface{}) map[string]interface{} {
+	adapted := make(map[string]interface{}, len(odooContext))
+	for k, v := range odooContext {
+		if renamed, ok := a.contextKeys[k]; ok {
+			k = renamed
+		}
+		adapted[k] = v
+	}
+	return adapted
+}
@@ -0,0 +1,84 @@
+package odoo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// DatetimeFormat is the layout of Odoo datetime fields, which are in UTC
+const DatetimeFormat = "2006-01-02 15:04:05"
+
+// Watcher polls a model for records written since the previous poll. It is
+// how waOdoo notices changes made in the Odoo UI.
+type Watcher struct {
+	Client   *Client
+	Model    string
+	Domain   Domain
+	Fields   []string
+	Interval time.Duration
+
+	// cursor is the latest write_date seen; seen holds the ids written at
+	// exactly that time, since the next poll includes it again
+	cursor string
+	seen   map[int]bool
+}
+
+// Changes returns the records matching Domain written since the previous
+// call. The first call only returns records written after it was made.
+func (w *Watcher) Changes(ctx context.Context) ([]Record, error) {
+	if w.cursor == "" {
+		w.cursor = time.Now().UTC().Format(DatetimeFormat)
+		w.seen = map[int]bool{}
+	}
+
+	fields := append([]string{"write_date"}, w.Fields...)
+	domain := append(Domain{Cond("write_date", ">=", w.cursor)}, w.Domain...)
+	// Polls look for changes made in Odoo, which a cached result would hide
+	records, err := w.Client.SearchRead(Fresh(ctx), w.Model, domain, fields, &SearchOptions{Order: "write_date, id"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll %s: %w", w.Model, err)
+	}
+
+	changes := make([]Record, 0, len(records))
+	for _, r := range records {
+		writeDate := r.String("write_date")
+		if writeDate == w.cursor && w.seen[r.ID()] {
+			continue
+		}
+		if writeDate > w.cursor {
+			w.cursor = writeDate
+			w.seen = map[int]bool{}
+		}
+		w.seen[r.ID()] = true
+		changes = append(changes, r)
+	}
+	return changes, nil
+}
+
+// Run polls every Interval and passes changed records to fn until ctx is
+// cancelled. Errors are logged and retried on the next tick.
+func (w *Watcher) Run(ctx context.Context, fn func(ctx context.Context, records []Record) error) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			records, err := w.Changes(ctx)
+			if err != nil {
+				log.Printf("Watcher %s: %v", w.Model, err)
+				continue
+			}
+			if len(records) == 0 {
+				continue
+			}
+			if err := fn(ctx, records); err != nil {
+				log.Printf("Watcher %s: %v", w.Model, err)
+			}
+		}
+	}
+}
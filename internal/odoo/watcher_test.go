@@ -0,0 +1,58 @@
+package odoo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherChanges(t *testing.T) {
+	a := assert.New(t)
+
+	var domains []interface{}
+	batches := [][]map[string]interface{}{
+		{
+			{"id": 1, "write_date": "2099-03-01 10:00:00"},
+			{"id": 2, "write_date": "2099-03-01 10:00:05"},
+		},
+		// The record at the cursor comes back and must not be reported twice
+		{
+			{"id": 2, "write_date": "2099-03-01 10:00:05"},
+			{"id": 3, "write_date": "2099-03-01 10:00:05"},
+		},
+	}
+
+	client := newTestServer(t, func(service, method string, args []interface{}) (interface{}, *Fault) {
+		if service == "common" {
+			return 2, nil
+		}
+		domains = append(domains, args[5].([]interface{})[0])
+		batch := batches[0]
+		batches = batches[1:]
+		return batch, nil
+	})
+	watcher := &Watcher{Client: client, Model: "helpdesk.ticket", Domain: Domain{Cond("tag_ids.name", "=", "WhatsApp")}}
+
+	first, err := watcher.Changes(context.Background())
+	a.NoError(err)
+	a.Len(first, 2)
+
+	second, err := watcher.Changes(context.Background())
+	a.NoError(err)
+	if a.Len(second, 1) {
+		a.Equal(3, second[0].ID())
+	}
+
+	a.Equal([]interface{}{
+		[]interface{}{"write_date", ">=", "2099-03-01 10:00:05"},
+		[]interface{}{"tag_ids.name", "=", "WhatsApp"},
+	}, domains[1])
+}
+
+func TestHTMLToText(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("Hello Jane,\nYour part has shipped &amp; will arrive Monday.\n\nRegards",
+		HTMLToText("<p>Hello Jane,<br>Your part has <b>shipped</b> &amp;amp; will arrive Monday.</p><p></p><p>Regards</p>"))
+}
@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pclk/waOdoo/internal/database"
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// PostgresStore keeps queued writes in the odoo_write_queue table
+type PostgresStore struct {
+	db *database.DB
+}
+
+func NewPostgresStore(db *database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Migrate creates the queue table if it doesn't exist
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS odoo_write_queue (
+			id         SERIAL PRIMARY KEY,
+			connection TEXT NOT NULL,
+			call       JSONB NOT NULL,
+			queued_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create write queue table: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Add(ctx context.Context, connection string, call odoo.QueuedCall) error {
+	data, err := json.Marshal(call)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s.%s: %w", call.Model, call.Method, err)
+	}
+	_, err = s.db.Pool.Exec(ctx, `INSERT INTO odoo_write_queue (connection, call) VALUES ($1, $2)`, connection, data)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s.%s: %w", call.Model, call.Method, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Pending(ctx context.Context, connection string) ([]Entry, error) {
+	rows, err := s.db.Pool.Query(ctx,
+		`SELECT id, call, queued_at FROM odoo_write_queue WHERE connection = $1 ORDER BY id`, connection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued writes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Call, &e.QueuedAt); err != nil {
+			return nil, fmt.Errorf("failed to read queued write: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *PostgresStore) Remove(ctx context.Context, id int) error {
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM odoo_write_queue WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to remove queued write %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package outbox keeps the writes made while Odoo is unreachable and replays
+// them once it is back, telling the WhatsApp users who asked for them
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/failure"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// Outbox queues the writes of one connection. It implements odoo.WriteQueue.
+type Outbox struct {
+	odoo       *odoo.Client
+	store      Store
+	sender     agent.Sender
+	users      agent.UserResolver
+	connection string
+}
+
+// New creates the outbox of a client. Writes made as a user are replayed
+// as the user their requester is bound to, found with users.
+func New(client *odoo.Client, store Store, sender agent.Sender, users agent.UserResolver) *Outbox {
+	return &Outbox{odoo: client, store: store, sender: sender, users: users, connection: client.Name}
+}
+
+// Enqueue saves a write to replay it later
+func (o *Outbox) Enqueue(ctx context.Context, call odoo.QueuedCall) error {
+	if err := o.store.Add(ctx, o.connection, call); err != nil {
+		return err
+	}
+	log.Printf("Queued %s.%s for %s until Odoo is back", call.Model, call.Method, call.Requester)
+	return nil
+}
+
+// Run replays the queued writes each interval until ctx is cancelled
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.Replay(ctx); err != nil {
+			log.Printf("Failed to replay queued writes: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replay makes the queued writes in order, stopping at the first one Odoo
+// is still unreachable for or whose user can't be looked up
+func (o *Outbox) Replay(ctx context.Context) error {
+	entries, err := o.store.Pending(ctx, o.connection)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		// The entry is kept to be tried again on the next pass
+		callCtx, replayErr := o.userContext(ctx, e.Call)
+		if replayErr != nil && !errors.Is(replayErr, errUnbound) {
+			return fmt.Errorf("failed to find the user of %s: %w", e.Call.Requester, replayErr)
+		}
+		if replayErr == nil {
+			replayErr = o.odoo.ExecuteKW(callCtx, e.Call.Model, e.Call.Method, e.Call.Args, e.Call.Kwargs, nil)
+		}
+		if errors.Is(replayErr, odoo.ErrUnavailable) {
+			return nil
+		}
+		if err := o.store.Remove(ctx, e.ID); err != nil {
+			return err
+		}
+		if replayErr != nil {
+			log.Printf("Failed to replay %s.%s queued at %s: %v", e.Call.Model, e.Call.Method, e.QueuedAt.Format(time.RFC3339), replayErr)
+		}
+		if err := o.notify(ctx, e.Call, replayErr); err != nil {
+			log.Printf("Failed to tell %s about %s: %v", e.Call.Requester, e.Call.Summary, err)
+		}
+	}
+	return nil
+}
+
+// userContext returns the context to replay a queued write in, as the user
+// it was made as
+func (o *Outbox) userContext(ctx context.Context, call odoo.QueuedCall) (context.Context, error) {
+	if call.UserID == 0 {
+		return ctx, nil
+	}
+	user, err := o.users.Resolve(ctx, call.Requester)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.ID != call.UserID {
+		return nil, errUnbound
+	}
+	return odoo.WithUser(ctx, user), nil
+}
+
+// errUnbound means the requester's number was bound to another user since
+var errUnbound = errors.New("the requester is no longer bound to the user")
+
+// notify tells the requester of the outcome of a replayed write
+func (o *Outbox) notify(ctx context.Context, call odoo.QueuedCall, err error) error {
+	var text string
+	message, refused := failure.Refusal(err)
+	switch {
+	case err == nil:
+		text = fmt.Sprintf("✅ Odoo is back and %s is saved.", call.Summary)
+	case errors.Is(err, odoo.ErrTimeout):
+		// The write may have been made, so it isn't tried again
+		text = fmt.Sprintf("⚠️ Odoo is back but didn't confirm %s in time. Please check it in Odoo.", call.Summary)
+	case errors.Is(err, errUnbound):
+		text = fmt.Sprintf("❌ I couldn't save %s because your number is no longer linked to the same Odoo user.", call.Summary)
+	case refused:
+		text = fmt.Sprintf("❌ Odoo is back but refused %s: %s", call.Summary, message)
+	default:
+		explanation := failure.Report(err, "outbox")
+		text = fmt.Sprintf("❌ Odoo is back but I couldn't save %s.\n%s", call.Summary, explanation.Text())
+	}
+	_, err = o.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: call.Requester, Message: text})
+	return err
+}
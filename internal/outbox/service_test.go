@@ -0,0 +1,125 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/stretchr/testify/assert"
+)
+
+// users resolves every number to the same user, or fails with err
+type users struct {
+	user *odoo.User
+	err  *error
+}
+
+func (u users) Resolve(ctx context.Context, waID string) (*odoo.User, error) {
+	if u.err != nil && *u.err != nil {
+		return nil, *u.err
+	}
+	return u.user, nil
+}
+
+func TestReplay(t *testing.T) {
+	a := assert.New(t)
+	server := odootest.NewServer(t)
+	marc := &odoo.User{ID: server.AddUser(odoo.Record{"login": "marc", "name": "Marc Demo"}, "demo"), APIKey: "demo"}
+	client := server.Client()
+	sender := &agenttest.Sender{}
+	store := NewMemoryStore()
+	writes := New(client, store, sender, users{user: marc})
+	client.Queue = writes
+	ctx := context.Background()
+
+	// Odoo restarts behind its proxy
+	server.Inject(odootest.Injection{Model: "res.partner", Method: "create", Status: http.StatusBadGateway, Times: 2})
+
+	_, err := client.Create(ctx, "res.partner", odoo.Record{"name": "Lost"})
+	a.ErrorIs(err, odoo.ErrUnavailable)
+	a.NotErrorIs(err, odoo.ErrQueued)
+
+	queueable := odoo.Queueable(odoo.WithUser(ctx, marc), "6591112222", "the contact Azure Interior")
+	_, err = client.Create(queueable, "res.partner", odoo.Record{"name": "Azure Interior"})
+	a.ErrorIs(err, odoo.ErrQueued)
+	pending, _ := store.Pending(ctx, "test")
+	if a.Len(pending, 1) {
+		a.Equal(marc.ID, pending[0].Call.UserID)
+		a.Equal("6591112222", pending[0].Call.Requester)
+	}
+
+	a.NoError(writes.Replay(ctx))
+	partners := server.Records("res.partner", odoo.Domain{odoo.Cond("name", "=", "Azure Interior")})
+	if a.Len(partners, 1) {
+		a.Equal(marc.ID, partners[0].Int("create_uid"))
+	}
+	a.Equal("✅ Odoo is back and the contact Azure Interior is saved.", sender.LastText())
+	pending, _ = store.Pending(ctx, "test")
+	a.Empty(pending)
+}
+
+func TestReplayWaitsForOdoo(t *testing.T) {
+	a := assert.New(t)
+	server := odootest.NewServer(t)
+	client := server.Client()
+	sender := &agenttest.Sender{}
+	store := NewMemoryStore()
+	writes := New(client, store, sender, users{})
+	ctx := context.Background()
+
+	a.NoError(store.Add(ctx, "test", odoo.QueuedCall{
+		Model: "res.partner", Method: "create", Args: []interface{}{map[string]interface{}{"name": "Azure Interior"}},
+		Requester: "6591112222", Summary: "the contact Azure Interior",
+	}))
+	a.NoError(store.Add(ctx, "test", odoo.QueuedCall{
+		Model: "res.partner", Method: "write", Args: []interface{}{[]interface{}{999}, map[string]interface{}{"name": "Gone"}},
+		Requester: "6591112222", Summary: "the new name of Gone",
+	}))
+
+	server.Inject(odootest.Injection{Status: http.StatusServiceUnavailable, Times: 1})
+	a.NoError(writes.Replay(ctx))
+	a.Empty(sender.Messages)
+	pending, _ := store.Pending(ctx, "test")
+	a.Len(pending, 2)
+
+	server.Inject(odootest.Injection{Model: "res.partner", Method: "write", Fault: odootest.UserError("Record does not exist or has been deleted.")})
+	a.NoError(writes.Replay(ctx))
+	if a.Len(sender.Messages, 2) {
+		a.Equal("✅ Odoo is back and the contact Azure Interior is saved.", sender.Messages[0].Message)
+		a.Equal("❌ Odoo is back but refused the new name of Gone: Record does not exist or has been deleted.", sender.Messages[1].Message)
+	}
+	pending, _ = store.Pending(ctx, "test")
+	a.Empty(pending)
+}
+
+func TestReplayKeepsWritesWhileUsersCantBeFound(t *testing.T) {
+	a := assert.New(t)
+	server := odootest.NewServer(t)
+	marc := &odoo.User{ID: server.AddUser(odoo.Record{"login": "marc", "name": "Marc Demo"}, "demo"), APIKey: "demo"}
+	sender := &agenttest.Sender{}
+	store := NewMemoryStore()
+	resolveErr := errors.New("connection refused")
+	writes := New(server.Client(), store, sender, users{user: marc, err: &resolveErr})
+	ctx := context.Background()
+
+	a.NoError(store.Add(ctx, "test", odoo.QueuedCall{
+		Model: "res.partner", Method: "create", Args: []interface{}{map[string]interface{}{"name": "Azure Interior"}},
+		UserID: marc.ID, Requester: "6591112222", Summary: "the contact Azure Interior",
+	}))
+
+	// The bindings database is down, so the write waits for the next pass
+	a.ErrorContains(writes.Replay(ctx), "connection refused")
+	a.Empty(sender.Messages)
+	pending, _ := store.Pending(ctx, "test")
+	a.Len(pending, 1)
+
+	resolveErr = nil
+	a.NoError(writes.Replay(ctx))
+	a.Equal("✅ Odoo is back and the contact Azure Interior is saved.", sender.LastText())
+	pending, _ = store.Pending(ctx, "test")
+	a.Empty(pending)
+}
@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/odoo"
+)
+
+// Entry is a queued write
+type Entry struct {
+	ID       int
+	Call     odoo.QueuedCall
+	QueuedAt time.Time
+}
+
+// Store persists queued writes per connection, so they survive restarts
+type Store interface {
+	Add(ctx context.Context, connection string, call odoo.QueuedCall) error
+	// Pending returns the writes of a connection, oldest first
+	Pending(ctx context.Context, connection string) ([]Entry, error)
+	Remove(ctx context.Context, id int) error
+}
+
+// MemoryStore keeps queued writes in memory, for tests and setups without
+// a database
+type MemoryStore struct {
+	mu      sync.Mutex
+	lastID  int
+	entries map[string][]Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string][]Entry{}}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, connection string, call odoo.QueuedCall) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	s.entries[connection] = append(s.entries[connection], Entry{ID: s.lastID, Call: call, QueuedAt: time.Now()})
+	return nil
+}
+
+func (s *MemoryStore) Pending(ctx context.Context, connection string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := append([]Entry{}, s.entries[connection]...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for connection, entries := range s.entries {
+		for i, e := range entries {
+			if e.ID == id {
+				s.entries[connection] = append(entries[:i:i], entries[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package project
+
+import (
+	"time"
+)
+
+// Kinds of commands
+const (
+	Create  = "create"
+	Move    = "move"
+	Comment = "comment"
+	List    = "list"
+)
+
+// Command is a parsed task message such as
+// "new task in Website Redesign: fix footer, assign to Ana, due Friday"
+type Command struct {
+	Kind    string
+	Project string
+	// Task is the title of a new task, or the name or "#id" of an existing one
+	Task     string
+	Assignee string
+	// Due is the deadline of a new task, zero when it has none
+	Due     time.Time
+	Stage   string
+	Comment string
+}
+
+// pending is a command waiting for the user to pick its task
+type pending struct {
+	Command Command
+}
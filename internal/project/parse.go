@@ -0,0 +1,119 @@
+package project
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	createPattern  = regexp.MustCompile(`(?i)^\s*(?:new|add|create)\s+(?:a\s+)?task\s+(?:in|for|on|to)\s+(?:project\s+)?(.+?)\s*:\s*(.+?)\s*$`)
+	movePattern    = regexp.MustCompile(`(?i)^\s*move\s+task\s+(.+?)\s+to\s+(.+?)\s*$`)
+	commentPattern = regexp.MustCompile(`(?i)^\s*(?:comment|note)\s+on\s+task\s+(.+?)\s*:\s*(.+?)\s*$`)
+	listPattern    = regexp.MustCompile(`(?i)^\s*(?:my|show\s+my|list\s+my)\s+(?:open\s+)?tasks\s*\??\s*$`)
+
+	assignPattern = regexp.MustCompile(`(?i)^assign(?:ed)?\s+to\s+(.+)$`)
+	duePattern    = regexp.MustCompile(`(?i)^(?:due|by|deadline)\s+(?:on\s+|by\s+)?(.+)$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// dayLayouts are the accepted ways of writing a date without a year
+var dayLayouts = []string{"2 Jan", "2 January", "Jan 2", "January 2"}
+
+// IsCommand reports whether text is a task command
+func IsCommand(text string) bool {
+	return createPattern.MatchString(text) || movePattern.MatchString(text) ||
+		commentPattern.MatchString(text) || listPattern.MatchString(text)
+}
+
+// ParseCommand parses a task message. Due dates are relative to today,
+// which is given in the sender's timezone.
+func ParseCommand(text string, today time.Time) (Command, error) {
+	if m := createPattern.FindStringSubmatch(text); m != nil {
+		return parseCreate(m[1], m[2], today)
+	}
+	if m := movePattern.FindStringSubmatch(text); m != nil {
+		return Command{Kind: Move, Task: m[1], Stage: m[2]}, nil
+	}
+	if m := commentPattern.FindStringSubmatch(text); m != nil {
+		return Command{Kind: Comment, Task: m[1], Comment: m[2]}, nil
+	}
+	if listPattern.MatchString(text) {
+		return Command{Kind: List}, nil
+	}
+	return Command{}, fmt.Errorf(`I couldn't read that. Try "new task in <project>: <title>, assign to <name>, due <date>".`)
+}
+
+// parseCreate reads the title and the options that follow it after commas,
+// e.g. "fix footer, assign to Ana, due Friday". Parts that aren't options
+// belong to the title.
+func parseCreate(project, rest string, today time.Time) (Command, error) {
+	c := Command{Kind: Create, Project: project}
+	var title []string
+	for _, part := range strings.Split(rest, ",") {
+		part = strings.TrimSpace(part)
+		if m := assignPattern.FindStringSubmatch(part); m != nil && len(title) > 0 {
+			c.Assignee = strings.TrimSpace(m[1])
+			continue
+		}
+		if m := duePattern.FindStringSubmatch(part); m != nil && len(title) > 0 {
+			due, err := parseDate(m[1], today)
+			if err != nil {
+				return Command{}, err
+			}
+			c.Due = due
+			continue
+		}
+		title = append(title, part)
+	}
+	c.Task = strings.TrimSpace(strings.Join(title, ", "))
+	if c.Task == "" {
+		return Command{}, fmt.Errorf("What should the task be called?")
+	}
+	return c, nil
+}
+
+// parseDate resolves today, tomorrow, a weekday (the next one, today
+// included), "next week", a day and month (the next one) or an ISO date
+func parseDate(s string, today time.Time) (time.Time, error) {
+	s = strings.Trim(strings.TrimSpace(s), ".,")
+	lower := strings.ToLower(s)
+	switch {
+	case lower == "today":
+		return today, nil
+	case lower == "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case lower == "next week":
+		// Monday of next week
+		return today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7), nil
+	case len(lower) >= 3 && !strings.ContainsAny(lower, "0123456789"):
+		if day, ok := weekdays[lower[:3]]; ok {
+			offset := (int(day) - int(today.Weekday()) + 7) % 7
+			return today.AddDate(0, 0, offset), nil
+		}
+	}
+
+	if date, err := time.ParseInLocation(dateLayout, s, today.Location()); err == nil {
+		return date, nil
+	}
+	for _, layout := range dayLayouts {
+		if date, err := time.ParseInLocation(layout+" 2006", s, today.Location()); err == nil {
+			return date, nil
+		}
+		if date, err := time.ParseInLocation(layout, s, today.Location()); err == nil {
+			date = time.Date(today.Year(), date.Month(), date.Day(), 0, 0, 0, 0, today.Location())
+			if date.Before(today) {
+				date = date.AddDate(1, 0, 0)
+			}
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("I couldn't read the due date %q.", s)
+}
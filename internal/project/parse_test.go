@@ -0,0 +1,41 @@
+package project
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	a := assert.New(t)
+	// Wednesday 12 March 2025
+	today := time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		text string
+		want Command
+	}{
+		{"new task in Website Redesign: fix footer, assign to Ana, due Friday",
+			Command{Kind: Create, Project: "Website Redesign", Task: "fix footer", Assignee: "Ana", Due: day(14)}},
+		{"Create task for project Office: order chairs, tables, by tomorrow",
+			Command{Kind: Create, Project: "Office", Task: "order chairs, tables", Due: day(13)}},
+		{"add task to Office: plan party, due next week",
+			Command{Kind: Create, Project: "Office", Task: "plan party", Due: day(17)}},
+		{"move task fix footer to Done", Command{Kind: Move, Task: "fix footer", Stage: "Done"}},
+		{"comment on task #42: waiting for the logo", Command{Kind: Comment, Task: "#42", Comment: "waiting for the logo"}},
+		{"my tasks?", Command{Kind: List}},
+	}
+	for _, tt := range tests {
+		a.True(IsCommand(tt.text), tt.text)
+		got, err := ParseCommand(tt.text, today)
+		if a.NoError(err, tt.text) {
+			a.Equal(tt.want, got, tt.text)
+		}
+	}
+
+	a.False(IsCommand("move the meeting to Friday"))
+	_, err := ParseCommand("new task in Office: buy snacks, due someday", today)
+	a.EqualError(err, `I couldn't read the due date "someday".`)
+}
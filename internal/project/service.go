@@ -0,0 +1,361 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/fuzzy"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+const (
+	// maxChoices is the number of rows a WhatsApp list message can hold
+	maxChoices = 10
+	// maxTasks is how many tasks "my tasks" lists
+	maxTasks = 20
+	// datetimeDeadlines is the version since which task deadlines have a time
+	datetimeDeadlines = 17
+)
+
+// Service creates and updates project tasks from WhatsApp, as the Odoo user
+// bound to the sender's number
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	sessions *agent.Sessions
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, sessions *agent.Sessions) *Service {
+	return &Service{odoo: client, sender: sender, sessions: sessions, now: time.Now}
+}
+
+func (s *Service) Name() string {
+	return "project"
+}
+
+func (s *Service) Help() string {
+	return `"new task in <project>: <title>, assign to <name>, due <date>", "move task <task> to <stage>" or "my tasks"`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && IsCommand(msg.Body)
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	// Tasks are created and changed with the user's own access rights, which
+	// needs their API key: the service account could change any task
+	user := odoo.UserFrom(ctx)
+	if user == nil {
+		return s.send(ctx, msg.SenderID, "Tasks are only available to Odoo users.")
+	}
+	if user.APIKey == "" {
+		return s.send(ctx, msg.SenderID, "To work on tasks from WhatsApp, link this number to your Odoo user with an API key first.")
+	}
+	location, err := s.location(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if msg.ReplyID != "" {
+		return s.handleChoice(ctx, msg, location)
+	}
+
+	now := s.now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	cmd, err := ParseCommand(msg.Body, today)
+	if err != nil {
+		return s.send(ctx, msg.SenderID, err.Error())
+	}
+
+	switch cmd.Kind {
+	case Create:
+		return s.create(ctx, msg.SenderID, cmd)
+	case List:
+		return s.sendTasks(ctx, msg.SenderID, user.ID, today)
+	}
+
+	tasks, err := s.findTasks(ctx, cmd.Task)
+	if err != nil {
+		return err
+	}
+	switch len(tasks) {
+	case 0:
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("I couldn't find a task called \"%s\".", cmd.Task))
+	case 1:
+		return s.apply(ctx, msg.SenderID, cmd, tasks[0])
+	default:
+		s.sessions.Hold(msg.SenderID, s.Name(), &pending{Command: cmd})
+		return s.sendChoices(ctx, msg.SenderID, fmt.Sprintf("Which task is \"%s\"?", cmd.Task), tasks)
+	}
+}
+
+// handleChoice continues a command after the user picked its task
+func (s *Service) handleChoice(ctx context.Context, msg whatsapp.WebhookMessage, location *time.Location) error {
+	session := s.sessions.Get(msg.SenderID)
+	if session == nil || session.Capability != s.Name() {
+		return s.send(ctx, msg.SenderID, "That choice has expired, please send your message again.")
+	}
+	p := session.Data.(*pending)
+
+	var id int
+	if _, err := fmt.Sscanf(msg.ReplyID, "project:task:%d", &id); err != nil {
+		return fmt.Errorf("invalid reply id %q: %w", msg.ReplyID, err)
+	}
+	s.sessions.End(msg.SenderID)
+
+	tasks, err := s.odoo.Read(ctx, "project.task", []int{id}, []string{"name", "project_id"}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read task %d: %w", id, err)
+	}
+	if len(tasks) == 0 {
+		return s.send(ctx, msg.SenderID, "That task no longer exists.")
+	}
+	return s.apply(ctx, msg.SenderID, p.Command, tasks[0])
+}
+
+// create opens a task in the command's project, assigned and due as asked
+func (s *Service) create(ctx context.Context, to string, cmd Command) error {
+	// The project and assignee fall back on their last known values so that
+	// the task is queued while Odoo is down
+	lookups := odoo.LastKnown(ctx)
+	projects, err := s.match(lookups, "project.project", nil, cmd.Project)
+	if err != nil {
+		return err
+	}
+	if len(projects) != 1 {
+		return s.send(ctx, to, ambiguity("project", cmd.Project, projects))
+	}
+	project := projects[0]
+
+	values := map[string]interface{}{
+		"name":       cmd.Task,
+		"project_id": project.ID(),
+	}
+	text := fmt.Sprintf("✅ Task *%s* created in %s", cmd.Task, project.String("name"))
+
+	if cmd.Assignee != "" {
+		users, err := s.match(lookups, "res.users", odoo.Domain{odoo.Cond("share", "=", false)}, cmd.Assignee)
+		if err != nil {
+			return err
+		}
+		if len(users) != 1 {
+			return s.send(ctx, to, ambiguity("user", cmd.Assignee, users))
+		}
+		values["user_ids"] = []interface{}{[]interface{}{6, 0, []int{users[0].ID()}}}
+		text += ", assigned to " + users[0].String("name")
+	}
+	if !cmd.Due.IsZero() {
+		values["date_deadline"] = s.deadline(cmd.Due)
+		text += ", due " + cmd.Due.Format("Mon 2 Jan")
+	}
+
+	// The task is created once Odoo is back if it can't be reached now
+	summary := fmt.Sprintf("the task *%s*", cmd.Task)
+	_, err = s.odoo.Create(odoo.Queueable(ctx, to, summary), "project.task", values)
+	if errors.Is(err, odoo.ErrQueued) {
+		return s.send(ctx, to, fmt.Sprintf("⏳ Odoo is unreachable right now. I'll create %s as soon as it's back and let you know.", summary))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create task: %w", err)
+	}
+	return s.send(ctx, to, text+".")
+}
+
+// apply moves or comments on a task
+func (s *Service) apply(ctx context.Context, to string, cmd Command, task odoo.Record) error {
+	switch cmd.Kind {
+	case Move:
+		projectID, projectName := task.Many2one("project_id")
+		stages, err := s.odoo.SearchRead(ctx, "project.task.type", odoo.Domain{odoo.Cond("project_ids", "in", []int{projectID})},
+			[]string{"name"}, &odoo.SearchOptions{Order: "sequence, id"})
+		if err != nil {
+			return fmt.Errorf("failed to search stages: %w", err)
+		}
+		names := make([]string, len(stages))
+		for i, stage := range stages {
+			names[i] = stage.String("name")
+		}
+		best, ok := fuzzy.Best(cmd.Stage, names)
+		if !ok {
+			return s.send(ctx, to, fmt.Sprintf("\"%s\" isn't a stage of %s. Its stages are: %s.", cmd.Stage, projectName, strings.Join(names, ", ")))
+		}
+		if err := s.odoo.Write(ctx, "project.task", []int{task.ID()}, map[string]interface{}{"stage_id": stages[best.Index].ID()}); err != nil {
+			return fmt.Errorf("failed to move task %d: %w", task.ID(), err)
+		}
+		return s.send(ctx, to, fmt.Sprintf("✅ *%s* moved to %s.", task.String("name"), best.Name))
+
+	case Comment:
+		// Notes don't email the customers following the task
+		if _, err := s.odoo.MessagePost(ctx, "project.task", task.ID(), cmd.Comment, true); err != nil {
+			return fmt.Errorf("failed to comment on task %d: %w", task.ID(), err)
+		}
+		return s.send(ctx, to, fmt.Sprintf("📝 Note added to *%s*.", task.String("name")))
+	}
+	return fmt.Errorf("unknown task command %q", cmd.Kind)
+}
+
+// findTasks returns the task with the "#id" given, or the tasks whose name
+// matches: the single best one, or every close candidate
+func (s *Service) findTasks(ctx context.Context, ref string) ([]odoo.Record, error) {
+	if id, err := strconv.Atoi(strings.TrimPrefix(ref, "#")); err == nil && strings.HasPrefix(ref, "#") {
+		tasks, err := s.odoo.Read(ctx, "project.task", []int{id}, []string{"name", "project_id"}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read task %d: %w", id, err)
+		}
+		return tasks, nil
+	}
+	return s.match(ctx, "project.task", nil, ref)
+}
+
+// sendTasks lists the user's open tasks, those due soonest first
+func (s *Service) sendTasks(ctx context.Context, to string, userID int, today time.Time) error {
+	tasks, err := s.odoo.SearchRead(ctx, "project.task", odoo.Domain{
+		odoo.Cond("user_ids", "in", []int{userID}),
+		odoo.Cond("stage_id.fold", "=", false),
+	}, []string{"name", "project_id", "stage_id", "date_deadline"}, &odoo.SearchOptions{Limit: maxTasks, Order: "date_deadline, id"})
+	if err != nil {
+		return fmt.Errorf("failed to search tasks: %w", err)
+	}
+	return s.send(ctx, to, FormatTasks(tasks, today))
+}
+
+// FormatTasks renders a user's tasks with their project, stage and
+// deadline, flagging those overdue
+func FormatTasks(tasks []odoo.Record, today time.Time) string {
+	if len(tasks) == 0 {
+		return "You have no open tasks. 🎉"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "📋 *Your open tasks* (%d)\n", len(tasks))
+	for _, t := range tasks {
+		parts := []string{t.String("name")}
+		if _, project := t.Many2one("project_id"); project != "" {
+			parts = append(parts, project)
+		}
+		if _, stage := t.Many2one("stage_id"); stage != "" {
+			parts = append(parts, stage)
+		}
+		if due, ok := deadlineDay(t.String("date_deadline"), today.Location()); ok {
+			text := "due " + due.Format("Mon 2 Jan")
+			if due.Before(today) {
+				text += " ⚠️"
+			}
+			parts = append(parts, text)
+		}
+		fmt.Fprintf(&b, "\n• %s", strings.Join(parts, " · "))
+	}
+	return b.String()
+}
+
+// deadline returns the value of date_deadline for a due day: the day
+// before Odoo 17, its end in the user's timezone since
+func (s *Service) deadline(due time.Time) string {
+	if a := s.odoo.Adapter(); a != nil && a.Major < datetimeDeadlines {
+		return due.Format(dateLayout)
+	}
+	end := time.Date(due.Year(), due.Month(), due.Day(), 23, 59, 59, 0, due.Location())
+	return end.UTC().Format(odoo.DatetimeFormat)
+}
+
+// deadlineDay reads a date_deadline, a date or a UTC datetime, as a day
+// in the user's timezone
+func deadlineDay(value string, location *time.Location) (time.Time, bool) {
+	if t, err := time.Parse(odoo.DatetimeFormat, value); err == nil {
+		t = t.In(location)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location), true
+	}
+	if t, err := time.ParseInLocation(dateLayout, value, location); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// match returns the records of model whose name matches term: the single
+// best fuzzy match, or every close candidate when it's ambiguous
+func (s *Service) match(ctx context.Context, model string, domain odoo.Domain, term string) ([]odoo.Record, error) {
+	fields := []string{"name"}
+	if model == "project.task" {
+		fields = append(fields, "project_id")
+	}
+	records, err := s.odoo.SearchRead(ctx, model, domain, fields, &odoo.SearchOptions{Limit: 500})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", model, err)
+	}
+
+	names := make([]string, len(records))
+	for i, r := range records {
+		names[i] = r.String("name")
+	}
+
+	if best, ok := fuzzy.Best(term, names); ok {
+		return []odoo.Record{records[best.Index]}, nil
+	}
+	var candidates []odoo.Record
+	for _, m := range fuzzy.Rank(term, names) {
+		if len(candidates) == maxChoices {
+			break
+		}
+		candidates = append(candidates, records[m.Index])
+	}
+	return candidates, nil
+}
+
+// ambiguity tells the user that a name matched no record or several
+func ambiguity(kind, term string, records []odoo.Record) string {
+	if len(records) == 0 {
+		return fmt.Sprintf("I couldn't find a %s called \"%s\".", kind, term)
+	}
+	names := make([]string, len(records))
+	for i, r := range records {
+		names[i] = r.String("name")
+	}
+	return fmt.Sprintf("\"%s\" matches several %ss: %s. Please be more specific.", term, kind, strings.Join(names, "; "))
+}
+
+func (s *Service) sendChoices(ctx context.Context, to, body string, tasks []odoo.Record) error {
+	rows := make([]whatsapp.ListRow, 0, len(tasks))
+	for _, t := range tasks {
+		_, project := t.Many2one("project_id")
+		rows = append(rows, whatsapp.ListRow{
+			ID:          fmt.Sprintf("project:task:%d", t.ID()),
+			Title:       t.String("name"),
+			Description: project,
+		})
+	}
+
+	_, err := s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     body,
+		Button:   "Choose task",
+		Sections: []whatsapp.ListSection{{Rows: rows}},
+	})
+	return err
+}
+
+// location returns the timezone of the user, UTC when it isn't set. The
+// last known one does while Odoo is down, so that new tasks can be queued.
+func (s *Service) location(ctx context.Context, userID int) (*time.Location, error) {
+	users, err := s.odoo.Read(odoo.LastKnown(ctx), "res.users", []int{userID}, []string{"tz"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user: %w", err)
+	}
+	if len(users) > 0 && users[0].String("tz") != "" {
+		if l, err := time.LoadLocation(users[0].String("tz")); err == nil {
+			return l, nil
+		}
+	}
+	return time.UTC, nil
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
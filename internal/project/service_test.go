@@ -0,0 +1,147 @@
+package project
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/outbox"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T) (*Service, *odootest.Server, *agenttest.Sender, context.Context) {
+	server := odootest.NewServer(t)
+	server.Relate("project.task", "project_id", odootest.Relation{Model: "project.project"})
+	server.Relate("project.task", "stage_id", odootest.Relation{Model: "project.task.type"})
+	server.Relate("project.task.type", "project_ids", odootest.Relation{Model: "project.project", Many: true})
+	server.Seed("project.project", odoo.Record{"id": 1, "name": "Website Redesign"}, odoo.Record{"id": 2, "name": "Office Move"})
+	server.Seed("project.task.type",
+		odoo.Record{"id": 1, "name": "New", "sequence": 1, "project_ids": []int{1, 2}, "fold": false},
+		odoo.Record{"id": 2, "name": "In Progress", "sequence": 2, "project_ids": []int{1}, "fold": false},
+		odoo.Record{"id": 3, "name": "Done", "sequence": 3, "project_ids": []int{1, 2}, "fold": true},
+	)
+	ana := server.AddUser(odoo.Record{"login": "ana", "name": "Ana Lopez", "share": false, "tz": "Asia/Singapore"}, "ana-key")
+	server.Seed("project.task",
+		odoo.Record{"id": 1, "name": "Fix footer", "project_id": 1, "stage_id": 1, "user_ids": []int{ana}, "date_deadline": "2025-03-11 15:59:59"},
+		odoo.Record{"id": 2, "name": "New homepage", "project_id": 1, "stage_id": 2, "user_ids": []int{ana}},
+		odoo.Record{"id": 3, "name": "Book movers", "project_id": 2, "stage_id": 3, "user_ids": []int{ana}},
+		odoo.Record{"id": 4, "name": "Fix footer", "project_id": 2, "stage_id": 1},
+	)
+
+	sender := &agenttest.Sender{}
+	service := NewService(server.Client(), sender, agent.NewSessions(time.Minute))
+	// Wednesday 12 March 2025, 01:00 in Singapore
+	service.now = func() time.Time { return time.Date(2025, 3, 11, 17, 0, 0, 0, time.UTC) }
+	return service, server, sender, odoo.WithUser(context.Background(), &odoo.User{ID: ana, APIKey: "ana-key"})
+}
+
+func TestCreateTask(t *testing.T) {
+	a := assert.New(t)
+	service, server, sender, ctx := newTestService(t)
+	reply := func(text string) string {
+		a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: text}))
+		return sender.LastText()
+	}
+
+	a.Equal("✅ Task *fix logo* created in Website Redesign, assigned to Ana Lopez, due Fri 14 Mar.",
+		reply("new task in website redesign: fix logo, assign to Ana, due Friday"))
+	tasks := server.Records("project.task", odoo.Domain{odoo.Cond("name", "=", "fix logo")})
+	if a.Len(tasks, 1) {
+		a.Equal(1, tasks[0].Int("project_id"))
+		a.Equal([]int{tasks[0].Int("create_uid")}, tasks[0]["user_ids"])
+		// The end of Friday in Singapore
+		a.Equal("2025-03-14 15:59:59", tasks[0].String("date_deadline"))
+	}
+
+	// Before Odoo 17 deadlines are dates
+	server.Version = "16.0"
+	_, err := service.odoo.Detect(ctx)
+	a.NoError(err)
+	reply("new task in Office Move: label boxes, due tomorrow")
+	tasks = server.Records("project.task", odoo.Domain{odoo.Cond("name", "=", "label boxes")})
+	if a.Len(tasks, 1) {
+		a.Equal("2025-03-13", tasks[0].String("date_deadline"))
+	}
+
+	a.Equal(`I couldn't find a user called "Zed".`, reply("new task in Office Move: pack, assign to Zed"))
+	a.Equal(`I couldn't find a project called "Mars Base".`, reply("new task in Mars Base: launch"))
+}
+
+// bound resolves every number to the same user
+type bound struct{ user *odoo.User }
+
+func (b bound) Resolve(ctx context.Context, waID string) (*odoo.User, error) {
+	return b.user, nil
+}
+
+func TestCreateTaskQueuedWhileOdooIsDown(t *testing.T) {
+	a := assert.New(t)
+	service, server, sender, ctx := newTestService(t)
+	writes := outbox.New(service.odoo, outbox.NewMemoryStore(), sender, bound{odoo.UserFrom(ctx)})
+	service.odoo.Queue = writes
+
+	// The project was seen before Odoo went down
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "new task in office move: pack boxes"}))
+	server.Inject(odootest.Injection{Status: http.StatusBadGateway})
+	calls := len(server.Calls())
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "new task in office move: order boxes"}))
+	a.Equal("⏳ Odoo is unreachable right now. I'll create the task *order boxes* as soon as it's back and let you know.", sender.LastText())
+	a.Equal(calls, len(server.Calls()), "no call reached Odoo")
+
+	server.ClearInjections()
+	a.NoError(writes.Replay(ctx))
+	tasks := server.Records("project.task", odoo.Domain{odoo.Cond("name", "=", "order boxes")})
+	if a.Len(tasks, 1) {
+		a.Equal(2, tasks[0].Int("project_id"))
+	}
+	a.Equal("✅ Odoo is back and the task *order boxes* is saved.", sender.LastText())
+}
+
+func TestUpdateTasks(t *testing.T) {
+	a := assert.New(t)
+	service, server, sender, ctx := newTestService(t)
+	handle := func(msg whatsapp.WebhookMessage) {
+		msg.SenderID = "6591112222"
+		a.NoError(service.Handle(ctx, msg))
+	}
+
+	handle(whatsapp.WebhookMessage{Type: "text", Body: "my tasks"})
+	a.Equal("📋 *Your open tasks* (2)\n"+
+		"\n• Fix footer · Website Redesign · New · due Tue 11 Mar ⚠️"+
+		"\n• New homepage · Website Redesign · In Progress", sender.LastText())
+
+	// Two tasks have the same name
+	handle(whatsapp.WebhookMessage{Type: "text", Body: "move task fix footer to done"})
+	if a.Len(sender.Lists, 1) {
+		a.Equal("Office Move", sender.Lists[0].Sections[0].Rows[1].Description)
+	}
+	handle(whatsapp.WebhookMessage{Type: "interactive", ReplyID: "project:task:1", Body: "Fix footer"})
+	a.Equal("✅ *Fix footer* moved to Done.", sender.LastText())
+	a.Equal(3, server.Records("project.task", odoo.Domain{odoo.Cond("id", "=", 1)})[0].Int("stage_id"))
+
+	handle(whatsapp.WebhookMessage{Type: "text", Body: "move task #4 to in progress"})
+	a.Equal(`"in progress" isn't a stage of Office Move. Its stages are: New, Done.`, sender.LastText())
+
+	handle(whatsapp.WebhookMessage{Type: "text", Body: "comment on task new homepage: waiting for the logo"})
+	a.Equal("📝 Note added to *New homepage*.", sender.LastText())
+	messages := server.Records("mail.message", odoo.Domain{odoo.Cond("res_id", "=", 2), odoo.Cond("model", "=", "project.task")})
+	if a.Len(messages, 1) {
+		a.Contains(messages[0].String("body"), "waiting for the logo")
+	}
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "my tasks"}))
+	a.Equal("Tasks are only available to Odoo users.", sender.LastText())
+
+	n := len(server.Calls())
+	keyless := odoo.WithUser(context.Background(), &odoo.User{ID: odoo.UserFrom(ctx).ID})
+	a.NoError(service.Handle(keyless, whatsapp.WebhookMessage{SenderID: "6591112222", Type: "text", Body: "new task in Office Move: order boxes"}))
+	a.Equal("To work on tasks from WhatsApp, link this number to your Odoo user with an API key first.", sender.LastText())
+	a.Len(server.Calls(), n, "nothing is done as the service account")
+}
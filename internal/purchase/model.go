@@ -0,0 +1,24 @@
+package purchase
+
+// Approver is an Odoo user who may approve purchase orders
+type Approver struct {
+	UserID int
+	Name   string
+	Phone  string
+}
+
+// request is an approval request sent to one approver
+type request struct {
+	To        string
+	MessageID string
+}
+
+// stateLabels describes purchase.order states in messages
+var stateLabels = map[string]string{
+	"draft":      "reset to draft",
+	"sent":       "sent",
+	"to approve": "waiting for approval",
+	"purchase":   "approved",
+	"done":       "locked",
+	"cancel":     "rejected",
+}
@@ -0,0 +1,345 @@
+package purchase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxSummaryLines is the number of order lines listed in an approval request
+const maxSummaryLines = 5
+
+var orderFields = []string{"name", "state", "partner_id", "amount_total", "currency_id", "user_id", "write_uid"}
+
+// Service asks managers to approve purchase orders over WhatsApp
+type Service struct {
+	odoo   *odoo.Client
+	sender agent.Sender
+	// logins restricts approvers to these users instead of all purchase managers
+	logins []string
+
+	mu sync.Mutex
+	// states holds the last known state of each purchase order
+	states map[int]string
+	// pending holds the approval requests sent for each order
+	pending map[int][]request
+}
+
+func NewService(client *odoo.Client, sender agent.Sender) *Service {
+	var logins []string
+	for _, login := range strings.Split(os.Getenv("PURCHASE_APPROVERS"), ",") {
+		if login = strings.TrimSpace(login); login != "" {
+			logins = append(logins, login)
+		}
+	}
+
+	return &Service{
+		odoo:    client,
+		sender:  sender,
+		logins:  logins,
+		states:  map[int]string{},
+		pending: map[int][]request{},
+	}
+}
+
+func (s *Service) Name() string {
+	return "purchase"
+}
+
+func (s *Service) Help() string {
+	return "tap *Approve* or *Reject* on purchase order requests"
+}
+
+// Match is always false: the service only handles answers to its own buttons
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return false
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	action, orderID, err := parseReplyID(msg.ReplyID)
+	if err != nil {
+		return err
+	}
+
+	approver, err := s.approverByPhone(ctx, msg.SenderID)
+	if err != nil {
+		return err
+	}
+	if approver == nil {
+		return s.send(ctx, msg.SenderID, "", "Sorry, you're not allowed to approve purchase orders.")
+	}
+	// Without their API key the order would be approved by the service
+	// account, bypassing the approver's own rights and limits
+	if user := odoo.UserFrom(ctx); user == nil || user.APIKey == "" || user.ID != approver.UserID {
+		return s.send(ctx, msg.SenderID, "", "To approve purchase orders from WhatsApp, link this number to your Odoo user with an API key first. You can still approve the order in Odoo.")
+	}
+
+	// The order may have been handled in Odoo moments ago
+	orders, err := s.odoo.Read(odoo.Fresh(ctx), "purchase.order", []int{orderID}, orderFields, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read purchase order: %w", err)
+	}
+	if len(orders) == 0 {
+		return s.send(ctx, msg.SenderID, "", "This purchase order no longer exists.")
+	}
+	order := orders[0]
+
+	if state := order.String("state"); state != "to approve" {
+		_, by := order.Many2one("write_uid")
+		return s.send(ctx, msg.SenderID, "", fmt.Sprintf("%s was already %s by %s.", order.String("name"), stateLabels[state], by))
+	}
+
+	method, state, verb := "button_approve", "purchase", "approved"
+	if action == "reject" {
+		method, state, verb = "button_cancel", "cancel", "rejected"
+	}
+
+	// Record the new state first so the watcher doesn't report our own change
+	s.setState(orderID, state)
+	if err := s.odoo.ExecuteKW(ctx, "purchase.order", method, []interface{}{[]int{orderID}}, nil, nil); err != nil {
+		s.setState(orderID, "to approve")
+		return err
+	}
+
+	note := fmt.Sprintf("%s via WhatsApp by %s", strings.ToUpper(verb[:1])+verb[1:], approver.Name)
+	if _, err := s.odoo.MessagePost(ctx, "purchase.order", orderID, note, true); err != nil {
+		log.Printf("Failed to log approval of purchase order %d: %v", orderID, err)
+	}
+
+	text := fmt.Sprintf("%s %s was %s by %s.", stateIcon(state), order.String("name"), verb, approver.Name)
+	return s.resolve(ctx, orderID, text)
+}
+
+// Approvers returns the users asked to approve purchase orders
+func (s *Service) Approvers(ctx context.Context) ([]Approver, error) {
+	domain := odoo.Domain{odoo.Cond("share", "=", false)}
+	if len(s.logins) > 0 {
+		domain = append(domain, odoo.Cond("login", "in", s.logins))
+	} else {
+		groupID, err := s.odoo.Ref(ctx, "purchase.group_purchase_manager")
+		if err != nil {
+			return nil, err
+		}
+		domain = append(domain, odoo.Cond("groups_id", "in", []int{groupID}))
+	}
+
+	// res.users inherits the phone numbers of its partner
+	users, err := s.odoo.SearchRead(ctx, "res.users", domain, []string{"name", "phone", "mobile"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search approvers: %w", err)
+	}
+
+	approvers := make([]Approver, 0, len(users))
+	for _, u := range users {
+		phone := u.String("mobile")
+		if phone == "" {
+			phone = u.String("phone")
+		}
+		if phone == "" {
+			continue
+		}
+		approvers = append(approvers, Approver{UserID: u.ID(), Name: u.String("name"), Phone: phone})
+	}
+	return approvers, nil
+}
+
+// Run watches purchase orders and asks for approval when one needs it, until
+// ctx is cancelled
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	// Orders already waiting were announced before a restart
+	orders, err := s.odoo.SearchRead(ctx, "purchase.order", odoo.Domain{odoo.Cond("state", "=", "to approve")}, []string{"state"}, nil)
+	if err != nil {
+		log.Printf("Failed to load purchase orders to approve: %v", err)
+	}
+	for _, o := range orders {
+		s.setState(o.ID(), o.String("state"))
+	}
+
+	watcher := &odoo.Watcher{
+		Client:   s.odoo,
+		Model:    "purchase.order",
+		Fields:   orderFields,
+		Interval: interval,
+	}
+	watcher.Run(ctx, s.HandleChanges)
+}
+
+// HandleChanges sends approval requests for orders that entered "to approve"
+// and tells approvers when an order was handled in Odoo instead
+func (s *Service) HandleChanges(ctx context.Context, orders []odoo.Record) error {
+	for _, order := range orders {
+		state := order.String("state")
+		previous, known := s.setState(order.ID(), state)
+
+		switch {
+		case state == "to approve" && previous != "to approve":
+			if err := s.RequestApproval(ctx, order); err != nil {
+				return err
+			}
+		case known && previous == "to approve" && state != "to approve":
+			_, by := order.Many2one("write_uid")
+			text := fmt.Sprintf("%s %s was %s in Odoo by %s.", stateIcon(state), order.String("name"), stateLabels[state], by)
+			if err := s.resolve(ctx, order.ID(), text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RequestApproval sends the order summary with Approve/Reject buttons to
+// every approver
+func (s *Service) RequestApproval(ctx context.Context, order odoo.Record) error {
+	approvers, err := s.Approvers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(approvers) == 0 {
+		log.Printf("No approver with a phone number for purchase order %s", order.String("name"))
+		return nil
+	}
+
+	lines, err := s.odoo.SearchRead(ctx, "purchase.order.line", odoo.Domain{
+		odoo.Cond("order_id", "=", order.ID()),
+		odoo.Cond("display_type", "=", false),
+	}, []string{"name", "product_qty", "price_subtotal"}, &odoo.SearchOptions{Order: "price_subtotal desc"})
+	if err != nil {
+		return fmt.Errorf("failed to read order lines: %w", err)
+	}
+
+	body := FormatSummary(order, lines)
+	var requests []request
+	for _, approver := range approvers {
+		resp, err := s.sender.SendButtons(ctx, whatsapp.ButtonMessage{
+			To:     approver.Phone,
+			Header: "Purchase approval",
+			Body:   body,
+			Buttons: []whatsapp.Button{
+				{ID: fmt.Sprintf("purchase:approve:%d", order.ID()), Title: "Approve"},
+				{ID: fmt.Sprintf("purchase:reject:%d", order.ID()), Title: "Reject"},
+			},
+		})
+		if err != nil {
+			log.Printf("Failed to send approval request to %s: %v", approver.Name, err)
+			continue
+		}
+		requests = append(requests, request{To: approver.Phone, MessageID: resp.ID})
+	}
+
+	s.mu.Lock()
+	s.pending[order.ID()] = requests
+	s.mu.Unlock()
+	return nil
+}
+
+// FormatSummary renders a purchase order and its largest lines
+func FormatSummary(order odoo.Record, lines []odoo.Record) string {
+	_, vendor := order.Many2one("partner_id")
+	_, currency := order.Many2one("currency_id")
+	_, buyer := order.Many2one("user_id")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* needs your approval\n", order.String("name"))
+	fmt.Fprintf(&b, "Vendor: %s\n", vendor)
+	fmt.Fprintf(&b, "Total: %s %s", whatsapp.FormatAmount(order.Float("amount_total")), currency)
+	if buyer != "" {
+		fmt.Fprintf(&b, "\nBuyer: %s", buyer)
+	}
+
+	for i, line := range lines {
+		if i == maxSummaryLines {
+			fmt.Fprintf(&b, "\n…and %d more lines", len(lines)-maxSummaryLines)
+			break
+		}
+		name, _, _ := strings.Cut(line.String("name"), "\n")
+		fmt.Fprintf(&b, "\n• %s × %s: %s", whatsapp.FormatQuantity(line.Float("product_qty")), name, whatsapp.FormatAmount(line.Float("price_subtotal")))
+	}
+	return b.String()
+}
+
+// resolve tells every approver that was asked about an order how it ended
+func (s *Service) resolve(ctx context.Context, orderID int, text string) error {
+	s.mu.Lock()
+	requests := s.pending[orderID]
+	delete(s.pending, orderID)
+	s.mu.Unlock()
+
+	for _, r := range requests {
+		if err := s.send(ctx, r.To, r.MessageID, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// approverByPhone returns the approver messaging from waID. A number bound
+// to an Odoo user is that user, otherwise users are matched by phone.
+func (s *Service) approverByPhone(ctx context.Context, waID string) (*Approver, error) {
+	var userIDs []int
+	if user := odoo.UserFrom(ctx); user != nil {
+		userIDs = []int{user.ID}
+	} else {
+		users, err := s.odoo.SearchRead(ctx, "res.users", odoo.PhoneDomain(waID), []string{"id"}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search user: %w", err)
+		}
+		for _, u := range users {
+			userIDs = append(userIDs, u.ID())
+		}
+	}
+
+	approvers, err := s.Approvers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range userIDs {
+		for i := range approvers {
+			if approvers[i].UserID == id {
+				return &approvers[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// setState records an order's state and returns the one it replaces
+func (s *Service) setState(orderID int, state string) (previous string, known bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, known = s.states[orderID]
+	s.states[orderID] = state
+	return previous, known
+}
+
+func (s *Service) send(ctx context.Context, to, replyTo, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text, ReplyTo: replyTo})
+	return err
+}
+
+// parseReplyID splits "purchase:approve:12" into its action and order id
+func parseReplyID(replyID string) (string, int, error) {
+	parts := strings.Split(replyID, ":")
+	if len(parts) != 3 || (parts[1] != "approve" && parts[1] != "reject") {
+		return "", 0, fmt.Errorf("invalid reply id %q", replyID)
+	}
+	var id int
+	if _, err := fmt.Sscanf(parts[2], "%d", &id); err != nil {
+		return "", 0, fmt.Errorf("invalid reply id %q: %w", replyID, err)
+	}
+	return parts[1], id, nil
+}
+
+func stateIcon(state string) string {
+	if state == "cancel" {
+		return "❌"
+	}
+	return "✅"
+}
@@ -0,0 +1,173 @@
+package purchase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{}
+	service := NewService(recorder.Client(), sender)
+	service.logins = []string{"marc"}
+	return service, sender, recorder
+}
+
+func order(state string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           float64(12),
+		"name":         "P00012",
+		"state":        state,
+		"partner_id":   []interface{}{float64(9), "Wood Corner"},
+		"amount_total": 12500.0,
+		"currency_id":  []interface{}{float64(2), "USD"},
+		"user_id":      []interface{}{float64(2), "Mitchell Admin"},
+		"write_uid":    []interface{}{float64(2), "Mitchell Admin"},
+	}
+}
+
+var approvers = []map[string]interface{}{{"id": 7, "name": "Marc Demo", "mobile": "+6591112222", "phone": false}}
+
+func TestFormatSummary(t *testing.T) {
+	a := assert.New(t)
+
+	text := FormatSummary(odoo.Record(order("to approve")), []odoo.Record{
+		{"name": "[DESK] Desk\nOak finish", "product_qty": 10.0, "price_subtotal": 10000.0},
+		{"name": "Chair", "product_qty": 5.0, "price_subtotal": 2500.0},
+	})
+
+	a.Equal("*P00012* needs your approval\n"+
+		"Vendor: Wood Corner\n"+
+		"Total: 12,500.00 USD\n"+
+		"Buyer: Mitchell Admin\n"+
+		"• 10 × [DESK] Desk: 10,000.00\n"+
+		"• 5 × Chair: 2,500.00", text)
+}
+
+func TestHandleChangesRequestsApproval(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t, map[string]interface{}{
+		"res.users.search_read":           approvers,
+		"purchase.order.line.search_read": []interface{}{},
+	})
+
+	a.NoError(service.HandleChanges(context.Background(), []odoo.Record{order("to approve")}))
+
+	if a.Len(sender.Buttons, 1) {
+		a.Equal("+6591112222", sender.Buttons[0].To)
+		a.Equal("purchase:approve:12", sender.Buttons[0].Buttons[0].ID)
+		a.Equal("purchase:reject:12", sender.Buttons[0].Buttons[1].ID)
+	}
+
+	// Approving in the Odoo UI follows up on the request
+	approved := order("purchase")
+	a.NoError(service.HandleChanges(context.Background(), []odoo.Record{approved}))
+	if a.Len(sender.Messages, 1) {
+		a.Equal("✅ P00012 was approved in Odoo by Mitchell Admin.", sender.Messages[0].Message)
+		a.Equal("wamid.test1", sender.Messages[0].ReplyTo)
+	}
+}
+
+func TestHandleApprove(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"res.users.search_read":       approvers,
+		"purchase.order.read":         []interface{}{order("to approve")},
+		"purchase.order.message_post": 300,
+	})
+
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 7, Login: "marc", APIKey: "marc-key"})
+	err := service.Handle(ctx, whatsapp.WebhookMessage{
+		SenderID: "6591112222",
+		Type:     "interactive",
+		ReplyID:  "purchase:approve:12",
+	})
+
+	a.NoError(err)
+	var methods []string
+	for _, c := range recorder.Calls() {
+		if c.Model == "purchase.order" {
+			methods = append(methods, c.Method)
+		}
+	}
+	a.Equal([]string{"read", "button_approve", "message_post"}, methods)
+	state, _ := service.setState(12, "purchase")
+	a.Equal("purchase", state)
+	a.Empty(sender.Messages, "no approval request was pending")
+}
+
+func TestHandleApproveAsBoundUser(t *testing.T) {
+	a := assert.New(t)
+	service, _, recorder := newTestService(t, map[string]interface{}{
+		"res.users.search_read":       approvers,
+		"purchase.order.read":         []interface{}{order("to approve")},
+		"purchase.order.message_post": 300,
+	})
+
+	// The binding identifies the approver even from another number
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 7, Login: "marc", APIKey: "marc-key"})
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{
+		SenderID: "6590000000",
+		Type:     "interactive",
+		ReplyID:  "purchase:approve:12",
+	}))
+
+	var approved bool
+	for _, c := range recorder.Calls() {
+		a.Equal(7, c.UID, "%s.%s", c.Model, c.Method)
+		approved = approved || c.Method == "button_approve"
+	}
+	a.True(approved)
+}
+
+func TestHandleRefusesWithoutAPIKey(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"res.users.search_read": approvers,
+	})
+
+	// Matched by phone only, the order would be approved as the service account
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6591112222",
+		Type:     "interactive",
+		ReplyID:  "purchase:approve:12",
+	}))
+	a.Contains(sender.LastText(), "link this number to your Odoo user with an API key")
+	for _, c := range recorder.Calls() {
+		a.NotEqual("purchase.order", c.Model)
+	}
+
+	ctx := odoo.WithUser(context.Background(), &odoo.User{ID: 7, Login: "marc"})
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{
+		SenderID: "6591112222",
+		Type:     "interactive",
+		ReplyID:  "purchase:approve:12",
+	}))
+	a.Len(sender.Messages, 2)
+	for _, c := range recorder.Calls() {
+		a.NotEqual("purchase.order", c.Model)
+	}
+}
+
+func TestHandleRejectsUnknownApprover(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t, map[string]interface{}{
+		"res.users.search_read": []interface{}{},
+	})
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6590000000",
+		Type:     "interactive",
+		ReplyID:  "purchase:approve:12",
+	}))
+	a.Equal("Sorry, you're not allowed to approve purchase orders.", sender.LastText())
+}
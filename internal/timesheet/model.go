@@ -0,0 +1,23 @@
+package timesheet
+
+import (
+	"time"
+)
+
+// Entry is a parsed timesheet message such as
+// "2h on Website Redesign task Footer: fixed the links"
+type Entry struct {
+	Date        time.Time
+	Hours       float64
+	Project     string
+	Task        string
+	Description string
+}
+
+// pending is an entry waiting for the user to pick its project or task
+type pending struct {
+	Entry       Entry
+	EmployeeID  int
+	ProjectID   int
+	ProjectName string
+}
@@ -0,0 +1,121 @@
+package timesheet
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	entryPattern = regexp.MustCompile(`(?i)^\s*(?:log\s+)?` +
+		`(?:(yesterday|today|\d{4}-\d{2}-\d{2}|mon(?:day)?|tue(?:sday)?|wed(?:nesday)?|thu(?:rsday)?|fri(?:day)?|sat(?:urday)?|sun(?:day)?)\s+)?` +
+		`(\d+(?:[.,]\d+)?\s*(?:h|hrs?|hours?)(?:\s*\d+\s*(?:m|mins?|minutes?)?)?|\d+\s*(?:m|mins?|minutes?)|\d{1,2}:\d{2})` +
+		`\s+(?:on|for)\s+(.+?)\s*$`)
+	weekPattern = regexp.MustCompile(`(?i)^\s*(?:my\s+week|(?:my\s+)?(?:timesheets?|hours)\s+(?:this\s+)?week)\s*\??\s*$`)
+
+	hoursPattern   = regexp.MustCompile(`(?i)^(\d+(?:[.,]\d+)?)\s*(?:h|hrs?|hours?)(?:\s*(\d+)\s*(?:m|mins?|minutes?)?)?$`)
+	minutesPattern = regexp.MustCompile(`(?i)^(\d+)\s*(?:m|mins?|minutes?)$`)
+	clockPattern   = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	taskSeparator  = regexp.MustCompile(`(?i)\s+(?:task|/|>)\s+`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// IsEntry reports whether text looks like a timesheet entry
+func IsEntry(text string) bool {
+	return entryPattern.MatchString(text)
+}
+
+// IsWeekSummary reports whether text asks for this week's timesheets
+func IsWeekSummary(text string) bool {
+	return weekPattern.MatchString(text)
+}
+
+// ParseEntry parses a timesheet message. Dates default to today, which is
+// given in the employee's timezone.
+func ParseEntry(text string, today time.Time) (Entry, error) {
+	m := entryPattern.FindStringSubmatch(text)
+	if m == nil {
+		return Entry{}, fmt.Errorf(`I couldn't read that. Try "2h on <project> task <task>: <what you did>".`)
+	}
+
+	date, err := parseDate(m[1], today)
+	if err != nil {
+		return Entry{}, err
+	}
+	hours, err := parseDuration(m[2])
+	if err != nil {
+		return Entry{}, err
+	}
+
+	target, description, _ := strings.Cut(m[3], ":")
+	project, task := strings.TrimSpace(target), ""
+	if loc := taskSeparator.FindStringIndex(project); loc != nil {
+		project, task = strings.TrimSpace(project[:loc[0]]), strings.TrimSpace(project[loc[1]:])
+	}
+	project = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(project, "project "), "Project "))
+	if project == "" {
+		return Entry{}, fmt.Errorf("Which project did you work on?")
+	}
+
+	return Entry{
+		Date:        date,
+		Hours:       hours,
+		Project:     project,
+		Task:        task,
+		Description: strings.TrimSpace(description),
+	}, nil
+}
+
+// parseDuration reads "2h", "1.5 hours", "2h30", "45m" or "1:30" as hours
+func parseDuration(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if m := hoursPattern.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+		if m[2] != "" {
+			minutes, _ := strconv.Atoi(m[2])
+			hours += float64(minutes) / 60
+		}
+		return hours, nil
+	}
+	if m := minutesPattern.FindStringSubmatch(s); m != nil {
+		minutes, _ := strconv.Atoi(m[1])
+		return float64(minutes) / 60, nil
+	}
+	if m := clockPattern.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.Atoi(m[1])
+		minutes, _ := strconv.Atoi(m[2])
+		return float64(hours) + float64(minutes)/60, nil
+	}
+	return 0, fmt.Errorf("I couldn't read the duration %q.", s)
+}
+
+// parseDate resolves today, yesterday, a weekday (the most recent one, today
+// included) or an ISO date
+func parseDate(s string, today time.Time) (time.Time, error) {
+	s = strings.ToLower(s)
+	switch {
+	case s == "" || s == "today":
+		return today, nil
+	case s == "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case len(s) >= 3:
+		if day, ok := weekdays[s[:3]]; ok {
+			offset := (int(today.Weekday()) - int(day) + 7) % 7
+			return today.AddDate(0, 0, -offset), nil
+		}
+	}
+
+	date, err := time.ParseInLocation(dateLayout, s, today.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("I couldn't read the date %q.", s)
+	}
+	return date, nil
+}
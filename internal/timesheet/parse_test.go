@@ -0,0 +1,44 @@
+package timesheet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEntry(t *testing.T) {
+	a := assert.New(t)
+	// A Wednesday
+	today := time.Date(2025, 3, 12, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		text  string
+		entry Entry
+	}{
+		{"2h on Project X task Y: fixed pump", Entry{Date: today, Hours: 2, Project: "X", Task: "Y", Description: "fixed pump"}},
+		{"log 1h30 on Website Redesign / Footer", Entry{Date: today, Hours: 1.5, Project: "Website Redesign", Task: "Footer"}},
+		{"yesterday 45m on Internal: standup", Entry{Date: today.AddDate(0, 0, -1), Hours: 0.75, Project: "Internal", Description: "standup"}},
+		{"monday 1:15 on Office Design", Entry{Date: today.AddDate(0, 0, -2), Hours: 1.25, Project: "Office Design"}},
+		{"2025-03-03 7,5 hours for R&D > Prototype: soldering", Entry{Date: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), Hours: 7.5, Project: "R&D", Task: "Prototype", Description: "soldering"}},
+	}
+
+	for _, tt := range tests {
+		entry, err := ParseEntry(tt.text, today)
+		if a.NoError(err, tt.text) {
+			a.Equal(tt.entry, entry, tt.text)
+		}
+	}
+
+	_, err := ParseEntry("fixed the pump", today)
+	a.Error(err)
+}
+
+func TestIsWeekSummary(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(IsWeekSummary("my week"))
+	a.True(IsWeekSummary("Timesheets this week?"))
+	a.True(IsWeekSummary("hours week"))
+	a.False(IsWeekSummary("2h on my week planning"))
+}
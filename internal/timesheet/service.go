@@ -0,0 +1,295 @@
+package timesheet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/fuzzy"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+)
+
+// maxChoices is the number of rows a WhatsApp list message can hold
+const maxChoices = 10
+
+// Service logs timesheets (account.analytic.line) from WhatsApp for the
+// employee linked to the sender's number
+type Service struct {
+	odoo     *odoo.Client
+	sender   agent.Sender
+	sessions *agent.Sessions
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewService(client *odoo.Client, sender agent.Sender, sessions *agent.Sessions) *Service {
+	return &Service{odoo: client, sender: sender, sessions: sessions, now: time.Now}
+}
+
+func (s *Service) Name() string {
+	return "timesheet"
+}
+
+func (s *Service) Help() string {
+	return `"2h on <project> task <task>: <what you did>" to log time, or "my week" for your timesheets`
+}
+
+func (s *Service) Match(msg whatsapp.WebhookMessage) bool {
+	return msg.Type == "text" && (IsEntry(msg.Body) || IsWeekSummary(msg.Body))
+}
+
+func (s *Service) Handle(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	if msg.ReplyID != "" {
+		return s.handleChoice(ctx, msg)
+	}
+
+	// The employee and projects fall back on their last known values so that
+	// entries are queued while Odoo is down
+	employee, err := s.odoo.EmployeeByPhone(odoo.LastKnown(ctx), msg.SenderID, []string{"name", "tz"})
+	if err != nil {
+		return err
+	}
+	if employee == nil {
+		return s.send(ctx, msg.SenderID, "Your number isn't linked to an employee in Odoo, so I can't log time for you.")
+	}
+	today := s.today(employee.String("tz"))
+
+	if IsWeekSummary(msg.Body) {
+		return s.sendWeekSummary(ctx, msg.SenderID, employee.ID(), today)
+	}
+
+	entry, err := ParseEntry(msg.Body, today)
+	if err != nil {
+		return s.send(ctx, msg.SenderID, err.Error())
+	}
+	if entry.Hours <= 0 || entry.Hours > 24 {
+		return s.send(ctx, msg.SenderID, "A timesheet entry must be between a few minutes and 24 hours.")
+	}
+	if entry.Date.After(today) {
+		return s.send(ctx, msg.SenderID, "You can't log time in the future.")
+	}
+
+	p := &pending{Entry: entry, EmployeeID: employee.ID()}
+	projects, err := s.match(ctx, "project.project", odoo.Domain{odoo.Cond("allow_timesheets", "=", true)}, entry.Project)
+	if err != nil {
+		return err
+	}
+	switch len(projects) {
+	case 0:
+		return s.send(ctx, msg.SenderID, fmt.Sprintf("I couldn't find a project called \"%s\".", entry.Project))
+	case 1:
+		p.ProjectID, p.ProjectName = projects[0].ID(), projects[0].String("name")
+		return s.resolveTask(ctx, msg.SenderID, p)
+	default:
+		s.sessions.Hold(msg.SenderID, s.Name(), p)
+		return s.sendChoices(ctx, msg.SenderID, "project", fmt.Sprintf("Which project is \"%s\"?", entry.Project), projects)
+	}
+}
+
+// handleChoice continues an entry after the user picked a project or task
+func (s *Service) handleChoice(ctx context.Context, msg whatsapp.WebhookMessage) error {
+	session := s.sessions.Get(msg.SenderID)
+	if session == nil || session.Capability != s.Name() {
+		return s.send(ctx, msg.SenderID, "That choice has expired, please send your timesheet again.")
+	}
+	p := session.Data.(*pending)
+
+	var kind string
+	var id int
+	if _, err := fmt.Sscanf(strings.Replace(msg.ReplyID, ":", " ", 2), "timesheet %s %d", &kind, &id); err != nil {
+		return fmt.Errorf("invalid reply id %q: %w", msg.ReplyID, err)
+	}
+
+	switch kind {
+	case "project":
+		p.ProjectID, p.ProjectName = id, msg.Body
+		return s.resolveTask(ctx, msg.SenderID, p)
+	case "task":
+		s.sessions.End(msg.SenderID)
+		return s.log(ctx, msg.SenderID, p, id, msg.Body)
+	}
+	return fmt.Errorf("invalid reply id %q", msg.ReplyID)
+}
+
+// resolveTask matches the entry's task within its project and logs the entry
+func (s *Service) resolveTask(ctx context.Context, to string, p *pending) error {
+	if p.Entry.Task == "" {
+		s.sessions.End(to)
+		return s.log(ctx, to, p, 0, "")
+	}
+
+	tasks, err := s.match(ctx, "project.task", odoo.Domain{odoo.Cond("project_id", "=", p.ProjectID)}, p.Entry.Task)
+	if err != nil {
+		return err
+	}
+	switch len(tasks) {
+	case 0:
+		s.sessions.End(to)
+		return s.send(ctx, to, fmt.Sprintf("I couldn't find a task called \"%s\" in %s.", p.Entry.Task, p.ProjectName))
+	case 1:
+		s.sessions.End(to)
+		return s.log(ctx, to, p, tasks[0].ID(), tasks[0].String("name"))
+	default:
+		s.sessions.Hold(to, s.Name(), p)
+		return s.sendChoices(ctx, to, "task", fmt.Sprintf("Which task of %s is \"%s\"?", p.ProjectName, p.Entry.Task), tasks)
+	}
+}
+
+// log creates the analytic line and confirms it to the user
+func (s *Service) log(ctx context.Context, to string, p *pending, taskID int, taskName string) error {
+	description := p.Entry.Description
+	if description == "" {
+		description = "/"
+	}
+
+	values := map[string]interface{}{
+		"date":        p.Entry.Date.Format(dateLayout),
+		"name":        description,
+		"unit_amount": p.Entry.Hours,
+		"project_id":  p.ProjectID,
+		"employee_id": p.EmployeeID,
+	}
+	if taskID != 0 {
+		values["task_id"] = taskID
+	}
+	target := p.ProjectName
+	if taskName != "" {
+		target += " / " + taskName
+	}
+
+	// The timesheet is logged once Odoo is back if it can't be reached now
+	summary := fmt.Sprintf("your %s on %s", formatHours(p.Entry.Hours), target)
+	_, err := s.odoo.Create(odoo.Queueable(ctx, to, summary), "account.analytic.line", values)
+	if errors.Is(err, odoo.ErrQueued) {
+		return s.send(ctx, to, fmt.Sprintf("⏳ Odoo is unreachable right now. I'll log %s as soon as it's back and let you know.", summary))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create timesheet: %w", err)
+	}
+
+	text := fmt.Sprintf("✅ Logged %s on %s for %s", formatHours(p.Entry.Hours), target, p.Entry.Date.Format("Mon 2 Jan"))
+	if p.Entry.Description != "" {
+		text += ": " + p.Entry.Description
+	}
+	return s.send(ctx, to, text)
+}
+
+// match returns the records of model whose name matches term: the single
+// best fuzzy match, or every close candidate when it's ambiguous
+func (s *Service) match(ctx context.Context, model string, domain odoo.Domain, term string) ([]odoo.Record, error) {
+	records, err := s.odoo.SearchRead(odoo.LastKnown(ctx), model, domain, []string{"name"}, &odoo.SearchOptions{Limit: 500})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", model, err)
+	}
+
+	names := make([]string, len(records))
+	for i, r := range records {
+		names[i] = r.String("name")
+	}
+
+	if best, ok := fuzzy.Best(term, names); ok {
+		return []odoo.Record{records[best.Index]}, nil
+	}
+	var candidates []odoo.Record
+	for _, m := range fuzzy.Rank(term, names) {
+		if len(candidates) == maxChoices {
+			break
+		}
+		candidates = append(candidates, records[m.Index])
+	}
+	return candidates, nil
+}
+
+func (s *Service) sendChoices(ctx context.Context, to, kind, body string, records []odoo.Record) error {
+	rows := make([]whatsapp.ListRow, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, whatsapp.ListRow{
+			ID:    fmt.Sprintf("timesheet:%s:%d", kind, r.ID()),
+			Title: r.String("name"),
+		})
+	}
+
+	_, err := s.sender.SendList(ctx, whatsapp.ListMessage{
+		To:       to,
+		Body:     body,
+		Button:   "Choose " + kind,
+		Sections: []whatsapp.ListSection{{Rows: rows}},
+	})
+	return err
+}
+
+// sendWeekSummary reports the hours logged since Monday per day and project
+func (s *Service) sendWeekSummary(ctx context.Context, to string, employeeID int, today time.Time) error {
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	lines, err := s.odoo.SearchRead(ctx, "account.analytic.line", odoo.Domain{
+		odoo.Cond("employee_id", "=", employeeID),
+		odoo.Cond("project_id", "!=", false),
+		odoo.Cond("date", ">=", monday.Format(dateLayout)),
+		odoo.Cond("date", "<=", today.Format(dateLayout)),
+	}, []string{"date", "unit_amount", "project_id"}, &odoo.SearchOptions{Order: "date"})
+	if err != nil {
+		return fmt.Errorf("failed to search timesheets: %w", err)
+	}
+
+	return s.send(ctx, to, FormatWeek(monday, today, lines))
+}
+
+// FormatWeek renders the timesheet lines of a week as a WhatsApp message
+func FormatWeek(monday, today time.Time, lines []odoo.Record) string {
+	byDay := map[string]float64{}
+	byProject := map[string]float64{}
+	var total float64
+	for _, l := range lines {
+		_, project := l.Many2one("project_id")
+		byDay[l.String("date")] += l.Float("unit_amount")
+		byProject[project] += l.Float("unit_amount")
+		total += l.Float("unit_amount")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Your timesheets since %s*", monday.Format("Mon 2 Jan"))
+	for day := monday; !day.After(today); day = day.AddDate(0, 0, 1) {
+		fmt.Fprintf(&b, "\n%s: %s", day.Format("Mon 2"), formatHours(byDay[day.Format(dateLayout)]))
+	}
+
+	if len(byProject) > 0 {
+		projects := make([]string, 0, len(byProject))
+		for p := range byProject {
+			projects = append(projects, p)
+		}
+		sort.Slice(projects, func(i, j int) bool { return byProject[projects[i]] > byProject[projects[j]] })
+
+		b.WriteString("\n\n*By project*")
+		for _, p := range projects {
+			fmt.Fprintf(&b, "\n• %s: %s", p, formatHours(byProject[p]))
+		}
+	}
+	fmt.Fprintf(&b, "\n\n*Total: %s*", formatHours(total))
+	return b.String()
+}
+
+// today returns the current date at midnight in the employee's timezone
+func (s *Service) today(tz string) time.Time {
+	location, err := time.LoadLocation(tz)
+	if err != nil || tz == "" {
+		location = time.UTC
+	}
+	now := s.now().In(location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+}
+
+func (s *Service) send(ctx context.Context, to, text string) error {
+	_, err := s.sender.SendMessage(ctx, whatsapp.OutgoingMessage{To: to, Message: text})
+	return err
+}
+
+// formatHours prints hours the way Odoo's timesheet widget does, e.g. 1:30
+func formatHours(hours float64) string {
+	minutes := int(hours*60 + 0.5)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
@@ -0,0 +1,115 @@
+package timesheet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/agent/agenttest"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/odoo/odootest"
+	"github.com/pclk/waOdoo/internal/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestService runs the service against a recorder answering calls with
+// the results keyed by "model.method"
+func newTestService(t *testing.T, results map[string]interface{}) (*Service, *agenttest.Sender, *odootest.Recorder) {
+	recorder := odootest.NewRecorder(t, results)
+
+	sender := &agenttest.Sender{}
+	service := NewService(recorder.Client(), sender, agent.NewSessions(time.Minute))
+	// Wednesday 12 March 2025, 01:00 in Singapore
+	service.now = func() time.Time { return time.Date(2025, 3, 11, 17, 0, 0, 0, time.UTC) }
+	return service, sender, recorder
+}
+
+var employee = []map[string]interface{}{{"id": 4, "name": "Ana", "tz": "Asia/Singapore"}}
+
+func TestHandleLogsEntry(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"hr.employee.search_read":      employee,
+		"project.project.search_read":  []map[string]interface{}{{"id": 1, "name": "Office Design"}, {"id": 2, "name": "Website Redesign"}},
+		"project.task.search_read":     []map[string]interface{}{{"id": 20, "name": "Fix footer links"}, {"id": 21, "name": "Hero banner"}},
+		"account.analytic.line.create": 500,
+	})
+
+	err := service.Handle(context.Background(), whatsapp.WebhookMessage{
+		SenderID: "6598765432",
+		Type:     "text",
+		Body:     "2h on website redesing task footer: fixed the links",
+	})
+
+	a.NoError(err)
+	calls := recorder.Calls()
+	create := calls[len(calls)-1]
+	if a.Equal("create", create.Method) {
+		values := create.Args[0].(map[string]interface{})
+		a.Equal("2025-03-12", values["date"], "the date is today in the employee's timezone")
+		a.Equal(float64(2), values["unit_amount"])
+		a.Equal(float64(2), values["project_id"])
+		a.Equal(float64(20), values["task_id"])
+		a.Equal(float64(4), values["employee_id"])
+	}
+	a.Equal("✅ Logged 2:00 on Website Redesign / Fix footer links for Wed 12 Mar: fixed the links", sender.LastText())
+}
+
+func TestHandleAsksForAmbiguousProject(t *testing.T) {
+	a := assert.New(t)
+	service, sender, recorder := newTestService(t, map[string]interface{}{
+		"hr.employee.search_read":      employee,
+		"project.project.search_read":  []map[string]interface{}{{"id": 1, "name": "Office Design"}, {"id": 3, "name": "Garden Design"}},
+		"account.analytic.line.create": 501,
+	})
+	ctx := context.Background()
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{SenderID: "6598765432", Type: "text", Body: "30m on design"}))
+	if a.Len(sender.Lists, 1) {
+		a.Len(sender.Lists[0].Sections[0].Rows, 2)
+	}
+
+	a.NoError(service.Handle(ctx, whatsapp.WebhookMessage{
+		SenderID: "6598765432",
+		Type:     "interactive",
+		Body:     "Garden Design",
+		ReplyID:  "timesheet:project:3",
+	}))
+	calls := recorder.Calls()
+	create := calls[len(calls)-1]
+	if a.Equal("create", create.Method) {
+		a.Equal(float64(3), create.Args[0].(map[string]interface{})["project_id"])
+	}
+	a.Equal("✅ Logged 0:30 on Garden Design for Wed 12 Mar", sender.LastText())
+}
+
+func TestHandleRejectsUnknownEmployee(t *testing.T) {
+	a := assert.New(t)
+	service, sender, _ := newTestService(t, map[string]interface{}{
+		"hr.employee.search_read": []interface{}{},
+	})
+
+	a.NoError(service.Handle(context.Background(), whatsapp.WebhookMessage{SenderID: "6590000000", Type: "text", Body: "2h on Internal"}))
+	a.Contains(sender.LastText(), "isn't linked to an employee")
+}
+
+func TestFormatWeek(t *testing.T) {
+	a := assert.New(t)
+	monday := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	text := FormatWeek(monday, monday.AddDate(0, 0, 2), []odoo.Record{
+		{"date": "2025-03-10", "unit_amount": 6.0, "project_id": []interface{}{2.0, "Website Redesign"}},
+		{"date": "2025-03-10", "unit_amount": 1.5, "project_id": []interface{}{1.0, "Internal"}},
+		{"date": "2025-03-12", "unit_amount": 2.0, "project_id": []interface{}{2.0, "Website Redesign"}},
+	})
+
+	a.Equal("*Your timesheets since Mon 10 Mar*\n"+
+		"Mon 10: 7:30\n"+
+		"Tue 11: 0:00\n"+
+		"Wed 12: 2:00\n\n"+
+		"*By project*\n"+
+		"• Website Redesign: 8:00\n"+
+		"• Internal: 1:30\n\n"+
+		"*Total: 9:30*", text)
+}
@@ -0,0 +1,18 @@
+package whatsapp
+
+import "context"
+
+type phoneNumberIDKey struct{}
+
+// WithPhoneNumberID returns a context whose messages are sent from the
+// business phone number with the given id
+func WithPhoneNumberID(ctx context.Context, phoneNumberID string) context.Context {
+	return context.WithValue(ctx, phoneNumberIDKey{}, phoneNumberID)
+}
+
+// PhoneNumberIDFrom returns the phone number id set by WithPhoneNumberID, or
+// "" when messages are sent from the account's first number
+func PhoneNumberIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(phoneNumberIDKey{}).(string)
+	return id
+}
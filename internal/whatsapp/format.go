@@ -0,0 +1,34 @@
+package whatsapp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FormatQuantity rounds to the precision Odoo shows by default and drops
+// trailing zeros, so 3.0 prints as 3 and 2.50 as 2.5
+func FormatQuantity(q float64) string {
+	return strconv.FormatFloat(math.Round(q*1000)/1000, 'f', -1, 64)
+}
+
+// FormatAmount prints a monetary amount with two decimals and thousands
+// separators, e.g. 12,500.00
+func FormatAmount(amount float64) string {
+	s := strconv.FormatFloat(math.Abs(amount), 'f', 2, 64)
+	whole, decimals, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if amount < 0 && s != "0.00" {
+		b.WriteString("-")
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(",")
+		}
+		b.WriteRune(digit)
+	}
+	b.WriteString(".")
+	b.WriteString(decimals)
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package whatsapp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAmount(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("0.00", FormatAmount(0))
+	a.Equal("999.50", FormatAmount(999.5))
+	a.Equal("12,500.00", FormatAmount(12500))
+	a.Equal("-1,234,567.89", FormatAmount(-1234567.891))
+}
+
+func TestFormatQuantity(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("3", FormatQuantity(3))
+	a.Equal("2.5", FormatQuantity(2.50))
+	a.Equal("0.3", FormatQuantity(0.1+0.2))
+}
@@ -0,0 +1,39 @@
+package whatsapp
+
+import (
+	"mime"
+	"strings"
+)
+
+// commonExtensions picks the usual extension for MIME types where Go's table
+// offers several, e.g. .jpe/.jpeg/.jpg for image/jpeg
+var commonExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/webp":      ".webp",
+	"audio/ogg":       ".ogg",
+	"audio/mpeg":      ".mp3",
+	"video/mp4":       ".mp4",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+// MediaFilename builds a filename for media that arrived without one, such
+// as photos, e.g. "image-wamid.HBgL.jpg"
+func MediaFilename(kind, messageID, mimeType string) string {
+	// Voice notes are sent as "audio/ogg; codecs=opus"
+	base, _, _ := strings.Cut(mimeType, ";")
+	base = strings.TrimSpace(base)
+
+	ext, ok := commonExtensions[base]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(base); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	name := kind
+	if messageID != "" {
+		name += "-" + messageID
+	}
+	return name + ext
+}
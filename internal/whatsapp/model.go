@@ -3,12 +3,44 @@ package whatsapp
 // WebhookMessage represents an incoming WhatsApp message from the webhook
 type WebhookMessage struct {
 	SenderID    string                 `json:"sender_id"`
+	SenderName  string                 `json:"sender_name,omitempty"`
 	RecipientID string                 `json:"recipient_id"`
 	Timestamp   string                 `json:"timestamp"`
 	MessageID   string                 `json:"message_id"`
 	Body        string                 `json:"body"`
 	Type        string                 `json:"type"`
+	ReplyID     string                 `json:"reply_id,omitempty"`
 	Media       map[string]interface{} `json:"media,omitempty"`
+	Referral    *Referral              `json:"referral,omitempty"`
+}
+
+// MediaID returns the id of the media attached to an image, document, audio,
+// video or sticker message
+func (m WebhookMessage) MediaID() string {
+	id, _ := m.Media["id"].(string)
+	return id
+}
+
+// MediaFilename returns the original filename of a document message, or a
+// name derived from the message type and MIME type for other media
+func (m WebhookMessage) MediaFilename() string {
+	if name, ok := m.Media["filename"].(string); ok && name != "" {
+		return name
+	}
+	mimeType, _ := m.Media["mime_type"].(string)
+	return MediaFilename(m.Type, m.MessageID, mimeType)
+}
+
+// Referral describes the click-to-WhatsApp ad or post that led the user to
+// start the conversation
+type Referral struct {
+	SourceURL  string `json:"source_url"`
+	SourceID   string `json:"source_id"`
+	SourceType string `json:"source_type"`
+	Headline   string `json:"headline,omitempty"`
+	Body       string `json:"body,omitempty"`
+	MediaType  string `json:"media_type,omitempty"`
+	CtwaClid   string `json:"ctwa_clid,omitempty"`
 }
 
 // MessageResponse represents the API response for message operations
@@ -17,3 +49,71 @@ type MessageResponse struct {
 	Message string `json:"message"`
 	ID      string `json:"id,omitempty"`
 }
+
+// TemplateMessage is a pre-approved message template. Templates are the only
+// messages a business may send outside the 24 hour customer service window.
+type TemplateMessage struct {
+	To       string `json:"to"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	// BodyParameters fill the template's {{1}}, {{2}}, ... placeholders
+	BodyParameters []string `json:"body_parameters,omitempty"`
+}
+
+// ImageMessage is an image uploaded with UploadMedia
+type ImageMessage struct {
+	To      string `json:"to"`
+	MediaID string `json:"media_id"`
+	Caption string `json:"caption,omitempty"`
+	// ReplyTo quotes an earlier message, given by its wamid
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// ButtonMessage is an interactive message with up to three reply buttons
+type ButtonMessage struct {
+	To      string   `json:"to"`
+	Header  string   `json:"header,omitempty"`
+	Body    string   `json:"body"`
+	Footer  string   `json:"footer,omitempty"`
+	Buttons []Button `json:"buttons"`
+	ReplyTo string   `json:"reply_to,omitempty"`
+}
+
+// Button is a reply button; its ID comes back as the ReplyID of the user's
+// answer
+type Button struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// ListMessage is an interactive message that lets the user pick one row
+// from up to ten options grouped in sections
+type ListMessage struct {
+	To       string        `json:"to"`
+	Header   string        `json:"header,omitempty"`
+	Body     string        `json:"body"`
+	Footer   string        `json:"footer,omitempty"`
+	Button   string        `json:"button"`
+	Sections []ListSection `json:"sections"`
+}
+
+// ListSection groups rows of a ListMessage under a title
+type ListSection struct {
+	Title string    `json:"title,omitempty"`
+	Rows  []ListRow `json:"rows"`
+}
+
+// ListRow is a selectable option; its ID comes back as the ReplyID of the
+// user's answer
+type ListRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// Media is downloaded media content
+type Media struct {
+	ID       string
+	MimeType string
+	Data     []byte
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"strings"
 )
@@ -17,6 +19,10 @@ type Service struct {
 	BusinessAccountID string
 	APIVersion        string
 	WebhookSecret     string
+	// TemplateLanguage is used for templates sent without a language
+	TemplateLanguage string
+
+	handlers []MessageHandler
 }
 
 func NewService() *Service {
@@ -25,45 +31,274 @@ func NewService() *Service {
 		BusinessAccountID: os.Getenv("META_WA_BUSINESS_ID"),
 		APIVersion:        os.Getenv("META_WA_API_VERSION"),
 		WebhookSecret:     os.Getenv("META_WA_WEBHOOK_SECRET"),
+		TemplateLanguage:  templateLanguage(),
 	}
 }
 
+func templateLanguage() string {
+	if language := os.Getenv("META_WA_TEMPLATE_LANGUAGE"); language != "" {
+		return language
+	}
+	return "en_US"
+}
+
 // OutgoingMessage represents a message to be sent via WhatsApp
 type OutgoingMessage struct {
 	To       string `json:"to" example:"6598232744"`
 	Message  string `json:"message" example:"hi"`
 	MediaURL string `json:"media_url,omitempty"`
+	// ReplyTo quotes an earlier message, given by its wamid
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// MessageHandler is called for every message received through the webhook
+type MessageHandler func(ctx context.Context, msg WebhookMessage) error
+
+// OnMessage registers a handler for incoming messages
+func (s *Service) OnMessage(h MessageHandler) {
+	s.handlers = append(s.handlers, h)
 }
 
 // SendMessage implements sending a message via Meta's WhatsApp Business API
 func (s *Service) SendMessage(c context.Context, msg OutgoingMessage) (*MessageResponse, error) {
-	// Build the Graph API URL
-	var phoneID string
+	payload := map[string]interface{}{
+		"type": "text",
+		"text": map[string]string{
+			"body": msg.Message,
+		},
+	}
+	if msg.ReplyTo != "" {
+		payload["context"] = map[string]string{"message_id": msg.ReplyTo}
+	}
+	return s.postMessage(c, msg.To, payload)
+}
+
+// SendButtons sends an interactive message with reply buttons
+func (s *Service) SendButtons(c context.Context, msg ButtonMessage) (*MessageResponse, error) {
+	buttons := make([]map[string]interface{}, 0, len(msg.Buttons))
+	for _, b := range msg.Buttons {
+		buttons = append(buttons, map[string]interface{}{
+			"type": "reply",
+			"reply": map[string]string{
+				"id":    b.ID,
+				"title": truncate(b.Title, 20),
+			},
+		})
+	}
+
+	interactive := map[string]interface{}{
+		"type": "button",
+		"body": map[string]string{"text": msg.Body},
+		"action": map[string]interface{}{
+			"buttons": buttons,
+		},
+	}
+	if msg.Header != "" {
+		interactive["header"] = map[string]string{"type": "text", "text": truncate(msg.Header, 60)}
+	}
+	if msg.Footer != "" {
+		interactive["footer"] = map[string]string{"text": truncate(msg.Footer, 60)}
+	}
+
+	payload := map[string]interface{}{
+		"type":        "interactive",
+		"interactive": interactive,
+	}
+	if msg.ReplyTo != "" {
+		payload["context"] = map[string]string{"message_id": msg.ReplyTo}
+	}
+	return s.postMessage(c, msg.To, payload)
+}
+
+// SendList sends an interactive list message
+func (s *Service) SendList(c context.Context, msg ListMessage) (*MessageResponse, error) {
+	// Meta rejects list messages whose labels exceed these lengths
+	sections := make([]map[string]interface{}, 0, len(msg.Sections))
+	for _, section := range msg.Sections {
+		rows := make([]map[string]string, 0, len(section.Rows))
+		for _, row := range section.Rows {
+			r := map[string]string{
+				"id":    row.ID,
+				"title": truncate(row.Title, 24),
+			}
+			if row.Description != "" {
+				r["description"] = truncate(row.Description, 72)
+			}
+			rows = append(rows, r)
+		}
+		sec := map[string]interface{}{"rows": rows}
+		if section.Title != "" {
+			sec["title"] = truncate(section.Title, 24)
+		}
+		sections = append(sections, sec)
+	}
+
+	interactive := map[string]interface{}{
+		"type": "list",
+		"body": map[string]string{"text": msg.Body},
+		"action": map[string]interface{}{
+			"button":   truncate(msg.Button, 20),
+			"sections": sections,
+		},
+	}
+	if msg.Header != "" {
+		interactive["header"] = map[string]string{"type": "text", "text": truncate(msg.Header, 60)}
+	}
+	if msg.Footer != "" {
+		interactive["footer"] = map[string]string{"text": truncate(msg.Footer, 60)}
+	}
 
+	return s.postMessage(c, msg.To, map[string]interface{}{
+		"type":        "interactive",
+		"interactive": interactive,
+	})
+}
+
+// SendTemplate sends a message template with its body parameters
+func (s *Service) SendTemplate(c context.Context, msg TemplateMessage) (*MessageResponse, error) {
+	language := msg.Language
+	if language == "" {
+		language = s.TemplateLanguage
+	}
+
+	template := map[string]interface{}{
+		"name":     msg.Name,
+		"language": map[string]string{"code": language},
+	}
+	if len(msg.BodyParameters) > 0 {
+		parameters := make([]map[string]string, 0, len(msg.BodyParameters))
+		for _, p := range msg.BodyParameters {
+			parameters = append(parameters, map[string]string{"type": "text", "text": p})
+		}
+		template["components"] = []map[string]interface{}{
+			{"type": "body", "parameters": parameters},
+		}
+	}
+
+	return s.postMessage(c, msg.To, map[string]interface{}{
+		"type":     "template",
+		"template": template,
+	})
+}
+
+// SendImage sends an uploaded image with an optional caption
+func (s *Service) SendImage(c context.Context, msg ImageMessage) (*MessageResponse, error) {
+	image := map[string]string{"id": msg.MediaID}
+	if msg.Caption != "" {
+		image["caption"] = msg.Caption
+	}
+	payload := map[string]interface{}{
+		"type":  "image",
+		"image": image,
+	}
+	if msg.ReplyTo != "" {
+		payload["context"] = map[string]string{"message_id": msg.ReplyTo}
+	}
+	return s.postMessage(c, msg.To, payload)
+}
+
+// UploadMedia uploads a file to send in messages and returns its media id.
+// Meta keeps uploaded media for 30 days.
+func (s *Service) UploadMedia(c context.Context, data []byte, mimeType, filename string) (string, error) {
+	phoneID, err := s.phoneNumberID(c)
+	if err != nil {
+		return "", err
+	}
+	apiURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/media", s.APIVersion, phoneID)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("messaging_product", "whatsapp")
+	form.WriteField("type", mimeType)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	header.Set("Content-Type", mimeType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload: %w", err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(c, "POST", apiURL, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	return result.ID, nil
+}
+
+// phoneNumberID returns the number to send from: the one the conversation
+// came in on when there is one, otherwise the account's first number
+func (s *Service) phoneNumberID(c context.Context) (string, error) {
+	if phoneID := PhoneNumberIDFrom(c); phoneID != "" {
+		return phoneID, nil
+	}
 	phones, err := s.ListPhoneNumbers()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list phone numbers: %w", err)
+		return "", fmt.Errorf("failed to list phone numbers: %w", err)
+	}
+	if len(phones.Data) == 0 {
+		return "", fmt.Errorf("the business account has no phone numbers")
 	}
 	phone := phones.Data[0]
 	log.Printf("agent phone: %v", phone)
-	phoneID = phone.ID
+	return phone.ID, nil
+}
+
+// postMessage sends a message payload of any type to a recipient
+func (s *Service) postMessage(c context.Context, to string, payload map[string]interface{}) (*MessageResponse, error) {
+	// Build the Graph API URL
+	phoneID, err := s.phoneNumberID(c)
+	if err != nil {
+		return nil, err
+	}
 
 	apiURL := fmt.Sprintf("https://graph.facebook.com/%s/%s/messages",
 		s.APIVersion, phoneID)
 
 	// Format recipient phone number according to Meta requirements
-	// Remove "+" prefix if present, as Meta doesn't want it
-	recipient := strings.TrimPrefix(msg.To, "+")
+	// Keep only the digits, as Meta wants neither "+" nor separators
+	recipient := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, to)
 
 	// Prepare message request body according to Meta's format
 	requestBody := map[string]interface{}{
 		"messaging_product": "whatsapp",
 		"recipient_type":    "individual",
 		"to":                recipient,
-		"type":              "text",
-		"text": map[string]string{
-			"body": msg.Message,
-		},
+	}
+	for k, v := range payload {
+		requestBody[k] = v
 	}
 
 	// Convert to JSON
@@ -134,6 +369,15 @@ func (s *Service) SendMessage(c context.Context, msg OutgoingMessage) (*MessageR
 	}, nil
 }
 
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
 // ProcessWebhook handles Meta's WhatsApp webhook
 func (s *Service) ProcessWebhook(ctx context.Context, payload []byte) error {
 	// Parse the webhook payload
@@ -161,7 +405,24 @@ func (s *Service) ProcessWebhook(ctx context.Context, payload []byte) error {
 						Text      struct {
 							Body string `json:"body"`
 						} `json:"text,omitempty"`
-						Type string `json:"type"`
+						Image       *mediaObject `json:"image,omitempty"`
+						Document    *mediaObject `json:"document,omitempty"`
+						Audio       *mediaObject `json:"audio,omitempty"`
+						Video       *mediaObject `json:"video,omitempty"`
+						Sticker     *mediaObject `json:"sticker,omitempty"`
+						Interactive struct {
+							Type      string `json:"type"`
+							ListReply struct {
+								ID    string `json:"id"`
+								Title string `json:"title"`
+							} `json:"list_reply"`
+							ButtonReply struct {
+								ID    string `json:"id"`
+								Title string `json:"title"`
+							} `json:"button_reply"`
+						} `json:"interactive,omitempty"`
+						Referral *Referral `json:"referral,omitempty"`
+						Type     string    `json:"type"`
 					} `json:"messages"`
 				} `json:"value"`
 				Field string `json:"field"`
@@ -182,26 +443,58 @@ func (s *Service) ProcessWebhook(ctx context.Context, payload []byte) error {
 					// Extract and convert to our internal WebhookMessage format
 					senderID := message.From
 					messageText := ""
-					if message.Type == "text" {
+					replyID := ""
+					var media map[string]interface{}
+					switch message.Type {
+					case "text":
 						messageText = message.Text.Body
+					case "image", "document", "audio", "video", "sticker":
+						if m := firstMedia(message.Image, message.Document, message.Audio, message.Video, message.Sticker); m != nil {
+							media = m.toMap()
+							messageText = m.Caption
+						}
+					case "interactive":
+						// Replies to list and button messages carry the ID we set on the option
+						if message.Interactive.Type == "list_reply" {
+							replyID = message.Interactive.ListReply.ID
+							messageText = message.Interactive.ListReply.Title
+						} else {
+							replyID = message.Interactive.ButtonReply.ID
+							messageText = message.Interactive.ButtonReply.Title
+						}
+					}
+
+					senderName := ""
+					for _, contact := range change.Value.Contacts {
+						if contact.WaID == senderID {
+							senderName = contact.Profile.Name
+						}
 					}
 
 					internalMsg := WebhookMessage{
 						SenderID:    senderID,
+						SenderName:  senderName,
 						RecipientID: change.Value.Metadata.PhoneNumberID,
 						Timestamp:   message.Timestamp,
 						MessageID:   message.ID,
 						Body:        messageText,
 						Type:        message.Type,
+						ReplyID:     replyID,
+						Media:       media,
+						Referral:    message.Referral,
 					}
 
 					// Log the received message
 					fmt.Printf("Received message: %+v\n", internalMsg)
 
-					// Here you would typically:
-					// 1. Save the message to a database
-					// 2. Process it based on content
-					// 3. Potentially trigger an automated response
+					// Handler failures are only logged: returning an error would make
+					// Meta redeliver the whole batch
+					msgCtx := WithPhoneNumberID(ctx, internalMsg.RecipientID)
+					for _, handle := range s.handlers {
+						if err := handle(msgCtx, internalMsg); err != nil {
+							log.Printf("Failed to handle message %s: %v", internalMsg.MessageID, err)
+						}
+					}
 				}
 			}
 		}
@@ -210,6 +503,98 @@ func (s *Service) ProcessWebhook(ctx context.Context, payload []byte) error {
 	return nil
 }
 
+// mediaObject is the media part of an image, document, audio, video or
+// sticker message
+type mediaObject struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	Sha256   string `json:"sha256"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+func (m *mediaObject) toMap() map[string]interface{} {
+	media := map[string]interface{}{
+		"id":        m.ID,
+		"mime_type": m.MimeType,
+		"sha256":    m.Sha256,
+	}
+	if m.Caption != "" {
+		media["caption"] = m.Caption
+	}
+	if m.Filename != "" {
+		media["filename"] = m.Filename
+	}
+	return media
+}
+
+func firstMedia(objects ...*mediaObject) *mediaObject {
+	for _, m := range objects {
+		if m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// DownloadMedia fetches the content of a media object received through the
+// webhook. Meta keeps inbound media for 30 days.
+func (s *Service) DownloadMedia(c context.Context, mediaID string) (*Media, error) {
+	// The media endpoint returns a short-lived URL rather than the content
+	apiURL := fmt.Sprintf("https://graph.facebook.com/%s/%s", s.APIVersion, mediaID)
+	body, err := s.get(c, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media URL: %w", err)
+	}
+
+	var info struct {
+		URL      string `json:"url"`
+		MimeType string `json:"mime_type"`
+		Sha256   string `json:"sha256"`
+		FileSize int64  `json:"file_size"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse media info: %w", err)
+	}
+
+	data, err := s.get(c, info.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+
+	return &Media{
+		ID:       mediaID,
+		MimeType: info.MimeType,
+		Data:     data,
+	}, nil
+}
+
+// get performs an authenticated GET request against the Graph API
+func (s *Service) get(c context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(c, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
 // PhoneNumbersResponse represents the response structure from the phone numbers API
 type PhoneNumbersResponse struct {
 	Data   []PhoneNumber `json:"data"`
@@ -176,3 +176,62 @@ func TestProcessWebhookInvalidPayload(t *testing.T) {
 		"Error message should indicate parsing failure")
 	t.Log("Correctly detected invalid webhook payload")
 }
+
+func TestProcessWebhookInteractiveReply(t *testing.T) {
+	service, a := setup(t)
+	ctx := context.Background()
+
+	var received []WebhookMessage
+	var replyFrom string
+	service.OnMessage(func(ctx context.Context, msg WebhookMessage) error {
+		received = append(received, msg)
+		replyFrom = PhoneNumberIDFrom(ctx)
+		return nil
+	})
+
+	webhookPayload := `{
+		"object": "whatsapp_business_account",
+		"entry": [{
+			"id": "123456789",
+			"changes": [{
+				"value": {
+					"messaging_product": "whatsapp",
+					"metadata": {
+						"display_phone_number": "6591234567",
+						"phone_number_id": "9876543210"
+					},
+					"contacts": [{
+						"profile": {
+							"name": "Test User"
+						},
+						"wa_id": "6598765432"
+					}],
+					"messages": [{
+						"from": "6598765432",
+						"id": "wamid.test456",
+						"timestamp": "1677721357",
+						"interactive": {
+							"type": "list_reply",
+							"list_reply": {
+								"id": "inventory:product:10:0",
+								"title": "Office Chair"
+							}
+						},
+						"type": "interactive"
+					}]
+				},
+				"field": "messages"
+			}]
+		}]
+	}`
+
+	err := service.ProcessWebhook(ctx, []byte(webhookPayload))
+
+	a.NoError(err, "ProcessWebhook should not return an error for valid payload")
+	if a.Len(received, 1, "Handler should receive the message") {
+		a.Equal("inventory:product:10:0", received[0].ReplyID)
+		a.Equal("Office Chair", received[0].Body)
+		a.Equal("Test User", received[0].SenderName)
+		a.Equal("9876543210", replyFrom, "replies go out from the number that received the message")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"log"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,8 +18,32 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/pclk/waOdoo/docs" // Generated docs package
+	"github.com/pclk/waOdoo/internal/agent"
+	"github.com/pclk/waOdoo/internal/analytics"
+	"github.com/pclk/waOdoo/internal/attachment"
+	"github.com/pclk/waOdoo/internal/binding"
+	"github.com/pclk/waOdoo/internal/cache"
+	"github.com/pclk/waOdoo/internal/calendar"
+	"github.com/pclk/waOdoo/internal/chatter"
+	"github.com/pclk/waOdoo/internal/company"
+	"github.com/pclk/waOdoo/internal/connection"
+	"github.com/pclk/waOdoo/internal/crm"
+	"github.com/pclk/waOdoo/internal/custom"
 	"github.com/pclk/waOdoo/internal/database"
+	"github.com/pclk/waOdoo/internal/delivery"
+	"github.com/pclk/waOdoo/internal/digest"
+	"github.com/pclk/waOdoo/internal/expense"
+	"github.com/pclk/waOdoo/internal/filter"
+	"github.com/pclk/waOdoo/internal/helpdesk"
+	"github.com/pclk/waOdoo/internal/inventory"
+	"github.com/pclk/waOdoo/internal/leave"
 	"github.com/pclk/waOdoo/internal/ngrok"
+	"github.com/pclk/waOdoo/internal/notify"
+	"github.com/pclk/waOdoo/internal/odoo"
+	"github.com/pclk/waOdoo/internal/outbox"
+	"github.com/pclk/waOdoo/internal/project"
+	"github.com/pclk/waOdoo/internal/purchase"
+	"github.com/pclk/waOdoo/internal/timesheet"
 	"github.com/pclk/waOdoo/internal/whatsapp" // Import WhatsApp package
 	"gopkg.in/natefinch/lumberjack.v2"
 )
@@ -81,6 +107,10 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
 	// Initialize database connection
 	db, err := database.New(os.Getenv("DATABASE_URL"))
 	if err != nil {
@@ -104,13 +134,104 @@ func main() {
 	// Middleware
 	e.Use(middleware.Recover())
 
-	// Custom logger middleware
+	// Custom logger middleware. Odoo's webhooks pass their token in the query,
+	// so URIs are logged with it hidden.
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Output: multiWriter,
-		Format: "${time_rfc3339} ${remote_ip} ${method} ${uri} ${status} ${latency_human}\n",
+		Format: "${time_rfc3339} ${remote_ip} ${method} ${custom} ${status} ${latency_human}\n",
+		CustomTagFunc: func(c echo.Context, buf *bytes.Buffer) (int, error) {
+			return buf.WriteString(notify.LoggedURI(c.Request()))
+		},
 	}))
 
-	waHandler, _ := whatsapp.New()
+	waHandler, waService := whatsapp.New()
+
+	// Serve every configured Odoo database with its own set of capabilities
+	connectionConfigs, err := connection.LoadConfigs(os.Getenv("ODOO_CONNECTIONS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load Odoo connections: %v", err)
+	}
+	router := connection.NewRouter(connectionConfigs)
+
+	// Bind WhatsApp numbers to Odoo users so that their access rights apply
+	bindingStore := binding.NewPostgresStore(db)
+	if err := bindingStore.Migrate(context.Background()); err != nil {
+		log.Fatalf("Failed to migrate user bindings: %v", err)
+	}
+	registry, err := binding.NewRegistry(router, bindingStore)
+	if err != nil {
+		log.Fatalf("Failed to create user binding registry: %v", err)
+	}
+	router.Bindings = registry
+
+	leadRules, err := crm.LoadRules(os.Getenv("CRM_RULES_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load lead assignment rules: %v", err)
+	}
+	notifyRules, err := notify.LoadRules(os.Getenv("NOTIFY_RULES_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load notification rules: %v", err)
+	}
+	// Keep a local copy of frequently looked up records
+	cacheStore := cache.NewPostgresStore(db)
+	if err := cacheStore.Migrate(context.Background()); err != nil {
+		log.Fatalf("Failed to migrate record cache: %v", err)
+	}
+	cacheModels, err := cache.LoadModels(os.Getenv("CACHE_MODELS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load cached models: %v", err)
+	}
+
+	// Keep the writes made while Odoo is unreachable
+	writeStore := outbox.NewPostgresStore(db)
+	if err := writeStore.Migrate(context.Background()); err != nil {
+		log.Fatalf("Failed to migrate write queue: %v", err)
+	}
+
+	filterModels, err := filter.LoadModels(os.Getenv("FILTER_MODELS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load searchable models: %v", err)
+	}
+
+	customModels, err := custom.LoadModels(os.Getenv("CUSTOM_MODELS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load custom models: %v", err)
+	}
+
+	reports, err := analytics.LoadReports(os.Getenv("ANALYTICS_REPORTS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load reports: %v", err)
+	}
+
+	digests, err := digest.LoadDigests(os.Getenv("DIGESTS_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load digests: %v", err)
+	}
+
+	enabled := features{
+		defaultConnection: router.Connections()[0].Name(),
+		leadRules:         leadRules,
+		notifyRules:       notifyRules,
+		cacheStore:        cacheStore,
+		cacheModels:       cacheModels,
+		writeStore:        writeStore,
+		filterModels:      filterModels,
+		customModels:      customModels,
+		reports:           reports,
+		digests:           digests,
+		// Helpdesk is an Odoo Enterprise app, so it has to be enabled explicitly
+		helpdesk:          strings.ToLower(os.Getenv("HELPDESK_ENABLED")) == "true",
+		purchaseApprovals: strings.ToLower(os.Getenv("PURCHASE_APPROVALS_ENABLED")) == "true",
+	}
+
+	notifiers := map[string]*notify.Service{}
+	for _, conn := range router.Connections() {
+		notifiers[conn.Name()] = serveConnection(workerCtx, conn, waService, registry, enabled)
+	}
+	waService.OnMessage(router.HandleMessage)
+
+	// Deliver record events from Odoo automated actions
+	notifyHandler := notify.NewHandler(notifiers, enabled.defaultConnection)
 
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -127,6 +248,8 @@ func main() {
 
 	// Register routes
 	waHandler.RegisterRoutes(e)
+	notifyHandler.RegisterRoutes(e)
+	binding.NewHandler(registry).RegisterRoutes(e)
 
 	// Log server startup info
 	localAddr := ":1323"
@@ -152,6 +275,7 @@ func main() {
 	// Wait for interrupt signal to gracefully shut down the server
 	<-quit
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 	// Give outstanding requests a deadline for completion
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -175,6 +299,163 @@ func healthCheck(c echo.Context) error {
 	})
 }
 
+// features are the optional parts of waOdoo, the same for every connection
+type features struct {
+	// defaultConnection runs what isn't configured for a connection
+	defaultConnection string
+	leadRules         []crm.Rule
+	notifyRules       []notify.Rule
+	cacheStore        cache.Store
+	cacheModels       []cache.Model
+	writeStore        outbox.Store
+	filterModels      []filter.Model
+	customModels      []custom.Model
+	reports           []analytics.Report
+	digests           []digest.Digest
+	helpdesk          bool
+	purchaseApprovals bool
+}
+
+// serveConnection sets up the chat capabilities and background workers of
+// one Odoo database and returns its notification service
+func serveConnection(ctx context.Context, conn *connection.Connection, waService *whatsapp.Service, registry *binding.Registry, enabled features) *notify.Service {
+	odooClient := conn.Client
+	// Workers send from the connection's own WhatsApp number
+	ctx = conn.Context(ctx)
+
+	// Adapt calls to the connection's version of Odoo
+	detectVersion(ctx, conn.Name(), odooClient)
+
+	// Open CRM leads for numbers that aren't known partners
+	conn.OnMessage(crm.NewService(odooClient, enabled.leadRules).HandleMessage)
+
+	// Mirror conversations into Odoo chatter, and send what waOdoo says
+	// through the bridge so that it is mirrored too
+	bridge := chatter.NewService(odooClient, waService, waService)
+	if enabled.helpdesk {
+		bridge.Targets = append(bridge.Targets, chatter.Tickets)
+	}
+	conn.OnMessage(bridge.HandleMessage)
+	go bridge.Run(ctx, pollInterval())
+	sender := chatter.NewSender(waService, bridge)
+
+	// Route incoming WhatsApp messages to the Odoo capabilities
+	chatAgent := agent.New(sender)
+	chatAgent.Users = registry.Scope(conn.Name())
+
+	// Replay the writes made while Odoo was unreachable once it is back
+	writes := outbox.New(odooClient, enabled.writeStore, sender, chatAgent.Users)
+	odooClient.Queue = writes
+	go writes.Run(ctx, pollInterval())
+
+	// The commands of configured models come first, as clients chose them
+	for _, model := range enabled.customModels {
+		chatAgent.Register(custom.NewService(odooClient, sender, chatAgent.Sessions, model))
+	}
+
+	// Lookups are answered from the cache, which warns once it has missed
+	// a few syncs
+	records := cache.New(odooClient, enabled.cacheStore, enabled.cacheModels)
+	go records.Run(ctx, pollInterval())
+	chatAgent.Register(cache.NewLookup(records, sender, 3*pollInterval()))
+
+	// Questions about figures, e.g. "how many invoices", come before stock
+	// questions
+	chatAgent.Register(analytics.NewService(odooClient, sender, waService, enabled.reports))
+	chatAgent.Register(inventory.NewService(odooClient, sender))
+
+	deliveries := delivery.NewService(odooClient, sender)
+	chatAgent.Register(deliveries)
+	go deliveries.Run(ctx, pollInterval())
+
+	chatAgent.Register(timesheet.NewService(odooClient, sender, chatAgent.Sessions))
+	chatAgent.Register(project.NewService(odooClient, sender, chatAgent.Sessions))
+	chatAgent.Register(expense.NewService(odooClient, sender, waService, chatAgent.Sessions))
+	chatAgent.Register(leave.NewService(odooClient, sender, chatAgent.Sessions))
+	chatAgent.Register(company.NewService(odooClient, sender, registry))
+
+	meetings := calendar.NewService(odooClient, sender)
+	chatAgent.Register(meetings)
+	go meetings.Run(ctx, pollInterval())
+
+	if enabled.helpdesk {
+		tickets := helpdesk.NewService(odooClient, sender, waService, chatAgent.Sessions)
+		chatAgent.Register(tickets)
+		go tickets.Run(ctx, pollInterval())
+	}
+
+	if enabled.purchaseApprovals {
+		approvals := purchase.NewService(odooClient, sender)
+		chatAgent.Register(approvals)
+		go approvals.Run(ctx, pollInterval())
+	}
+
+	// Searches start with words like "show" and "list", so they come after
+	// the specific commands, e.g. "show my tasks"
+	chatAgent.Register(filter.NewService(odooClient, sender, enabled.filterModels))
+
+	// File the remaining photos and documents on the records they concern
+	attachments := attachment.NewService(odooClient, sender, waService, chatAgent.Sessions)
+	if enabled.helpdesk {
+		attachments.Targets = append(attachments.Targets, attachment.Tickets)
+	}
+	chatAgent.Register(attachments)
+
+	conn.OnMessage(chatAgent.HandleMessage)
+
+	// Send scheduled report digests
+	go digest.NewScheduler(odooClient, sender, waService, digest.For(enabled.digests, conn.Name(), enabled.defaultConnection)).Run(ctx)
+
+	notifier := notify.NewService(odooClient, sender, enabled.notifyRules)
+	if len(conn.PhoneNumberIDs) > 0 {
+		notifier.PhoneNumberID = conn.PhoneNumberIDs[0]
+	}
+	return notifier
+}
+
+// detectVersion detects the Odoo version of a connection, retrying in the
+// background while Odoo can't be reached
+func detectVersion(ctx context.Context, name string, client *odoo.Client) {
+	detect := func() bool {
+		adapter, err := client.Detect(ctx)
+		if err != nil {
+			log.Printf("Failed to detect Odoo version of %s: %v", name, err)
+			return false
+		}
+		log.Printf("Connected to Odoo %s on %s", adapter.Version, name)
+		if !adapter.Supported() {
+			log.Printf("Warning: Odoo %d on %s is not supported, waOdoo supports Odoo %d to %d", adapter.Major, name, odoo.MinVersion, odoo.MaxVersion)
+		}
+		return true
+	}
+	if detect() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if detect() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// pollInterval is how often background workers check Odoo for changes
+func pollInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("ODOO_POLL_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return 30 * time.Second
+	}
+	return interval
+}
+
 // ScalarAPIReference handles rendering the API documentation using Scalar
 func scalarAPIReference(c echo.Context) error {
 	htmlContent, err := scalar.ApiReferenceHTML(&scalar.Options{